@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/handlers"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const usage = `usage: bookings [command] [flags]
+
+  serve        run the site, the default when there is no command
+  migrate      apply or roll back database migrations, see bookings migrate -h
+  user         create a user or reset a password, see bookings user -h
+  reservation  show a reservation or send its confirmation again, see bookings reservation -h
+  seed         add demo reservations around today
+  purge        delete what has been in the trash too long
+  help         show this
+
+Every command takes the settings serve does, see bookings serve -h. Each is read from, first to last, its flag,
+the environment, .env and the JSON file in -config or CONFIG_FILE`
+
+// commands are the subcommands by name. Each is given the arguments after its name and writes what it did to out
+var commands = map[string]func(args []string, out io.Writer) error{
+	"serve":       serve,
+	"migrate":     runMigrate,
+	"user":        runUser,
+	"reservation": runReservation,
+	"seed":        runSeed,
+	"purge":       runPurge,
+}
+
+// Stdin, replaced in tests
+var stdin io.Reader = os.Stdin
+
+// loadConfig parses a command's flags, which get a flag for every setting, and loads the rest of the settings
+// from the environment, .env and the config file. The settings are applied to app
+func loadConfig(flags *flag.FlagSet, args []string, required ...string) (config.Config, error) {
+	_ = godotenv.Load()
+
+	cfg, err := config.Load(flags, args, os.Getenv, required...)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Apply(&app)
+}
+
+// openRepo loads a subcommand's settings and connects to the database the same way the server does.
+// The caller closes the returned database
+func openRepo(flags *flag.FlagSet, args []string, required ...string) (*driver.DB, *handlers.Repository, error) {
+	cfg, err := loadConfig(flags, args, append(required, "dburi")...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	setupLogs()
+	return connect(cfg.DBURI, false)
+}
+
+// newFlags returns the flag set for a subcommand, which returns its errors instead of exiting
+func newFlags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// password returns the password read from stdin if fromStdin is set, otherwise a new random one.
+// generated reports whether it was made up, so it can be shown
+func password(fromStdin bool) (string, bool, error) {
+	if !fromStdin {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) < 8 {
+		return "", false, errors.New("the password must be at least 8 characters")
+	}
+	return line, false, nil
+}
+
+// hashPassword hashes a password the way the seeded admin's is
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	return string(hash), err
+}
+
+const userUsage = `usage: bookings user create -email EMAIL [-first NAME] [-last NAME] [-access LEVEL] [-password-stdin]
+       bookings user reset -email EMAIL [-password-stdin]
+
+A random password is made up and shown unless -password-stdin reads one from stdin`
+
+// runUser creates a user or resets a user's password
+func runUser(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "reset") {
+		return errors.New(userUsage)
+	}
+	command := args[0]
+
+	flags := newFlags("user "+command, userUsage)
+	email := flags.String("email", "", "The email the user logs in with")
+	fromStdin := flags.Bool("password-stdin", false, "Read the password from stdin")
+	var first, last *string
+	var access *int
+	if command == "create" {
+		first = flags.String("first", "", "First name")
+		last = flags.String("last", "", "Last name")
+		access = flags.Int("access", 1, "Access level, which is 1 for the seeded admin")
+	}
+
+	// The flags are parsed with the settings, so -email is only known once they are loaded
+	cfg, err := loadConfig(flags, args[1:], "dburi")
+	if err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	pass, generated, err := password(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return err
+	}
+
+	setupLogs()
+	db, repo, err := connect(cfg.DBURI, false)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx := context.Background()
+
+	if command == "create" {
+		id, err := repo.DB.InsertUser(ctx, models.User{
+			FirstName:   *first,
+			LastName:    *last,
+			Email:       *email,
+			Password:    hash,
+			AccessLevel: *access,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot create %s: %w", *email, err)
+		}
+		fmt.Fprintf(out, "Created user %d %s\n", id, *email)
+	} else {
+		user, err := repo.DB.GetUserByEmail(ctx, *email)
+		if err != nil {
+			return fmt.Errorf("cannot find %s: %w", *email, err)
+		}
+
+		err = repo.DB.UpdateUserPassword(ctx, user.ID, hash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Reset the password of user %d %s\n", user.ID, user.Email)
+	}
+
+	if generated {
+		fmt.Fprintf(out, "Password: %s\n", pass)
+	}
+	return nil
+}
+
+const reservationUsage = `usage: bookings reservation show ID
+       bookings reservation resend ID
+
+resend sends the guest's confirmation mail again`
+
+// runReservation shows a reservation or sends its guest the confirmation mail again
+func runReservation(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "show" && args[0] != "resend") {
+		return errors.New(reservationUsage)
+	}
+	command := args[0]
+
+	// Sending needs to know who from, and the key to send with
+	var required []string
+	if command == "resend" {
+		required = []string{"mail-from", "sendinblue-api-key"}
+	}
+
+	flags := newFlags("reservation "+command, reservationUsage)
+	db, repo, err := openRepo(flags, args[1:], required...)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	if flags.NArg() != 1 {
+		return errors.New(reservationUsage)
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%q is not a reservation id", flags.Arg(0))
+	}
+
+	ctx := context.Background()
+
+	reservation, err := repo.Booking.GetReservation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if command == "resend" {
+		message := repo.Mail.GuestConfirmation(reservation)
+		err = sendMessage(message)
+		logMail(repo.DB, message, err)
+		if err != nil {
+			return fmt.Errorf("cannot send the confirmation to %s: %w", message.To, err)
+		}
+		fmt.Fprintf(out, "Sent the confirmation of reservation %d to %s\n", reservation.ID, message.To)
+		return nil
+	}
+
+	notes, err := repo.DB.GetNotesForReservation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	mails, err := repo.DB.GetMailLogsForReservation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return writeReservation(out, reservation, notes, mails)
+}
+
+// writeReservation writes out a reservation with its notes and the mail sent about it
+func writeReservation(out io.Writer, r models.Reservation, notes []models.ReservationNote, mails []models.MailLog) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Reservation\t%d\n", r.ID)
+	fmt.Fprintf(w, "Guest\t%s %s\n", r.FirstName, r.LastName)
+	fmt.Fprintf(w, "Email\t%s\n", r.Email)
+	fmt.Fprintf(w, "Phone\t%s\n", r.Phone)
+	fmt.Fprintf(w, "Room\t%s\n", r.Room.RoomName)
+	fmt.Fprintf(w, "Stay\t%s to %s\n", r.StartDate.Format("2006-01-02"), r.EndDate.Format("2006-01-02"))
+	fmt.Fprintf(w, "Status\t%s\n", r.Status)
+	fmt.Fprintf(w, "Booked\t%s\n", r.CreatedAt.Format("2006-01-02 15:04"))
+	if !r.DeletedAt.IsZero() {
+		fmt.Fprintf(w, "Trashed\t%s\n", r.DeletedAt.Format("2006-01-02 15:04"))
+	}
+
+	for _, note := range notes {
+		fmt.Fprintf(w, "Note\t%s %s: %s\n", note.CreatedAt.Format("2006-01-02 15:04"), note.User.Email, note.Note)
+	}
+
+	for _, mail := range mails {
+		fmt.Fprintf(w, "Mail\t%s %s %q to %s\n", mail.CreatedAt.Format("2006-01-02 15:04"), mail.Status, mail.Subject, mail.To)
+	}
+
+	return w.Flush()
+}
+
+// The demo reservations, by how many days from today they start. Rooms are the first and second room
+var demoReservations = []struct {
+	first, last string
+	room        int
+	start       int
+	nights      int
+	status      models.ReservationStatus
+}{
+	{"Ada", "Lovelace", 1, -10, 3, models.StatusCheckedOut},
+	{"Alan", "Turing", 2, -6, 2, models.StatusCheckedOut},
+	{"Grace", "Hopper", 2, -3, 1, models.StatusNoShow},
+	{"Linus", "Torvalds", 1, -1, 3, models.StatusCheckedIn},
+	{"Margaret", "Hamilton", 2, 0, 2, models.StatusConfirmed},
+	{"Dennis", "Ritchie", 1, 5, 4, models.StatusPending},
+	{"Ken", "Thompson", 2, 9, 3, models.StatusConfirmed},
+	{"Barbara", "Liskov", 1, 12, 2, models.StatusCancelled},
+}
+
+// runSeed adds the demo reservations around today, without mailing their guests or telling the webhooks.
+// Nothing is added if any of them clash with a booking already made
+func runSeed(args []string, out io.Writer) error {
+	flags := newFlags("seed", "usage: bookings seed")
+	db, repo, err := openRepo(flags, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx := context.Background()
+
+	rooms, err := repo.DB.AllRooms(ctx)
+	if err != nil {
+		return err
+	}
+	if len(rooms) < 2 {
+		return errors.New("the demo reservations need at least two rooms")
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var reservations []models.Reservation
+	for _, demo := range demoReservations {
+		start := today.AddDate(0, 0, demo.start)
+		reservations = append(reservations, models.Reservation{
+			FirstName: demo.first,
+			LastName:  demo.last,
+			Email:     strings.ToLower(demo.first) + "@example.com",
+			Phone:     "555-0100",
+			RoomID:    rooms[demo.room-1].ID,
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, demo.nights),
+			Status:    demo.status,
+			// Booked a couple of weeks before they arrive
+			CreatedAt: start.AddDate(0, 0, -14),
+		})
+	}
+
+	ids, err := repo.DB.ImportReservations(ctx, reservations)
+	if err != nil {
+		return fmt.Errorf("cannot add the demo reservations: %w", err)
+	}
+
+	fmt.Fprintf(out, "Added %d demo reservations\n", len(ids))
+	return nil
+}
+
+// runPurge deletes the reservations and rooms that have been in the trash longer than -trashdays
+func runPurge(args []string, out io.Writer) error {
+	flags := newFlags("purge", "usage: bookings purge [-trashdays DAYS]")
+	db, repo, err := openRepo(flags, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	reservations, rooms, err := purgeTrash(repo.DB)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Purged %d reservations and %d rooms from the trash\n", reservations, rooms)
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/repository/dbrepo"
+)
+
+// useMigratedDatabase points DBURI at a new SQLite database with the migrations applied, until the test ends
+func useMigratedDatabase(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bookings.db")
+	t.Setenv("DBURI", "sqlite://"+path)
+
+	if err := runMigrate(nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// authenticate reports whether email can log in with password on the database at path
+func authenticate(t *testing.T, path, email, password string) bool {
+	t.Helper()
+
+	db, err := driver.NewDatabase("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _, err = dbrepo.NewSQLiteRepo(db, &app).Authenticate(context.Background(), email, password)
+	return err == nil
+}
+
+// command runs a subcommand, returning what it wrote
+func command(t *testing.T, name string, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := commands[name](args, &out)
+	return out.String(), err
+}
+
+func TestRunUser(t *testing.T) {
+	path := useMigratedDatabase(t)
+
+	stdin = strings.NewReader("correct horse\n")
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	out, err := command(t, "user", "create", "-email", "ada@prosper.com", "-first", "Ada", "-last", "Lovelace", "-password-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Created user 2 ada@prosper.com") || strings.Contains(out, "Password") {
+		t.Errorf("unexpected output %q", out)
+	}
+	if !authenticate(t, path, "ada@prosper.com", "correct horse") {
+		t.Error("expected the new user to log in with the password from stdin")
+	}
+
+	if _, err := command(t, "user", "create", "-email", "atu@prosper.com"); err == nil {
+		t.Error("expected a second user with the admin's email to be refused")
+	}
+
+	out, err = command(t, "user", "reset", "-email", "atu@prosper.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	password := regexp.MustCompile(`Password: (\S+)`).FindStringSubmatch(out)
+	if password == nil {
+		t.Fatalf("expected the new password to be shown, but got %q", out)
+	}
+	if authenticate(t, path, "atu@prosper.com", "password") || !authenticate(t, path, "atu@prosper.com", password[1]) {
+		t.Error("expected the admin to log in with the new password only")
+	}
+
+	stdin = strings.NewReader("short\n")
+	invalid := [][]string{
+		{},
+		{"delete"},
+		{"reset"},
+		{"reset", "-email", "nobody@prosper.com"},
+		{"reset", "-email", "atu@prosper.com", "-password-stdin"},
+		{"create", "-email", "grace@prosper.com", "-unknown"},
+	}
+	for _, args := range invalid {
+		if _, err := command(t, "user", args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestRunUser_FlagsFirst(t *testing.T) {
+	// Nothing listens here, so getting as far as connecting would fail differently
+	t.Setenv("DBURI", "postgres://nobody@127.0.0.1:1/bookings?connect_timeout=1")
+
+	if _, err := command(t, "user", "create"); err == nil || err.Error() != "-email is required" {
+		t.Errorf("expected the missing email to be reported before connecting, but got %v", err)
+	}
+
+	stdin = strings.NewReader("short\n")
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	_, err := command(t, "user", "reset", "-email", "atu@prosper.com", "-password-stdin")
+	if err == nil || !strings.Contains(err.Error(), "at least 8 characters") {
+		t.Errorf("expected the short password to be reported before connecting, but got %v", err)
+	}
+}
+
+func TestRunSeedAndReservation(t *testing.T) {
+	useMigratedDatabase(t)
+
+	out, err := command(t, "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Added 8 demo reservations") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	// They would hold the same rooms on the same days again
+	if _, err := command(t, "seed"); err == nil {
+		t.Error("expected seeding twice to be refused")
+	}
+
+	out, err = command(t, "reservation", "show", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Ada Lovelace", "ada@example.com", "Generals Suit", "checked-out"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in\n%s", expected, out)
+		}
+	}
+
+	invalid := [][]string{{}, {"show"}, {"show", "one"}, {"show", "100"}, {"resend", "100"}, {"cancel", "1"}}
+	for _, args := range invalid {
+		if _, err := command(t, "reservation", args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestRunPurge(t *testing.T) {
+	useMigratedDatabase(t)
+
+	out, err := command(t, "purge", "-trashdays", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Purged 0 reservations and 0 rooms") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
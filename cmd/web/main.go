@@ -1,22 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/atuprosper/booking-project/internal/config"
 	"github.com/atuprosper/booking-project/internal/driver"
 	"github.com/atuprosper/booking-project/internal/handlers"
 	"github.com/atuprosper/booking-project/internal/helpers"
+	"github.com/atuprosper/booking-project/internal/importer"
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/atuprosper/booking-project/internal/migrate"
 	"github.com/atuprosper/booking-project/internal/models"
 	"github.com/atuprosper/booking-project/internal/render"
-	"github.com/joho/godotenv"
 )
 
 var app config.AppConfig
@@ -25,40 +30,83 @@ var infoLog *log.Logger
 var errorLog *log.Logger
 
 func main() {
+	// The server is the default, so the binary still starts it when run with only its flags
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	if command == "help" {
+		fmt.Println(usage)
+		return
+	}
+
+	runCommand, ok := commands[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", command, usage)
+		os.Exit(2)
+	}
+
+	if err := runCommand(args, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	err := godotenv.Load()
+// serve runs the site until the server stops
+func serve(args []string, out io.Writer) error {
+	// run reads the flags from os.Args, which still has the subcommand in it
+	os.Args = append([]string{os.Args[0]}, args...)
+
+	cfg, connectedDB, err := run()
 	if err != nil {
-		log.Println("Error loading .env file")
+		return err
 	}
 
-	host := os.Getenv("HOST")
-	port := os.Getenv("PORT")
+	// Close database connection when the server has shut down
+	if connectedDB != nil {
+		defer connectedDB.SQL.Close()
+	}
 
-	connectedDB, err := run()
+	listener, err := net.Listen("tcp", cfg.Host+":"+cfg.Port)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Close database connection when main function finish running and the mail server if mail has finsished sending
-	defer connectedDB.SQL.Close()
-	defer close(app.MailChannel)
+	jobs := newBackground()
+
+	// Serving the metrics, away from the public site
+	if cfg.MetricsAddr != "" {
+		metricsListener, err := net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Serving metrics at %s/metrics\n", cfg.MetricsAddr)
+		listenForMetrics(jobs, metricsListener)
+	}
 
 	// Listening for mail
-	fmt.Println("Listening for mail...")
-	listenForMail()
+	fmt.Fprintln(out, "Listening for mail...")
+	listenForMail(jobs, handlers.Repo.DB)
 
-	fmt.Printf("Server started at host %s and port %s", host, port)
+	// Purging the trash
+	listenForPurge(jobs, handlers.Repo.DB)
+
+	// Sending webhooks
+	listenForWebhooks(jobs, handlers.Repo.DB)
+
+	fmt.Fprintf(out, "Server started at host %s and port %s\n", cfg.Host, cfg.Port)
 	// Create a variable to serve the routes
 	srv := &http.Server{
-		Addr:    host + ":" + port,
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
-	log.Fatal(err)
+	return serveUntilSignal(srv, listener, handlers.Repo.Events, jobs, cfg.ShutdownTimeout)
 }
 
-func run() (*driver.DB, error) {
+// serveRequired are the settings the site can't run without, unless it is the demo
+var serveRequired = []string{"dburi", "mail-from", "admin-email"}
+
+func run() (config.Config, *driver.DB, error) {
 
 	// Things to be stored in the session
 	// gob, is a built in library used for storing sessions
@@ -68,76 +116,53 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Restriction{})
 	gob.Register(models.TodoList{})
 	gob.Register(make(map[string]int))
+	gob.Register(importer.Upload{})
 
-	err := godotenv.Load()
+	// The test binary's own flags are on the command line too
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:], serveRequired...)
 	if err != nil {
-		log.Println("Error loading .env file")
-	}
-
-	dbURI := os.Getenv("DBURI")
-
-	// Read flags
-	inProduction := flag.Bool("production", true, "App is in production")
-	useCache := flag.Bool("cache", true, "Use template cache")
-	// dbHost := flag.String("dbhost", "", "Database host")
-	// dbName := flag.String("dbname", "", "Database name")
-	// dbUser := flag.String("dbuser", "", "Database user")
-	// dbPassword := flag.String("dbpassword", "", "Database password")
-	// dbPort := flag.String("dbport", "", "Database port")
-	// dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
-
-	flag.Parse()
-
-	// if *dbName == "" || *dbUser == "" || *dbHost == "" {
-	// 	fmt.Println("Missing flag dependencies, attach the flag dependencies in your batch file")
-	// 	os.Exit(1)
-	// }
-
-	if dbURI == "" {
-		fmt.Println("Missing flag dependencies, attach the flag dependencies in your batch file")
-		os.Exit(1)
+		return cfg, nil, err
 	}
 
-	app.InProduction = *inProduction
-	app.UseCache = *useCache
-
-	mailChannel := make(chan models.MailData)
+	mailChannel := make(chan models.MailData, mailQueueSize)
 	app.MailChannel = mailChannel
+	metrics.RegisterMailQueue(func() int { return len(app.MailChannel) })
 
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+	// Buffered so queueing a webhook never waits on the sender
+	app.WebhookChannel = make(chan struct{}, 1)
 
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	setupLogs()
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = app.SessionLifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
 
-	// Connect to database
-	log.Println("Connecting to database...")
-	// connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPassword, *dbSSL)
-	connectedDB, err := driver.ConnectSQL(dbURI)
-	if err != nil {
-		log.Fatal("Cannot connect to database. Closing application")
-	}
-
-	log.Println("Connected to database")
-
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("Cannot create template cache")
-		return nil, err
+		return cfg, nil, err
 	}
 
 	app.TemplateCache = tc
 
 	// Variable to reference our app
-	repo := handlers.NewRepo(&app, connectedDB)
+	var repo *handlers.Repository
+	var connectedDB *driver.DB
+
+	if cfg.Demo {
+		log.Println("Running the demo, nothing will be saved when the server stops")
+		repo = handlers.NewMemoryRepo(&app)
+	} else {
+		connectedDB, repo, err = connect(cfg.DBURI, cfg.Migrate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		metrics.RegisterDB(connectedDB.SQL)
+	}
 
 	// Pass the repo variable back to the new handler
 	handlers.NewHandlers(repo)
@@ -148,5 +173,44 @@ func run() (*driver.DB, error) {
 	// Pass the app config to the helpers
 	helpers.NewHelpers(&app)
 
-	return connectedDB, nil
+	return cfg, connectedDB, nil
+}
+
+// setupLogs points the app's info and error logs at stdout
+func setupLogs() {
+	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	app.InfoLog = infoLog
+
+	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	app.ErrorLog = errorLog
+}
+
+// connect opens the database at dbURI, applying any pending migrations first if autoMigrate is set,
+// and returns it with the repository on it
+func connect(dbURI string, autoMigrate bool) (*driver.DB, *handlers.Repository, error) {
+	log.Println("Connecting to database...")
+	// connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPassword, *dbSSL)
+	connectedDB, err := driver.ConnectSQL(dbURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	log.Println("Connected to database")
+
+	if autoMigrate {
+		runner, err := migrate.New(connectedDB)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		done, err := runner.Up(context.Background())
+		for _, m := range done {
+			log.Printf("Applied migration %d %s", m.Version, m.Name)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot migrate the database: %w", err)
+		}
+	}
+
+	return connectedDB, handlers.NewRepo(&app, connectedDB), nil
 }
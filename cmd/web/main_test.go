@@ -1,10 +1,47 @@
 package main
 
-import "testing"
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
+	t.Setenv("DBURI", "sqlite://"+filepath.Join(t.TempDir(), "bookings.db"))
+	t.Setenv("MIGRATE", "true")
+	t.Setenv("MAIL_FROM", "desk@prosper.com")
+	t.Setenv("ADMIN_EMAIL", "atu@prosper.com")
+
+	cfg, db, err := run()
 	if err != nil {
-		t.Error("Failed run()")
+		t.Fatalf("Failed run(): %v", err)
+	}
+	defer db.SQL.Close()
+
+	if cfg.MailFrom != "desk@prosper.com" || app.TemplateCache == nil {
+		t.Errorf("expected the settings applied and the templates loaded, but got %+v", cfg)
+	}
+}
+
+func TestRun_MissingSettings(t *testing.T) {
+	for _, name := range []string{"DBURI", "MAIL_FROM", "ADMIN_EMAIL", "DEMO"} {
+		t.Setenv(name, "")
+	}
+
+	// run loads its settings onto the command line's flags, which can only be defined once
+	_, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), nil, serveRequired...)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, expected := range []string{
+		"dburi: is required, set -dburi or DBURI",
+		"mail-from: is required, set -mail-from or MAIL_FROM",
+		"admin-email: is required, set -admin-email or ADMIN_EMAIL",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %q", expected, err)
+		}
 	}
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/go-chi/chi/v5"
+)
+
+// metricsRoutes serves the Prometheus metrics. They say how busy the hotel is, so they are kept off the public site
+func metricsRoutes() http.Handler {
+	mux := chi.NewRouter()
+	mux.Method("GET", "/metrics", metrics.Handler())
+	return mux
+}
+
+// listenForMetrics serves the metrics on listener until the background jobs are stopped
+func listenForMetrics(jobs *background, listener net.Listener) {
+	srv := &http.Server{Handler: metricsRoutes()}
+
+	jobs.Go(func(stop <-chan struct{}) {
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.Serve(listener)
+		}()
+
+		select {
+		case err := <-served:
+			app.ErrorLog.Println("Metrics server stopped:", err)
+			return
+		case <-stop:
+		}
+
+		// Scrapes are quick to repeat, so one in flight is cut off rather than waited for
+		srv.Close()
+	})
+}
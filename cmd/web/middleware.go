@@ -2,11 +2,40 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/atuprosper/booking-project/internal/helpers"
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 )
 
+// Metrics counts and times requests by the route pattern they matched, so /rooms/1 and /rooms/2 are counted together
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		// Paths that match nothing are counted together, so scanners can't add a series each
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(started).Seconds())
+	})
+}
+
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 
@@ -17,6 +46,9 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// API clients don't hold a CSRF cookie, and a browser can't send a JSON body cross-site without CORS allowing it
+	csrfHandler.ExemptRegexp("^/api/")
+
 	return csrfHandler
 }
 
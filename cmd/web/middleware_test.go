@@ -3,7 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNoSurf(testPointer *testing.T) {
@@ -30,3 +35,38 @@ func TestSessionLoad(testPointer *testing.T) {
 		testPointer.Error(fmt.Sprintf("type is not http.Handler but is %T", handlerType))
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Metrics)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Post("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusSeeOther)
+		})
+	})
+
+	rooms := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/rooms/{id}", "200"))
+	admin := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("POST", "/admin/rooms/{id}", "303"))
+	unmatched := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404"))
+	timed := metrics.SampleCount(metrics.HTTPDuration, "GET", "/rooms/{id}")
+
+	for _, request := range [][2]string{
+		{"GET", "/rooms/1"}, {"GET", "/rooms/2"}, {"POST", "/admin/rooms/3"}, {"GET", "/wp-login.php"},
+	} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request[0], request[1], nil))
+	}
+
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/rooms/{id}", "200")) - rooms; got != 2 {
+		t.Errorf("expected both rooms to be counted under their route, but got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("POST", "/admin/rooms/{id}", "303")) - admin; got != 1 {
+		t.Errorf("expected the subrouter's full pattern and the status written, but got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")) - unmatched; got != 1 {
+		t.Errorf("expected the unknown path to be counted as unmatched, but got %v", got)
+	}
+	if got := metrics.SampleCount(metrics.HTTPDuration, "GET", "/rooms/{id}") - timed; got != 2 {
+		t.Errorf("expected both rooms to be timed, but got %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/migrate"
+)
+
+const migrateUsage = `usage: bookings migrate [flags] [up | down | status | to VERSION]
+
+  up          apply every pending migration (the default)
+  down        roll back the newest applied migration
+  status      list the migrations and when each was applied or adopted
+  to VERSION  apply or roll back migrations until VERSION is the newest applied, 0 rolls back everything`
+
+// runMigrate runs the migrate subcommand on the database in DBURI, writing what it did to out
+func runMigrate(args []string, out io.Writer) error {
+	flags := newFlags("migrate", migrateUsage)
+	cfg, err := loadConfig(flags, args, "dburi")
+	if err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	var target int64
+	switch {
+	case command == "to" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a version\n\n%s", args[1], migrateUsage)
+		}
+		target = version
+	case (command == "up" || command == "down" || command == "status") && len(args) <= 1:
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	db, err := driver.ConnectSQL(cfg.DBURI)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	runner, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return writeMigrationStatus(out, statuses)
+	case "down":
+		done, err := runner.Down(ctx)
+		writeMigrated(out, done, -1)
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "Nothing to roll back")
+		}
+		return err
+	case "up":
+		target = runner.Latest()
+	}
+
+	done, err := runner.To(ctx, target)
+	writeMigrated(out, done, target)
+	if err == nil && len(done) == 0 {
+		fmt.Fprintln(out, "Nothing to migrate")
+	}
+	return err
+}
+
+// writeMigrated writes out each migration done on the way to target. Those after it were rolled back, as are all of them for -1
+func writeMigrated(out io.Writer, done []migrate.Migration, target int64) {
+	for _, m := range done {
+		action := "Applied"
+		if target < 0 || m.Version > target {
+			action = "Rolled back"
+		}
+		fmt.Fprintf(out, "%s %d %s\n", action, m.Version, m.Name)
+	}
+}
+
+// writeMigrationStatus writes a table of the migrations and when each was applied, or adopted from soda
+func writeMigrationStatus(out io.Writer, statuses []migrate.Status) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+
+	for _, s := range statuses {
+		applied := "pending"
+		if !s.Pending() {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if s.Adopted {
+			applied += " (adopted)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Each step runs against the database the steps before it migrated
+var migrateSteps = []struct {
+	args     []string
+	expected []string
+}{
+	{[]string{"status"}, []string{"create_tables       pending", "update_soda_schema  pending"}},
+	{nil, []string{"Applied 20261019170000 create_tables", "Applied 20261019170100 update_soda_schema"}},
+	{[]string{"up"}, []string{"Nothing to migrate"}},
+	{[]string{"down"}, []string{"Rolled back 20261019170100 update_soda_schema"}},
+	{[]string{"to", "0"}, []string{"Rolled back 20261019170000 create_tables"}},
+	{[]string{"down"}, []string{"Nothing to roll back"}},
+	{[]string{"to", "20261019170100"}, []string{"Applied 20261019170000 create_tables", "Applied 20261019170100 update_soda_schema"}},
+}
+
+func TestRunMigrate(t *testing.T) {
+	t.Setenv("DBURI", "sqlite://"+filepath.Join(t.TempDir(), "bookings.db"))
+
+	for _, e := range migrateSteps {
+		var out bytes.Buffer
+		err := runMigrate(e.args, &out)
+		if err != nil {
+			t.Fatalf("%v: %s", e.args, err)
+		}
+
+		for _, line := range e.expected {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("%v: expected %q in\n%s", e.args, line, out.String())
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"sideways"}, {"to"}, {"to", "latest"}, {"up", "now"}} {
+		if err := runMigrate(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	if err := runMigrate([]string{"to", "1"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error migrating to a version that doesn't exist")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/repository"
+)
+
+// How often the trash is checked for records past the retention window
+const purgeInterval = time.Hour
+
+func listenForPurge(jobs *background, repo repository.DatabaseRepo) {
+	// Go routine function that runs in the background
+	jobs.Go(func(stop <-chan struct{}) {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			reservations, rooms, err := purgeTrash(repo)
+			if err != nil {
+				app.ErrorLog.Println("Cannot purge the trash:", err)
+			}
+			if reservations > 0 || rooms > 0 {
+				app.InfoLog.Printf("Purged %d reservations and %d rooms from the trash\n", reservations, rooms)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+// purgeTrash permanently deletes reservations and rooms that have been in the trash longer than the retention window,
+// returning how many of each went. Rooms are still purged if reservations can't be
+func purgeTrash(repo repository.DatabaseRepo) (reservations, rooms int, err error) {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-app.TrashRetention)
+
+	reservations, reservationsErr := repo.PurgeDeletedReservations(ctx, cutoff)
+	if reservationsErr != nil {
+		reservationsErr = fmt.Errorf("cannot purge deleted reservations: %w", reservationsErr)
+	}
+
+	rooms, roomsErr := repo.PurgeDeletedRooms(ctx, cutoff)
+	if roomsErr != nil {
+		roomsErr = fmt.Errorf("cannot purge deleted rooms: %w", roomsErr)
+	}
+
+	return reservations, rooms, errors.Join(reservationsErr, roomsErr)
+}
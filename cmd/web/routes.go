@@ -5,6 +5,7 @@ import (
 
 	"github.com/atuprosper/booking-project/internal/config"
 	"github.com/atuprosper/booking-project/internal/handlers"
+	"github.com/atuprosper/booking-project/internal/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -13,58 +14,120 @@ func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	// Add all our middlewares here
+	mux.Use(Metrics)
 	mux.Use(middleware.Recoverer)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/rooms/{id}", handlers.Repo.SingleRoom)
-
-	mux.Get("/reservation", handlers.Repo.Reservation)
-	mux.Post("/reservation", handlers.Repo.PostReservation)
-	mux.Post("/reservation-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	mux.Get("/make-reservation", handlers.Repo.MakeReservation)
-	mux.Post("/make-reservation", handlers.Repo.PostMakeReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-
-	mux.Get("/user/login", handlers.Repo.Login)
-	mux.Post("/user/login", handlers.Repo.PostLogin)
-	mux.Get("/user/logout", handlers.Repo.Logout)
-
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
-
-	mux.Route("/admin", func(mux chi.Router) {
-		// Use the Auth middleware
-		mux.Use(Auth)
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
-
-		mux.Get("/new-reservations", handlers.Repo.AdminNewReservations)
-		mux.Get("/all-reservations", handlers.Repo.AdminAllReservations)
-		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
-		mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
-
-		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminSingleReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.PostAdminSingleReservation)
-
-		mux.Get("/rooms", handlers.Repo.AdminAllRooms)
-		mux.Get("/rooms/{id}", handlers.Repo.AdminSingleRoom)
-		mux.Post("/rooms/{id}", handlers.Repo.PostAdminSingleRoom)
-		mux.Get("/rooms/new-room", handlers.Repo.AdminNewRoom)
-		mux.Post("/rooms/new-room", handlers.Repo.PostAdminNewRoom)
-		mux.Get("/delete-room/{id}", handlers.Repo.AdminDeleteRoom)
-
-		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
-
-		mux.Get("/todo-list", handlers.Repo.AdminTodoList)
-		mux.Post("/todo-list", handlers.Repo.PostAdminTodoList)
-		mux.Get("/delete-todo/{id}", handlers.Repo.AdminDeleteTodo)
+
+	// Probed by the load balancer, so they get no session or CSRF cookie
+	mux.Get("/healthz", handlers.Repo.Healthz)
+	mux.Get("/readyz", handlers.Repo.Readyz)
+	mux.Get("/version", handlers.Repo.Version)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(NoSurf)
+		mux.Use(SessionLoad)
+
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/contact", handlers.Repo.Contact)
+		mux.Get("/rooms/{id}", handlers.Repo.SingleRoom)
+
+		mux.Get("/reservation", handlers.Repo.Reservation)
+		mux.Post("/reservation", handlers.Repo.PostReservation)
+		mux.Post("/reservation-json", handlers.Repo.AvailabilityJSON)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+
+		mux.Get("/make-reservation", handlers.Repo.MakeReservation)
+		mux.Post("/make-reservation", handlers.Repo.PostMakeReservation)
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+
+		mux.Get("/user/login", handlers.Repo.Login)
+		mux.Post("/user/login", handlers.Repo.PostLogin)
+		mux.Post("/user/logout", handlers.Repo.Logout)
+
+		mux.Route("/api/v1", func(mux chi.Router) {
+			mux.NotFound(handlers.Repo.APINotFound)
+			mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+			mux.Get("/openapi.json", handlers.Repo.APIOpenAPI)
+
+			readOnly := mux.With(handlers.Repo.APIAuth(models.ScopeReadOnly))
+			readOnly.Get("/rooms", handlers.Repo.APIListRooms)
+			readOnly.Get("/rooms/{id}", handlers.Repo.APIGetRoom)
+			readOnly.Get("/availability", handlers.Repo.APIAvailability)
+			readOnly.Get("/reservations/{id}", handlers.Repo.APIGetReservation)
+
+			booking := mux.With(handlers.Repo.APIAuth(models.ScopeBooking))
+			booking.Post("/reservations", handlers.Repo.APICreateReservation)
+			booking.Post("/reservations/{id}/cancel", handlers.Repo.APICancelReservation)
+		})
+
+		fileServer := http.FileServer(http.Dir("./static/"))
+		mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+
+		mux.Route("/admin", func(mux chi.Router) {
+			// Use the Auth middleware
+			mux.Use(Auth)
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+
+			mux.Get("/new-reservations", handlers.Repo.AdminNewReservations)
+			mux.Get("/all-reservations", handlers.Repo.AdminAllReservations)
+			mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
+			mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
+
+			mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminSingleReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.PostAdminSingleReservation)
+			mux.Post("/reservations/{src}/{id}/notes", handlers.Repo.PostAdminReservationNote)
+			mux.Post("/reservations/{src}/{id}/message", handlers.Repo.PostAdminReservationMessage)
+
+			mux.Get("/rooms", handlers.Repo.AdminAllRooms)
+			mux.Get("/rooms/{id}", handlers.Repo.AdminSingleRoom)
+			mux.Post("/rooms/{id}", handlers.Repo.PostAdminSingleRoom)
+			mux.Get("/rooms/new-room", handlers.Repo.AdminNewRoom)
+			mux.Post("/rooms/new-room", handlers.Repo.PostAdminNewRoom)
+			mux.Post("/delete-room/{id}", handlers.Repo.AdminDeleteRoom)
+
+			mux.Post("/reservations/{src}/{id}/status", handlers.Repo.AdminUpdateReservationStatus)
+			mux.Post("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+			mux.Post("/reservations/bulk", handlers.Repo.AdminBulkReservations)
+
+			mux.Get("/todo-list", handlers.Repo.AdminTodoList)
+			mux.Post("/todo-list", handlers.Repo.PostAdminTodoList)
+			mux.Post("/delete-todo/{id}", handlers.Repo.AdminDeleteTodo)
+
+			mux.Get("/audit", handlers.Repo.AdminAuditLog)
+
+			mux.Get("/reports", handlers.Repo.AdminReports)
+			mux.Get("/reports/{report}/{format}", handlers.Repo.AdminDownloadReport)
+
+			mux.Get("/api-keys", handlers.Repo.AdminAPIKeys)
+			mux.Post("/api-keys", handlers.Repo.PostAdminAPIKey)
+			mux.Post("/api-keys/{id}/revoke", handlers.Repo.AdminRevokeAPIKey)
+
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+			mux.Post("/webhooks", handlers.Repo.PostAdminWebhook)
+			mux.Get("/webhooks/{id}", handlers.Repo.AdminWebhook)
+			mux.Post("/webhooks/{id}/active", handlers.Repo.AdminToggleWebhook)
+			mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminDeleteWebhook)
+			mux.Post("/webhooks/{id}/deliveries/{delivery}/retry", handlers.Repo.AdminRetryWebhookDelivery)
+
+			mux.Get("/import", handlers.Repo.AdminImport)
+			mux.Post("/import/upload", handlers.Repo.PostAdminImportUpload)
+			mux.Post("/import/mapping", handlers.Repo.PostAdminImportMapping)
+			mux.Post("/import/commit", handlers.Repo.PostAdminImportCommit)
+			mux.Post("/import/cancel", handlers.Repo.PostAdminImportCancel)
+
+			mux.Get("/today", handlers.Repo.AdminFrontDesk)
+			mux.Get("/today/no-shows", handlers.Repo.AdminNoShowReport)
+			mux.Post("/today/{id}/check-in", handlers.Repo.AdminCheckIn)
+			mux.Post("/today/{id}/check-out", handlers.Repo.AdminCheckOut)
+			mux.Post("/today/{id}/no-show", handlers.Repo.AdminMarkNoShow)
+
+			mux.Get("/trash/reservations", handlers.Repo.AdminTrashReservations)
+			mux.Post("/trash/reservations/{id}/restore", handlers.Repo.AdminRestoreReservation)
+			mux.Get("/trash/rooms", handlers.Repo.AdminTrashRooms)
+			mux.Post("/trash/rooms/{id}/restore", handlers.Repo.AdminRestoreRoom)
+		})
 	})
 
 	return mux
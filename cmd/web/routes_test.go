@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexedwards/scs/v2"
 	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/handlers"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -20,3 +29,71 @@ func TestRoutes(testPointer *testing.T) {
 		testPointer.Error(fmt.Sprintf("type is not *chi.Mux, but is %T", handlerType))
 	}
 }
+
+func TestRoutes_Probes(t *testing.T) {
+	setupLogs()
+	session = scs.New()
+	app.Session = session
+	handlers.NewHandlers(handlers.NewMemoryRepo(&app))
+	t.Cleanup(func() { handlers.NewHandlers(nil) })
+
+	mux := routes(&app)
+
+	for _, url := range []string{"/healthz", "/readyz", "/version"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+
+		if rr.Code == http.StatusNotFound || rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected JSON, but got %d %q", url, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+			t.Errorf("%s: expected no session or CSRF cookie, but got %v", url, cookies)
+		}
+	}
+
+	// The metrics have their own listener, so the public site doesn't give them away
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rr.Body.String(), "bookings_http_requests_total") {
+		t.Error("expected the site not to serve the metrics")
+	}
+
+	// The site still checks the CSRF token
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/user/login", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a post without a CSRF token to be refused, but got %d", rr.Code)
+	}
+}
+
+func TestListenForMetrics(t *testing.T) {
+	setupLogs()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := newBackground()
+	listenForMetrics(jobs, listener)
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "go_goroutines") {
+		t.Errorf("expected the metrics, but got %d\n%s", resp.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := jobs.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + listener.Addr().String() + "/metrics"); err == nil {
+		t.Error("expected the metrics server to stop with the background jobs")
+	}
+}
@@ -7,28 +7,66 @@ import (
 	"os"
 	"strings"
 
+	"github.com/atuprosper/booking-project/internal/metrics"
 	"github.com/atuprosper/booking-project/internal/models"
-	"github.com/joho/godotenv"
+	"github.com/atuprosper/booking-project/internal/repository"
 	sendinblue "github.com/sendinblue/APIv3-go-library/v2/lib"
 )
 
-func listenForMail() {
+// Sends a mail, replaced in tests
+var sendMail = sendMessage
+
+// How many mails can wait to be sent before queueing one waits for the worker
+const mailQueueSize = 100
+
+// listenForMail sends the mail queued on the mail channel until it is closed, so what is queued before
+// shutting down is still sent
+func listenForMail(jobs *background, repo repository.DatabaseRepo) {
 	// Go routine function that runs in the background
-	go func() {
-		for {
-			message := <-app.MailChannel
-			sendMessage(message)
+	jobs.Go(func(stop <-chan struct{}) {
+		app.MailWorker.Store(true)
+		defer app.MailWorker.Store(false)
+
+		for message := range app.MailChannel {
+			err := sendMail(message)
+			if err != nil {
+				log.Println(err)
+				metrics.MailFailures.Inc()
+			} else {
+				metrics.MailSent.Inc()
+			}
+			logMail(repo, message, err)
 		}
-	}()
+	})
 }
 
-func sendMessage(m models.MailData) {
-	err := godotenv.Load()
+// logMail records a mail about a reservation in its communication log, with the error if it failed to send
+func logMail(repo repository.DatabaseRepo, m models.MailData, sendErr error) {
+	if m.ReservationID == 0 {
+		return
+	}
+
+	entry := models.MailLog{
+		ReservationID: m.ReservationID,
+		To:            m.To,
+		From:          m.From,
+		Subject:       m.Subject,
+		Content:       m.Content,
+		Status:        models.MailSent,
+	}
+	if sendErr != nil {
+		entry.Status = models.MailFailed
+		entry.Error = sendErr.Error()
+	}
+
+	err := repo.InsertMailLog(context.Background(), entry)
 	if err != nil {
-		log.Println("Error loading .env file")
+		app.ErrorLog.Println("Cannot log mail for reservation", m.ReservationID, err)
 	}
+}
 
-	SENDINBLUE_API_KEY := os.Getenv("SENDINBLUE_API_KEY")
+func sendMessage(m models.MailData) error {
+	SENDINBLUE_API_KEY := app.SendinblueAPIKey
 
 	var ctx context.Context
 	cfg := sendinblue.NewConfiguration()
@@ -38,10 +76,9 @@ func sendMessage(m models.MailData) {
 	cfg.AddDefaultHeader("partner-key", SENDINBLUE_API_KEY)
 
 	sib := sendinblue.NewAPIClient(cfg)
-	_, _, err = sib.AccountApi.GetAccount(ctx)
+	_, _, err := sib.AccountApi.GetAccount(ctx)
 	if err != nil {
-		fmt.Println("Error when calling AccountApi->get_account: ", err.Error())
-		return
+		return fmt.Errorf("error when calling AccountApi->get_account: %w", err)
 	}
 
 	var emailContent string
@@ -67,7 +104,7 @@ func sendMessage(m models.MailData) {
 	// Create an email message
 	message := sendinblue.SendSmtpEmail{
 		Sender: &sendinblue.SendSmtpEmailSender{
-			Name:  "Hotel Bookings",
+			Name:  app.HotelName,
 			Email: m.From,
 		},
 		To: []sendinblue.SendSmtpEmailTo{
@@ -83,11 +120,11 @@ func sendMessage(m models.MailData) {
 	// Send the email using the Sendinblue API
 	_, _, err = sib.TransactionalEmailsApi.SendTransacEmail(ctx, message)
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
 
 	// Print a message indicating that the email was sent successfully
 	fmt.Println("Email sent successfully!")
 
+	return nil
 }
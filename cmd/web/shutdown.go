@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/events"
+)
+
+// background keeps track of the jobs running beside the server, so shutting down can wait for them
+type background struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newBackground() *background {
+	return &background{stop: make(chan struct{})}
+}
+
+// Go runs job in a goroutine. The job should return soon after stop is closed
+func (b *background) Go(job func(stop <-chan struct{})) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		job(b.stop)
+	}()
+}
+
+// Wait tells the jobs to stop and waits for them to return, until ctx is done
+func (b *background) Wait(ctx context.Context) error {
+	close(b.stop)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs were still running: %w", ctx.Err())
+	}
+}
+
+// serveUntilSignal serves srv on listener until the process gets SIGINT or SIGTERM, then shuts down, giving the
+// requests in flight, the events and mail they caused and the background jobs up to timeout to finish
+func serveUntilSignal(srv *http.Server, listener net.Listener, bus *events.Bus, jobs *background, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(listener)
+	}()
+	app.Ready.Store(true)
+
+	select {
+	case err := <-served:
+		app.Ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process straight away
+	stop()
+	app.InfoLog.Println("Shutting down...")
+
+	return shutdown(srv, bus, jobs, timeout)
+}
+
+// shutdown stops the server taking requests and waits up to timeout for those in flight, then for the subscribers
+// on bus to handle the events they published, the mail worker to send what was queued and the other background
+// jobs to stop
+func shutdown(srv *http.Server, bus *events.Bus, jobs *background, timeout time.Duration) error {
+	// Load balancers stop sending requests before the server stops accepting them
+	app.Ready.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		// The requests still running may yet queue mail, so the channel can't be closed under them
+		return errors.Join(fmt.Errorf("requests were still running after %s: %w", timeout, err), srv.Close())
+	}
+
+	// Mail is queued from the requests' events, so the last of it is queued once the bus is done with them
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		return fmt.Errorf("events were still being handled after %s: %w", timeout, ctx.Err())
+	}
+
+	// Nothing else queues mail, so the worker sends what is left and returns
+	close(app.MailChannel)
+
+	err = jobs.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.InfoLog.Println("Shut down")
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/repository/dbrepo"
+)
+
+func TestServeUntilSignal(t *testing.T) {
+	setupLogs()
+	app.MailChannel = make(chan models.MailData)
+
+	// Sending is slow, so the mail is still going out when the server stops
+	var mu sync.Mutex
+	var sent []string
+	sendMail = func(m models.MailData) error {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, m.To)
+		return nil
+	}
+	t.Cleanup(func() { sendMail = sendMessage })
+
+	// Like the confirmation mail, queued by an async subscriber after the request has published its event
+	bus := events.NewBus(app.ErrorLog)
+	bus.Subscribe("mail", events.Async, func(ctx context.Context, event events.Event) error {
+		app.MailChannel <- models.MailData{To: event.(events.ReservationCreated).Reservation.Email}
+		return nil
+	})
+
+	jobs := newBackground()
+	listenForMail(jobs, dbrepo.NewMemoryRepo(&app))
+
+	stopped := false
+	jobs.Go(func(stop <-chan struct{}) {
+		<-stop
+		stopped = true
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+
+			_ = bus.Publish(r.Context(), events.ReservationCreated{Reservation: models.Reservation{Email: "john@smith.com"}})
+			_, _ = io.WriteString(w, "booked")
+		}),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntilSignal(srv, listener, bus, jobs, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responded := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responded <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responded <- result{string(body), err}
+	}()
+
+	<-started
+	if !app.Ready.Load() {
+		t.Error("expected the server to be ready while serving")
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server stops being ready before it waits for the request
+	deadline := time.Now().Add(5 * time.Second)
+	for app.Ready.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if app.Ready.Load() {
+		t.Error("expected the server to stop being ready once told to stop")
+	}
+
+	select {
+	case err := <-served:
+		t.Fatalf("expected the server to wait for the request in flight, but it returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	r := <-responded
+	if r.err != nil || r.body != "booked" {
+		t.Errorf("expected the request in flight to finish, but got %q, %v", r.body, r.err)
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("expected a clean shutdown, but got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0] != "john@smith.com" {
+		t.Errorf("expected the mail the request queued to be sent before shutting down, but sent %v", sent)
+	}
+	if !stopped {
+		t.Error("expected the background jobs to be stopped")
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("expected the server to stop taking requests")
+	}
+}
+
+func TestShutdown_Timeout(t *testing.T) {
+	setupLogs()
+	app.MailChannel = make(chan models.MailData)
+
+	// The job never stops, so shutting down gives up on it
+	jobs := newBackground()
+	block := make(chan struct{})
+	jobs.Go(func(stop <-chan struct{}) {
+		<-block
+	})
+	t.Cleanup(func() { close(block) })
+
+	err := shutdown(&http.Server{}, events.NewBus(app.ErrorLog), jobs, 20*time.Millisecond)
+	if err == nil {
+		t.Error("expected an error when the background jobs don't stop in time")
+	}
+}
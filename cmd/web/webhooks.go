@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/repository"
+	"github.com/atuprosper/booking-project/internal/webhooks"
+)
+
+// How often the queue is checked for retries that have come due
+const webhookInterval = 30 * time.Second
+
+func listenForWebhooks(jobs *background, repo repository.DatabaseRepo) {
+	sender := webhooks.NewSender(repo)
+
+	// Go routine function that runs in the background
+	jobs.Go(func(stop <-chan struct{}) {
+		ticker := time.NewTicker(webhookInterval)
+		defer ticker.Stop()
+
+		for {
+			sendWebhooks(sender)
+
+			select {
+			case <-app.WebhookChannel:
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+// sendWebhooks sends every delivery that is due
+func sendWebhooks(sender *webhooks.Sender) {
+	delivered, err := sender.SendDue(context.Background())
+	if err != nil {
+		app.ErrorLog.Println("Cannot send webhooks:", err)
+	}
+
+	if delivered > 0 {
+		app.InfoLog.Printf("Delivered %d webhooks\n", delivered)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Version is the version of the API served under /api/v1
+const Version = "1.0.0"
+
+// DateLayout is the format of every date the API reads and writes
+const DateLayout = "2006-01-02"
+
+// Room is a room as the API shows it
+type Room struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Price       string `json:"price"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+}
+
+// Reservation is a reservation as the API shows it
+type Reservation struct {
+	ID        int                      `json:"id"`
+	FirstName string                   `json:"first_name"`
+	LastName  string                   `json:"last_name"`
+	Email     string                   `json:"email"`
+	Phone     string                   `json:"phone"`
+	RoomID    int                      `json:"room_id"`
+	StartDate string                   `json:"start_date" format:"date"`
+	EndDate   string                   `json:"end_date" format:"date"`
+	Status    models.ReservationStatus `json:"status"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+// NewReservation is the body of a request to make a reservation
+type NewReservation struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+}
+
+// Availability is the rooms free for a whole stay
+type Availability struct {
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+	Rooms     []Room `json:"rooms"`
+}
+
+// The envelopes every successful response is wrapped in
+type (
+	RoomList struct {
+		Data []Room `json:"data"`
+	}
+	RoomResponse struct {
+		Data Room `json:"data"`
+	}
+	ReservationResponse struct {
+		Data Reservation `json:"data"`
+	}
+	AvailabilityResponse struct {
+		Data Availability `json:"data"`
+	}
+)
+
+// Error codes, so clients can tell errors apart without parsing the message
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+	CodeValidation       = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the envelope every error is sent in
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Error describes what went wrong with a request
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The problems with each invalid field of the request, when the code is validation_failed
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// FromRoom returns the API view of room
+func FromRoom(room models.Room) Room {
+	return Room{
+		ID:          room.ID,
+		Name:        room.RoomName,
+		Price:       room.Price,
+		Description: room.Description,
+		ImageURL:    room.ImageSource,
+	}
+}
+
+// FromRooms returns the API view of rooms, an empty list rather than null when there are none
+func FromRooms(rooms []models.Room) []Room {
+	list := []Room{}
+	for _, room := range rooms {
+		list = append(list, FromRoom(room))
+	}
+	return list
+}
+
+// FromReservation returns the API view of reservation
+func FromReservation(reservation models.Reservation) Reservation {
+	return Reservation{
+		ID:        reservation.ID,
+		FirstName: reservation.FirstName,
+		LastName:  reservation.LastName,
+		Email:     reservation.Email,
+		Phone:     reservation.Phone,
+		RoomID:    reservation.RoomID,
+		StartDate: reservation.StartDate.Format(DateLayout),
+		EndDate:   reservation.EndDate.Format(DateLayout),
+		Status:    reservation.Status,
+		CreatedAt: reservation.CreatedAt,
+	}
+}
+
+// Values returns the request as form values, so it is checked by the same forms rules as the booking form
+func (n NewReservation) Values() url.Values {
+	values := url.Values{}
+	values.Set("first_name", n.FirstName)
+	values.Set("last_name", n.LastName)
+	values.Set("email", n.Email)
+	values.Set("phone", n.Phone)
+	values.Set("start_date", n.StartDate)
+	values.Set("end_date", n.EndDate)
+	if n.RoomID > 0 {
+		values.Set("room_id", strconv.Itoa(n.RoomID))
+	}
+	return values
+}
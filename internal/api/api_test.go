@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+func TestNewReservationValues(t *testing.T) {
+	values := NewReservation{FirstName: "John", RoomID: 2, StartDate: "2040-01-01"}.Values()
+
+	if values.Get("first_name") != "John" || values.Get("room_id") != "2" || values.Get("start_date") != "2040-01-01" {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	values = NewReservation{}.Values()
+	if values.Get("room_id") != "" {
+		t.Error("expected a missing room to be left empty for the required rule")
+	}
+}
+
+func TestFromReservation(t *testing.T) {
+	reservation := FromReservation(models.Reservation{
+		ID:        7,
+		StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+		Status:    models.StatusConfirmed,
+	})
+
+	if reservation.StartDate != "2040-01-01" || reservation.EndDate != "2040-01-03" || reservation.Status != "confirmed" {
+		t.Errorf("unexpected reservation %+v", reservation)
+	}
+}
+
+func TestFromRoomsEmpty(t *testing.T) {
+	out, _ := json.Marshal(RoomList{Data: FromRooms(nil)})
+	if string(out) != `{"data":[]}` {
+		t.Errorf("expected an empty list, but got %s", out)
+	}
+}
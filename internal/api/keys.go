@@ -0,0 +1,58 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Every key looks like bk_<prefix>_<secret>. The prefix identifies the key, the secret proves it
+const (
+	keyStart     = "bk_"
+	PrefixLength = 8
+	secretLength = 32
+)
+
+// ErrMalformedKey is returned for a string that can't be an API key
+var ErrMalformedKey = errors.New("malformed API key")
+
+// NewKey generates a key, returning it with the prefix it is looked up by
+func NewKey() (key, prefix string, err error) {
+	random := make([]byte, PrefixLength/2+secretLength/2)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", "", err
+	}
+
+	encoded := hex.EncodeToString(random)
+	prefix = encoded[:PrefixLength]
+
+	return keyStart + prefix + "_" + encoded[PrefixLength:], prefix, nil
+}
+
+// KeyPrefix returns the prefix of key, or ErrMalformedKey if key isn't shaped like an API key
+func KeyPrefix(key string) (string, error) {
+	if !strings.HasPrefix(key, keyStart) {
+		return "", ErrMalformedKey
+	}
+
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(key, keyStart), "_")
+	if !found || len(prefix) != PrefixLength || secret == "" {
+		return "", ErrMalformedKey
+	}
+	return prefix, nil
+}
+
+// HashKey returns the hash a key is stored as. Keys are long and random, so a fast hash is enough
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckKey reports whether key is the one stored as hash, taking the same time whether or not it is
+func CheckKey(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashKey(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, "bk_"+prefix+"_") {
+		t.Errorf("expected %s to start with its prefix %s", key, prefix)
+	}
+
+	found, err := KeyPrefix(key)
+	if err != nil || found != prefix {
+		t.Errorf("expected prefix %s, but got %s: %v", prefix, found, err)
+	}
+
+	if !CheckKey(key, HashKey(key)) {
+		t.Error("expected a key to match its own hash")
+	}
+
+	other, _, _ := NewKey()
+	if other == key || CheckKey(other, HashKey(key)) {
+		t.Error("expected each key to be different")
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	for _, key := range []string{"", "secret", "bk_", "bk_short_secret", "bk_abcd1234", "bk_abcd1234_", "xx_abcd1234_secret"} {
+		_, err := KeyPrefix(key)
+		if err != ErrMalformedKey {
+			t.Errorf("expected %q to be malformed, but got %v", key, err)
+		}
+	}
+}
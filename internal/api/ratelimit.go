@@ -0,0 +1,50 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter counts the requests made with each API key in fixed one minute windows
+type RateLimiter struct {
+	mu      sync.Mutex
+	windows map[int]*window
+	// Replaced in tests to control the clock
+	now func() time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter returns a limiter with no requests counted
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		windows: make(map[int]*window),
+		now:     time.Now,
+	}
+}
+
+// Allow counts a request made with key id and reports whether it is within limit requests a minute,
+// along with how many requests are left and when the count starts again
+func (l *RateLimiter) Allow(id, limit int) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	w, ok := l.windows[id]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &window{start: now}
+		l.windows[id] = w
+	}
+
+	reset := w.start.Add(time.Minute)
+	if w.count >= limit {
+		return false, 0, reset
+	}
+
+	w.count++
+	return true, limit - w.count, reset
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, remaining, reset := limiter.Allow(1, 3)
+		if !ok || remaining != 2-i {
+			t.Errorf("request %d: expected to be allowed with %d left, but got %v with %d", i+1, 2-i, ok, remaining)
+		}
+		if !reset.Equal(now.Add(time.Minute)) {
+			t.Errorf("request %d: expected the window to reset a minute from the first request, but got %s", i+1, reset)
+		}
+	}
+
+	if ok, _, _ := limiter.Allow(1, 3); ok {
+		t.Error("expected the fourth request in a minute to be refused")
+	}
+
+	// Each key is counted on its own
+	if ok, _, _ := limiter.Allow(2, 3); !ok {
+		t.Error("expected another key to be allowed")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, remaining, _ := limiter.Allow(1, 3); !ok || remaining != 2 {
+		t.Errorf("expected the count to start again after a minute, but got %v with %d left", ok, remaining)
+	}
+}
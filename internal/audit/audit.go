@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate       = "create"
+	ActionUpdate       = "update"
+	ActionDelete       = "delete"
+	ActionRestore      = "restore"
+	ActionStatusChange = "status_change"
+	ActionBlockAdded   = "block_added"
+	ActionBlockRemoved = "block_removed"
+	ActionRevoke       = "revoke"
+	ActionMessage      = "message"
+)
+
+// Entities recorded in the audit log
+const (
+	EntityReservation = "reservation"
+	EntityRoom        = "room"
+	EntityTodo        = "todo"
+	EntityAPIKey      = "api_key"
+	EntityWebhook     = "webhook"
+)
+
+// Fields that change on every write and would only add noise to the diff
+var ignoredFields = map[string]bool{
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// Diff compares two values of the same struct type and returns the fields that changed.
+// Either value may be nil, which is how a create (before is nil) or a delete (after is nil) is recorded
+func Diff(before, after interface{}) []models.AuditChange {
+	var changes []models.AuditChange
+
+	beforeValue := structValue(before)
+	afterValue := structValue(after)
+
+	var structType reflect.Type
+	switch {
+	case beforeValue.IsValid() && afterValue.IsValid():
+		if beforeValue.Type() != afterValue.Type() {
+			return changes
+		}
+		structType = beforeValue.Type()
+	case beforeValue.IsValid():
+		structType = beforeValue.Type()
+	case afterValue.IsValid():
+		structType = afterValue.Type()
+	default:
+		return changes
+	}
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() || ignoredFields[field.Name] {
+			continue
+		}
+
+		// Nested models (e.g. Reservation.Room) are audited on their own
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			continue
+		}
+
+		from := formatField(beforeValue, i)
+		to := formatField(afterValue, i)
+		if from == to {
+			continue
+		}
+
+		changes = append(changes, models.AuditChange{
+			Field: field.Name,
+			From:  from,
+			To:    to,
+		})
+	}
+
+	return changes
+}
+
+// structValue dereferences pointers and returns the zero Value when there is nothing to compare
+func structValue(v interface{}) reflect.Value {
+	if v == nil {
+		return reflect.Value{}
+	}
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	return value
+}
+
+// formatField returns the string form of the i'th field, or an empty string when the value is missing
+func formatField(value reflect.Value, i int) string {
+	if !value.IsValid() {
+		return ""
+	}
+
+	field := value.Field(i).Interface()
+	if t, ok := field.(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+
+	return fmt.Sprint(field)
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+func TestDiff_Update(t *testing.T) {
+	before := models.Reservation{
+		ID:        1,
+		FirstName: "Prosper",
+		Email:     "atu@prosper.com",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Now(),
+	}
+	after := before
+	after.Email = "new@prosper.com"
+	after.UpdatedAt = time.Now().Add(time.Hour)
+	after.Room.RoomName = "Generals Suit"
+
+	changes := Diff(before, after)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change but got %d: %v", len(changes), changes)
+	}
+
+	if changes[0].Field != "Email" || changes[0].From != "atu@prosper.com" || changes[0].To != "new@prosper.com" {
+		t.Errorf("unexpected change recorded: %+v", changes[0])
+	}
+}
+
+func TestDiff_CreateAndDelete(t *testing.T) {
+	room := models.Room{ID: 3, RoomName: "Luxery One"}
+
+	created := Diff(nil, room)
+	if len(created) != 2 {
+		t.Errorf("expected 2 changes for create but got %d: %v", len(created), created)
+	}
+	for _, c := range created {
+		if c.From != "" {
+			t.Errorf("create should have empty from values, got %+v", c)
+		}
+	}
+
+	deleted := Diff(&room, nil)
+	if len(deleted) != 2 {
+		t.Errorf("expected 2 changes for delete but got %d: %v", len(deleted), deleted)
+	}
+	for _, c := range deleted {
+		if c.To != "" {
+			t.Errorf("delete should have empty to values, got %+v", c)
+		}
+	}
+}
+
+func TestDiff_NothingToCompare(t *testing.T) {
+	if changes := Diff(nil, nil); len(changes) != 0 {
+		t.Errorf("expected no changes but got %v", changes)
+	}
+
+	if changes := Diff(models.Room{ID: 1}, models.Reservation{ID: 1}); len(changes) != 0 {
+		t.Errorf("expected no changes for mismatched types but got %v", changes)
+	}
+}
@@ -0,0 +1,171 @@
+// Package booking holds the rules for taking and changing bookings, shared by the site, the admin and the API.
+// Handlers turn requests into calls on a Service and its errors into responses
+package booking
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/forms"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/repository"
+)
+
+// ErrNotFound is returned when the reservation or room asked for doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnavailable is returned when the room is already booked or blocked for some of the dates of a stay
+var ErrUnavailable = models.ErrRoomUnavailable
+
+// ValidationError is returned when the details of a reservation or room break the rules for one
+type ValidationError struct {
+	// The messages for each invalid field, keyed by the field's form name
+	Fields map[string][]string
+}
+
+func (e *ValidationError) Error() string {
+	var fields []string
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "invalid " + strings.Join(fields, ", ")
+}
+
+// TransitionError is returned when the lifecycle doesn't allow a reservation to move to a status.
+// It matches models.ErrInvalidTransition with errors.Is
+type TransitionError struct {
+	From models.ReservationStatus
+	To   models.ReservationStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("a %s reservation can't be marked as %s", e.From.Label(), e.To.Label())
+}
+
+func (e *TransitionError) Unwrap() error {
+	return models.ErrInvalidTransition
+}
+
+// Service makes changes to reservations and rooms, announcing each one on Events
+type Service struct {
+	DB       repository.DatabaseRepo
+	Events   *events.Bus
+	ErrorLog *log.Logger
+	// Returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// NewService returns a service keeping its data in db and publishing changes on bus
+func NewService(db repository.DatabaseRepo, bus *events.Bus, errorLog *log.Logger) *Service {
+	if errorLog == nil {
+		errorLog = log.Default()
+	}
+
+	return &Service{
+		DB:       db,
+		Events:   bus,
+		ErrorLog: errorLog,
+		now:      time.Now,
+	}
+}
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx saying the admin with id is making the changes
+func WithUser(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, userKey{}, id)
+}
+
+// UserID returns the admin making the changes in ctx, 0 for a guest or an API client
+func UserID(ctx context.Context) int {
+	id, _ := ctx.Value(userKey{}).(int)
+	return id
+}
+
+// meta says who is making a change in ctx, for the event announcing it
+func (s *Service) meta(ctx context.Context) events.Meta {
+	return events.Meta{UserID: UserID(ctx), At: s.now()}
+}
+
+// How long the inline subscribers to an event have to handle it
+const publishTimeout = 10 * time.Second
+
+// commit makes a change in one database transaction with the InTx subscribers to the events announcing it, so
+// the change is rolled back if they fail, and their error returned. change returns those events, which are
+// published to the other subscribers once the change is committed
+func (s *Service) commit(ctx context.Context, change func(ctx context.Context) ([]events.Event, error)) error {
+	var changed []events.Event
+
+	err := s.DB.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		changed, err = change(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range changed {
+			err := s.Events.PublishInTx(ctx, event)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range changed {
+		s.publish(ctx, event)
+	}
+	return nil
+}
+
+// publish announces event. The change has already been committed by then, so a failing subscriber is logged rather than returned.
+// Subscribers still hear of it if the request that made it is cancelled in the meantime, as the metrics must count it
+func (s *Service) publish(ctx context.Context, event events.Event) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+
+	err := s.Events.Publish(ctx, event)
+	if err != nil {
+		s.ErrorLog.Println(err)
+	}
+}
+
+// validate runs rules over values, returning the form so checks that need the database can add to it
+func validate(values url.Values, rules func(*forms.Form)) *forms.Form {
+	form := forms.New(values)
+	rules(form)
+	return form
+}
+
+// invalid returns the errors of form as a ValidationError, or nil if it is valid
+func invalid(form *forms.Form) error {
+	if form.Valid() {
+		return nil
+	}
+	return &ValidationError{Fields: map[string][]string(form.Errors)}
+}
+
+// notFound turns the repository's sql.ErrNoRows into ErrNotFound, keeping what wasn't found
+func notFound(err error, what string, id int) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return gone(what, id)
+	}
+	return err
+}
+
+// gone returns ErrNotFound saying what wasn't found
+func gone(what string, id int) error {
+	return fmt.Errorf("%w: %s %d", ErrNotFound, what, id)
+}
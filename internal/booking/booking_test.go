@@ -0,0 +1,406 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/repository/dbrepo"
+)
+
+// The test repo has rooms free in 2040, fails its availability query in 2060 and is fully booked otherwise
+var (
+	free    = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	booked  = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	failing = time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// published keeps the events a service announced
+type published struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *published) record(ctx context.Context, event events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *published) names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var names []string
+	for _, event := range p.events {
+		names = append(names, event.Name())
+	}
+	return names
+}
+
+// newTestService returns a service on the test repo and what it publishes
+func newTestService() (*Service, *published) {
+	bus := events.NewBus(nil)
+	recorder := &published{}
+	bus.Subscribe("recorder", events.Inline, recorder.record)
+
+	return NewService(dbrepo.NewTestRepo(&config.AppConfig{}), bus, nil), recorder
+}
+
+func guest(roomID int, start time.Time) models.Reservation {
+	return models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		Phone:     "555",
+		RoomID:    roomID,
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+	}
+}
+
+var createReservationTests = []struct {
+	name   string
+	roomID int
+	start  time.Time
+	// Breaks the guest details, if the test needs them broken
+	change func(*models.Reservation)
+	// The error expected, or the fields of the expected ValidationError
+	err    error
+	fields []string
+}{
+	{"valid", 1, free, nil, nil, nil},
+	{"short-name", 1, free, func(r *models.Reservation) { r.FirstName = "J" }, nil, []string{"first_name"}},
+	{"bad-email", 1, free, func(r *models.Reservation) { r.Email = "john" }, nil, []string{"email"}},
+	{"backwards", 1, free, func(r *models.Reservation) { r.EndDate = free.AddDate(0, 0, -1) }, nil, []string{"end_date"}},
+	{"no-dates", 1, time.Time{}, func(r *models.Reservation) { r.EndDate = time.Time{} }, nil, []string{"end_date", "start_date"}},
+	{"no-room", 0, free, nil, nil, []string{"room_id"}},
+	{"missing-room", 9, free, nil, nil, []string{"room_id"}},
+	{"booked", 1, booked, nil, ErrUnavailable, nil},
+	{"query-fails", 1, failing, nil, errors.New("failed to query availability"), nil},
+	{"insert-fails", 2, free, nil, errors.New("failed to insert reservation"), nil},
+}
+
+func TestCreateReservation(t *testing.T) {
+	for _, e := range createReservationTests {
+		service, recorder := newTestService()
+
+		reservation := guest(e.roomID, e.start)
+		if e.change != nil {
+			e.change(&reservation)
+		}
+
+		reservation, err := service.CreateReservation(WithUser(context.Background(), 7), reservation)
+
+		var invalid *ValidationError
+		switch {
+		case e.fields != nil:
+			if !errors.As(err, &invalid) {
+				t.Errorf("failed %s: expected a ValidationError, but got %v", e.name, err)
+				continue
+			}
+			if got := invalid.Error(); got != "invalid "+strings.Join(e.fields, ", ") {
+				t.Errorf("failed %s: expected invalid %v, but got %s", e.name, e.fields, got)
+			}
+		case e.err == ErrUnavailable:
+			if !errors.Is(err, ErrUnavailable) {
+				t.Errorf("failed %s: expected ErrUnavailable, but got %v", e.name, err)
+			}
+		case e.err != nil:
+			if err == nil || err.Error() != e.err.Error() {
+				t.Errorf("failed %s: expected %v, but got %v", e.name, e.err, err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("failed %s: %v", e.name, err)
+				continue
+			}
+			if reservation.ID != 1 || reservation.Status != models.StatusPending || reservation.Room.ID != 1 {
+				t.Errorf("failed %s: the reservation wasn't booked, got %+v", e.name, reservation)
+			}
+
+			if len(recorder.events) != 1 || recorder.events[0].Metadata().UserID != 7 {
+				t.Errorf("failed %s: expected reservation.created by user 7, but got %v", e.name, recorder.events)
+			}
+			continue
+		}
+
+		if len(recorder.events) > 0 {
+			t.Errorf("failed %s: nothing should be announced, but got %v", e.name, recorder.names())
+		}
+	}
+}
+
+func TestSearchAvailability(t *testing.T) {
+	service, recorder := newTestService()
+	ctx := context.Background()
+
+	rooms, err := service.SearchAvailability(ctx, free, free.AddDate(0, 0, 2), 1)
+	if err != nil || len(rooms) != 1 {
+		t.Errorf("expected room 1 to be free in 2040, but got %v, %v", rooms, err)
+	}
+
+	rooms, err = service.SearchAvailability(ctx, booked, booked.AddDate(0, 0, 2), 1)
+	if err != nil || len(rooms) != 0 {
+		t.Errorf("expected room 1 to be booked in 2050, but got %v, %v", rooms, err)
+	}
+
+	// Each search is announced with how many rooms it found
+	var found []int
+	for _, event := range recorder.events {
+		if searched, ok := event.(events.AvailabilitySearched); ok {
+			found = append(found, searched.Rooms)
+		}
+	}
+	if len(found) != 2 || found[0] != 1 || found[1] != 0 {
+		t.Errorf("expected one search with a room free and one without, but got %v", recorder.names())
+	}
+
+	_, err = service.SearchAvailability(ctx, free, free.AddDate(0, 0, 2), 9)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a room that doesn't exist, but got %v", err)
+	}
+
+	var invalid *ValidationError
+	_, err = service.SearchAvailability(ctx, free, free, 0)
+	if !errors.As(err, &invalid) || invalid.Fields["end"] == nil {
+		t.Errorf("expected a stay of no nights to be invalid, but got %v", err)
+	}
+}
+
+func TestChangeStatus(t *testing.T) {
+	service, recorder := newTestService()
+	ctx := context.Background()
+
+	reservation, err := service.ChangeStatus(ctx, 1, models.StatusConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != models.StatusConfirmed || reservation.ConfirmedAt.IsZero() {
+		t.Errorf("expected the reservation to be confirmed, but got %+v", reservation)
+	}
+
+	_, err = service.ChangeStatus(ctx, 1, models.StatusCheckedOut)
+	var refused *TransitionError
+	if !errors.As(err, &refused) || refused.From != models.StatusPending || refused.To != models.StatusCheckedOut {
+		t.Errorf("expected a TransitionError from pending to checked-out, but got %v", err)
+	}
+	if !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("expected the TransitionError to match models.ErrInvalidTransition")
+	}
+
+	_, err = service.ChangeStatus(ctx, 100, models.StatusConfirmed)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for reservation 100, but got %v", err)
+	}
+
+	if names := recorder.names(); len(names) != 1 || names[0] != "reservation.status_changed" {
+		t.Errorf("expected only the confirmation to be announced, but got %v", names)
+	}
+}
+
+func TestAtDesk(t *testing.T) {
+	service, recorder := newTestService()
+	ctx := context.Background()
+	arrived := time.Date(2040, 1, 10, 15, 0, 0, 0, time.UTC)
+
+	reservation, err := service.CheckIn(ctx, 1, Arrival{At: arrived, IDDocument: "Passport 123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != models.StatusCheckedIn || !reservation.ConfirmedAt.Equal(arrived) || reservation.IDDocument != "Passport 123" {
+		t.Errorf("expected the pending reservation to be confirmed and checked in, but got %+v", reservation)
+	}
+
+	reservation, err = service.MarkNoShow(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != models.StatusNoShow || reservation.ConfirmedAt.IsZero() {
+		t.Errorf("expected the pending reservation to be confirmed and marked as a no-show, but got %+v", reservation)
+	}
+
+	if _, err = service.MarkNoShow(ctx, 100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for reservation 100, but got %v", err)
+	}
+
+	// Each step is announced, so subscribers see the reservation confirmed before the guest arrived or didn't
+	var steps []models.ReservationStatus
+	for _, event := range recorder.events {
+		steps = append(steps, event.(events.ReservationStatusChanged).After.Status)
+	}
+	want := []models.ReservationStatus{models.StatusConfirmed, models.StatusCheckedIn, models.StatusConfirmed, models.StatusNoShow}
+	if fmt.Sprint(steps) != fmt.Sprint(want) {
+		t.Errorf("expected the status changes %v, but got %v", want, steps)
+	}
+}
+
+func TestUpdateReservation(t *testing.T) {
+	service, recorder := newTestService()
+
+	changes := guest(1, free)
+	changes.FirstName = "J"
+
+	reservation, err := service.UpdateReservation(context.Background(), 1, changes)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["first_name"] == nil {
+		t.Errorf("expected first_name to be invalid, but got %v", err)
+	}
+	if reservation.FirstName != "J" {
+		t.Errorf("expected the invalid details to be returned to correct, but got %+v", reservation)
+	}
+
+	changes.FirstName = "John"
+	reservation, err = service.UpdateReservation(context.Background(), 1, changes)
+	if err != nil || reservation.FirstName != "John" || !reservation.StartDate.IsZero() {
+		t.Errorf("expected only the guest details to change, but got %+v, %v", reservation, err)
+	}
+
+	if names := recorder.names(); len(names) != 1 || names[0] != "reservation.updated" {
+		t.Errorf("expected only the valid update to be announced, but got %v", names)
+	}
+}
+
+func TestRoomChanges(t *testing.T) {
+	service, recorder := newTestService()
+	ctx := context.Background()
+
+	room := models.Room{RoomName: "Sea View", Price: "120", ImageSource: "sea.png", Description: "By the sea"}
+
+	_, err := service.CreateRoom(ctx, models.Room{RoomName: "Sea"})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["room_name"] == nil || invalid.Fields["price"] == nil {
+		t.Errorf("expected the room details to be invalid, but got %v", err)
+	}
+
+	if _, err := service.CreateRoom(ctx, room); err != nil {
+		t.Error(err)
+	}
+	if _, err := service.UpdateRoom(ctx, 1, room); err != nil {
+		t.Error(err)
+	}
+	if _, err := service.UpdateRoom(ctx, 9, room); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for room 9, but got %v", err)
+	}
+	if err := service.BlockRoom(ctx, 1, free); err != nil {
+		t.Error(err)
+	}
+	if err := service.UnblockRoom(ctx, 1, 4, free); err != nil {
+		t.Error(err)
+	}
+
+	expected := "room.created room.updated room.blocked room.unblocked"
+	if names := strings.Join(recorder.names(), " "); names != expected {
+		t.Errorf("expected %s, but got %s", expected, names)
+	}
+}
+
+func TestRestoreReservation(t *testing.T) {
+	service, recorder := newTestService()
+
+	// Reservation 1 of the test repo has no dates, which the test repo treats as booked
+	_, err := service.RestoreReservation(context.Background(), 1)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, but got %v", err)
+	}
+
+	if len(recorder.events) > 0 {
+		t.Errorf("nothing should be announced, but got %v", recorder.names())
+	}
+}
+
+func TestMail(t *testing.T) {
+	reservation := guest(1, free)
+	reservation.ID = 4
+
+	mailer := Mailer{Hotel: "Seaview & Co", From: "desk@seaview.com", Admin: "owner@seaview.com"}
+
+	mails := mailer.ConfirmationMails(reservation)
+	if len(mails) != 2 || mails[0].To != "john@smith.com" || mails[1].To != "owner@seaview.com" {
+		t.Fatalf("expected a mail to the guest and the admin, but got %+v", mails)
+	}
+	if mails[0].From != "desk@seaview.com" || mails[1].From != "desk@seaview.com" {
+		t.Errorf("expected the mail to be from the configured address, but got %+v", mails)
+	}
+	if !strings.Contains(mails[0].Content, "Seaview &amp; Co") {
+		t.Errorf("expected the guest mail to name the hotel, but got %q", mails[0].Content)
+	}
+	if !strings.Contains(mails[0].Content, "2040-01-01") || mails[0].ReservationID != 4 {
+		t.Errorf("expected the guest mail to confirm the stay, but got %+v", mails[0])
+	}
+
+	if confirmation := mailer.GuestConfirmation(reservation); confirmation != mails[0] {
+		t.Errorf("expected the guest's confirmation to be the one sent on booking, but got %+v", confirmation)
+	}
+
+	reservation.FirstName = "<b>John</b>"
+	if mail := mailer.GuestConfirmation(reservation); !strings.Contains(mail.Content, "Dear &lt;b&gt;John&lt;/b&gt;") {
+		t.Errorf("expected the guest's name to be escaped, but got %q", mail.Content)
+	}
+	if mail := mailer.ConfirmationMails(reservation)[1]; strings.Contains(mail.Content, "<b>John") {
+		t.Errorf("expected the guest's name to be escaped for the admin, but got %q", mail.Content)
+	}
+
+	message := mailer.GuestMessage(reservation, " Parking ", "Park <here>\nThanks")
+	if message.Subject != "Parking" || message.From != "desk@seaview.com" || message.Content != "Park &lt;here&gt;<br />Thanks" {
+		t.Errorf("expected the message to be escaped, but got %+v", message)
+	}
+}
+
+func TestMessageGuests(t *testing.T) {
+	service, recorder := newTestService()
+
+	// Reservation 100 doesn't exist in the test repo
+	result, err := service.MessageGuests(context.Background(), []int{1, 100, 2}, "Parking", "The car park is closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Succeeded) != 2 || len(result.Skipped) != 1 || result.Skipped[0].ID != 100 {
+		t.Errorf("expected reservation 100 to be skipped, but got %+v", result)
+	}
+
+	// One event carries the whole batch, for the mail subscriber to send once the request is done
+	if len(recorder.events) != 1 {
+		t.Fatalf("expected one event, but got %v", recorder.names())
+	}
+	messaged, ok := recorder.events[0].(events.GuestsMessaged)
+	if !ok || len(messaged.Reservations) != 2 || messaged.Subject != "Parking" {
+		t.Errorf("expected the guests of 1 and 2 to be messaged, but got %+v", recorder.events[0])
+	}
+}
+
+func TestPublishAfterCancel(t *testing.T) {
+	service, _ := newTestService()
+
+	var subscriberErr error
+	var deadline bool
+	var userID int
+	service.Events.Subscribe("audit", events.Inline, func(ctx context.Context, event events.Event) error {
+		subscriberErr = ctx.Err()
+		_, deadline = ctx.Deadline()
+		userID = UserID(ctx)
+		return nil
+	})
+
+	// The browser went away after the change was committed
+	ctx, cancel := context.WithCancel(WithUser(context.Background(), 7))
+	cancel()
+
+	service.publish(ctx, events.ReservationDeleted{Meta: service.meta(ctx)})
+
+	if subscriberErr != nil || !deadline {
+		t.Errorf("expected the subscriber to get its own time to run, but got %v", subscriberErr)
+	}
+	if userID != 7 {
+		t.Errorf("expected the subscriber to know who made the change, but got user %d", userID)
+	}
+}
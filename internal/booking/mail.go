@@ -0,0 +1,78 @@
+package booking
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Mailer writes the mail sent to guests and the admin, from the configured hotel and addresses
+type Mailer struct {
+	// The hotel's name, which guests are thanked for booking with
+	Hotel string
+	// The address mail is sent from
+	From string
+	// Where new reservations are announced
+	Admin string
+}
+
+// ConfirmationMails returns the mail confirming a new reservation to its guest, and the one telling the admin about it
+func (m Mailer) ConfirmationMails(reservation models.Reservation) []models.MailData {
+	return []models.MailData{m.GuestConfirmation(reservation), m.adminNotice(reservation)}
+}
+
+// GuestConfirmation returns the mail confirming reservation to its guest
+func (m Mailer) GuestConfirmation(reservation models.Reservation) models.MailData {
+	content := fmt.Sprintf(`
+	<strong>Thank you for making a reservation at %s</strong><br />
+	<p>Dear %s, </p>
+	<p>This is to confirm your reservation from %s, to %s. </p>
+	<p>We hope to see you soon</p>
+	`, template.HTMLEscapeString(m.Hotel), template.HTMLEscapeString(reservation.FirstName),
+		reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+
+	return models.MailData{
+		To:            reservation.Email,
+		From:          m.From,
+		Subject:       "Reservation Confirmation",
+		Content:       content,
+		Template:      "basic.html",
+		ReservationID: reservation.ID,
+	}
+}
+
+// adminNotice returns the mail telling the admin about a new reservation
+func (m Mailer) adminNotice(reservation models.Reservation) models.MailData {
+	content := fmt.Sprintf(`
+	<strong>Hello, Admin</strong><br />
+	<p>There is a new reservation from %s %s, </p>
+	<p>Reservation Dates: %s, to %s. </p>
+	<p>Room: %s. </p>
+	<p>Customer Email: %s</p>
+	`, template.HTMLEscapeString(reservation.FirstName), template.HTMLEscapeString(reservation.LastName),
+		reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"),
+		template.HTMLEscapeString(reservation.Room.RoomName), template.HTMLEscapeString(reservation.Email))
+
+	return models.MailData{
+		To:            m.Admin,
+		From:          m.From,
+		Subject:       "New Reservation",
+		Content:       content,
+		ReservationID: reservation.ID,
+	}
+}
+
+// GuestMessage returns a message from staff to the guest of reservation. The message is typed as plain text
+// but sent inside the html template
+func (m Mailer) GuestMessage(reservation models.Reservation, subject, message string) models.MailData {
+	return models.MailData{
+		To:            reservation.Email,
+		From:          m.From,
+		Subject:       strings.TrimSpace(subject),
+		Content:       strings.ReplaceAll(template.HTMLEscapeString(strings.TrimSpace(message)), "\n", "<br />"),
+		Template:      "basic.html",
+		ReservationID: reservation.ID,
+	}
+}
@@ -0,0 +1,452 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/forms"
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Arrival is what the front desk records when a guest checks in
+type Arrival struct {
+	At         time.Time
+	IDDocument string
+	Notes      string
+}
+
+// guestValues returns the guest details of reservation under the names the booking form uses
+func guestValues(reservation models.Reservation) url.Values {
+	values := url.Values{}
+	values.Set("first_name", reservation.FirstName)
+	values.Set("last_name", reservation.LastName)
+	values.Set("email", reservation.Email)
+	values.Set("phone", reservation.Phone)
+	return values
+}
+
+// checkStay adds an error to form unless start and end are a stay of at least one night
+func checkStay(form *forms.Form, start, end time.Time, startField, endField string) {
+	if start.IsZero() {
+		form.Errors.Add(startField, "This field is required")
+	}
+	if end.IsZero() {
+		form.Errors.Add(endField, "This field is required")
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		form.Errors.Add(endField, "Must be after "+startField)
+	}
+}
+
+// stamp sets reservation to status, recording when it got there
+func stamp(reservation *models.Reservation, status models.ReservationStatus, at time.Time) {
+	reservation.Status = status
+	switch status {
+	case models.StatusConfirmed:
+		reservation.ConfirmedAt = at
+	case models.StatusCheckedIn:
+		reservation.CheckedInAt = at
+	case models.StatusCheckedOut:
+		reservation.CheckedOutAt = at
+	case models.StatusCancelled:
+		reservation.CancelledAt = at
+	case models.StatusNoShow:
+		reservation.NoShowAt = at
+	}
+}
+
+// SearchAvailability returns the rooms free for the whole stay from start to end. With a roomID it only checks that room,
+// returning ErrNotFound if there is no such room
+func (s *Service) SearchAvailability(ctx context.Context, start, end time.Time, roomID int) ([]models.Room, error) {
+	form := forms.New(nil)
+	checkStay(form, start, end, "start", "end")
+	if err := invalid(form); err != nil {
+		return nil, err
+	}
+
+	rooms, err := s.searchAvailability(ctx, start, end, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(ctx, events.AvailabilitySearched{Meta: s.meta(ctx), Start: start, End: end, RoomID: roomID, Rooms: len(rooms)})
+	return rooms, nil
+}
+
+// searchAvailability finds the rooms for SearchAvailability, once the stay is known to be valid
+func (s *Service) searchAvailability(ctx context.Context, start, end time.Time, roomID int) ([]models.Room, error) {
+	if roomID == 0 {
+		return s.DB.SearchAvailabilityForAllRooms(ctx, start, end)
+	}
+
+	room, err := s.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := s.DB.SearchAvailabilityByDatesByRoomID(ctx, start, end, room.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms []models.Room
+	if available {
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+// GetReservation returns the reservation with id. Reservations in the trash are treated as gone
+func (s *Service) GetReservation(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return reservation, notFound(err, "reservation", id)
+	}
+
+	if !reservation.DeletedAt.IsZero() {
+		return models.Reservation{}, gone("reservation", id)
+	}
+	return reservation, nil
+}
+
+// reservation returns the reservation with id for staff to change, including one in the trash
+func (s *Service) reservation(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return reservation, notFound(err, "reservation", id)
+	}
+	return reservation, nil
+}
+
+// CreateReservation books the stay in reservation for its guest, holding the room for the dates.
+// The guest details, the stay and the room are checked first, and the room must be free for the whole stay
+func (s *Service) CreateReservation(ctx context.Context, reservation models.Reservation) (models.Reservation, error) {
+	form := validate(guestValues(reservation), (*forms.Form).ReservationRules)
+	checkStay(form, reservation.StartDate, reservation.EndDate, "start_date", "end_date")
+
+	var room models.Room
+	if reservation.RoomID == 0 {
+		form.Errors.Add("room_id", "This field is required")
+	} else {
+		var err error
+		room, err = s.GetRoom(ctx, reservation.RoomID)
+		if errors.Is(err, ErrNotFound) {
+			form.Errors.Add("room_id", "There is no such room")
+		} else if err != nil {
+			return reservation, err
+		}
+	}
+
+	if err := invalid(form); err != nil {
+		return reservation, err
+	}
+
+	reservation.Room = room
+	reservation.Status = models.StatusPending
+	reservation.CreatedAt = s.now()
+
+	// The room is checked and held in one go, so two guests can't both book it for the same night
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		id, err := s.DB.InsertBooking(ctx, reservation)
+		if err != nil {
+			return nil, err
+		}
+		reservation.ID = id
+
+		return []events.Event{events.ReservationCreated{Meta: s.meta(ctx), Reservation: reservation}}, nil
+	})
+	return reservation, err
+}
+
+// UpdateReservation changes the guest details of the reservation with id to those in changes; nothing else is taken from it.
+// If the details are invalid the reservation is returned with them alongside the ValidationError, so they can be corrected
+func (s *Service) UpdateReservation(ctx context.Context, id int, changes models.Reservation) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	before := reservation
+
+	reservation.FirstName = changes.FirstName
+	reservation.LastName = changes.LastName
+	reservation.Email = changes.Email
+	reservation.Phone = changes.Phone
+
+	if err := invalid(validate(guestValues(reservation), (*forms.Form).ReservationRules)); err != nil {
+		return reservation, err
+	}
+
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.UpdateReservation(ctx, reservation)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.ReservationUpdated{Meta: s.meta(ctx), Before: before, After: reservation}}, nil
+	})
+	return reservation, err
+}
+
+// ChangeStatus moves the reservation with id to status, returning a TransitionError if its lifecycle doesn't allow it
+func (s *Service) ChangeStatus(ctx context.Context, id int, status models.ReservationStatus) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	return s.changeStatus(ctx, reservation, status)
+}
+
+// CancelReservation cancels the reservation with id, which the lifecycle only allows before the guest checks in
+func (s *Service) CancelReservation(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.GetReservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	return s.changeStatus(ctx, reservation, models.StatusCancelled)
+}
+
+// changeStatus moves reservation to status and announces it
+func (s *Service) changeStatus(ctx context.Context, reservation models.Reservation, status models.ReservationStatus) (models.Reservation, error) {
+	after := reservation
+	stamp(&after, status, s.now())
+
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.UpdateReservationStatus(ctx, reservation.ID, status)
+		if errors.Is(err, models.ErrInvalidTransition) {
+			return nil, &TransitionError{From: reservation.Status, To: status}
+		} else if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.ReservationStatusChanged{Meta: s.meta(ctx), Before: reservation, After: after}}, nil
+	})
+	if err != nil {
+		return reservation, err
+	}
+	return after, nil
+}
+
+// CheckIn checks the guest of the reservation with id in, returning a TransitionError if it can't be checked in.
+// The front desk checks in whoever is booked for the day, so a pending reservation is confirmed in the same step
+func (s *Service) CheckIn(ctx context.Context, id int, arrival Arrival) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	after := reservation
+	after.IDDocument = arrival.IDDocument
+	after.FrontDeskNotes = arrival.Notes
+
+	return s.atDesk(ctx, reservation, after, models.StatusCheckedIn, arrival.At, func(ctx context.Context) error {
+		return s.DB.CheckInReservation(ctx, id, arrival.At, arrival.IDDocument, arrival.Notes)
+	})
+}
+
+// MarkNoShow records that the guest of the reservation with id never arrived, returning a TransitionError if it
+// can't be. Like CheckIn, a pending reservation is confirmed in the same step
+func (s *Service) MarkNoShow(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	return s.atDesk(ctx, reservation, reservation, models.StatusNoShow, s.now(), func(ctx context.Context) error {
+		return s.DB.MarkNoShow(ctx, id)
+	})
+}
+
+// atDesk makes the front desk's change, which moves before to status at with the other changes in after, and
+// announces it, returning the reservation as it now is. Confirming a pending reservation on the way is announced
+// as a change of its own
+func (s *Service) atDesk(ctx context.Context, before, after models.Reservation, status models.ReservationStatus, at time.Time,
+	change func(ctx context.Context) error) (models.Reservation, error) {
+	reservation := before
+
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := change(ctx)
+		if errors.Is(err, models.ErrInvalidTransition) {
+			return nil, &TransitionError{From: before.Status, To: status}
+		} else if err != nil {
+			return nil, err
+		}
+
+		var changed []events.Event
+		if before.Status == models.StatusPending {
+			confirmed := before
+			stamp(&confirmed, models.StatusConfirmed, at)
+			changed = append(changed, events.ReservationStatusChanged{Meta: s.meta(ctx), Before: before, After: confirmed})
+
+			before = confirmed
+			after.Status, after.ConfirmedAt = confirmed.Status, confirmed.ConfirmedAt
+		}
+
+		stamp(&after, status, at)
+		return append(changed, events.ReservationStatusChanged{Meta: s.meta(ctx), Before: before, After: after}), nil
+	})
+	if err != nil {
+		return reservation, err
+	}
+	return after, nil
+}
+
+// DeleteReservation moves the reservation with id to the trash
+func (s *Service) DeleteReservation(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.DeleteReservation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.ReservationDeleted{Meta: s.meta(ctx), Reservation: reservation}}, nil
+	})
+	return reservation, err
+}
+
+// RestoreReservation takes the reservation with id out of the trash. The room must still be free for its dates,
+// otherwise ErrUnavailable is returned. The repository checks that in the same transaction as it restores
+func (s *Service) RestoreReservation(ctx context.Context, id int) (models.Reservation, error) {
+	reservation, err := s.reservation(ctx, id)
+	if err != nil {
+		return reservation, err
+	}
+
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.RestoreReservation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.ReservationRestored{Meta: s.meta(ctx), ReservationID: id, DeletedAt: reservation.DeletedAt}}, nil
+	})
+	return reservation, err
+}
+
+// reservations returns the reservations in ids that exist, keyed by id, to tell subscribers what each was before a bulk change
+func (s *Service) reservations(ctx context.Context, ids []int) (map[int]models.Reservation, error) {
+	found := make(map[int]models.Reservation)
+	for _, id := range ids {
+		reservation, err := s.reservation(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		found[id] = reservation
+	}
+	return found, nil
+}
+
+// BulkChangeStatus moves every reservation in ids to status in one transaction, skipping those whose lifecycle doesn't allow it
+func (s *Service) BulkChangeStatus(ctx context.Context, ids []int, status models.ReservationStatus) (models.BulkResult, error) {
+	before, err := s.reservations(ctx, ids)
+	if err != nil {
+		return models.BulkResult{}, err
+	}
+
+	var result models.BulkResult
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		result, err = s.DB.BulkUpdateReservationStatus(ctx, ids, status)
+		if err != nil {
+			return nil, err
+		}
+
+		now := s.now()
+		var changed []events.Event
+		for _, id := range result.Succeeded {
+			after := before[id]
+			stamp(&after, status, now)
+			changed = append(changed, events.ReservationStatusChanged{Meta: s.meta(ctx), Before: before[id], After: after})
+		}
+		return changed, nil
+	})
+	return result, err
+}
+
+// BulkDeleteReservations moves every reservation in ids to the trash in one transaction
+func (s *Service) BulkDeleteReservations(ctx context.Context, ids []int) (models.BulkResult, error) {
+	before, err := s.reservations(ctx, ids)
+	if err != nil {
+		return models.BulkResult{}, err
+	}
+
+	var result models.BulkResult
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		result, err = s.DB.BulkDeleteReservations(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		var changed []events.Event
+		for _, id := range result.Succeeded {
+			changed = append(changed, events.ReservationDeleted{Meta: s.meta(ctx), Reservation: before[id]})
+		}
+		return changed, nil
+	})
+	return result, err
+}
+
+// MessageGuests writes to the guests of every reservation in ids, skipping those that are gone. The mail is only
+// handed to the bus, for its async subscribers to send after MessageGuests returns
+func (s *Service) MessageGuests(ctx context.Context, ids []int, subject, message string) (models.BulkResult, error) {
+	var result models.BulkResult
+	var reservations []models.Reservation
+	for _, id := range ids {
+		reservation, err := s.GetReservation(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: "not found"})
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		reservations = append(reservations, reservation)
+		result.Succeeded = append(result.Succeeded, id)
+	}
+
+	if len(reservations) == 0 {
+		return result, nil
+	}
+
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		return []events.Event{events.GuestsMessaged{Meta: s.meta(ctx), Reservations: reservations, Subject: subject, Message: message}}, nil
+	})
+	return result, err
+}
+
+// ImportReservations inserts historical reservations that have already been checked, returning their ids.
+// ErrUnavailable is returned, and nothing imported, if one clashes with a booking made since they were checked
+func (s *Service) ImportReservations(ctx context.Context, reservations []models.Reservation) ([]int, error) {
+	var ids []int
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		ids, err = s.DB.ImportReservations(ctx, reservations)
+		if err != nil {
+			return nil, err
+		}
+
+		var changed []events.Event
+		for i, id := range ids {
+			reservations[i].ID = id
+			changed = append(changed, events.ReservationCreated{Meta: s.meta(ctx), Reservation: reservations[i], Imported: true})
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,173 @@
+package booking
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/forms"
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// roomValues returns the details of room under the names the room form uses
+func roomValues(room models.Room) url.Values {
+	values := url.Values{}
+	values.Set("room_name", room.RoomName)
+	values.Set("price", room.Price)
+	values.Set("image_src", room.ImageSource)
+	values.Set("description", room.Description)
+	return values
+}
+
+// GetRoom returns the room with id. Rooms in the trash are treated as gone
+func (s *Service) GetRoom(ctx context.Context, id int) (models.Room, error) {
+	room, err := s.DB.GetRoomByID(ctx, id)
+	if err != nil {
+		return room, notFound(err, "room", id)
+	}
+
+	if !room.DeletedAt.IsZero() {
+		return models.Room{}, gone("room", id)
+	}
+	return room, nil
+}
+
+// room returns the room with id for staff to change, including one in the trash
+func (s *Service) room(ctx context.Context, id int) (models.Room, error) {
+	room, err := s.DB.GetRoomByID(ctx, id)
+	if err != nil {
+		return room, notFound(err, "room", id)
+	}
+	return room, nil
+}
+
+// CreateRoom adds room once its details are checked
+func (s *Service) CreateRoom(ctx context.Context, room models.Room) (models.Room, error) {
+	if err := invalid(validate(roomValues(room), (*forms.Form).RoomRules)); err != nil {
+		return room, err
+	}
+
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		room.ID, err = s.DB.InsertRoom(ctx, room)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.RoomCreated{Meta: s.meta(ctx), Room: room}}, nil
+	})
+	return room, err
+}
+
+// UpdateRoom changes the name, price, image and description of the room with id to those in changes.
+// If they are invalid the room is returned with them alongside the ValidationError, so they can be corrected
+func (s *Service) UpdateRoom(ctx context.Context, id int, changes models.Room) (models.Room, error) {
+	room, err := s.room(ctx, id)
+	if err != nil {
+		return room, err
+	}
+
+	before := room
+
+	room.RoomName = changes.RoomName
+	room.Price = changes.Price
+	room.ImageSource = changes.ImageSource
+	room.Description = changes.Description
+
+	if err := invalid(validate(roomValues(room), (*forms.Form).RoomRules)); err != nil {
+		return room, err
+	}
+
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.UpdateRoom(ctx, room)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.RoomUpdated{Meta: s.meta(ctx), Before: before, After: room}}, nil
+	})
+	return room, err
+}
+
+// DeleteRoom moves the room with id to the trash
+func (s *Service) DeleteRoom(ctx context.Context, id int) (models.Room, error) {
+	room, err := s.room(ctx, id)
+	if err != nil {
+		return room, err
+	}
+
+	err = s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.DeleteRoom(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.RoomDeleted{Meta: s.meta(ctx), Room: room}}, nil
+	})
+	return room, err
+}
+
+// RestoreRoom takes the room with id out of the trash
+func (s *Service) RestoreRoom(ctx context.Context, id int) error {
+	room, err := s.room(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.RestoreRoom(ctx, id)
+		if err != nil {
+			return nil, notFound(err, "room", id)
+		}
+
+		return []events.Event{events.RoomRestored{Meta: s.meta(ctx), RoomID: id, DeletedAt: room.DeletedAt}}, nil
+	})
+}
+
+// BlockRoom keeps the room with roomID from being booked on date, for the owner's own use or maintenance
+func (s *Service) BlockRoom(ctx context.Context, roomID int, date time.Time) error {
+	return s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.InsertBlockForRoom(ctx, roomID, date)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.RoomBlocked{Meta: s.meta(ctx), RoomID: roomID, Date: date}}, nil
+	})
+}
+
+// UnblockRoom removes the block with blockID, which kept the room with roomID from being booked on date
+func (s *Service) UnblockRoom(ctx context.Context, roomID, blockID int, date time.Time) error {
+	return s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		err := s.DB.DeleteBlockByID(ctx, blockID)
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{events.RoomUnblocked{Meta: s.meta(ctx), RoomID: roomID, Date: date}}, nil
+	})
+}
+
+// ImportRooms inserts rooms that have already been checked, returning their ids
+func (s *Service) ImportRooms(ctx context.Context, rooms []models.Room) ([]int, error) {
+	var ids []int
+	err := s.commit(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		ids, err = s.DB.ImportRooms(ctx, rooms)
+		if err != nil {
+			return nil, err
+		}
+
+		var changed []events.Event
+		for i, id := range ids {
+			rooms[i].ID = id
+			changed = append(changed, events.RoomCreated{Meta: s.meta(ctx), Room: rooms[i], Imported: true})
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
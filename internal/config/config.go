@@ -1,8 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"html/template"
 	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/atuprosper/booking-project/internal/models"
@@ -16,4 +21,108 @@ type AppConfig struct {
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChannel   chan models.MailData
+	// Woken when webhook deliveries are queued, so they go out without waiting for the next poll
+	WebhookChannel chan struct{}
+	// How long deleted reservations and rooms stay in the trash before they are purged
+	TrashRetention time.Duration
+	// How long each database operation may run before it is cancelled
+	DBTimeouts DBTimeouts
+	// How long a login lasts
+	SessionLifetime time.Duration
+	// Shown on the site and as the sender of mail
+	HotelName string
+	// The address mail is sent from, and where new reservations are announced
+	MailFrom   string
+	AdminEmail string
+	// The key mail is sent through Sendinblue with
+	SendinblueAPIKey string
+	// Set while the server takes requests, and cleared as soon as it starts shutting down
+	Ready atomic.Bool
+	// Set while the mail worker is taking mail from MailChannel
+	MailWorker atomic.Bool
+}
+
+// DefaultDBTimeout is how long a database operation may run when nothing else is configured
+const DefaultDBTimeout = 3 * time.Second
+
+// DBTimeouts says how long database operations may run. Operations are named after their repository method
+type DBTimeouts struct {
+	// Used for every operation without its own entry, DefaultDBTimeout if zero
+	Default    time.Duration
+	Operations map[string]time.Duration
+}
+
+// DBOperations names the operations a timeout can be set for: the repository methods that query the database,
+// and the Ping of the health check
+var DBOperations = []string{
+	"AllAPIKeys", "AllRooms", "AllWebhooks", "Authenticate", "BulkDeleteReservations", "BulkUpdateReservationStatus",
+	"CheckInReservation", "CountReservationsByStatus", "CountReservationsCreatedBetween", "DeleteBlockByID",
+	"DeleteReservation", "DeleteRoom", "DeleteTodo", "DeleteWebhook", "DeletedReservations", "DeletedRooms",
+	"DueWebhookDeliveries", "EachReportReservation", "GetAPIKeyByPrefix", "GetAuditLogsForEntity",
+	"GetMailLogsForReservation", "GetNotesForReservation", "GetReservationByID", "GetRestrictionsForCurrentRoom",
+	"GetRoomByID", "GetTodoListByUserID", "GetUserByEmail", "GetUserByID", "GetWebhookByID", "GetWebhookDeliveries",
+	"ImportReservations", "ImportRooms", "InsertAPIKey", "InsertAuditLog", "InsertBlockForRoom", "InsertBooking",
+	"InsertMailLog", "InsertReservation", "InsertReservationNote", "InsertRoom", "InsertRoomRestriction",
+	"InsertTodoList", "InsertUser", "InsertWebhook", "InsertWebhookDelivery", "MarkNoShow", "OccupancyForRange",
+	"PickupForRange", "Ping", "PurgeDeletedReservations", "PurgeDeletedRooms", "ReservationsArrivingOn",
+	"ReservationsDepartingOn", "ReservationsInHouse", "ReservationsNotArrivedBy", "RestoreReservation", "RestoreRoom",
+	"RetryWebhookDelivery", "RevokeAPIKey", "SearchAuditLogs", "SearchAvailabilityByDatesByRoomID",
+	"SearchAvailabilityForAllRooms", "SearchReservations", "SetWebhookActive", "TouchAPIKey", "UpdateReservation",
+	"UpdateReservationStatus", "UpdateRoom", "UpdateUser", "UpdateUserPassword", "UpdateWebhookDelivery",
+	"WebhooksForEvent",
+}
+
+// NewDBTimeouts returns the default timeouts. Imports write every row in one transaction and report exports
+// stream to the browser, so both get longer than the usual query
+func NewDBTimeouts() DBTimeouts {
+	return DBTimeouts{
+		Default: DefaultDBTimeout,
+		Operations: map[string]time.Duration{
+			"ImportReservations":    time.Minute,
+			"ImportRooms":           time.Minute,
+			"EachReportReservation": 5 * time.Minute,
+		},
+	}
+}
+
+// For returns how long the operation op may run
+func (t DBTimeouts) For(op string) time.Duration {
+	if timeout, ok := t.Operations[op]; ok && timeout > 0 {
+		return timeout
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultDBTimeout
+}
+
+// Set overrides the timeouts from a list like "EachReportReservation=10m,SearchReservations=5s". Each operation must be in DBOperations
+func (t *DBTimeouts) Set(list string) error {
+	if t.Operations == nil {
+		t.Operations = make(map[string]time.Duration)
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("database timeout %q must look like Operation=duration", entry)
+		}
+
+		op := strings.TrimSpace(parts[0])
+		if !slices.Contains(DBOperations, op) {
+			return fmt.Errorf("database timeout %q names an unknown operation. Operations are repository methods like SearchReservations", entry)
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("database timeout %q must be a positive duration like 5s", entry)
+		}
+		t.Operations[op] = timeout
+	}
+	return nil
 }
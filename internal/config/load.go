@@ -0,0 +1,290 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is everything the app is configured with. Every setting has a flag, an environment variable and a key in
+// the config file, named alike: the flag -hotel-name is HOTEL_NAME in the environment and "hotel-name" in the file.
+// Where a setting is given more than once the flag wins over the environment, which wins over the file, which wins
+// over the default
+type Config struct {
+	// The JSON config file, which only comes from -config or CONFIG_FILE
+	File string
+
+	Host string
+	Port string
+	// Where /metrics is served, apart from the site. Metrics aren't served if it's empty
+	MetricsAddr string
+	DBURI       string
+	// Apply pending migrations before starting
+	Migrate bool
+	// Keep everything in memory instead of a database
+	Demo bool
+
+	InProduction bool
+	UseCache     bool
+
+	SessionLifetime time.Duration
+	TrashDays       int
+	DBTimeout       time.Duration
+	// Timeouts for particular operations, like EachReportReservation=10m,SearchReservations=5s
+	DBTimeouts string
+	// How long shutting down may wait for requests and background jobs to finish
+	ShutdownTimeout time.Duration
+
+	HotelName        string
+	MailFrom         string
+	AdminEmail       string
+	SendinblueAPIKey string
+}
+
+// Defaults returns the configuration used for whatever isn't set
+func Defaults() Config {
+	return Config{
+		Port:            "8080",
+		InProduction:    true,
+		UseCache:        true,
+		SessionLifetime: 24 * time.Hour,
+		TrashDays:       30,
+		DBTimeout:       DefaultDBTimeout,
+		ShutdownTimeout: 30 * time.Second,
+		HotelName:       "Hotel Bookings",
+	}
+}
+
+// bind adds a flag for every setting to flags, defaulting to and setting c's fields. It returns the settings' names
+func (c *Config) bind(flags *flag.FlagSet) []string {
+	flags.StringVar(&c.Host, "host", c.Host, "Host to listen on")
+	flags.StringVar(&c.Port, "port", c.Port, "Port to listen on")
+	flags.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Address to serve /metrics on, apart from the site, like 127.0.0.1:9090. Not served if empty")
+	flags.StringVar(&c.DBURI, "dburi", c.DBURI, "Database to connect to, a Postgres connection string or sqlite://path/to/file.db")
+	flags.BoolVar(&c.Migrate, "migrate", c.Migrate, "Apply pending database migrations before starting")
+	flags.BoolVar(&c.Demo, "demo", c.Demo, "Keep everything in memory instead of a database, starting from the seeded rooms and admin")
+	flags.BoolVar(&c.InProduction, "production", c.InProduction, "App is in production")
+	flags.BoolVar(&c.UseCache, "cache", c.UseCache, "Use template cache")
+	flags.DurationVar(&c.SessionLifetime, "session-lifetime", c.SessionLifetime, "How long a login lasts")
+	flags.IntVar(&c.TrashDays, "trashdays", c.TrashDays, "Days to keep deleted reservations and rooms before purging them")
+	flags.DurationVar(&c.DBTimeout, "dbtimeout", c.DBTimeout, "How long a database operation may run")
+	flags.StringVar(&c.DBTimeouts, "dbtimeouts", c.DBTimeouts, "Timeouts for particular database operations, like EachReportReservation=10m,SearchReservations=5s")
+	flags.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "How long shutting down may wait for requests, mail and background jobs to finish")
+	flags.StringVar(&c.HotelName, "hotel-name", c.HotelName, "The hotel's name, shown on the site and in mail")
+	flags.StringVar(&c.MailFrom, "mail-from", c.MailFrom, "The address mail is sent from")
+	flags.StringVar(&c.AdminEmail, "admin-email", c.AdminEmail, "Where new reservations are announced")
+	flags.StringVar(&c.SendinblueAPIKey, "sendinblue-api-key", c.SendinblueAPIKey, "The Sendinblue API key mail is sent with")
+
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+
+	flags.StringVar(&c.File, "config", c.File, "JSON file of settings, keyed by their flag names")
+	return names
+}
+
+// envName returns the environment variable for the setting with the flag name
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load parses args with flags, which gets a flag for every setting as well as any it already has, and fills in
+// the settings not given as flags from the environment through getenv, then the config file, then the defaults.
+// The settings in required must not be empty, except with -demo, which keeps everything in memory and doesn't
+// mind mail going nowhere. Every invalid setting is reported in the one error
+func Load(flags *flag.FlagSet, args []string, getenv func(string) string, required ...string) (Config, error) {
+	c := Defaults()
+	names := c.bind(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return c, err
+	}
+
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var errs []error
+
+	if !given["config"] {
+		c.File = getenv("CONFIG_FILE")
+	}
+	if c.File != "" {
+		errs = append(errs, c.loadFile(flags, names, given)...)
+	}
+
+	for _, name := range names {
+		value := getenv(envName(name))
+		if given[name] || value == "" {
+			continue
+		}
+
+		if err := flags.Set(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not a valid %s", envName(name), value, kind(flags, name)))
+		}
+	}
+
+	errs = append(errs, c.validate(flags, required)...)
+	if len(errs) > 0 {
+		return c, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return c, nil
+}
+
+// loadFile sets the settings in c.File that weren't given as flags
+func (c *Config) loadFile(flags *flag.FlagSet, names []string, given map[string]bool) []error {
+	content, err := os.ReadFile(c.File)
+	if err != nil {
+		return []error{err}
+	}
+
+	// Numbers are kept as written, so large ones don't turn into 1e+06
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+	err = decoder.Decode(&values)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", c.File, err)}
+	}
+
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: there is no setting %q", c.File, key))
+			continue
+		}
+		if given[key] {
+			continue
+		}
+
+		value := fmt.Sprint(values[key])
+		if err := flags.Set(key, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %q is not a valid %s", c.File, key, value, kind(flags, key)))
+		}
+	}
+	return errs
+}
+
+// kind names the type of value the flag name takes, for error messages
+func kind(flags *flag.FlagSet, name string) string {
+	switch flags.Lookup(name).Value.(flag.Getter).Get().(type) {
+	case bool:
+		return "true or false"
+	case int:
+		return "number"
+	case time.Duration:
+		return "duration like 30s or 24h"
+	}
+	return "value"
+}
+
+// validate returns everything wrong with the settings, by flag name
+func (c *Config) validate(flags *flag.FlagSet, required []string) []error {
+	var errs []error
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	for _, name := range required {
+		if flags.Lookup(name).Value.String() == "" && !c.Demo {
+			invalid(name, "is required, set -%s or %s", name, envName(name))
+		}
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "%q must be a number from 1 to 65535", c.Port)
+	}
+
+	if c.SessionLifetime < time.Minute {
+		invalid("session-lifetime", "must be at least a minute")
+	}
+
+	if c.TrashDays < 0 {
+		invalid("trashdays", "must not be negative")
+	}
+
+	if c.DBTimeout <= 0 {
+		invalid("dbtimeout", "must be more than 0")
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		invalid("shutdown-timeout", "must be more than 0")
+	}
+
+	if _, err := c.Timeouts(); err != nil {
+		invalid("dbtimeouts", "%s", err)
+	}
+
+	if strings.TrimSpace(c.HotelName) == "" {
+		invalid("hotel-name", "must not be blank")
+	}
+
+	for name, address := range map[string]string{"mail-from": c.MailFrom, "admin-email": c.AdminEmail} {
+		if address == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			invalid(name, "%q is not an email address", address)
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errs
+}
+
+// Timeouts returns the database timeouts, the defaults with DBTimeout and DBTimeouts applied
+func (c Config) Timeouts() (DBTimeouts, error) {
+	timeouts := NewDBTimeouts()
+	timeouts.Default = c.DBTimeout
+	err := timeouts.Set(c.DBTimeouts)
+	return timeouts, err
+}
+
+// TrashRetention returns how long reservations and rooms stay in the trash
+func (c Config) TrashRetention() time.Duration {
+	return time.Duration(c.TrashDays) * 24 * time.Hour
+}
+
+// Apply copies the settings the rest of the app reads from its AppConfig into app
+func (c Config) Apply(app *AppConfig) error {
+	timeouts, err := c.Timeouts()
+	if err != nil {
+		return err
+	}
+
+	app.InProduction = c.InProduction
+	app.UseCache = c.UseCache
+	app.TrashRetention = c.TrashRetention()
+	app.DBTimeouts = timeouts
+	app.SessionLifetime = c.SessionLifetime
+	app.HotelName = c.HotelName
+	app.MailFrom = c.MailFrom
+	app.AdminEmail = c.AdminEmail
+	app.SendinblueAPIKey = c.SendinblueAPIKey
+	return nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load loads the configuration from args, the environment in env and a config file holding file, if it isn't empty
+func load(t *testing.T, args []string, env map[string]string, file string, required ...string) (Config, error) {
+	t.Helper()
+
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "bookings.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		env["CONFIG_FILE"] = path
+	}
+
+	flags := flag.NewFlagSet("bookings", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return Load(flags, args, func(name string) string { return env[name] }, required...)
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, err := load(t, nil, map[string]string{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Defaults()
+	if c != expected {
+		t.Errorf("expected the defaults %+v, but got %+v", expected, c)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := `{"port": 9000, "hotel-name": "From the file", "trashdays": 7, "production": false, "dbtimeout": "10s"}`
+	env := map[string]string{
+		"HOTEL_NAME": "From the environment",
+		"TRASHDAYS":  "14",
+		"MAIL_FROM":  "desk@seaview.com",
+	}
+
+	c, err := load(t, []string{"-trashdays", "21"}, env, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Port != "9000" || c.InProduction || c.DBTimeout != 10*time.Second {
+		t.Errorf("expected what only the file sets from it, but got %+v", c)
+	}
+	if c.HotelName != "From the environment" || c.MailFrom != "desk@seaview.com" {
+		t.Errorf("expected the environment over the file, but got %+v", c)
+	}
+	if c.TrashDays != 21 {
+		t.Errorf("expected the flag over everything, but got %d trash days", c.TrashDays)
+	}
+	if c.SessionLifetime != 24*time.Hour {
+		t.Errorf("expected the default for what isn't set, but got %s", c.SessionLifetime)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	file := `{"port": "http", "color": "blue"}`
+	env := map[string]string{
+		"TRASHDAYS":        "-1",
+		"SESSION_LIFETIME": "a day",
+		"DBTIMEOUTS":       "SearchReservations",
+		"ADMIN_EMAIL":      "the admin",
+		"HOTEL_NAME":       " ",
+	}
+
+	_, err := load(t, nil, env, file, "dburi", "mail-from")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Every problem is reported at once
+	for _, expected := range []string{
+		`there is no setting "color"`,
+		`port: "http" must be a number`,
+		"trashdays: must not be negative",
+		`SESSION_LIFETIME: "a day" is not a valid duration`,
+		`dbtimeouts: database timeout "SearchReservations"`,
+		`admin-email: "the admin" is not an email address`,
+		"hotel-name: must not be blank",
+		"dburi: is required, set -dburi or DBURI",
+		"mail-from: is required, set -mail-from or MAIL_FROM",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in\n%s", expected, err)
+		}
+	}
+}
+
+func TestLoad_Demo(t *testing.T) {
+	// The demo needs no database and can do without mail
+	c, err := load(t, []string{"-demo"}, map[string]string{}, "", "dburi", "mail-from")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Demo {
+		t.Error("expected the demo")
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	_, err := load(t, []string{"-config", filepath.Join(t.TempDir(), "missing.json")}, map[string]string{}, "")
+	if err == nil {
+		t.Error("expected an error for a config file that doesn't exist")
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	c := Defaults()
+	c.TrashDays = 2
+	c.DBTimeouts = "SearchReservations=5s"
+	c.HotelName = "Seaview"
+	c.AdminEmail = "owner@seaview.com"
+
+	var app AppConfig
+	if err := c.Apply(&app); err != nil {
+		t.Fatal(err)
+	}
+
+	if app.TrashRetention != 48*time.Hour || app.SessionLifetime != 24*time.Hour {
+		t.Errorf("expected the durations to be applied, but got %s and %s", app.TrashRetention, app.SessionLifetime)
+	}
+	if app.DBTimeouts.For("SearchReservations") != 5*time.Second || app.DBTimeouts.For("ImportRooms") != time.Minute {
+		t.Errorf("expected the timeouts to be applied over their defaults, but got %+v", app.DBTimeouts)
+	}
+	if app.HotelName != "Seaview" || app.AdminEmail != "owner@seaview.com" || !app.InProduction {
+		t.Errorf("expected the settings to be applied, but got %q, %q and %t", app.HotelName, app.AdminEmail, app.InProduction)
+	}
+}
@@ -2,41 +2,57 @@ package driver
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// The database drivers a connection string can select
+const (
+	Postgres = "pgx"
+	SQLite   = "sqlite"
 )
 
 // DB holds the database connection pool
 type DB struct {
 	SQL *sql.DB
+	// Which of Postgres or SQLite the pool is connected to
+	Driver string
 }
 
-var dbConnection = &DB{}
-
 const maxOpenDbConn = 10
 const maxIdleDbConn = 5
 const maxDbLifetime = 5 * time.Minute
 
-// ConnectSQL creates database pool for Postgres
+// How every SQLite connection is set up: foreign keys enforced as Postgres does, readers not blocking the writer,
+// writers waiting their turn instead of failing, transactions taking the write lock up front so two can't deadlock
+// upgrading to it, and times stored in UTC in a format that sorts as text
+const sqliteOptions = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+	"&_txlock=immediate&_time_format=sqlite&_timezone=UTC"
+
+// ConnectSQL creates a database pool for Postgres, or for SQLite if the connection string starts with sqlite://.
+// Every call opens a pool of its own
 func ConnectSQL(dbConnectionString string) (*DB, error) {
 	newDatabase, err := NewDatabase(dbConnectionString)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	newDatabase.SetMaxOpenConns(maxOpenDbConn)
 	newDatabase.SetMaxIdleConns(maxIdleDbConn)
 	newDatabase.SetConnMaxLifetime(maxDbLifetime)
 
-	dbConnection.SQL = newDatabase
-
 	err = testDB(newDatabase)
 	if err != nil {
+		newDatabase.Close()
 		return nil, err
 	}
-	return dbConnection, nil
+
+	driver, _ := DataSource(dbConnectionString)
+	return &DB{SQL: newDatabase, Driver: driver}, nil
 }
 
 // testDB tries to ping the database
@@ -48,9 +64,26 @@ func testDB(newDatabase *sql.DB) error {
 	return nil
 }
 
+// DataSource returns the driver a connection string selects and what to open it with.
+// sqlite://bookings.db and sqlite:///var/lib/bookings.db open SQLite database files, anything else is for Postgres
+func DataSource(dbConnectionString string) (string, string) {
+	path := strings.TrimPrefix(dbConnectionString, "sqlite://")
+	if path == dbConnectionString {
+		path = strings.TrimPrefix(dbConnectionString, "sqlite:")
+	}
+	if path == dbConnectionString {
+		return Postgres, dbConnectionString
+	}
+
+	if strings.Contains(path, "?") {
+		return SQLite, path + "&" + sqliteOptions
+	}
+	return SQLite, path + "?" + sqliteOptions
+}
+
 // NewDatabase creates a new database for the application
 func NewDatabase(dbConnectionString string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dbConnectionString)
+	db, err := sql.Open(DataSource(dbConnectionString))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestConnectSQL(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := ConnectSQL("sqlite://" + filepath.Join(dir, "first.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.SQL.Close()
+
+	second, err := ConnectSQL("sqlite://" + filepath.Join(dir, "second.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.SQL.Close()
+
+	// Opening the second database leaves the first caller's pool as it was
+	if first == second || first.SQL == second.SQL || first.Driver != SQLite {
+		t.Errorf("expected two pools, but got %+v and %+v", first, second)
+	}
+	if _, err := first.SQL.Exec("create table rooms (id integer)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.SQL.Exec("select id from rooms"); err == nil {
+		t.Error("expected the second database not to have the first one's table")
+	}
+
+	// A database that can't be opened is an error rather than a panic
+	if db, err := ConnectSQL("sqlite://" + filepath.Join(dir, "missing", "bookings.db")); err == nil {
+		db.SQL.Close()
+		t.Error("expected an error for a database in a missing directory")
+	}
+}
@@ -0,0 +1,207 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Mode is when a subscriber is run
+type Mode int
+
+const (
+	// InTx subscribers run in the publisher's goroutine before the change is committed, in the same database
+	// transaction, which the context PublishInTx is given carries. If one fails the change is rolled back, so
+	// they suit what must be recorded with the change, such as the audit log. Publish doesn't run them
+	InTx Mode = iota
+	// Inline subscribers run in the publisher's goroutine before Publish returns, and their errors are returned to
+	// the publisher. Changes are published once they have been committed, so an inline subscriber can't undo the
+	// change by failing. Publishers log the error instead, and the change stands without what the subscriber does
+	Inline
+	// Async subscribers run one event at a time, in the order published, on the bus's own goroutine after Publish
+	// returns. They suit slow side effects such as mail. Their errors are logged
+	Async
+)
+
+// Handler is a subscriber's reaction to an event
+type Handler func(ctx context.Context, event Event) error
+
+// How many async events can wait before Publish blocks
+const queueSize = 256
+
+// Bus passes the events published on it to every subscriber
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	nextID      int
+	closed      bool
+	// Publishers queueing async events, which Close waits for before closing the queue
+	sending sync.WaitGroup
+
+	queue    chan job
+	done     chan struct{}
+	errorLog *log.Logger
+}
+
+type subscriber struct {
+	id      int
+	name    string
+	mode    Mode
+	handler Handler
+}
+
+type job struct {
+	subscriber *subscriber
+	event      Event
+}
+
+// NewBus returns a bus with no subscribers, ready to publish to. Errors from async subscribers go to errorLog
+func NewBus(errorLog *log.Logger) *Bus {
+	if errorLog == nil {
+		errorLog = log.Default()
+	}
+
+	b := &Bus{
+		queue:    make(chan job, queueSize),
+		done:     make(chan struct{}),
+		errorLog: errorLog,
+	}
+
+	go b.work()
+
+	return b
+}
+
+// Subscribe runs handler for every event published from now on. The name identifies the subscriber in errors.
+// It returns a function that ends the subscription
+func (b *Bus) Subscribe(name string, mode Mode, handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	s := &subscriber{id: b.nextID, name: name, mode: mode, handler: handler}
+	b.subscribers = append(b.subscribers, s)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, existing := range b.subscribers {
+			if existing.id == s.id {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// PublishInTx runs the InTx subscribers to event, in the order they subscribed, with ctx, which carries the
+// transaction of the change. It stops at the first error and returns it, as the change is then rolled back
+func (b *Bus) PublishInTx(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		if s.mode != InTx {
+			continue
+		}
+
+		err := run(ctx, s, event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish runs the inline subscribers to event, in the order they subscribed, and queues it for the async ones.
+// Every inline subscriber is run even if one fails, and the first error is returned
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	closed := b.closed
+	if !closed {
+		b.sending.Add(1)
+	}
+	b.mu.RUnlock()
+
+	var first error
+	for _, s := range subscribers {
+		if s.mode != Inline {
+			continue
+		}
+
+		err := run(ctx, s, event)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	for _, s := range subscribers {
+		if s.mode != Async {
+			continue
+		}
+
+		// Once the bus is closed there is no one to hand the event to, so the publisher runs it rather than drop it
+		if closed {
+			b.report(run(context.Background(), s, event))
+			continue
+		}
+
+		// A full queue holds up only this publisher, as no lock is held. Close waits for it to get its events in
+		b.queue <- job{subscriber: s, event: event}
+	}
+
+	if !closed {
+		b.sending.Done()
+	}
+
+	return first
+}
+
+// Close stops queueing async events and waits for those already queued to be handled
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	b.sending.Wait()
+	close(b.queue)
+	<-b.done
+}
+
+// work runs the queued async events. They get a fresh context, as the publisher's has usually ended by then
+func (b *Bus) work() {
+	defer close(b.done)
+
+	for j := range b.queue {
+		b.report(run(context.Background(), j.subscriber, j.event))
+	}
+}
+
+func (b *Bus) report(err error) {
+	if err != nil {
+		b.errorLog.Println(err)
+	}
+}
+
+// run calls a subscriber, turning a panic into an error so one bad subscriber can't take the others down
+func run(ctx context.Context, s *subscriber, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s subscriber panicked on %s: %v", s.name, event.Name(), r)
+		}
+	}()
+
+	err = s.handler(ctx, event)
+	if err != nil {
+		return fmt.Errorf("%s subscriber failed on %s: %w", s.name, event.Name(), err)
+	}
+	return nil
+}
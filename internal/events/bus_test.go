@@ -0,0 +1,192 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the names of the events a subscriber was given
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *recorder) handle(ctx context.Context, event Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, event.Name())
+	return nil
+}
+
+func (r *recorder) got() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.names, ",")
+}
+
+func TestBusInline(t *testing.T) {
+	bus := NewBus(nil)
+	defer bus.Close()
+
+	var order []string
+	failure := errors.New("no audit log")
+
+	bus.Subscribe("first", Inline, func(ctx context.Context, event Event) error {
+		order = append(order, "first")
+		return failure
+	})
+	bus.Subscribe("second", Inline, func(ctx context.Context, event Event) error {
+		order = append(order, "second")
+		return errors.New("second failure")
+	})
+
+	err := bus.Publish(context.Background(), RoomRestored{RoomID: 1})
+
+	// Every inline subscriber has run, in order, by the time Publish returns
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("expected both subscribers to run in order, but got %v", order)
+	}
+
+	// The publisher is told of the first failure
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "first subscriber failed on room.restored") {
+		t.Errorf("expected the first subscriber's error, but got %v", err)
+	}
+}
+
+func TestBusInTx(t *testing.T) {
+	bus := NewBus(nil)
+	defer bus.Close()
+
+	audit, inline := &recorder{}, &recorder{}
+	failure := errors.New("no audit log")
+	bus.Subscribe("audit", InTx, audit.handle)
+	bus.Subscribe("broken", InTx, func(ctx context.Context, event Event) error { return failure })
+	bus.Subscribe("after", InTx, audit.handle)
+	bus.Subscribe("inline", Inline, inline.handle)
+
+	// The first failure stops the rest, as the change is rolled back
+	err := bus.PublishInTx(context.Background(), RoomCreated{})
+	if !errors.Is(err, failure) || audit.got() != "room.created" || inline.got() != "" {
+		t.Errorf("expected only the InTx subscribers up to the failure to run, but got %v, %q and %q", err, audit.got(), inline.got())
+	}
+
+	// And Publish leaves them out
+	_ = bus.Publish(context.Background(), RoomDeleted{})
+	if audit.got() != "room.created" || inline.got() != "room.deleted" {
+		t.Errorf("expected Publish to run only the inline subscriber, but got %q and %q", audit.got(), inline.got())
+	}
+}
+
+func TestBusAsync(t *testing.T) {
+	var logged bytes.Buffer
+	bus := NewBus(log.New(&logged, "", 0))
+
+	mail := &recorder{}
+	bus.Subscribe("mail", Async, mail.handle)
+	bus.Subscribe("broken", Async, func(ctx context.Context, event Event) error {
+		panic("out of stamps")
+	})
+
+	for _, event := range []Event{ReservationCreated{}, ReservationStatusChanged{}, RoomBlocked{}} {
+		err := bus.Publish(context.Background(), event)
+		if err != nil {
+			t.Errorf("expected async failures to stay off the publisher, but got %v", err)
+		}
+	}
+
+	// Close waits for the queue to drain
+	bus.Close()
+
+	if mail.got() != "reservation.created,reservation.status_changed,room.blocked" {
+		t.Errorf("expected every event in the order published, but got %s", mail.got())
+	}
+
+	if !strings.Contains(logged.String(), "broken subscriber panicked on room.blocked: out of stamps") {
+		t.Errorf("expected the panic to be logged, but got %q", logged.String())
+	}
+
+	// Events published after Close are still handled, by the publisher
+	err := bus.Publish(context.Background(), RoomUnblocked{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(mail.got(), ",room.unblocked") {
+		t.Errorf("expected an event published after close to be handled, but got %s", mail.got())
+	}
+
+	// Closing twice is harmless
+	bus.Close()
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := NewBus(nil)
+	defer bus.Close()
+
+	kept, dropped := &recorder{}, &recorder{}
+	bus.Subscribe("kept", Inline, kept.handle)
+	unsubscribe := bus.Subscribe("dropped", Inline, dropped.handle)
+
+	_ = bus.Publish(context.Background(), RoomCreated{})
+	unsubscribe()
+	_ = bus.Publish(context.Background(), RoomDeleted{})
+
+	if kept.got() != "room.created,room.deleted" || dropped.got() != "room.created" {
+		t.Errorf("expected only the remaining subscriber to get the second event, but got %q and %q", kept.got(), dropped.got())
+	}
+}
+
+func TestBusFullQueue(t *testing.T) {
+	bus := NewBus(nil)
+
+	release := make(chan struct{})
+	mail := &recorder{}
+	bus.Subscribe("mail", Async, func(ctx context.Context, event Event) error {
+		<-release
+		return mail.handle(ctx, event)
+	})
+
+	// One event is being handled and the queue is full, so the last publisher waits for room
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < queueSize+2; i++ {
+			_ = bus.Publish(context.Background(), RoomCreated{})
+		}
+	}()
+
+	for len(bus.queue) < queueSize {
+		time.Sleep(time.Millisecond)
+	}
+
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		bus.Subscribe("audit", InTx, (&recorder{}).handle)
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Subscribe not to wait for a publisher stuck on the full queue")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		bus.Close()
+	}()
+
+	close(release)
+	<-published
+	<-closed
+
+	if got := strings.Count(mail.got(), "room.created"); got != queueSize+2 {
+		t.Errorf("expected Close to wait for every event to be handled, but %d were", got)
+	}
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Event is something that happened in the app, published for whatever needs to react to it
+type Event interface {
+	// Name identifies the kind of event, e.g. reservation.created
+	Name() string
+	// Metadata says who caused the event and when
+	Metadata() Meta
+}
+
+// Meta is carried by every event
+type Meta struct {
+	// The admin who made the change, 0 for a guest or an API client
+	UserID int
+	At     time.Time
+}
+
+// Metadata returns the metadata of the event it is part of
+func (m Meta) Metadata() Meta {
+	return m
+}
+
+// ReservationCreated is published when a reservation is booked, or imported
+type ReservationCreated struct {
+	Meta
+	Reservation models.Reservation
+	// Imported reservations are historical, so guests aren't mailed and integrations aren't told about them
+	Imported bool
+}
+
+// ReservationUpdated is published when a reservation's guest details are edited
+type ReservationUpdated struct {
+	Meta
+	Before models.Reservation
+	After  models.Reservation
+}
+
+// ReservationStatusChanged is published when a reservation moves through its lifecycle, e.g. is cancelled or checked in
+type ReservationStatusChanged struct {
+	Meta
+	Before models.Reservation
+	After  models.Reservation
+}
+
+// ReservationDeleted is published when a reservation is moved to the trash
+type ReservationDeleted struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// ReservationRestored is published when a reservation is taken out of the trash
+type ReservationRestored struct {
+	Meta
+	ReservationID int
+	// When it had been moved to the trash
+	DeletedAt time.Time
+}
+
+// GuestsMessaged is published when staff write to the guests of several reservations at once
+type GuestsMessaged struct {
+	Meta
+	Reservations []models.Reservation
+	Subject      string
+	// Plain text, as staff typed it
+	Message string
+}
+
+// AvailabilitySearched is published when someone looks for free rooms, on the site, in the admin or through the API
+type AvailabilitySearched struct {
+	Meta
+	Start time.Time
+	End   time.Time
+	// The room searched, 0 for every room
+	RoomID int
+	// How many rooms were free
+	Rooms int
+}
+
+// RoomCreated is published when a room is added, or imported
+type RoomCreated struct {
+	Meta
+	Room     models.Room
+	Imported bool
+}
+
+// RoomUpdated is published when a room is edited
+type RoomUpdated struct {
+	Meta
+	Before models.Room
+	After  models.Room
+}
+
+// RoomDeleted is published when a room is moved to the trash
+type RoomDeleted struct {
+	Meta
+	Room models.Room
+}
+
+// RoomRestored is published when a room is taken out of the trash
+type RoomRestored struct {
+	Meta
+	RoomID int
+	// When it had been moved to the trash
+	DeletedAt time.Time
+}
+
+// RoomBlocked is published when a room is blocked for a night from the calendar
+type RoomBlocked struct {
+	Meta
+	RoomID int
+	Date   time.Time
+}
+
+// RoomUnblocked is published when a block is taken off a room
+type RoomUnblocked struct {
+	Meta
+	RoomID int
+	Date   time.Time
+}
+
+func (ReservationCreated) Name() string       { return "reservation.created" }
+func (ReservationUpdated) Name() string       { return "reservation.updated" }
+func (ReservationStatusChanged) Name() string { return "reservation.status_changed" }
+func (ReservationDeleted) Name() string       { return "reservation.deleted" }
+func (ReservationRestored) Name() string      { return "reservation.restored" }
+func (GuestsMessaged) Name() string           { return "guests.messaged" }
+func (AvailabilitySearched) Name() string     { return "availability.searched" }
+func (RoomCreated) Name() string              { return "room.created" }
+func (RoomUpdated) Name() string              { return "room.updated" }
+func (RoomDeleted) Name() string              { return "room.deleted" }
+func (RoomRestored) Name() string             { return "room.restored" }
+func (RoomBlocked) Name() string              { return "room.blocked" }
+func (RoomUnblocked) Name() string            { return "room.unblocked" }
@@ -128,3 +128,48 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_ReservationRules(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("first_name", "John")
+	postedValues.Add("last_name", "Smith")
+	postedValues.Add("email", "john@here.com")
+	postedValues.Add("phone", "555")
+	form := New(postedValues)
+
+	form.ReservationRules()
+	if !form.Valid() {
+		t.Error("got invalid when all the reservation details are there")
+	}
+
+	postedValues.Set("last_name", "Sm")
+	postedValues.Set("email", "john")
+	form = New(postedValues)
+
+	form.ReservationRules()
+	if form.Errors.Get("last_name") == "" || form.Errors.Get("email") == "" {
+		t.Error("expected a short last name and a bad email to fail")
+	}
+}
+
+func TestForm_RoomRules(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("room_name", "Sea View Room")
+	postedValues.Add("price", "120")
+	postedValues.Add("image_src", "sea.png")
+	postedValues.Add("description", "A room by the sea")
+	form := New(postedValues)
+
+	form.RoomRules()
+	if !form.Valid() {
+		t.Error("got invalid when all the room details are there")
+	}
+
+	postedValues.Del("price")
+	form = New(postedValues)
+
+	form.RoomRules()
+	if form.Errors.Get("price") == "" {
+		t.Error("expected a missing price to fail")
+	}
+}
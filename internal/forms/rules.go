@@ -0,0 +1,18 @@
+package forms
+
+// The rules for each kind of record, shared by the site, the admin, the API and imports so they can't drift apart
+
+// ReservationRules checks the guest details every reservation needs
+func (f *Form) ReservationRules() {
+	f.Required("first_name", "last_name", "email", "phone")
+	f.MinLength("first_name", 3, 30)
+	f.MinLength("last_name", 3, 30)
+	f.IsEmail("email")
+}
+
+// RoomRules checks the details every room needs
+func (f *Form) RoomRules() {
+	f.Required("room_name", "price", "image_src", "description")
+	f.MinLength("room_name", 5, 30)
+	f.MinLength("description", 5, 20000)
+}
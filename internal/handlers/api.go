@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/api"
+	"github.com/atuprosper/booking-project/internal/booking"
+	"github.com/atuprosper/booking-project/internal/forms"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/openapi"
+	"github.com/go-chi/chi/v5"
+)
+
+// The largest request body the API reads
+const maxAPIBody = 1 << 20
+
+// Errors every endpoint can send
+var apiCommonErrors = []openapi.Response{
+	{Status: http.StatusInternalServerError, Body: api.ErrorResponse{}},
+}
+
+// Errors every endpoint that needs an API key can send
+var apiAuthErrors = []openapi.Response{
+	{Status: http.StatusUnauthorized, Description: "The API key is missing, unknown or revoked", Body: api.ErrorResponse{}},
+	{Status: http.StatusForbidden, Description: "The API key's scope doesn't allow this", Body: api.ErrorResponse{}},
+	{Status: http.StatusTooManyRequests, Description: "The API key is over its rate limit", Body: api.ErrorResponse{}},
+}
+
+var apiIDParameter = openapi.Parameter{Name: "id", In: "path", Type: "integer"}
+
+// apiOperations describes every endpoint of /api/v1, and is what the OpenAPI document is generated from
+var apiOperations = []openapi.Operation{
+	{
+		Method:    http.MethodGet,
+		Path:      "/rooms",
+		Summary:   "List the rooms",
+		Scope:     string(models.ScopeReadOnly),
+		Tag:       "rooms",
+		Responses: []openapi.Response{{Status: http.StatusOK, Body: api.RoomList{}}},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/rooms/{id}",
+		Summary:    "Get a room",
+		Scope:      string(models.ScopeReadOnly),
+		Tag:        "rooms",
+		Parameters: []openapi.Parameter{apiIDParameter},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Body: api.RoomResponse{}},
+			{Status: http.StatusNotFound, Body: api.ErrorResponse{}},
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/availability",
+		Summary: "List the rooms free for a whole stay",
+		Scope:   string(models.ScopeReadOnly),
+		Tag:     "rooms",
+		Parameters: []openapi.Parameter{
+			{Name: "start", In: "query", Required: true, Type: "string", Format: "date", Description: "Arrival date"},
+			{Name: "end", In: "query", Required: true, Type: "string", Format: "date", Description: "Departure date"},
+			{Name: "room_id", In: "query", Type: "integer", Description: "Only check this room"},
+		},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Body: api.AvailabilityResponse{}},
+			{Status: http.StatusNotFound, Description: "The room doesn't exist", Body: api.ErrorResponse{}},
+			{Status: http.StatusUnprocessableEntity, Body: api.ErrorResponse{}},
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/reservations",
+		Summary: "Make a reservation",
+		Scope:   string(models.ScopeBooking),
+		Tag:     "reservations",
+		Body:    api.NewReservation{},
+		Responses: []openapi.Response{
+			{Status: http.StatusCreated, Body: api.ReservationResponse{}},
+			{Status: http.StatusBadRequest, Description: "The body isn't a reservation", Body: api.ErrorResponse{}},
+			{Status: http.StatusConflict, Description: "The room is already booked for some of the dates", Body: api.ErrorResponse{}},
+			{Status: http.StatusUnprocessableEntity, Body: api.ErrorResponse{}},
+		},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/reservations/{id}",
+		Summary:    "Get a reservation",
+		Scope:      string(models.ScopeReadOnly),
+		Tag:        "reservations",
+		Parameters: []openapi.Parameter{apiIDParameter},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Body: api.ReservationResponse{}},
+			{Status: http.StatusNotFound, Body: api.ErrorResponse{}},
+		},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/reservations/{id}/cancel",
+		Summary:    "Cancel a reservation",
+		Scope:      string(models.ScopeBooking),
+		Tag:        "reservations",
+		Parameters: []openapi.Parameter{apiIDParameter},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Body: api.ReservationResponse{}},
+			{Status: http.StatusNotFound, Body: api.ErrorResponse{}},
+			{Status: http.StatusConflict, Description: "The reservation can no longer be cancelled", Body: api.ErrorResponse{}},
+		},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/openapi.json",
+		Summary:   "This document",
+		Responses: []openapi.Response{{Status: http.StatusOK}},
+	},
+}
+
+// APIAuth returns middleware that only lets through requests made with an API key allowed scope,
+// counting each one against the key's rate limit
+func (m *Repository) APIAuth(scope models.APIScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := m.apiKey(w, r)
+			if !ok {
+				return
+			}
+
+			if !key.Scope.Allows(scope) {
+				apiError(w, http.StatusForbidden, api.CodeForbidden, fmt.Sprintf("This needs a key with the %s scope", scope), nil)
+				return
+			}
+
+			allowed, remaining, reset := m.limiter.Allow(key.ID, key.RateLimit)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+			if !allowed {
+				wait := int(time.Until(reset).Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(wait))
+				apiError(w, http.StatusTooManyRequests, api.CodeRateLimited, fmt.Sprintf("This key may make %d requests a minute", key.RateLimit), nil)
+				return
+			}
+
+			// Recording every request would be a write per call, so last used is only kept to the minute
+			if time.Since(key.LastUsedAt) > time.Minute {
+				err := m.DB.TouchAPIKey(r.Context(), key.ID, time.Now())
+				if err != nil {
+					m.App.ErrorLog.Println(err)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKey finds the key the request is made with, sending an unauthorized error if there isn't a usable one
+func (m *Repository) apiKey(w http.ResponseWriter, r *http.Request) (models.APIKey, bool) {
+	unauthorized := func(message string) (models.APIKey, bool) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		apiError(w, http.StatusUnauthorized, api.CodeUnauthorized, message, nil)
+		return models.APIKey{}, false
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return unauthorized("Send an API key as Authorization: Bearer <key>")
+	}
+	secret := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	prefix, err := api.KeyPrefix(secret)
+	if err != nil {
+		return unauthorized("The API key is not valid")
+	}
+
+	key, err := m.DB.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return unauthorized("The API key is not valid")
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return models.APIKey{}, false
+	}
+
+	if !api.CheckKey(secret, key.Hash) {
+		return unauthorized("The API key is not valid")
+	}
+
+	if key.Revoked() {
+		return unauthorized("The API key has been revoked")
+	}
+
+	return key, true
+}
+
+// Handles the openapi.json route, describing the API
+func (m *Repository) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	operations := make([]openapi.Operation, len(apiOperations))
+	for i, op := range apiOperations {
+		op.Responses = append(append([]openapi.Response{}, op.Responses...), apiCommonErrors...)
+		if op.Scope != "" {
+			op.Responses = append(op.Responses, apiAuthErrors...)
+		}
+		operations[i] = op
+	}
+
+	writeJSON(w, http.StatusOK, openapi.Document("Booking API", api.Version, "/api/v1", operations))
+}
+
+// Handles listing the rooms
+func (m *Repository) APIListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.RoomList{Data: api.FromRooms(rooms)})
+}
+
+// Handles getting one room
+func (m *Repository) APIGetRoom(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.apiRoom(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.RoomResponse{Data: api.FromRoom(room)})
+}
+
+// Handles searching for the rooms free over a date range, or checking a single room
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start", "end")
+	start, end := apiDateRange(form, "start", "end")
+
+	if !form.Valid() {
+		apiValidationError(w, form)
+		return
+	}
+
+	var roomID int
+	if value := r.URL.Query().Get("room_id"); value != "" {
+		var err error
+		roomID, err = strconv.Atoi(value)
+		if err != nil {
+			apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such room", nil)
+			return
+		}
+	}
+
+	rooms, err := m.Booking.SearchAvailability(r.Context(), start, end, roomID)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		apiError(w, http.StatusUnprocessableEntity, api.CodeValidation, "The request has invalid fields", invalid.Fields)
+		return
+	} else if errors.Is(err, booking.ErrNotFound) {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such room", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.AvailabilityResponse{Data: api.Availability{
+		StartDate: start.Format(api.DateLayout),
+		EndDate:   end.Format(api.DateLayout),
+		Rooms:     api.FromRooms(rooms),
+	}})
+}
+
+// Handles making a reservation. It is checked with the same rules as the booking form, then booked and confirmed to the guest the same way
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var body api.NewReservation
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&body)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, api.CodeBadRequest, "The body must be a JSON reservation: "+err.Error(), nil)
+		return
+	}
+
+	form := forms.New(body.Values())
+	start, end := apiDateRange(form, "start_date", "end_date")
+
+	if !form.Valid() {
+		apiValidationError(w, form)
+		return
+	}
+
+	reservation, err := m.Booking.CreateReservation(r.Context(), models.Reservation{
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		Email:     body.Email,
+		Phone:     body.Phone,
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    body.RoomID,
+	})
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		apiError(w, http.StatusUnprocessableEntity, api.CodeValidation, "The request has invalid fields", invalid.Fields)
+		return
+	} else if errors.Is(err, booking.ErrUnavailable) {
+		apiError(w, http.StatusConflict, api.CodeConflict, "The room is already booked for some of these dates", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservation.ID))
+	writeJSON(w, http.StatusCreated, api.ReservationResponse{Data: api.FromReservation(reservation)})
+}
+
+// Handles getting one reservation
+func (m *Repository) APIGetReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.apiReservation(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.ReservationResponse{Data: api.FromReservation(reservation)})
+}
+
+// Handles cancelling a reservation, which the lifecycle only allows before the guest checks in
+func (m *Repository) APICancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such reservation", nil)
+		return
+	}
+
+	reservation, err := m.Booking.CancelReservation(r.Context(), id)
+	var refused *booking.TransitionError
+	if errors.As(err, &refused) {
+		apiError(w, http.StatusConflict, api.CodeConflict, fmt.Sprintf("A %s reservation can't be cancelled", refused.From.Label()), nil)
+		return
+	} else if errors.Is(err, booking.ErrNotFound) {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such reservation", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.ReservationResponse{Data: api.FromReservation(reservation)})
+}
+
+// Handles paths under /api/v1 that don't exist
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such endpoint", nil)
+}
+
+// Handles requests to an endpoint with a method it doesn't support
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	apiError(w, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed, r.Method+" is not supported here", nil)
+}
+
+// apiRoom looks up the room with the id in value, sending a not found error if there is none
+func (m *Repository) apiRoom(w http.ResponseWriter, r *http.Request, value string) (models.Room, bool) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such room", nil)
+		return models.Room{}, false
+	}
+
+	room, err := m.Booking.GetRoom(r.Context(), id)
+	if errors.Is(err, booking.ErrNotFound) {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such room", nil)
+		return models.Room{}, false
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return models.Room{}, false
+	}
+
+	return room, true
+}
+
+// apiReservation looks up the reservation with the id in value, sending a not found error if there is none
+func (m *Repository) apiReservation(w http.ResponseWriter, r *http.Request, value string) (models.Reservation, bool) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such reservation", nil)
+		return models.Reservation{}, false
+	}
+
+	reservation, err := m.Booking.GetReservation(r.Context(), id)
+	if errors.Is(err, booking.ErrNotFound) {
+		apiError(w, http.StatusNotFound, api.CodeNotFound, "There is no such reservation", nil)
+		return models.Reservation{}, false
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return models.Reservation{}, false
+	}
+
+	return reservation, true
+}
+
+// apiDateRange parses the start and end fields of form, adding an error to the form if they aren't dates.
+// Whether they make a stay is checked by the booking service
+func apiDateRange(form *forms.Form, startField, endField string) (time.Time, time.Time) {
+	start, startErr := time.Parse(api.DateLayout, form.Get(startField))
+	if startErr != nil && form.HasField(startField) {
+		form.Errors.Add(startField, "Must be a date like "+api.DateLayout)
+	}
+
+	end, endErr := time.Parse(api.DateLayout, form.Get(endField))
+	if endErr != nil && form.HasField(endField) {
+		form.Errors.Add(endField, "Must be a date like "+api.DateLayout)
+	}
+
+	return start, end
+}
+
+// apiValidationError sends the errors of an invalid form
+func apiValidationError(w http.ResponseWriter, form *forms.Form) {
+	apiError(w, http.StatusUnprocessableEntity, api.CodeValidation, "The request has invalid fields", map[string][]string(form.Errors))
+}
+
+// apiServerError logs err and sends an internal error, keeping the details from the client
+func (m *Repository) apiServerError(w http.ResponseWriter, err error) {
+	m.App.ErrorLog.Println(err)
+	apiError(w, http.StatusInternalServerError, api.CodeInternal, "Something went wrong on our side", nil)
+}
+
+// apiError sends an error in the envelope every API error uses
+func apiError(w http.ResponseWriter, status int, code, message string, fields map[string][]string) {
+	writeJSON(w, status, api.ErrorResponse{Error: api.Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	}})
+}
+
+// writeJSON sends v as the JSON body of a response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
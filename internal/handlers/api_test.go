@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atuprosper/booking-project/internal/api"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiRoutes mirrors the /api/v1 routes of the web server
+func apiRoutes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(Repo.APINotFound)
+		mux.MethodNotAllowed(Repo.APIMethodNotAllowed)
+
+		mux.Get("/openapi.json", Repo.APIOpenAPI)
+
+		readOnly := mux.With(Repo.APIAuth(models.ScopeReadOnly))
+		readOnly.Get("/rooms", Repo.APIListRooms)
+		readOnly.Get("/rooms/{id}", Repo.APIGetRoom)
+		readOnly.Get("/availability", Repo.APIAvailability)
+		readOnly.Get("/reservations/{id}", Repo.APIGetReservation)
+
+		booking := mux.With(Repo.APIAuth(models.ScopeBooking))
+		booking.Post("/reservations", Repo.APICreateReservation)
+		booking.Post("/reservations/{id}/cancel", Repo.APICancelReservation)
+	})
+
+	return mux
+}
+
+var apiTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+	// The error code sent back, empty when the request should succeed
+	expectedCode string
+	// A field expected to be reported invalid
+	expectedField string
+}{
+	{"list-rooms", "GET", "/api/v1/rooms", "", http.StatusOK, "", ""},
+	{"get-room", "GET", "/api/v1/rooms/1", "", http.StatusOK, "", ""},
+	{"get-missing-room", "GET", "/api/v1/rooms/3", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"get-room-bad-id", "GET", "/api/v1/rooms/fish", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"availability", "GET", "/api/v1/availability?start=2040-01-01&end=2040-01-03", "", http.StatusOK, "", ""},
+	{"availability-one-room", "GET", "/api/v1/availability?start=2040-01-01&end=2040-01-03&room_id=1", "", http.StatusOK, "", ""},
+	{"availability-missing-room", "GET", "/api/v1/availability?start=2040-01-01&end=2040-01-03&room_id=9", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"availability-no-dates", "GET", "/api/v1/availability", "", http.StatusUnprocessableEntity, api.CodeValidation, "start"},
+	{"availability-backwards", "GET", "/api/v1/availability?start=2040-01-03&end=2040-01-01", "", http.StatusUnprocessableEntity, api.CodeValidation, "end"},
+	{"availability-query-fails", "GET", "/api/v1/availability?start=2060-01-01&end=2060-01-03&room_id=1", "", http.StatusInternalServerError, api.CodeInternal, ""},
+	{
+		"create-reservation", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "2040-01-01", "end_date": "2040-01-03"}`,
+		http.StatusCreated, "", "",
+	},
+	{
+		"create-reservation-booked", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03"}`,
+		http.StatusConflict, api.CodeConflict, "",
+	},
+	{
+		"create-reservation-bad-email", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john", "phone": "555", "room_id": 1, "start_date": "2040-01-01", "end_date": "2040-01-03"}`,
+		http.StatusUnprocessableEntity, api.CodeValidation, "email",
+	},
+	{
+		"create-reservation-missing-room", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 9, "start_date": "2040-01-01", "end_date": "2040-01-03"}`,
+		http.StatusUnprocessableEntity, api.CodeValidation, "room_id",
+	},
+	{
+		"create-reservation-bad-date", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "01/01/2040", "end_date": "2040-01-03"}`,
+		http.StatusUnprocessableEntity, api.CodeValidation, "start_date",
+	},
+	{"create-reservation-unknown-field", "POST", "/api/v1/reservations", `{"name": "John"}`, http.StatusBadRequest, api.CodeBadRequest, ""},
+	{"create-reservation-not-json", "POST", "/api/v1/reservations", "first_name=John", http.StatusBadRequest, api.CodeBadRequest, ""},
+	{"get-reservation", "GET", "/api/v1/reservations/1", "", http.StatusOK, "", ""},
+	{"get-missing-reservation", "GET", "/api/v1/reservations/100", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"cancel-reservation", "POST", "/api/v1/reservations/1/cancel", "", http.StatusOK, "", ""},
+	{"cancel-missing-reservation", "POST", "/api/v1/reservations/100/cancel", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"unknown-endpoint", "GET", "/api/v1/guests", "", http.StatusNotFound, api.CodeNotFound, ""},
+	{"wrong-method", "DELETE", "/api/v1/rooms", "", http.StatusMethodNotAllowed, api.CodeMethodNotAllowed, ""},
+}
+
+func TestAPI(t *testing.T) {
+	useTestRepo(t)
+
+	routes := apiRoutes()
+
+	for _, e := range apiTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer bk_bookkey1_secret")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d, but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+		}
+
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected a JSON response, but got %s", e.name, rr.Header().Get("Content-Type"))
+		}
+
+		if e.expectedCode == "" {
+			continue
+		}
+
+		var response api.ErrorResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Errorf("%s: expected an error envelope, but got %s", e.name, rr.Body.String())
+			continue
+		}
+
+		if response.Error.Code != e.expectedCode || response.Error.Status != e.expectedStatusCode {
+			t.Errorf("%s: expected error %s, but got %+v", e.name, e.expectedCode, response.Error)
+		}
+
+		if e.expectedField != "" && len(response.Error.Fields[e.expectedField]) == 0 {
+			t.Errorf("%s: expected %s to be reported invalid, but got %v", e.name, e.expectedField, response.Error.Fields)
+		}
+	}
+}
+
+func TestAPICreateReservation(t *testing.T) {
+	useTestRepo(t)
+
+	body := `{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "2040-01-01", "end_date": "2040-01-03"}`
+
+	req, _ := http.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer bk_bookkey1_secret")
+	rr := httptest.NewRecorder()
+	apiRoutes().ServeHTTP(rr, req)
+
+	var response api.ReservationResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reservation := response.Data
+	if reservation.ID != 1 || reservation.StartDate != "2040-01-01" || reservation.Status != "pending" {
+		t.Errorf("unexpected reservation %+v", reservation)
+	}
+
+	if rr.Header().Get("Location") != "/api/v1/reservations/1" {
+		t.Errorf("expected the location of the new reservation, but got %q", rr.Header().Get("Location"))
+	}
+}
+
+func TestAPIOpenAPI(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	apiRoutes().ServeHTTP(rr, req)
+
+	var document struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas         map[string]interface{} `json:"schemas"`
+			SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+		} `json:"components"`
+	}
+
+	err := json.Unmarshal(rr.Body.Bytes(), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every documented operation must be routed, and answer with something other than the not found envelope
+	routes := apiRoutes()
+	for _, op := range apiOperations {
+		operation, ok := document.Paths[op.Path][strings.ToLower(op.Method)]
+		if !ok {
+			t.Errorf("expected %s %s in the document", op.Method, op.Path)
+		}
+
+		if _, secured := operation["security"]; secured != (op.Scope != "") {
+			t.Errorf("expected %s %s to need a key only if it has a scope", op.Method, op.Path)
+		}
+
+		path := strings.ReplaceAll(op.Path, "{id}", "1")
+		req, _ := http.NewRequest(op.Method, "/api/v1"+path, strings.NewReader("{}"))
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if strings.Contains(rr.Body.String(), "There is no such endpoint") || rr.Code == http.StatusMethodNotAllowed {
+			t.Errorf("expected %s %s to be routed, but got %d", op.Method, op.Path, rr.Code)
+		}
+	}
+
+	if len(document.Components.SecuritySchemes) == 0 {
+		t.Error("expected the API key scheme in the document")
+	}
+
+	for _, schema := range []string{"Room", "Reservation", "NewReservation", "ErrorResponse"} {
+		if _, ok := document.Components.Schemas[schema]; !ok {
+			t.Errorf("expected the %s schema in the document", schema)
+		}
+	}
+}
+
+var apiAuthTests = []struct {
+	name               string
+	method             string
+	url                string
+	authorization      string
+	expectedStatusCode int
+	expectedCode       string
+}{
+	{"no-key", "GET", "/api/v1/rooms", "", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"not-bearer", "GET", "/api/v1/rooms", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"malformed-key", "GET", "/api/v1/rooms", "Bearer secret", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"unknown-key", "GET", "/api/v1/rooms", "Bearer bk_unknown1_secret", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"wrong-secret", "GET", "/api/v1/rooms", "Bearer bk_readkey1_guess", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"revoked-key", "GET", "/api/v1/rooms", "Bearer bk_revoked1_secret", http.StatusUnauthorized, api.CodeUnauthorized},
+	{"lookup-fails", "GET", "/api/v1/rooms", "Bearer bk_failkey1_secret", http.StatusInternalServerError, api.CodeInternal},
+	{"read-only-reads", "GET", "/api/v1/rooms", "Bearer bk_readkey1_secret", http.StatusOK, ""},
+	{"read-only-books", "POST", "/api/v1/reservations/1/cancel", "Bearer bk_readkey1_secret", http.StatusForbidden, api.CodeForbidden},
+	{"booking-books", "POST", "/api/v1/reservations/1/cancel", "Bearer bk_bookkey1_secret", http.StatusOK, ""},
+	{"admin-books", "POST", "/api/v1/reservations/1/cancel", "Bearer bk_adminkey_secret", http.StatusOK, ""},
+	{"document-is-public", "GET", "/api/v1/openapi.json", "", http.StatusOK, ""},
+}
+
+func TestAPIAuth(t *testing.T) {
+	useTestRepo(t)
+
+	routes := apiRoutes()
+
+	for _, e := range apiAuthTests {
+		req, _ := http.NewRequest(e.method, e.url, nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d, but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+		}
+
+		if e.expectedStatusCode == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", e.name)
+		}
+
+		if e.expectedCode == "" {
+			continue
+		}
+
+		var response api.ErrorResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil || response.Error.Code != e.expectedCode {
+			t.Errorf("%s: expected error %s, but got %s", e.name, e.expectedCode, rr.Body.String())
+		}
+	}
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	useTestRepo(t)
+
+	Repo.limiter = api.NewRateLimiter()
+	routes := apiRoutes()
+
+	// The limited key may make 2 requests a minute
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("GET", "/api/v1/rooms", nil)
+		req.Header.Set("Authorization", "Bearer bk_limited1_secret")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != expected {
+			t.Errorf("request %d: expected status %d, but got %d", i+1, expected, rr.Code)
+		}
+
+		if rr.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("request %d: expected a limit of 2, but got %q", i+1, rr.Header().Get("X-RateLimit-Limit"))
+		}
+
+		if expected == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: expected a Retry-After header", i+1)
+		}
+	}
+
+	// Other keys have their own count
+	req, _ := http.NewRequest("GET", "/api/v1/rooms", nil)
+	req.Header.Set("Authorization", "Bearer bk_readkey1_secret")
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected another key to be unaffected, but got %d", rr.Code)
+	}
+}
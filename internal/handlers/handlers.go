@@ -1,22 +1,34 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/atuprosper/booking-project/internal/api"
+	"github.com/atuprosper/booking-project/internal/audit"
+	"github.com/atuprosper/booking-project/internal/booking"
 	"github.com/atuprosper/booking-project/internal/config"
 	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/events"
 	"github.com/atuprosper/booking-project/internal/forms"
 	"github.com/atuprosper/booking-project/internal/helpers"
+	"github.com/atuprosper/booking-project/internal/importer"
 	"github.com/atuprosper/booking-project/internal/models"
 	"github.com/atuprosper/booking-project/internal/render"
+	"github.com/atuprosper/booking-project/internal/reports"
 	"github.com/atuprosper/booking-project/internal/repository"
 	"github.com/atuprosper/booking-project/internal/repository/dbrepo"
+	"github.com/atuprosper/booking-project/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -26,22 +38,56 @@ var Repo *Repository
 type Repository struct {
 	App *config.AppConfig
 	DB  repository.DatabaseRepo
+	// Announces changes to reservations and rooms to the mail, audit and webhook subscribers
+	Events *events.Bus
+	// Makes the changes to reservations and rooms, so the site, admin and API follow the same rules
+	Booking *booking.Service
+	// Writes the mail to guests and the admin, from the hotel and addresses in App
+	Mail booking.Mailer
+	// The connection pool DB is on, pinged to check the database is up. Nil when the data is in memory
+	pool *driver.DB
+	// Counts the API requests made with each key
+	limiter *api.RateLimiter
 }
 
-// This function creates a new repository
+// This function creates a new repository, on SQLite or Postgres depending on what the pool is connected to
 func NewRepo(appConfig *config.AppConfig, dbConnectionPool *driver.DB) *Repository {
-	return &Repository{
-		App: appConfig,
-		DB:  dbrepo.NewPostgresRepo(dbConnectionPool.SQL, appConfig),
+	var repo *Repository
+	if dbConnectionPool.Driver == driver.SQLite {
+		repo = newRepo(appConfig, dbrepo.NewSQLiteRepo(dbConnectionPool.SQL, appConfig))
+	} else {
+		repo = newRepo(appConfig, dbrepo.NewPostgresRepo(dbConnectionPool.SQL, appConfig))
 	}
+	repo.pool = dbConnectionPool
+	return repo
 }
 
 // This function creates a new repository
 func NewTestRepo(appConfig *config.AppConfig) *Repository {
-	return &Repository{
-		App: appConfig,
-		DB:  dbrepo.NewTestRepo(appConfig),
-	}
+	return newRepo(appConfig, dbrepo.NewTestRepo(appConfig))
+}
+
+// NewMemoryRepo creates a repository that keeps its data in memory, for the demo and for tests that need bookings to stick
+func NewMemoryRepo(appConfig *config.AppConfig) *Repository {
+	return newRepo(appConfig, dbrepo.NewMemoryRepo(appConfig))
+}
+
+// newRepo creates a repository on db, with the booking service and event subscribers wired up
+func newRepo(appConfig *config.AppConfig, db repository.DatabaseRepo) *Repository {
+	repo := &Repository{
+		App:    appConfig,
+		DB:     db,
+		Events: events.NewBus(appConfig.ErrorLog),
+		Mail: booking.Mailer{
+			Hotel: appConfig.HotelName,
+			From:  appConfig.MailFrom,
+			Admin: appConfig.AdminEmail,
+		},
+		limiter: api.NewRateLimiter(),
+	}
+	repo.Booking = booking.NewService(repo.DB, repo.Events, appConfig.ErrorLog)
+	repo.subscribe(repo.Events)
+	return repo
 }
 
 // This function NewHandlers, sets the repository for the handlers
@@ -49,9 +95,27 @@ func NewHandlers(r *Repository) {
 	Repo = r
 }
 
+// recordAudit stores who made an admin change, what changed and when, for changes to the admin's own settings.
+// Changes to reservations and rooms are audited from their events. A failure to write the audit log is logged
+// but does not fail the request
+func (m *Repository) recordAudit(r *http.Request, action, entity string, entityID int, before, after interface{}) {
+	entry := models.AuditLog{
+		UserID:   m.App.Session.GetInt(r.Context(), "user_id"),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Changes:  audit.Diff(before, after),
+	}
+
+	err := m.DB.InsertAuditLog(r.Context(), entry)
+	if err != nil {
+		m.App.ErrorLog.Println("Cannot write audit log:", err)
+	}
+}
+
 // This function handles the Home page and renders the template
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	rooms, err := m.DB.AllRooms()
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -83,7 +147,7 @@ func (m *Repository) SingleRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(id)
+	room, err := m.DB.GetRoomByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -117,8 +181,13 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
-	if err != nil {
+	rooms, err := m.Booking.SearchAvailability(r.Context(), startDate, endDate, 0)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		m.App.Session.Put(r.Context(), "error", "The departure date must be after the arrival date")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
@@ -186,7 +255,7 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	roomId, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomId)
+	rooms, err := m.Booking.SearchAvailability(r.Context(), startDate, endDate, roomId)
 	if err != nil {
 		response := jsonResponse{
 			Ok:      false,
@@ -200,7 +269,7 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := jsonResponse{
-		Ok:        available,
+		Ok:        len(rooms) > 0,
 		Message:   "",
 		StartDate: r.Form.Get("start"),
 		EndDate:   r.Form.Get("end"),
@@ -223,7 +292,7 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(reservationInSession.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), reservationInSession.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't find room")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -272,15 +341,12 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
 
-	form := forms.New(r.PostForm)
-
-	// Form validations
-	form.Required("first_name", "last_name", "email", "phone")
-	form.MinLength("first_name", 3, 30)
-	form.MinLength("last_name", 3, 30)
-	form.IsEmail("email")
+	created, err := m.Booking.CreateReservation(r.Context(), reservation)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		form.Errors = invalid.Fields
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 		m.App.Session.Put(r.Context(), "error", "Invalid form input")
@@ -289,68 +355,18 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 			Data: data,
 		})
 		return
-	}
-
-	newReservationId, err := m.DB.InsertReservation(reservation)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert into database")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	} else if errors.Is(err, booking.ErrUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "The room has just been booked for some of these dates, please search again")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
 		return
-	}
-
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationId,
-		RestrictionID: 1,
-	}
-
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert room restriction!")
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't insert into database")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	// Send email notification to customer
-	htmlBody := fmt.Sprintf(`
-	<strong>Thank you for making a reservation</strong><br />
-	<p>Dear %s, </p>
-	<p>This is to confirm your reservation from %s, to %s. </p>
-	<p>We hope to see you soon</p>
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-
-	message := models.MailData{
-		To:       reservation.Email,
-		From:     "prosperdevstack@gmail.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlBody,
-		Template: "basic.html",
-	}
-
-	m.App.MailChannel <- message
-
-	// Send email notification to admin
-	htmlBody = fmt.Sprintf(`
-	<strong>Hello, Admin</strong><br />
-	<p>There is a new reservation from %s %s, </p>
-	<p>Reservation Dates: %s, to %s. </p>
-	<p>Room: %s. </p>
-	<p>Customer Email: %s</p>
-	`, reservation.FirstName, reservation.LastName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"), reservation.Room.RoomName, reservation.Email)
-
-	message = models.MailData{
-		To:      "atu.prosper@gmail.com",
-		From:    "prosperdevstack@gmail.com",
-		Subject: "New Reservation",
-		Content: htmlBody,
-	}
-
-	m.App.MailChannel <- message
-	// End of emails
-
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	m.App.Session.Put(r.Context(), "reservation", created)
 
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
@@ -397,7 +413,7 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -486,7 +502,7 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
 		log.Println(err)
 
@@ -510,43 +526,150 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// The number of days ahead the dashboard reports pickup for
+var pickupHorizons = []int{30, 60, 90}
+
 // Handles the admin dashborad
 func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{})
-}
+	layout := "2006-01-02"
+
+	// Default to the last 30 nights
+	end := today()
+	start := end.AddDate(0, 0, -30)
+
+	if r.URL.Query().Get("start") != "" || r.URL.Query().Get("end") != "" {
+		startDate, startErr := time.Parse(layout, r.URL.Query().Get("start"))
+		endDate, endErr := time.Parse(layout, r.URL.Query().Get("end"))
+		if startErr != nil || endErr != nil || !endDate.After(startDate) {
+			m.App.Session.Put(r.Context(), "error", "Choose a start date before the end date")
+		} else {
+			start, end = startDate, endDate
+		}
+	}
 
-// Handles the new-reservations route
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+	stats, err := m.DB.OccupancyForRange(r.Context(), start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// Bookings made on the end date count too, so the window runs to midnight after it
+	bookedEnd := end.AddDate(0, 0, 1)
+
+	created, err := m.DB.CountReservationsCreatedBetween(r.Context(), start, bookedEnd)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	pending, err := m.DB.CountReservationsByStatus(r.Context(), models.StatusPending)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	var pickup []models.Pickup
+	for _, days := range pickupHorizons {
+		pickedUp, err := m.DB.PickupForRange(r.Context(), today(), today().AddDate(0, 0, days), start, bookedEnd)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		pickup = append(pickup, models.Pickup{Days: days, Stats: pickedUp})
+	}
+
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["stats"] = stats
+	data["pickup"] = pickup
 
-	render.Template(w, r, "admin-new-reservations.page.html", &models.TemplateData{
-		Data: data,
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format(layout)
+	stringMap["end"] = end.Format(layout)
+
+	intMap := make(map[string]int)
+	intMap["created"] = created
+	intMap["pending"] = pending
+
+	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
-// Handles the all-reservations route
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+// reservationFilter reads a reservation list filter from the query string. Values that don't parse are ignored
+func reservationFilter(r *http.Request) models.ReservationFilter {
+	query := r.URL.Query()
+
+	filter := models.ReservationFilter{
+		Search:  strings.TrimSpace(query.Get("q")),
+		Desc:    query.Get("dir") == "desc",
+		Page:    1,
+		PerPage: models.DefaultPerPage,
+	}
+
+	filter.Start, _ = time.Parse("2006-01-02", query.Get("start"))
+	filter.End, _ = time.Parse("2006-01-02", query.Get("end"))
+	filter.RoomID, _ = strconv.Atoi(query.Get("room"))
+	filter.Status, _ = models.ParseReservationStatus(query.Get("status"))
+
+	for _, sort := range models.ReservationSorts {
+		if query.Get("sort") == sort {
+			filter.Sort = sort
+		}
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 1 {
+		filter.Page = page
+	}
+
+	return filter
+}
+
+// renderReservationList renders one page of the reservations matching filter with the given template.
+// src is the list the reservation pages link back to
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, tmpl, src string, filter models.ReservationFilter) {
+	page, err := m.DB.SearchReservations(r.Context(), filter)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["page"] = page
+	data["rooms"] = rooms
+	data["statuses"] = models.ReservationStatuses
+	data["sorts"] = models.ReservationSorts
 
-	render.Template(w, r, "admin-all-reservations.page.html", &models.TemplateData{
-		Data: data,
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["return"] = r.URL.RequestURI()
+
+	render.Template(w, r, tmpl, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
 	})
 }
 
+// Handles the new-reservations route, which lists the pending reservations
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	filter := reservationFilter(r)
+	filter.Status = models.StatusPending
+
+	m.renderReservationList(w, r, "admin-new-reservations.page.html", "new", filter)
+}
+
+// Handles the all-reservations route
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservationList(w, r, "admin-all-reservations.page.html", "all", reservationFilter(r))
+}
+
 // Handles the single-reservation route
 func (m *Repository) AdminSingleReservation(w http.ResponseWriter, r *http.Request) {
 	urlParams := strings.Split(r.RequestURI, "/")
@@ -565,7 +688,25 @@ func (m *Repository) AdminSingleReservation(w http.ResponseWriter, r *http.Reque
 	stringMap["year"] = year
 	stringMap["month"] = month
 
-	reservation, err := m.DB.GetReservationByID(id)
+	reservation, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	history, err := m.DB.GetAuditLogsForEntity(r.Context(), audit.EntityReservation, id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	notes, err := m.DB.GetNotesForReservation(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	mailLogs, err := m.DB.GetMailLogsForReservation(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -573,6 +714,9 @@ func (m *Repository) AdminSingleReservation(w http.ResponseWriter, r *http.Reque
 
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
+	data["history"] = history
+	data["notes"] = notes
+	data["mail_logs"] = mailLogs
 
 	render.Template(w, r, "admin-single-reservation.page.html", &models.TemplateData{
 		StringMap: stringMap,
@@ -600,24 +744,19 @@ func (m *Repository) PostAdminSingleReservation(w http.ResponseWriter, r *http.R
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
 
-	reservation, err := m.DB.GetReservationByID(id)
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
+	changes := models.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
 	}
 
-	reservation.FirstName = r.Form.Get("first_name")
-	reservation.LastName = r.Form.Get("last_name")
-	reservation.Email = r.Form.Get("email")
-	reservation.Phone = r.Form.Get("phone")
-
-	form := forms.New(r.PostForm)
-	form.Required("first_name", "last_name", "email", "phone")
-	form.MinLength("first_name", 3, 30)
-	form.MinLength("last_name", 3, 30)
-	form.IsEmail("email")
+	reservation, err := m.Booking.UpdateReservation(m.actor(r), id, changes)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		form.Errors = invalid.Fields
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 		m.App.Session.Put(r.Context(), "error", "Invalid inputs")
@@ -628,10 +767,7 @@ func (m *Repository) PostAdminSingleReservation(w http.ResponseWriter, r *http.R
 		})
 
 		return
-	}
-
-	err = m.DB.UpdateReservation(reservation)
-	if err != nil {
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
@@ -648,59 +784,122 @@ func (m *Repository) PostAdminSingleReservation(w http.ResponseWriter, r *http.R
 	}
 }
 
-// Handles the processing of revervation
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+// reservationPage returns the url of a single reservation, keeping the calendar month to go back to
+func reservationPage(src string, id int, year, month string) string {
+	page := fmt.Sprintf("/admin/reservations/%s/%d/show", src, id)
+	if year != "" {
+		page = fmt.Sprintf("%s?y=%s&m=%s", page, year, month)
+	}
+	return page
+}
 
-	reservation, err := m.DB.GetReservationByID(id)
+// Handles adding an internal note to a reservation
+func (m *Repository) PostAdminReservationNote(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	if reservation.Processed == 0 {
-		err = m.DB.UpdateProcessedForReservation(id, 1)
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
-		m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Reservation is now marked as Processed</p>")
-	} else {
-		err = m.DB.UpdateProcessedForReservation(id, 0)
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
-		m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Reservation is now marked as Not Processed</p>")
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	page := reservationPage(chi.URLParam(r, "src"), id, r.Form.Get("year"), r.Form.Get("month"))
+
+	form := forms.New(r.PostForm)
+	form.Required("note")
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "The note can't be empty")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	note := models.ReservationNote{
+		ReservationID: id,
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Note:          strings.TrimSpace(r.Form.Get("note")),
+	}
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	err = m.DB.InsertReservationNote(r.Context(), note)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
 
+	m.App.Session.Put(r.Context(), "flash", "Note Added")
+	http.Redirect(w, r, page, http.StatusSeeOther)
 }
 
-// Handles the deleting of revervation
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+// Handles sending an ad-hoc message to the guest of a reservation
+func (m *Repository) PostAdminReservationMessage(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+	page := reservationPage(chi.URLParam(r, "src"), id, r.Form.Get("year"), r.Form.Get("month"))
+
+	form := forms.New(r.PostForm)
+	form.Required("subject", "message")
 
-	err := m.DB.DeleteReservation(id)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "A message needs a subject and a body")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	// Reservations in the trash aren't messaged
+	reservation, err := m.Booking.GetReservation(r.Context(), id)
+	if errors.Is(err, booking.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.Booking.MessageGuests(m.actor(r), []int{id}, r.Form.Get("subject"), r.Form.Get("message"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("<strong>Successful!!!</strong><br><br> <p>Message sent to %s</p>",
+		template.HTMLEscapeString(reservation.Email)))
+	http.Redirect(w, r, page, http.StatusSeeOther)
+}
+
+// Handles moving a reservation to a new status in its lifecycle
+func (m *Repository) AdminUpdateReservationStatus(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	status, ok := models.ParseReservationStatus(r.Form.Get("status"))
+	if !ok {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = m.Booking.ChangeStatus(m.actor(r), id, status)
+	var refused *booking.TransitionError
+	if errors.As(err, &refused) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be marked as %s", refused.From.Label(), status.Label()))
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("<strong>Successful!!!</strong><br><br> <p>Reservation is now marked as %s</p>", status.Label()))
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Reservation Deleted</p>")
+	year := r.Form.Get("year")
+	month := r.Form.Get("month")
 
 	if year == "" {
 		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
@@ -709,52 +908,352 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-// Handles the reservations-calendar route
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	now := time.Now()
+// today returns the current date at midnight, the form dates are stored in
+func today() time.Time {
+	year, month, day := time.Now().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
 
-	if r.URL.Query().Get("y") != "" {
-		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+// Handles the front desk view of today's arrivals, in-house guests and departures
+func (m *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+	date := today()
 
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	arrivals, err := m.DB.ReservationsArrivingOn(r.Context(), date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
 
-	data := make(map[string]interface{})
-	data["now"] = now
+	inHouse, err := m.DB.ReservationsInHouse(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	// get next and previous months/year
-	nextMonth := now.AddDate(0, 1, 0)
-	previousMonth := now.AddDate(0, -1, 0)
+	departures, err := m.DB.ReservationsDepartingOn(r.Context(), date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["arrivals"] = arrivals
+	data["in_house"] = inHouse
+	data["departures"] = departures
 
 	stringMap := make(map[string]string)
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_year"] = now.Format("2006")
-	stringMap["next_month"] = nextMonth.Format("01")
-	stringMap["next_year"] = nextMonth.Format("2006")
-	stringMap["previous_month"] = previousMonth.Format("01")
-	stringMap["previous_year"] = previousMonth.Format("2006")
+	stringMap["today"] = date.Format("Monday, 02 January 2006")
 
-	// Get the first and last day of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	render.Template(w, r, "admin-today.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+}
 
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+// Handles the end of day report of guests due today or earlier who never arrived
+func (m *Repository) AdminNoShowReport(w http.ResponseWriter, r *http.Request) {
+	date := today()
 
-	rooms, err := m.DB.AllRooms()
+	reservations, err := m.DB.ReservationsNotArrivedBy(r.Context(), date)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	data["rooms"] = rooms
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
 
-	for _, x := range rooms {
-		// get the reservation and block maps
+	stringMap := make(map[string]string)
+	stringMap["today"] = date.Format("Monday, 02 January 2006")
+
+	render.Template(w, r, "admin-no-shows.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// Handles checking a guest in from the front desk. The arrival time defaults to now
+func (m *Repository) AdminCheckIn(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	arrivedAt := time.Now()
+	if arrival := r.Form.Get("arrived_at"); arrival != "" {
+		clock, err := time.Parse("15:04", arrival)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		arrivedAt = time.Date(arrivedAt.Year(), arrivedAt.Month(), arrivedAt.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	}
+
+	reservation, err := m.Booking.CheckIn(m.actor(r), id, booking.Arrival{
+		At:         arrivedAt,
+		IDDocument: strings.TrimSpace(r.Form.Get("id_document")),
+		Notes:      strings.TrimSpace(r.Form.Get("notes")),
+	})
+	var refused *booking.TransitionError
+	if errors.As(err, &refused) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be checked in", refused.From.Label()))
+		http.Redirect(w, r, "/admin/today", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("<strong>Successful!!!</strong><br><br> <p>%s %s checked in</p>",
+		template.HTMLEscapeString(reservation.FirstName), template.HTMLEscapeString(reservation.LastName)))
+	http.Redirect(w, r, "/admin/today", http.StatusSeeOther)
+}
+
+// Handles checking a guest out from the front desk
+func (m *Repository) AdminCheckOut(w http.ResponseWriter, r *http.Request) {
+	m.frontDeskTransition(w, r, models.StatusCheckedOut, "/admin/today", func(ctx context.Context, id int) (models.Reservation, error) {
+		return m.Booking.ChangeStatus(ctx, id, models.StatusCheckedOut)
+	})
+}
+
+// Handles marking a guest who never arrived as a no-show from the end of day report
+func (m *Repository) AdminMarkNoShow(w http.ResponseWriter, r *http.Request) {
+	m.frontDeskTransition(w, r, models.StatusNoShow, "/admin/today/no-shows", m.Booking.MarkNoShow)
+}
+
+// frontDeskTransition moves the reservation in the url to status with change, and redirects back to the front desk
+// page it came from
+func (m *Repository) frontDeskTransition(w http.ResponseWriter, r *http.Request, status models.ReservationStatus, redirect string,
+	change func(ctx context.Context, id int) (models.Reservation, error)) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	reservation, err := change(m.actor(r), id)
+	var refused *booking.TransitionError
+	if errors.As(err, &refused) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be marked as %s", refused.From.Label(), status.Label()))
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("<strong>Successful!!!</strong><br><br> <p>%s %s marked as %s</p>",
+		template.HTMLEscapeString(reservation.FirstName), template.HTMLEscapeString(reservation.LastName), status.Label()))
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// Handles the deleting of revervation
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	_, err = m.Booking.DeleteReservation(m.actor(r), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	year := r.Form.Get("year")
+	month := r.Form.Get("month")
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Reservation moved to trash</p>")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// Handles an action on the reservations ticked in a list: a status change, delete, export or email.
+// Status changes and deletes run in one transaction and report which reservations were skipped
+func (m *Repository) AdminBulkReservations(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// Only send staff back to an admin page, never somewhere a form could point them
+	back := r.Form.Get("return")
+	if !strings.HasPrefix(back, "/admin/") {
+		back = "/admin/all-reservations"
+	}
+
+	var ids []int
+	for _, value := range r.Form["id"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Select at least one reservation")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "status":
+		status, ok := models.ParseReservationStatus(r.Form.Get("status"))
+		if !ok {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		result, err := m.Booking.BulkChangeStatus(m.actor(r), ids, status)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "flash", bulkSummary(result, "marked as "+status.Label()))
+
+	case "delete":
+		result, err := m.Booking.BulkDeleteReservations(m.actor(r), ids)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "flash", bulkSummary(result, "moved to trash"))
+
+	case "export":
+		reservations, err := m.selectedReservations(r, ids)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", reports.ContentType(reports.FormatCSV))
+		w.Header().Set("Content-Disposition", `attachment; filename="selected-reservations.csv"`)
+
+		writer, _ := reports.NewWriter(reports.FormatCSV, w)
+		writer.Write(reports.Header())
+		for _, id := range ids {
+			if reservation, ok := reservations[id]; ok {
+				writer.Write(reports.Row(reservation))
+			}
+		}
+
+		err = writer.Close()
+		if err != nil {
+			m.App.ErrorLog.Println("Cannot write export:", err)
+		}
+		return
+
+	case "email":
+		form := forms.New(r.PostForm)
+		form.Required("subject", "message")
+		if !form.Valid() {
+			m.App.Session.Put(r.Context(), "error", "A message needs a subject and a body")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		result, err := m.Booking.MessageGuests(m.actor(r), ids, r.Form.Get("subject"), r.Form.Get("message"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "flash", bulkSummary(result, "emailed"))
+
+	default:
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// selectedReservations returns the reservations in ids that still exist, keyed by id
+func (m *Repository) selectedReservations(r *http.Request, ids []int) (map[int]models.Reservation, error) {
+	reservations := make(map[int]models.Reservation)
+	for _, id := range ids {
+		reservation, err := m.Booking.GetReservation(r.Context(), id)
+		if errors.Is(err, booking.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		reservations[id] = reservation
+	}
+	return reservations, nil
+}
+
+// bulkSummary describes the result of a bulk action for the flash message, e.g. "3 reservations marked as Confirmed"
+func bulkSummary(result models.BulkResult, done string) string {
+	noun := "reservations"
+	if len(result.Succeeded) == 1 {
+		noun = "reservation"
+	}
+
+	summary := fmt.Sprintf("<strong>%d %s %s</strong>", len(result.Succeeded), noun, done)
+	for _, skip := range result.Skipped {
+		summary += fmt.Sprintf("<br><p>Skipped #%d: %s</p>", skip.ID, template.HTMLEscapeString(skip.Reason))
+	}
+	return summary
+}
+
+// Handles the reservations-calendar route
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
+		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	// get next and previous months/year
+	nextMonth := now.AddDate(0, 1, 0)
+	previousMonth := now.AddDate(0, -1, 0)
+
+	stringMap := make(map[string]string)
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_year"] = now.Format("2006")
+	stringMap["next_month"] = nextMonth.Format("01")
+	stringMap["next_year"] = nextMonth.Format("2006")
+	stringMap["previous_month"] = previousMonth.Format("01")
+	stringMap["previous_year"] = previousMonth.Format("2006")
+
+	// Get the first and last day of the month
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	for _, x := range rooms {
+		// get the reservation, status and block maps
 		reservationMap := make(map[string]int)
+		statusMap := make(map[string]string)
 		blockMap := make(map[string]int)
 
 		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
@@ -763,7 +1262,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		}
 
 		// get all the restrictions for the current room
-		restrictions, err := m.DB.GetRestrictionsForCurrentRoom(x.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionsForCurrentRoom(r.Context(), x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
@@ -774,6 +1273,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 				// it's a reservation
 				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
 					reservationMap[d.Format("2006-01-2")] = y.ReservationID
+					statusMap[d.Format("2006-01-2")] = string(y.Reservation.Status)
 				}
 			} else {
 				// it's a block
@@ -781,6 +1281,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 			}
 		}
 		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("status_map_%d", x.ID)] = statusMap
 		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
 
 		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
@@ -805,7 +1306,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	month, _ := strconv.Atoi(r.Form.Get("month"))
 
 	//Process changes
-	rooms, err := m.DB.AllRooms()
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -826,9 +1327,11 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 				if val > 0 {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
 						// delete the restriction by id
-						err := m.DB.DeleteBlockByID(value)
+						date, _ := time.Parse("2006-01-2", name)
+						err := m.Booking.UnblockRoom(m.actor(r), x.ID, value, date)
 						if err != nil {
 							log.Println(err)
+							continue
 						}
 						m.App.Session.Put(r.Context(), "flash", "Block removed successfully")
 					}
@@ -844,9 +1347,10 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 			roomID, _ := strconv.Atoi(exploded[2])
 			t, _ := time.Parse("2006-01-02", exploded[3])
 			// insert a new block
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			err := m.Booking.BlockRoom(m.actor(r), roomID, t)
 			if err != nil {
 				log.Println(err)
+				continue
 			}
 			m.App.Session.Put(r.Context(), "flash", "Reservation Block Updated")
 		}
@@ -857,7 +1361,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 
 // Handles the all-rooms route
 func (m *Repository) AdminAllRooms(w http.ResponseWriter, r *http.Request) {
-	rooms, err := m.DB.AllRooms()
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -880,7 +1384,7 @@ func (m *Repository) AdminSingleRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(id)
+	room, err := m.DB.GetRoomByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -910,23 +1414,12 @@ func (m *Repository) PostAdminSingleRoom(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(id)
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
-	}
-
-	room.RoomName = r.Form.Get("room_name")
-	room.Price = r.Form.Get("price")
-	room.ImageSource = r.Form.Get("image_src")
-	room.Description = r.Form.Get("description")
-
-	form := forms.New(r.PostForm)
-	form.Required("room_name", "price", "image_src", "description")
-	form.MinLength("room_name", 5, 30)
-	form.MinLength("description", 5, 20000)
+	room, err := m.Booking.UpdateRoom(m.actor(r), id, roomChanges(r))
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		form.Errors = invalid.Fields
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["room"] = room
 		m.App.Session.Put(r.Context(), "error", "Invalid inputs")
@@ -936,10 +1429,7 @@ func (m *Repository) PostAdminSingleRoom(w http.ResponseWriter, r *http.Request)
 		})
 
 		return
-	}
-
-	err = m.DB.UpdateRoom(room)
-	if err != nil {
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
@@ -963,20 +1453,12 @@ func (m *Repository) PostAdminNewRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var room models.Room
+	room, err := m.Booking.CreateRoom(m.actor(r), roomChanges(r))
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		form.Errors = invalid.Fields
 
-	room.RoomName = r.Form.Get("room_name")
-	room.Price = r.Form.Get("price")
-	room.ImageSource = r.Form.Get("image_src")
-	room.Description = r.Form.Get("description")
-
-	// Form validations
-	form := forms.New(r.PostForm)
-	form.Required("room_name", "price", "image_src", "description")
-	form.MinLength("room_name", 5, 30)
-	form.MinLength("description", 5, 20000)
-
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["room"] = room
 		m.App.Session.Put(r.Context(), "error", "Invalid form input")
@@ -985,14 +1467,8 @@ func (m *Repository) PostAdminNewRoom(w http.ResponseWriter, r *http.Request) {
 			Data: data,
 		})
 		return
-	}
-
-	// Insert new room here
-	err = m.DB.InsertRoom(room)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert into database")
+	} else if err != nil {
 		helpers.ServerError(w, err)
-		http.Redirect(w, r, "/admin/rooms", http.StatusTemporaryRedirect)
 		return
 	}
 
@@ -1000,91 +1476,765 @@ func (m *Repository) PostAdminNewRoom(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
 }
 
+// roomChanges returns the room details posted in the room form
+func roomChanges(r *http.Request) models.Room {
+	return models.Room{
+		RoomName:    r.Form.Get("room_name"),
+		Price:       r.Form.Get("price"),
+		ImageSource: r.Form.Get("image_src"),
+		Description: r.Form.Get("description"),
+	}
+}
+
+// Handles the deleting of a room, which moves it to the trash
 func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	err := m.DB.DeleteRoom(id)
+	_, err := m.Booking.DeleteRoom(m.actor(r), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Room Deleted</p>")
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Room moved to trash</p>")
 	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
 }
 
-// Handles the admin todo list route
-func (m *Repository) AdminTodoList(w http.ResponseWriter, r *http.Request) {
-	userID := m.App.Session.GetInt(r.Context(), "user_id")
-
-	todoList, err := m.DB.GetTodoListByUserID(userID)
+// Handles the trash view for reservations
+func (m *Repository) AdminTrashReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.DeletedReservations(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["todo_list"] = todoList
+	data["reservations"] = reservations
 
-	render.Template(w, r, "admin-todo.page.html", &models.TemplateData{
-		Form: forms.New(nil),
-		Data: data,
+	intMap := make(map[string]int)
+	intMap["retention_days"] = int(m.App.TrashRetention.Hours() / 24)
+
+	render.Template(w, r, "admin-trash-reservations.page.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
 	})
 }
 
-// Handles the Post for todo list route
-func (m *Repository) PostAdminTodoList(w http.ResponseWriter, r *http.Request) {
-	userID := m.App.Session.GetInt(r.Context(), "user_id")
-
-	var todoList models.TodoList
+// Handles restoring a reservation from the trash. The room must still be free for the reservation dates
+func (m *Repository) AdminRestoreReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	err := r.ParseForm()
-	if err != nil {
+	_, err := m.Booking.RestoreReservation(m.actor(r), id)
+	if errors.Is(err, booking.ErrUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "The room has been booked or blocked for these dates since the reservation was deleted")
+		http.Redirect(w, r, "/admin/trash/reservations", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	todoList.Todo = r.Form.Get("todo_list")
-	todoList.UserID = userID
-
-	form := forms.New(r.PostForm)
-	form.Required("todo_list")
-	form.MinLength("todo_list", 5, 255)
-
-	if !form.Valid() {
-		data := make(map[string]interface{})
-		data["todo_list"] = todoList
-		m.App.Session.Put(r.Context(), "error", "Invalid form input. <br> must be less than 250 and more than 5 characters")
-		render.Template(w, r, "admin-todo.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
-		return
-	}
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Reservation Restored</p>")
+	http.Redirect(w, r, "/admin/trash/reservations", http.StatusSeeOther)
+}
 
-	// Insert new todo here
-	err = m.DB.InsertTodoList(todoList)
+// Handles the trash view for rooms
+func (m *Repository) AdminTrashRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.DeletedRooms(r.Context())
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert into database")
 		helpers.ServerError(w, err)
-		http.Redirect(w, r, "/admin/todo-list", http.StatusTemporaryRedirect)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Todo Created Successfully!!!")
-	http.Redirect(w, r, "/admin/todo-list", http.StatusSeeOther)
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	intMap := make(map[string]int)
+	intMap["retention_days"] = int(m.App.TrashRetention.Hours() / 24)
+
+	render.Template(w, r, "admin-trash-rooms.page.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
 }
 
-// AdminDeleteTodo deletes Todo from the database and
-func (m *Repository) AdminDeleteTodo(w http.ResponseWriter, r *http.Request) {
+// Handles restoring a room from the trash
+func (m *Repository) AdminRestoreRoom(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	err := m.DB.DeleteTodo(id)
+	err := m.Booking.RestoreRoom(m.actor(r), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Todo Deleted</p>")
-	http.Redirect(w, r, "/admin/todo-list", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Room Restored</p>")
+	http.Redirect(w, r, "/admin/trash/rooms", http.StatusSeeOther)
+}
+
+// Handles the reports page. The dates default to last month, which is what the accountant asks for
+func (m *Repository) AdminReports(w http.ResponseWriter, r *http.Request) {
+	year, month, _ := today().Date()
+	firstOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+
+	data := make(map[string]interface{})
+	data["reports"] = reports.Reports
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02")
+	stringMap["end"] = firstOfMonth.AddDate(0, 0, -1).Format("2006-01-02")
+
+	render.Template(w, r, "admin-reports.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// Handles downloading a report. Rows are written to the response as they are read from the database
+func (m *Repository) AdminDownloadReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := reports.Find(chi.URLParam(r, "report"))
+	if !ok {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	format := chi.URLParam(r, "format")
+	if format != reports.FormatCSV && format != reports.FormatXLSX {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	layout := "2006-01-02"
+	start, err := time.Parse(layout, r.URL.Query().Get("start"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	end, err := time.Parse(layout, r.URL.Query().Get("end"))
+	if err != nil || end.Before(start) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", reports.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-to-%s.%s"`, report.Kind, start.Format(layout), end.Format(layout), format))
+
+	writer, err := reports.NewWriter(format, w)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = writer.Write(reports.Header())
+	if err != nil {
+		m.App.ErrorLog.Println("Cannot write report:", err)
+		return
+	}
+
+	// The end date is picked inclusive on the reports page
+	query := models.ReportQuery{
+		Kind:  report.Kind,
+		Start: start,
+		End:   end.AddDate(0, 0, 1),
+	}
+
+	err = m.DB.EachReportReservation(r.Context(), query, func(res models.Reservation) error {
+		return writer.Write(reports.Row(res))
+	})
+	if err != nil {
+		// The download has already started, so all that can be done is to cut it short
+		m.App.ErrorLog.Println("Cannot write report:", err)
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		m.App.ErrorLog.Println("Cannot write report:", err)
+	}
+}
+
+// The largest CSV file that can be uploaded for import
+const maxImportSize = 5 << 20
+
+// Handles the import route. Shows the upload form and, once a file is uploaded, its column mapping and a dry run of every row
+func (m *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["kinds"] = importer.Kinds
+
+	upload, ok := m.App.Session.Get(r.Context(), "import").(importer.Upload)
+	if ok {
+		preview, err := m.previewImport(r.Context(), upload)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data["upload"] = upload
+		data["preview"] = preview
+	}
+
+	render.Template(w, r, "admin-import.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// Handles uploading a file to import. The parsed file is kept in the session until it is imported or discarded
+func (m *Repository) PostAdminImportUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Upload a CSV file no larger than %d MB", maxImportSize>>20))
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose a CSV file to upload")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	upload, err := importer.Parse(r.Form.Get("kind"), header.Filename, file)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't read "+template.HTMLEscapeString(header.Filename)+": "+template.HTMLEscapeString(err.Error()))
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "import", upload)
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
+
+// Handles changing which column of the uploaded file each field is read from
+func (m *Repository) PostAdminImportMapping(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	upload, ok := m.App.Session.Get(r.Context(), "import").(importer.Upload)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Upload a file to import first")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	fields, _ := importer.Fields(upload.Kind)
+
+	columns := make(map[string]int)
+	for _, field := range fields {
+		column, err := strconv.Atoi(r.Form.Get("map_" + field.Name))
+		if err != nil {
+			column = -1
+		}
+		columns[field.Name] = column
+	}
+	upload.Map(columns)
+
+	m.App.Session.Put(r.Context(), "import", upload)
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
+
+// Handles importing the uploaded file. Every row is checked again and nothing is written unless all of them pass
+func (m *Repository) PostAdminImportCommit(w http.ResponseWriter, r *http.Request) {
+	upload, ok := m.App.Session.Get(r.Context(), "import").(importer.Upload)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Upload a file to import first")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	preview, err := m.previewImport(r.Context(), upload)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !preview.OK() {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Nothing was imported, %d rows have errors", preview.InvalidRows()))
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	var redirect string
+
+	switch upload.Kind {
+	case importer.KindRooms:
+		_, err := m.Booking.ImportRooms(m.actor(r), preview.Rooms())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		redirect = "/admin/rooms"
+
+	default:
+		_, err := m.Booking.ImportReservations(m.actor(r), preview.Reservations())
+		if errors.Is(err, booking.ErrUnavailable) {
+			// Someone booked one of the rooms since the preview was shown
+			m.App.Session.Put(r.Context(), "error", "Nothing was imported, "+template.HTMLEscapeString(err.Error()))
+			http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		redirect = "/admin/all-reservations"
+	}
+
+	m.App.Session.Remove(r.Context(), "import")
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("<strong>Successful!!!</strong><br><br> <p>%d %s imported from %s</p>",
+		len(preview.Rows), upload.Kind, template.HTMLEscapeString(upload.Filename)))
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// Handles discarding the uploaded file without importing it
+func (m *Repository) PostAdminImportCancel(w http.ResponseWriter, r *http.Request) {
+	m.App.Session.Remove(r.Context(), "import")
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
+
+// previewImport checks every row of upload against the rooms and bookings already in the database
+func (m *Repository) previewImport(ctx context.Context, upload importer.Upload) (importer.Preview, error) {
+	rooms, err := m.DB.AllRooms(ctx)
+	if err != nil {
+		return importer.Preview{}, err
+	}
+
+	if upload.Kind == importer.KindRooms {
+		return importer.CheckRooms(upload, rooms), nil
+	}
+	return importer.CheckReservations(ctx, upload, rooms, m.DB.SearchAvailabilityByDatesByRoomID)
+}
+
+// Handles the API keys page. A key that was just created is shown here once, and never again
+func (m *Repository) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	m.renderAPIKeys(w, r, forms.New(nil), models.APIKey{Scope: models.ScopeReadOnly, RateLimit: models.DefaultAPIRateLimit})
+}
+
+// Handles creating an API key
+func (m *Repository) PostAdminAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "scope", "rate_limit")
+	form.MinLength("name", 3, 50)
+
+	key := models.APIKey{
+		Name:   r.Form.Get("name"),
+		UserID: m.App.Session.GetInt(r.Context(), "user_id"),
+	}
+
+	scope, ok := models.ParseAPIScope(r.Form.Get("scope"))
+	if !ok && form.HasField("scope") {
+		form.Errors.Add("scope", "Choose one of the scopes")
+	}
+	key.Scope = scope
+
+	key.RateLimit, err = strconv.Atoi(r.Form.Get("rate_limit"))
+	if (err != nil || key.RateLimit < 1 || key.RateLimit > 10000) && form.HasField("rate_limit") {
+		form.Errors.Add("rate_limit", "Must be a number of requests from 1 to 10000")
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid form input")
+		m.renderAPIKeys(w, r, form, key)
+		return
+	}
+
+	secret, prefix, err := api.NewKey()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	key.Prefix = prefix
+	key.Hash = api.HashKey(secret)
+
+	key.ID, err = m.DB.InsertAPIKey(r.Context(), key)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The hash stays out of the audit log along with the key
+	key.Hash = ""
+	m.recordAudit(r, audit.ActionCreate, audit.EntityAPIKey, key.ID, nil, key)
+
+	m.App.Session.Put(r.Context(), "new_api_key", secret)
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>API Key Created</p>")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// Handles revoking an API key. Requests made with it are refused from then on
+func (m *Repository) AdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "That key doesn't exist or is already revoked")
+		http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.recordAudit(r, audit.ActionRevoke, audit.EntityAPIKey, id, nil, nil)
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>API Key Revoked</p>")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// renderAPIKeys shows the API keys page, with key filled into the new key form
+func (m *Repository) renderAPIKeys(w http.ResponseWriter, r *http.Request, form *forms.Form, key models.APIKey) {
+	keys, err := m.DB.AllAPIKeys(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["keys"] = keys
+	data["key"] = key
+	data["scopes"] = models.APIScopes
+
+	stringMap := make(map[string]string)
+	stringMap["new_key"] = m.App.Session.PopString(r.Context(), "new_api_key")
+
+	render.Template(w, r, "admin-api-keys.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// How many of a webhook's latest deliveries its page shows
+const webhookLogSize = 50
+
+// Handles the webhooks page
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	m.renderWebhooks(w, r, forms.New(nil), models.Webhook{})
+}
+
+// Handles adding a webhook. It is sent events from then on, signed with a secret generated for it
+func (m *Repository) PostAdminWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	hook := models.Webhook{
+		URL:         strings.TrimSpace(r.Form.Get("url")),
+		Description: strings.TrimSpace(r.Form.Get("description")),
+		Events:      r.Form["events"],
+		Active:      true,
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	target, err := url.Parse(hook.URL)
+	if form.HasField("url") && (err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "") {
+		form.Errors.Add("url", "Must be a full http or https address")
+	}
+
+	if len(hook.Events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+	for _, event := range hook.Events {
+		if !webhooks.IsEvent(event) {
+			form.Errors.Add("events", "There is no event called "+event)
+		}
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid form input")
+		m.renderWebhooks(w, r, form, hook)
+		return
+	}
+
+	hook.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	hook.ID, err = m.DB.InsertWebhook(r.Context(), hook)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The secret is kept out of the audit log
+	audited := hook
+	audited.Secret = ""
+	m.recordAudit(r, audit.ActionCreate, audit.EntityWebhook, hook.ID, nil, audited)
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Webhook Added</p>")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// Handles a webhook's page, with its secret and the log of what has been sent to it
+func (m *Repository) AdminWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := m.adminWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := m.DB.GetWebhookDeliveries(r.Context(), hook.ID, webhookLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhook"] = hook
+	data["deliveries"] = deliveries
+
+	render.Template(w, r, "admin-webhook.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// Handles pausing and resuming a webhook. Events queued while it is paused are sent when it is resumed
+func (m *Repository) AdminToggleWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := m.adminWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	active := r.Form.Get("active") == "true"
+
+	err = m.DB.SetWebhookActive(r.Context(), hook.ID, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	after := hook
+	after.Active = active
+	m.recordAudit(r, audit.ActionUpdate, audit.EntityWebhook, hook.ID, hook, after)
+
+	if active {
+		m.wakeWebhooks()
+		m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Webhook Resumed</p>")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Webhook Paused</p>")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// Handles deleting a webhook, along with its delivery log
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := m.adminWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteWebhook(r.Context(), hook.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	hook.Secret = ""
+	m.recordAudit(r, audit.ActionDelete, audit.EntityWebhook, hook.ID, hook, nil)
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Webhook Deleted</p>")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// Handles sending a delivery again, e.g. once a receiver that was down is fixed
+func (m *Repository) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	hook, ok := m.adminWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "delivery"))
+
+	err := m.DB.RetryWebhookDelivery(r.Context(), hook.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.wakeWebhooks()
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Delivery queued to be sent again</p>")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// adminWebhook looks up the webhook in the url, sending a not found if there is none
+func (m *Repository) adminWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	hook, err := m.DB.GetWebhookByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return hook, false
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return hook, false
+	}
+
+	return hook, true
+}
+
+// renderWebhooks shows the webhooks page, with hook filled into the new webhook form
+func (m *Repository) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form, hook models.Webhook) {
+	hooks, err := m.DB.AllWebhooks(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+	data["webhook"] = hook
+	data["events"] = webhooks.Events
+
+	render.Template(w, r, "admin-webhooks.page.html", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// Handles the admin todo list route
+func (m *Repository) AdminTodoList(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	todoList, err := m.DB.GetTodoListByUserID(r.Context(), userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["todo_list"] = todoList
+
+	render.Template(w, r, "admin-todo.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// Handles the Post for todo list route
+func (m *Repository) PostAdminTodoList(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	var todoList models.TodoList
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	todoList.Todo = r.Form.Get("todo_list")
+	todoList.UserID = userID
+
+	form := forms.New(r.PostForm)
+	form.Required("todo_list")
+	form.MinLength("todo_list", 5, 255)
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["todo_list"] = todoList
+		m.App.Session.Put(r.Context(), "error", "Invalid form input. <br> must be less than 250 and more than 5 characters")
+		render.Template(w, r, "admin-todo.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	// Insert new todo here
+	todoList.ID, err = m.DB.InsertTodoList(r.Context(), todoList)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't insert into database")
+		helpers.ServerError(w, err)
+		http.Redirect(w, r, "/admin/todo-list", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.recordAudit(r, audit.ActionCreate, audit.EntityTodo, todoList.ID, nil, todoList)
+
+	m.App.Session.Put(r.Context(), "flash", "Todo Created Successfully!!!")
+	http.Redirect(w, r, "/admin/todo-list", http.StatusSeeOther)
+}
+
+// AdminDeleteTodo deletes Todo from the database and
+func (m *Repository) AdminDeleteTodo(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	// The todo is kept for the audit log, from the admin's own list
+	todoList, err := m.DB.GetTodoListByUserID(r.Context(), userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var before interface{}
+	for _, todo := range todoList {
+		if todo.ID == id {
+			before = todo
+		}
+	}
+
+	err = m.DB.DeleteTodo(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.recordAudit(r, audit.ActionDelete, audit.EntityTodo, id, before, nil)
+
+	m.App.Session.Put(r.Context(), "flash", "<strong>Successful!!!</strong><br><br> <p>Todo Deleted</p>")
+	http.Redirect(w, r, "/admin/todo-list", http.StatusSeeOther)
+}
+
+// Handles the audit log route, searchable by text and entity
+func (m *Repository) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	entity := r.URL.Query().Get("entity")
+
+	logs, err := m.DB.SearchAuditLogs(r.Context(), search, entity)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = search
+	stringMap["entity"] = entity
+
+	data := make(map[string]interface{})
+	data["audit_logs"] = logs
+
+	render.Template(w, r, "admin-audit.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
 }
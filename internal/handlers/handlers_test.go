@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,6 +17,8 @@ import (
 
 	"github.com/atuprosper/booking-project/internal/driver"
 	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/webhooks"
+	"github.com/go-chi/chi/v5"
 )
 
 type postData struct {
@@ -39,7 +43,7 @@ var theTests = []struct {
 	{"res summary", "/reservation-summary", "GET", http.StatusOK},
 	{"non-existent", "/green/eggs/and/ham", "GET", http.StatusNotFound},
 	{"login", "/user/login", "GET", http.StatusOK},
-	{"logout", "/user/logout", "GET", http.StatusOK},
+	{"logout", "/user/logout", "GET", http.StatusMethodNotAllowed},
 	{"dasboard", "/admin/dasboard", "GET", http.StatusOK},
 	{"new res", "/admin/new-reservations", "GET", http.StatusOK},
 	{"all res", "/admin/all-reservations", "GET", http.StatusOK},
@@ -51,9 +55,18 @@ var theTests = []struct {
 	{"single room", "/admin/rooms/1", "GET", http.StatusOK},
 	{"new room", "/admin/rooms/new-room", "GET", http.StatusOK},
 	{"todo", "/admin/todo-list", "GET", http.StatusOK},
+	{"audit", "/admin/audit", "GET", http.StatusOK},
+	{"audit search", "/admin/audit?q=atu&entity=reservation", "GET", http.StatusOK},
+	{"trash reservations", "/admin/trash/reservations", "GET", http.StatusOK},
+	{"trash rooms", "/admin/trash/rooms", "GET", http.StatusOK},
+	{"front desk", "/admin/today", "GET", http.StatusOK},
+	{"no-show report", "/admin/today/no-shows", "GET", http.StatusOK},
+	{"reports", "/admin/reports", "GET", http.StatusOK},
 }
 
 func TestHandlers(testPointer *testing.T) {
+	useTestRepo(testPointer)
+
 	routes := getRoutes()
 
 	testServer := httptest.NewTLSServer(routes)
@@ -115,6 +128,8 @@ var reservationTests = []struct {
 }
 
 func TestRepository_MakeReservation(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range reservationTests {
 		req, _ := http.NewRequest("GET", "/make-reservation", nil)
 		ctx := getContext(req)
@@ -274,6 +289,8 @@ var postReservationTests = []struct {
 
 // TestPostReservation tests the PostReservation handler
 func TestPostReservation(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range postReservationTests {
 		var req *http.Request
 		if e.postedData != nil {
@@ -368,6 +385,8 @@ var testAvailabilityJSONData = []struct {
 
 // TestAvailabilityJSON tests the AvailabilityJSON handler
 func TestAvailabilityJSON(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range testAvailabilityJSONData {
 		// create request, get the context with session, set header, create recorder
 		var req *http.Request
@@ -455,6 +474,8 @@ var testPostAvailabilityData = []struct {
 
 // TestPostAvailability tests the PostAvailabilityHandler
 func TestPostAvailability(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range testPostAvailabilityData {
 		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(e.postedData.Encode()))
 
@@ -508,6 +529,8 @@ var reservationSummaryTests = []struct {
 
 // TestReservationSummary tests the ReservationSummaryHandler
 func TestReservationSummary(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range reservationSummaryTests {
 		req, _ := http.NewRequest("GET", e.url, nil)
 		ctx := getContext(req)
@@ -574,6 +597,8 @@ var chooseRoomTests = []struct {
 
 // TestChooseRoom tests the ChooseRoom handler
 func TestChooseRoom(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range chooseRoomTests {
 		req, _ := http.NewRequest("GET", e.url, nil)
 		ctx := getContext(req)
@@ -622,6 +647,8 @@ var bookRoomTests = []struct {
 
 // TestBookRoom tests the BookRoom handler
 func TestBookRoom(t *testing.T) {
+	useTestRepo(t)
+
 	reservation := models.Reservation{
 		RoomID: 1,
 		Room: models.Room{
@@ -680,6 +707,8 @@ var loginTests = []struct {
 }
 
 func TestLogin(t *testing.T) {
+	useTestRepo(t)
+
 	// range through all tests
 	for _, e := range loginTests {
 		postedData := url.Values{}
@@ -775,6 +804,8 @@ var adminPostShowReservationTests = []struct {
 
 // TestAdminPostShowReservation tests the AdminPostReservation handler
 func TestAdminPostShowReservation(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range adminPostShowReservationTests {
 		var req *http.Request
 		if e.postedData != nil {
@@ -850,6 +881,8 @@ var adminPostReservationCalendarTests = []struct {
 }
 
 func TestPostReservationCalendar(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range adminPostReservationCalendarTests {
 		var req *http.Request
 		if e.postedData != nil {
@@ -901,40 +934,61 @@ func TestPostReservationCalendar(t *testing.T) {
 	}
 }
 
-var adminProcessReservationTests = []struct {
+var adminUpdateReservationStatusTests = []struct {
 	name                 string
-	queryParams          string
+	postedData           url.Values
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
-		name:                 "process-reservation",
-		queryParams:          "",
+		name:                 "confirm-reservation",
+		postedData:           url.Values{"status": {"confirmed"}},
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/-reservations",
 	},
 	{
-		name:                 "process-reservation-back-to-cal",
-		queryParams:          "?y=2021&m=12",
+		name:                 "confirm-reservation-back-to-cal",
+		postedData:           url.Values{"status": {"confirmed"}, "year": {"2021"}, "month": {"12"}},
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/reservations-calendar?y=2021&m=12",
+	},
+	{
+		name:                 "transition-not-allowed",
+		postedData:           url.Values{"status": {"checked-out"}},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/-reservations",
+	},
+	{
+		name:                 "unknown-status",
+		postedData:           url.Values{"status": {"processed"}},
+		expectedResponseCode: http.StatusBadRequest,
 	},
 }
 
-func TestAdminProcessReservation(t *testing.T) {
-	for _, e := range adminProcessReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+func TestAdminUpdateReservationStatus(t *testing.T) {
+	useTestRepo(t)
+
+	for _, e := range adminUpdateReservationStatusTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/cal/1/status", strings.NewReader(e.postedData.Encode()))
 		ctx := getContext(req)
 		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 		rr := httptest.NewRecorder()
 
-		handler := http.HandlerFunc(Repo.AdminProcessReservation)
+		handler := http.HandlerFunc(Repo.AdminUpdateReservationStatus)
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
 	}
 }
 
@@ -952,17 +1006,20 @@ var adminDeleteReservationTests = []struct {
 	},
 	{
 		name:                 "delete-reservation-back-to-cal",
-		queryParams:          "?y=2021&m=12",
+		queryParams:          "year=2021&month=12",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "",
 	},
 }
 
 func TestAdminDeleteReservation(t *testing.T) {
+	useTestRepo(t)
+
 	for _, e := range adminDeleteReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/delete-reservation/cal/1/do%s", e.queryParams), nil)
+		req, _ := http.NewRequest("POST", "/admin/delete-reservation/cal/1", strings.NewReader(e.queryParams))
 		ctx := getContext(req)
 		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 		rr := httptest.NewRecorder()
 
@@ -975,6 +1032,207 @@ func TestAdminDeleteReservation(t *testing.T) {
 	}
 }
 
+var adminBulkReservationsTests = []struct {
+	name                 string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedFlash        string
+}{
+	{
+		name: "mark-confirmed",
+		postedData: url.Values{
+			"id":     {"1", "2"},
+			"action": {"status"},
+			"status": {"confirmed"},
+			"return": {"/admin/new-reservations?page=2"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/new-reservations?page=2",
+		expectedFlash:        "2 reservations marked as Confirmed",
+	},
+	{
+		name: "invalid-transition-skipped",
+		postedData: url.Values{
+			"id":     {"1"},
+			"action": {"status"},
+			"status": {"checked-out"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+		expectedFlash:        "Skipped #1",
+	},
+	{
+		name: "unknown-status",
+		postedData: url.Values{
+			"id":     {"1"},
+			"action": {"status"},
+			"status": {"lost"},
+		},
+		expectedResponseCode: http.StatusBadRequest,
+	},
+	{
+		name: "email",
+		postedData: url.Values{
+			"id":      {"1"},
+			"action":  {"email"},
+			"subject": {"Parking"},
+			"message": {"The car park is closed on Sunday"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+		expectedFlash:        "1 reservation emailed",
+	},
+	{
+		name: "email-without-subject",
+		postedData: url.Values{
+			"id":      {"1"},
+			"action":  {"email"},
+			"message": {"The car park is closed on Sunday"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+	},
+	{
+		name: "delete",
+		postedData: url.Values{
+			"id":     {"1", "2", "3"},
+			"action": {"delete"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+		expectedFlash:        "3 reservations moved to trash",
+	},
+	{
+		name: "nothing-selected",
+		postedData: url.Values{
+			"action": {"delete"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+	},
+	{
+		name: "external-return",
+		postedData: url.Values{
+			"id":     {"1"},
+			"action": {"delete"},
+			"return": {"https://example.com/"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/all-reservations",
+	},
+	{
+		name: "unknown-action",
+		postedData: url.Values{
+			"id":     {"1"},
+			"action": {"archive"},
+		},
+		expectedResponseCode: http.StatusBadRequest,
+	},
+}
+
+func TestAdminBulkReservations(t *testing.T) {
+	// Each case runs against the reservations the cases before it changed
+	useFixtureRepo(t)
+
+	for _, e := range adminBulkReservationsTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/bulk", strings.NewReader(e.postedData.Encode()))
+		ctx := getContext(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminBulkReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedFlash != "" {
+			flash := session.GetString(ctx, "flash")
+			if !strings.Contains(flash, e.expectedFlash) {
+				t.Errorf("failed %s: expected flash to contain %q, but got %q", e.name, e.expectedFlash, flash)
+			}
+		}
+	}
+}
+
+func TestAdminBulkExport(t *testing.T) {
+	useFixtureRepo(t)
+
+	postedData := url.Values{
+		"id":     {"1", "2"},
+		"action": {"export"},
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/reservations/bulk", strings.NewReader(postedData.Encode()))
+	ctx := getContext(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminBulkReservations)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected code %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("expected a csv download, but got %s", contentType)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, but got %d lines", len(lines))
+	}
+	// Two nights in rooms priced at 100 and 150
+	if !strings.HasPrefix(lines[1], "1,John,Smith,") || !strings.HasSuffix(lines[1], ",200.00") ||
+		!strings.HasPrefix(lines[2], "2,Jane,Doe,") || !strings.HasSuffix(lines[2], ",300.00") {
+		t.Errorf("expected the selected reservations with their revenue, but got\n%s", rr.Body.String())
+	}
+}
+
+func TestAdminBulkExport_Formulas(t *testing.T) {
+	useFixtureRepo(t)
+
+	// A guest can book under any name, including one a spreadsheet would run
+	reservation, _ := Repo.DB.GetReservationByID(context.Background(), 3)
+	reservation.FirstName = `=HYPERLINK("http://evil")`
+	reservation.LastName = "@SUM(A1)"
+	if err := Repo.DB.UpdateReservation(context.Background(), reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	postedData := url.Values{
+		"id":     {"3"},
+		"action": {"export"},
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/reservations/bulk", strings.NewReader(postedData.Encode()))
+	ctx := getContext(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminBulkReservations)
+	handler.ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `3,"'=HYPERLINK(""http://evil"")",'@SUM(A1),`) {
+		t.Errorf("expected the guest's name to be quoted so it can't run, but got\n%s", rr.Body.String())
+	}
+}
 
 func getContext(request *http.Request) context.Context {
 	ctx, err := session.Load(request.Context(), request.Header.Get("X-Session"))
@@ -983,3 +1241,864 @@ func getContext(request *http.Request) context.Context {
 	}
 	return ctx
 }
+
+var adminRestoreTests = []struct {
+	name             string
+	url              string
+	handler          func(*Repository, http.ResponseWriter, *http.Request)
+	expectedLocation string
+}{
+	{
+		name:             "restore-reservation",
+		url:              "/admin/trash/reservations/1/restore",
+		handler:          (*Repository).AdminRestoreReservation,
+		expectedLocation: "/admin/trash/reservations",
+	},
+	{
+		name:             "restore-room",
+		url:              "/admin/trash/rooms/1/restore",
+		handler:          (*Repository).AdminRestoreRoom,
+		expectedLocation: "/admin/trash/rooms",
+	},
+}
+
+func TestAdminRestore(t *testing.T) {
+	useFixtureRepo(t)
+
+	if _, err := Repo.Booking.DeleteReservation(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repo.Booking.DeleteRoom(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range adminRestoreTests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		ctx := getContext(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strings.Split(e.url, "/")[4])
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+
+	reservation, err := Repo.DB.GetReservationByID(context.Background(), 1)
+	if err != nil || !reservation.DeletedAt.IsZero() {
+		t.Errorf("expected reservation 1 out of the trash, but got %+v, %v", reservation, err)
+	}
+	room, err := Repo.DB.GetRoomByID(context.Background(), 1)
+	if err != nil || !room.DeletedAt.IsZero() {
+		t.Errorf("expected room 1 out of the trash, but got %+v, %v", room, err)
+	}
+}
+
+var adminFrontDeskTests = []struct {
+	name                 string
+	url                  string
+	postedData           url.Values
+	handler              func(*Repository, http.ResponseWriter, *http.Request)
+	expectedResponseCode int
+	expectedLocation     string
+}{
+	{
+		name:                 "check-in",
+		url:                  "/admin/today/1/check-in",
+		postedData:           url.Values{"id_document": {"Passport A1234567"}, "notes": {"Late checkout requested"}},
+		handler:              (*Repository).AdminCheckIn,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/today",
+	},
+	{
+		name:                 "check-in-with-arrival-time",
+		url:                  "/admin/today/2/check-in",
+		postedData:           url.Values{"arrived_at": {"14:35"}},
+		handler:              (*Repository).AdminCheckIn,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/today",
+	},
+	{
+		name:                 "check-in-bad-arrival-time",
+		url:                  "/admin/today/3/check-in",
+		postedData:           url.Values{"arrived_at": {"half past two"}},
+		handler:              (*Repository).AdminCheckIn,
+		expectedResponseCode: http.StatusBadRequest,
+	},
+	{
+		name:                 "check-out-before-check-in",
+		url:                  "/admin/today/3/check-out",
+		handler:              (*Repository).AdminCheckOut,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/today",
+	},
+	{
+		name:                 "no-show",
+		url:                  "/admin/today/3/no-show",
+		handler:              (*Repository).AdminMarkNoShow,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/today/no-shows",
+	},
+}
+
+func TestAdminFrontDesk(t *testing.T) {
+	useFixtureRepo(t)
+
+	for _, e := range adminFrontDeskTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		ctx := getContext(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strings.Split(e.url, "/")[3])
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+
+	expected := map[int]models.ReservationStatus{1: models.StatusCheckedIn, 2: models.StatusCheckedIn, 3: models.StatusNoShow}
+	for id, status := range expected {
+		reservation, err := Repo.DB.GetReservationByID(context.Background(), id)
+		if err != nil || reservation.Status != status {
+			t.Errorf("expected reservation %d to be %s, but got %s, %v", id, status, reservation.Status, err)
+		}
+	}
+}
+
+func TestAdminFrontDeskEscapesGuests(t *testing.T) {
+	useFixtureRepo(t)
+
+	reservation, _ := Repo.DB.GetReservationByID(context.Background(), 1)
+	reservation.FirstName = `<img src=x onerror="alert(1)">`
+	if err := Repo.DB.UpdateReservation(context.Background(), reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []struct {
+		url     string
+		handler func(*Repository, http.ResponseWriter, *http.Request)
+	}{
+		{"/admin/today/1/check-in", (*Repository).AdminCheckIn},
+		{"/admin/today/1/check-out", (*Repository).AdminCheckOut},
+	} {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(url.Values{"id_document": {"Passport 123"}}.Encode()))
+		ctx := getContext(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		e.handler(Repo, httptest.NewRecorder(), req)
+
+		flash := session.GetString(ctx, "flash")
+		if strings.Contains(flash, "<img") || !strings.Contains(flash, "&lt;img") {
+			t.Errorf("expected the guest's name to be escaped in the flash of %s, but got %q", e.url, flash)
+		}
+	}
+}
+
+var adminReservationCommunicationTests = []struct {
+	name             string
+	url              string
+	postedData       url.Values
+	handler          func(*Repository, http.ResponseWriter, *http.Request)
+	expectedLocation string
+}{
+	{
+		name:             "add-note",
+		url:              "/admin/reservations/all/1/notes",
+		postedData:       url.Values{"note": {"Guest asked for a cot"}},
+		handler:          (*Repository).PostAdminReservationNote,
+		expectedLocation: "/admin/reservations/all/1/show",
+	},
+	{
+		name:             "add-empty-note",
+		url:              "/admin/reservations/all/1/notes",
+		postedData:       url.Values{"note": {""}},
+		handler:          (*Repository).PostAdminReservationNote,
+		expectedLocation: "/admin/reservations/all/1/show",
+	},
+	{
+		name:             "send-message-back-to-cal",
+		url:              "/admin/reservations/cal/1/message",
+		postedData:       url.Values{"subject": {"Parking"}, "message": {"Your space is B12"}, "year": {"2021"}, "month": {"12"}},
+		handler:          (*Repository).PostAdminReservationMessage,
+		expectedLocation: "/admin/reservations/cal/1/show?y=2021&m=12",
+	},
+	{
+		name:             "send-message-without-subject",
+		url:              "/admin/reservations/all/1/message",
+		postedData:       url.Values{"message": {"Your space is B12"}},
+		handler:          (*Repository).PostAdminReservationMessage,
+		expectedLocation: "/admin/reservations/all/1/show",
+	},
+}
+
+func TestAdminReservationCommunication(t *testing.T) {
+	useFixtureRepo(t)
+
+	for _, e := range adminReservationCommunicationTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		ctx := getContext(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		// The handlers read the url params from chi
+		rctx := chi.NewRouteContext()
+		params := strings.Split(e.url, "/")
+		rctx.URLParams.Add("src", params[3])
+		rctx.URLParams.Add("id", params[4])
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+// seedDashboard adds stays around today to the fixtures, whose own stays are far in the future. Everything is
+// booked today: room 1 for the 2 nights from 4 days ago at 100, room 2 for 3 nights from 5 days ahead at 150,
+// room 1 for 2 nights from 40 days ahead and a cancelled stay in room 2 from 10 days ahead
+func seedDashboard(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+
+	stays := []struct {
+		room      int
+		from, to  int
+		cancelled bool
+	}{
+		{1, -4, -2, false},
+		{2, 5, 8, false},
+		{1, 40, 42, false},
+		{2, 10, 12, true},
+	}
+	for _, stay := range stays {
+		id, err := Repo.DB.InsertReservation(ctx, models.Reservation{
+			FirstName: "Guest", LastName: "Stay", Email: "guest@stay.com", Phone: "555", RoomID: stay.room,
+			StartDate: today().AddDate(0, 0, stay.from), EndDate: today().AddDate(0, 0, stay.to),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stay.cancelled {
+			if err := Repo.DB.UpdateReservationStatus(ctx, id, models.StatusCancelled); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+var adminDashboardTests = []struct {
+	name string
+	// Days from today
+	start, end    int
+	expectedParts []string
+}{
+	{
+		name:  "last-10-nights",
+		start: -10,
+		end:   0,
+		// 2 of the 20 room nights sold at 100, the 7 bookings and 6 pending made today, and 3 room nights for 450
+		// picked up in the next 30 days, then 5 for 650 in the next 60 and 90
+		expectedParts: []string{"10.0%", "2 of 20 room nights", "100.00", "10.00", "Revenue 200.00", "<h3>7</h3>",
+			">6</h3>", "<td>3</td>", "<td>450.00</td>", "<td>5</td>", "<td>650.00</td>"},
+	},
+	{
+		name:  "range-before-today",
+		start: -10,
+		end:   -1,
+		// Nothing was booked before today, so nothing was picked up
+		expectedParts: []string{"2 of 18 room nights", "<h3>0</h3>", "<td>0</td>", "<td>0.00</td>"},
+	},
+	{
+		name:          "backwards-range-falls-back-to-last-30-nights",
+		start:         0,
+		end:           -10,
+		expectedParts: []string{"2 of 60 room nights", "<h3>7</h3>"},
+	},
+}
+
+func TestAdminDashboard(t *testing.T) {
+	useFixtureRepo(t)
+	seedDashboard(t)
+
+	for _, e := range adminDashboardTests {
+		query := fmt.Sprintf("?start=%s&end=%s", today().AddDate(0, 0, e.start).Format("2006-01-02"),
+			today().AddDate(0, 0, e.end).Format("2006-01-02"))
+		req, _ := http.NewRequest("GET", "/admin/dashboard"+query, nil)
+		ctx := getContext(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDashboard)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusOK, rr.Code)
+		}
+
+		for _, part := range e.expectedParts {
+			if !strings.Contains(rr.Body.String(), part) {
+				t.Errorf("failed %s: expected the dashboard to show %q", e.name, part)
+			}
+		}
+	}
+}
+
+var adminDownloadReportTests = []struct {
+	name                 string
+	report               string
+	format               string
+	query                string
+	expectedResponseCode int
+	expectedContentType  string
+}{
+	{
+		name:                 "csv",
+		report:               "by-stay-date",
+		format:               "csv",
+		query:                "?start=2026-09-01&end=2026-09-30",
+		expectedResponseCode: http.StatusOK,
+		expectedContentType:  "text/csv",
+	},
+	{
+		name:                 "xlsx",
+		report:               "by-room",
+		format:               "xlsx",
+		query:                "?start=2026-09-01&end=2026-09-30",
+		expectedResponseCode: http.StatusOK,
+		expectedContentType:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	},
+	{
+		name:                 "unknown-report",
+		report:               "payroll",
+		format:               "csv",
+		query:                "?start=2026-09-01&end=2026-09-30",
+		expectedResponseCode: http.StatusNotFound,
+	},
+	{
+		name:                 "unknown-format",
+		report:               "no-shows",
+		format:               "pdf",
+		query:                "?start=2026-09-01&end=2026-09-30",
+		expectedResponseCode: http.StatusNotFound,
+	},
+	{
+		name:                 "missing-dates",
+		report:               "cancellations",
+		format:               "csv",
+		expectedResponseCode: http.StatusBadRequest,
+	},
+}
+
+func TestAdminDownloadReport(t *testing.T) {
+	useFixtureRepo(t)
+
+	for _, e := range adminDownloadReportTests {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/reports/%s/%s%s", e.report, e.format, e.query), nil)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("report", e.report)
+		rctx.URLParams.Add("format", e.format)
+		req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDownloadReport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedContentType != "" && rr.Header().Get("Content-Type") != e.expectedContentType {
+			t.Errorf("failed %s: expected content type %s, but got %s", e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+		}
+	}
+
+	// John Smith's fixture is two nights in room 1, at its seeded price of 100
+	req, _ := http.NewRequest("GET", "/admin/reports/by-stay-date/csv?start=2040-01-01&end=2040-01-31", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("report", "by-stay-date")
+	rctx.URLParams.Add("format", "csv")
+	req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDownloadReport).ServeHTTP(rr, req)
+
+	expected := "1,John,Smith,john@smith.com,555-1000,Generals Suit,2040-01-10,2040-01-12,2,Pending," +
+		time.Now().Format("2006-01-02") + ",,,200.00\n"
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("expected the report to have %q but got %q", expected, rr.Body.String())
+	}
+}
+
+var reservationFilterTests = []struct {
+	name     string
+	query    string
+	expected models.ReservationFilter
+}{
+	{
+		name:     "defaults",
+		query:    "",
+		expected: models.ReservationFilter{Page: 1, PerPage: models.DefaultPerPage},
+	},
+	{
+		name:  "every-field",
+		query: "?q=+smith+&start=2026-10-01&end=2026-10-31&room=2&status=confirmed&sort=name&dir=desc&page=3",
+		expected: models.ReservationFilter{
+			Search:  "smith",
+			Start:   time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC),
+			RoomID:  2,
+			Status:  models.StatusConfirmed,
+			Sort:    "name",
+			Desc:    true,
+			Page:    3,
+			PerPage: models.DefaultPerPage,
+		},
+	},
+	{
+		name:     "bad-values-are-ignored",
+		query:    "?start=yesterday&room=two&status=processed&sort=id;drop table reservations&page=-4",
+		expected: models.ReservationFilter{Page: 1, PerPage: models.DefaultPerPage},
+	},
+}
+
+func TestReservationFilter(t *testing.T) {
+	for _, e := range reservationFilterTests {
+		req, _ := http.NewRequest("GET", "/admin/all-reservations"+e.query, nil)
+
+		filter := reservationFilter(req)
+		if !reflect.DeepEqual(filter, e.expected) {
+			t.Errorf("failed %s: expected %+v but got %+v", e.name, e.expected, filter)
+		}
+	}
+}
+
+func TestAdminReservationLists(t *testing.T) {
+	for _, path := range []string{"/admin/all-reservations?q=smith&room=1", "/admin/new-reservations?sort=created&dir=desc"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		ctx := getContext(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		if strings.HasPrefix(path, "/admin/all") {
+			Repo.AdminAllReservations(rr, req)
+		} else {
+			Repo.AdminNewReservations(rr, req)
+		}
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected code %d, but got %d", path, http.StatusOK, rr.Code)
+		}
+
+		if !strings.Contains(rr.Body.String(), "John Smith") {
+			t.Errorf("%s: expected the list to show the seeded reservation", path)
+		}
+	}
+}
+
+// importUpload builds a multipart upload of a CSV file for the import wizard
+func importUpload(t *testing.T, kind, file string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("kind", kind)
+
+	part, err := writer.CreateFormFile("file", "old-system.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(file))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/import/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestAdminImport(t *testing.T) {
+	useFixtureRepo(t)
+
+	rooms := "Name,Rate,Photo,Details\n" +
+		"Sea View Room,120,sea.png,A room by the sea\n" +
+		"Garden Room,90,garden.png,Opens onto the lawn\n"
+
+	req := importUpload(t, "rooms", rooms)
+	ctx := getContext(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportUpload).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("upload: expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	// The preview shows the guessed columns and every row ready to import
+	req, _ = http.NewRequest("GET", "/admin/import", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminImport).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("preview: expected code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	for _, expected := range []string{"2 ready", "0 with errors", "Sea View Room", `<option value="1" selected>Rate</option>`} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("preview: expected the page to contain %q", expected)
+		}
+	}
+
+	// Unmapping a required column fails every row
+	req, _ = http.NewRequest("POST", "/admin/import/mapping", strings.NewReader("map_room_name=0&map_price=-1&map_image_src=2&map_description=3"))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportMapping).ServeHTTP(rr, req)
+
+	req, _ = http.NewRequest("POST", "/admin/import/commit", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportCommit).ServeHTTP(rr, req)
+
+	if location, _ := rr.Result().Location(); location.String() != "/admin/import" {
+		t.Errorf("commit with errors: expected to go back to the preview, but got %s", location)
+	}
+	if errorMessage := session.PopString(ctx, "error"); !strings.Contains(errorMessage, "2 rows have errors") {
+		t.Errorf("commit with errors: expected an error, but got %q", errorMessage)
+	}
+
+	// Mapped back, the import goes through
+	req, _ = http.NewRequest("POST", "/admin/import/mapping", strings.NewReader("map_room_name=0&map_price=1&map_image_src=2&map_description=3"))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportMapping).ServeHTTP(rr, req)
+
+	req, _ = http.NewRequest("POST", "/admin/import/commit", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportCommit).ServeHTTP(rr, req)
+
+	if location, _ := rr.Result().Location(); location.String() != "/admin/rooms" {
+		t.Errorf("commit: expected to go to the rooms, but got %s", location)
+	}
+	if flash := session.GetString(ctx, "flash"); !strings.Contains(flash, "2 rooms imported from old-system.csv") {
+		t.Errorf("commit: expected a summary, but got %q", flash)
+	}
+	if session.Exists(ctx, "import") {
+		t.Error("commit: expected the upload to be cleared from the session")
+	}
+}
+
+func TestAdminImportReservations(t *testing.T) {
+	useFixtureRepo(t)
+
+	// The test database has no rooms, so every row fails
+	file := "first_name,last_name,email,phone,room,start_date,end_date\n" +
+		"John,Smith,john@here.com,555,Attic,2026-01-01,2026-01-03\n"
+
+	req := importUpload(t, "reservations", file)
+	ctx := getContext(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportUpload).ServeHTTP(rr, req)
+
+	req, _ = http.NewRequest("GET", "/admin/import", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminImport).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "There is no room called &#34;Attic&#34;") {
+		t.Error("expected the preview to show the row error")
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/import/cancel", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportCancel).ServeHTTP(rr, req)
+
+	if session.Exists(ctx, "import") {
+		t.Error("expected cancel to clear the upload from the session")
+	}
+
+	// A file that isn't a CSV of rows is refused at upload
+	req = importUpload(t, "reservations", "first_name,last_name\n")
+	ctx = getContext(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminImportUpload).ServeHTTP(rr, req)
+
+	if errorMessage := session.GetString(ctx, "error"); !strings.Contains(errorMessage, "no rows below its header") {
+		t.Errorf("expected an empty file to be refused, but got %q", errorMessage)
+	}
+}
+
+var adminAPIKeyTests = []struct {
+	name                 string
+	postedData           string
+	expectedResponseCode int
+	// Whether a new key should be waiting in the session to be shown
+	expectedKey bool
+}{
+	{"valid", "name=Channel+manager&scope=booking&rate_limit=120", http.StatusSeeOther, true},
+	{"short-name", "name=CM&scope=booking&rate_limit=120", http.StatusOK, false},
+	{"unknown-scope", "name=Channel+manager&scope=owner&rate_limit=120", http.StatusOK, false},
+	{"zero-limit", "name=Channel+manager&scope=booking&rate_limit=0", http.StatusOK, false},
+	{"missing-limit", "name=Channel+manager&scope=booking", http.StatusOK, false},
+}
+
+func TestAdminAPIKeys(t *testing.T) {
+	useFixtureRepo(t)
+
+	for _, e := range adminAPIKeyTests {
+		req, _ := http.NewRequest("POST", "/admin/api-keys", strings.NewReader(e.postedData))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := getContext(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostAdminAPIKey).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		key := session.GetString(ctx, "new_api_key")
+		if (key != "") != e.expectedKey {
+			t.Errorf("failed %s: expected a new key %v, but got %q", e.name, e.expectedKey, key)
+		}
+
+		if !e.expectedKey {
+			continue
+		}
+
+		// The key is shown once, on the page redirected to
+		req, _ = http.NewRequest("GET", "/admin/api-keys", nil)
+		req = req.WithContext(ctx)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminAPIKeys).ServeHTTP(rr, req)
+
+		if !strings.Contains(rr.Body.String(), key) {
+			t.Errorf("failed %s: expected the new key on the page", e.name)
+		}
+
+		if session.GetString(ctx, "new_api_key") != "" {
+			t.Errorf("failed %s: expected the key to be shown only once", e.name)
+		}
+	}
+}
+
+func TestAdminRevokeAPIKey(t *testing.T) {
+	useFixtureRepo(t)
+
+	_, err := Repo.DB.InsertAPIKey(context.Background(), models.APIKey{
+		Name: "Channel manager", Prefix: "bk_revoke1", Scope: models.ScopeBooking, RateLimit: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []struct {
+		id            string
+		expectedError bool
+	}{
+		{"1", false},
+		{"9", true},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/api-keys/"+e.id+"/revoke", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := context.WithValue(getContext(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminRevokeAPIKey).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed revoking %s: expected code %d, but got %d", e.id, http.StatusSeeOther, rr.Code)
+		}
+
+		if hasError := session.GetString(ctx, "error") != ""; hasError != e.expectedError {
+			t.Errorf("failed revoking %s: expected an error %v", e.id, e.expectedError)
+		}
+	}
+}
+
+var adminWebhookTests = []struct {
+	name                 string
+	postedData           string
+	expectedResponseCode int
+	expectedLocation     string
+}{
+	{"valid", "url=https://crm.example.com/hooks&description=CRM&events=reservation.created&events=reservation.cancelled", http.StatusSeeOther, "/admin/webhooks/1"},
+	{"missing-url", "events=reservation.created", http.StatusOK, ""},
+	{"not-http", "url=ftp://crm.example.com/hooks&events=reservation.created", http.StatusOK, ""},
+	{"relative-url", "url=/hooks&events=reservation.created", http.StatusOK, ""},
+	{"no-events", "url=https://crm.example.com/hooks", http.StatusOK, ""},
+	{"unknown-event", "url=https://crm.example.com/hooks&events=guest.arrived", http.StatusOK, ""},
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	useFixtureRepo(t)
+
+	for _, e := range adminWebhookTests {
+		req, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(e.postedData))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(getContext(req))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostAdminWebhook).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// addWebhook adds webhook 1, sent event, with a failed delivery 1 waiting to be retried
+func addWebhook(t *testing.T, event string) {
+	t.Helper()
+
+	id, err := Repo.DB.InsertWebhook(context.Background(), models.Webhook{
+		URL: "https://crm.example.com/hooks", Secret: "whsec_test", Events: []string{event}, Active: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Repo.DB.InsertWebhookDelivery(context.Background(), models.WebhookDelivery{
+		WebhookID: id, Event: event, Payload: "{}", Status: models.DeliveryFailed, Attempts: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var adminWebhookPageTests = []struct {
+	name                 string
+	method               string
+	params               map[string]string
+	postedData           string
+	handler              func(*Repository, http.ResponseWriter, *http.Request)
+	expectedResponseCode int
+}{
+	{"show", "GET", map[string]string{"id": "1"}, "", (*Repository).AdminWebhook, http.StatusOK},
+	{"show-missing", "GET", map[string]string{"id": "9"}, "", (*Repository).AdminWebhook, http.StatusNotFound},
+	{"pause", "POST", map[string]string{"id": "1"}, "active=false", (*Repository).AdminToggleWebhook, http.StatusSeeOther},
+	{"resume", "POST", map[string]string{"id": "1"}, "active=true", (*Repository).AdminToggleWebhook, http.StatusSeeOther},
+	{"retry", "POST", map[string]string{"id": "1", "delivery": "1"}, "", (*Repository).AdminRetryWebhookDelivery, http.StatusSeeOther},
+	{"retry-missing", "POST", map[string]string{"id": "1", "delivery": "9"}, "", (*Repository).AdminRetryWebhookDelivery, http.StatusNotFound},
+	{"delete", "POST", map[string]string{"id": "1"}, "", (*Repository).AdminDeleteWebhook, http.StatusSeeOther},
+	{"delete-missing", "POST", map[string]string{"id": "9"}, "", (*Repository).AdminDeleteWebhook, http.StatusNotFound},
+}
+
+func TestAdminWebhookPages(t *testing.T) {
+	useFixtureRepo(t)
+	addWebhook(t, webhooks.EventReservationCreated)
+
+	for _, e := range adminWebhookPageTests {
+		req, _ := http.NewRequest(e.method, "/admin/webhooks", strings.NewReader(e.postedData))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rctx := chi.NewRouteContext()
+		for key, value := range e.params {
+			rctx.URLParams.Add(key, value)
+		}
+		req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+func TestWebhookEmitted(t *testing.T) {
+	useFixtureRepo(t)
+	addWebhook(t, webhooks.EventReservationCancelled)
+
+	// Drain any signal left by earlier tests
+	select {
+	case <-app.WebhookChannel:
+	default:
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/reservations/all/1/status", strings.NewReader("status=cancelled"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("src", "all")
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminUpdateReservationStatus).ServeHTTP(rr, req)
+
+	select {
+	case <-app.WebhookChannel:
+	default:
+		t.Error("expected a status change to queue a webhook and wake the sender")
+	}
+
+	// A refused change sends nothing
+	req, _ = http.NewRequest("POST", "/admin/reservations/all/1/status", strings.NewReader("status=checked-out"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminUpdateReservationStatus).ServeHTTP(rr, req)
+
+	select {
+	case <-app.WebhookChannel:
+		t.Error("expected a refused status change not to queue a webhook")
+	default:
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/atuprosper/booking-project/internal/version"
+)
+
+// check is one thing the site needs to serve requests
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// checkResult is how a check went, as /readyz reports it
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readiness is the body of /readyz
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// Healthz tells the load balancer the process is up. It checks nothing else, so a database outage doesn't get
+// every instance restarted
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz tells the load balancer whether to send requests here, with how each check went. It is unavailable
+// until the server starts and once it starts shutting down, and while a check fails
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+	body := readiness{Status: "ok", Checks: make(map[string]checkResult)}
+	status := http.StatusOK
+
+	for _, c := range m.readinessChecks() {
+		err := c.run(r.Context())
+		if err != nil {
+			body.Checks[c.name] = checkResult{Status: "failing", Error: err.Error()}
+			body.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		body.Checks[c.name] = checkResult{Status: "ok"}
+	}
+
+	writeJSON(w, status, body)
+}
+
+// readinessChecks returns what the site needs to serve requests
+func (m *Repository) readinessChecks() []check {
+	return []check{
+		{"server", func(ctx context.Context) error {
+			if !m.App.Ready.Load() {
+				return errors.New("the server is starting or shutting down")
+			}
+			return nil
+		}},
+		{"database", func(ctx context.Context) error {
+			if m.pool == nil {
+				// Kept in memory, so always there
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, m.App.DBTimeouts.For("Ping"))
+			defer cancel()
+			return m.pool.SQL.PingContext(ctx)
+		}},
+		{"templates", func(ctx context.Context) error {
+			if m.App.UseCache && len(m.App.TemplateCache) == 0 {
+				return errors.New("the template cache is empty")
+			}
+			return nil
+		}},
+		{"mail", func(ctx context.Context) error {
+			if !m.App.MailWorker.Load() {
+				return errors.New("the mail worker isn't running")
+			}
+			return nil
+		}},
+	}
+}
+
+// Version shows what the running binary was built from
+func (m *Repository) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
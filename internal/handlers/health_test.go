@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/version"
+)
+
+// readyz asks repo whether it is ready, returning the status code and body
+func readyz(t *testing.T, repo *Repository) (int, readiness) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	repo.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	var body readiness
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, body
+}
+
+func TestReadyz(t *testing.T) {
+	db, err := driver.NewDatabase("sqlite://" + filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRepo(&app, &driver.DB{SQL: db, Driver: driver.SQLite})
+	app.Ready.Store(true)
+	app.MailWorker.Store(true)
+	t.Cleanup(func() {
+		app.Ready.Store(false)
+		app.MailWorker.Store(false)
+	})
+
+	code, body := readyz(t, repo)
+	if code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("expected ready, but got %d %+v", code, body)
+	}
+	for _, name := range []string{"server", "database", "templates", "mail"} {
+		if body.Checks[name].Status != "ok" {
+			t.Errorf("expected the %s check to pass, but got %+v", name, body.Checks[name])
+		}
+	}
+
+	// Everything going wrong at once is reported check by check
+	db.Close()
+	app.MailWorker.Store(false)
+	app.Ready.Store(false)
+
+	code, body = readyz(t, repo)
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("expected unavailable, but got %d %+v", code, body)
+	}
+	for _, name := range []string{"server", "database", "mail"} {
+		if body.Checks[name].Status != "failing" || body.Checks[name].Error == "" {
+			t.Errorf("expected the %s check to fail with its error, but got %+v", name, body.Checks[name])
+		}
+	}
+	if body.Checks["templates"].Status != "ok" {
+		t.Errorf("expected the templates check to pass, but got %+v", body.Checks["templates"])
+	}
+}
+
+func TestReadyz_TemplateCache(t *testing.T) {
+	repo := NewMemoryRepo(&app)
+	app.Ready.Store(true)
+	app.MailWorker.Store(true)
+
+	cache := app.TemplateCache
+	useCache := app.UseCache
+	app.UseCache = true
+	app.TemplateCache = map[string]*template.Template{}
+	t.Cleanup(func() {
+		app.Ready.Store(false)
+		app.MailWorker.Store(false)
+		app.TemplateCache = cache
+		app.UseCache = useCache
+	})
+
+	code, body := readyz(t, repo)
+	if code != http.StatusServiceUnavailable || body.Checks["templates"].Status != "failing" {
+		t.Errorf("expected an empty template cache to fail, but got %d %+v", code, body)
+	}
+	if body.Checks["database"].Status != "ok" {
+		t.Errorf("expected the in-memory database to be up, but got %+v", body.Checks["database"])
+	}
+}
+
+func TestHealthzAndVersion(t *testing.T) {
+	repo := NewMemoryRepo(&app)
+
+	rr := httptest.NewRecorder()
+	repo.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the process to be healthy even before it is ready, but got %d", rr.Code)
+	}
+
+	version.Version = "v1.2.3"
+	version.Commit = "abc123"
+	t.Cleanup(func() {
+		version.Version = "dev"
+		version.Commit = ""
+	})
+
+	rr = httptest.NewRecorder()
+	repo.Version(rr, httptest.NewRequest("GET", "/version", nil))
+
+	var info version.Info
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v1.2.3" || info.Commit != "abc123" || info.GoVersion == "" {
+		t.Errorf("expected the build metadata, but got %+v", info)
+	}
+}
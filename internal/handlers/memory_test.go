@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/api"
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// useMemoryRepo points the handlers at a repository that keeps what is booked, until the test ends.
+// It returns an API key allowed to make bookings
+func useMemoryRepo(t *testing.T) string {
+	t.Helper()
+
+	previous := Repo
+	t.Cleanup(func() { NewHandlers(previous) })
+	NewHandlers(NewMemoryRepo(&app))
+
+	key, prefix, err := api.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Repo.DB.InsertAPIKey(context.Background(), models.APIKey{
+		Name:      "Tests",
+		Prefix:    prefix,
+		Hash:      api.HashKey(key),
+		Scope:     models.ScopeBooking,
+		RateLimit: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Each step runs against what the steps before it booked
+var memoryBookingSteps = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+	// The rooms the availability steps expect to find free
+	expectedRooms int
+}{
+	{"free", "GET", "/api/v1/availability?start=2040-01-10&end=2040-01-12", "", http.StatusOK, 2},
+	{
+		"book-room-1", "POST", "/api/v1/reservations",
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "2040-01-10", "end_date": "2040-01-12"}`,
+		http.StatusCreated, 0,
+	},
+	{"room-1-taken", "GET", "/api/v1/availability?start=2040-01-11&end=2040-01-13", "", http.StatusOK, 1},
+	{"other-dates-free", "GET", "/api/v1/availability?start=2040-02-10&end=2040-02-12", "", http.StatusOK, 2},
+	{
+		"book-room-1-again", "POST", "/api/v1/reservations",
+		`{"first_name": "Jane", "last_name": "Doe", "email": "jane@doe.com", "phone": "555", "room_id": 1, "start_date": "2040-01-11", "end_date": "2040-01-13"}`,
+		http.StatusConflict, 0,
+	},
+	{"cancel", "POST", "/api/v1/reservations/1/cancel", "", http.StatusOK, 0},
+	{"room-1-free-again", "GET", "/api/v1/availability?start=2040-01-11&end=2040-01-13", "", http.StatusOK, 2},
+	{"cancel-again", "POST", "/api/v1/reservations/1/cancel", "", http.StatusConflict, 0},
+}
+
+func TestMemoryBooking(t *testing.T) {
+	key := useMemoryRepo(t)
+	routes := apiRoutes()
+
+	for _, e := range memoryBookingSteps {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Fatalf("%s: expected status %d, but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+		}
+
+		if !strings.Contains(e.url, "availability") {
+			continue
+		}
+
+		var response api.AvailabilityResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &response)
+		if len(response.Data.Rooms) != e.expectedRooms {
+			t.Errorf("%s: expected %d rooms free, but got %+v", e.name, e.expectedRooms, response.Data.Rooms)
+		}
+	}
+}
+
+func TestMemoryAvailabilityJSON(t *testing.T) {
+	useMemoryRepo(t)
+
+	search := func() bool {
+		form := url.Values{"start": {"2040-01-10"}, "end": {"2040-01-12"}, "room_id": {"2"}}
+		req, _ := http.NewRequest("POST", "/reservation-json", strings.NewReader(form.Encode()))
+		req = req.WithContext(getContext(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		Repo.AvailabilityJSON(rr, req)
+
+		var j jsonResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &j)
+		return j.Ok
+	}
+
+	if !search() {
+		t.Fatal("expected room 2 to be free before it is booked")
+	}
+
+	reservation := models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555",
+		RoomID: 2, StartDate: time.Date(2040, 1, 11, 0, 0, 0, 0, time.UTC),
+		EndDate: time.Date(2040, 1, 14, 0, 0, 0, 0, time.UTC)}
+	if _, err := Repo.Booking.CreateReservation(context.Background(), reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	if search() {
+		t.Error("expected room 2 to be taken once it is booked")
+	}
+}
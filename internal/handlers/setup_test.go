@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"html/template"
@@ -13,6 +14,8 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/helpers"
+	"github.com/atuprosper/booking-project/internal/importer"
 	"github.com/atuprosper/booking-project/internal/models"
 	"github.com/atuprosper/booking-project/internal/render"
 	"github.com/go-chi/chi"
@@ -39,6 +42,7 @@ func TestMain(m *testing.M) {
 	gob.Register(models.Restriction{})
 	gob.Register(models.TodoList{})
 	gob.Register(map[string]int{})
+	gob.Register(importer.Upload{})
 
 	// change this to true when in production
 	app.InProduction = false
@@ -60,6 +64,8 @@ func TestMain(m *testing.M) {
 
 	mailChannel := make(chan models.MailData)
 	app.MailChannel = mailChannel
+
+	app.WebhookChannel = make(chan struct{}, 1)
 	defer close(mailChannel)
 
 	listenForMail()
@@ -72,14 +78,92 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = true
 
-	repo := NewTestRepo(&app)
+	repo, err := newFixtureRepo()
+	if err != nil {
+		log.Fatal("cannot seed the test repository:", err)
+	}
 	NewHandlers(repo)
 
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
 
+// fixtureReservations are booked into every fixture repository, getting ids 1, 2 and 3
+var fixtureReservations = []models.Reservation{
+	{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555-1000", RoomID: 1,
+		StartDate: time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 1, 12, 0, 0, 0, 0, time.UTC)},
+	{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", Phone: "555-2000", RoomID: 2,
+		StartDate: time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 1, 12, 0, 0, 0, 0, time.UTC)},
+	{FirstName: "Ann", LastName: "Brown", Email: "ann@brown.com", Phone: "555-3000", RoomID: 1,
+		StartDate: time.Date(2040, 2, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 2, 12, 0, 0, 0, 0, time.UTC)},
+}
+
+// newFixtureRepo returns handlers on an in-memory repository holding the seeded rooms and admin, priced at 100 and
+// 150 a night, and the pending fixtureReservations. They are written straight to the repository, so nothing is
+// audited or sent for them
+func newFixtureRepo() (*Repository, error) {
+	repo := NewMemoryRepo(&app)
+	ctx := context.Background()
+
+	for id, price := range map[int]string{1: "100", 2: "150"} {
+		room, err := repo.DB.GetRoomByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		room.Price = price
+		if err := repo.DB.UpdateRoom(ctx, room); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, reservation := range fixtureReservations {
+		id, err := repo.DB.InsertReservation(ctx, reservation)
+		if err != nil {
+			return nil, err
+		}
+
+		err = repo.DB.InsertRoomRestriction(ctx, models.RoomRestriction{
+			StartDate:     reservation.StartDate,
+			EndDate:       reservation.EndDate,
+			RoomID:        reservation.RoomID,
+			ReservationID: id,
+			RestrictionID: 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
+
+// useFixtureRepo points the handlers at a fresh fixture repository until the test ends, for tests that change it
+func useFixtureRepo(t *testing.T) {
+	t.Helper()
+
+	repo, err := newFixtureRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Repo
+	t.Cleanup(func() { NewHandlers(previous) })
+	NewHandlers(repo)
+}
+
+// useTestRepo points the handlers at the canned test repository until the test ends. It answers any id, and its
+// magic ids, dates and keys make queries fail, so it suits the tests of how handlers cope with a failing database
+func useTestRepo(t *testing.T) {
+	t.Helper()
+
+	previous := Repo
+	t.Cleanup(func() { NewHandlers(previous) })
+	NewHandlers(NewTestRepo(&app))
+}
+
 func listenForMail() {
 	go func() {
 		for {
@@ -111,7 +195,7 @@ func getRoutes() http.Handler {
 
 	mux.Get("/user/login", Repo.Login)
 	mux.Post("/user/login", Repo.PostLogin)
-	mux.Get("/user/logout", Repo.Logout)
+	mux.Post("/user/logout", Repo.Logout)
 
 	mux.Get("/dashboard", Repo.AdminDashboard)
 
@@ -128,14 +212,50 @@ func getRoutes() http.Handler {
 	mux.Post("/admin/rooms/{id}", Repo.PostAdminSingleRoom)
 	mux.Get("/admin/rooms/new-room", Repo.AdminNewRoom)
 	mux.Post("/admin/rooms/new-room", Repo.PostAdminNewRoom)
-	mux.Get("/admin/delete-room/{id}", Repo.AdminDeleteRoom)
+	mux.Post("/admin/delete-room/{id}", Repo.AdminDeleteRoom)
 
-	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
-	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Post("/admin/reservations/{src}/{id}/notes", Repo.PostAdminReservationNote)
+	mux.Post("/admin/reservations/{src}/{id}/message", Repo.PostAdminReservationMessage)
+	mux.Post("/admin/reservations/{src}/{id}/status", Repo.AdminUpdateReservationStatus)
+	mux.Post("/admin/delete-reservation/{src}/{id}", Repo.AdminDeleteReservation)
+	mux.Post("/admin/reservations/bulk", Repo.AdminBulkReservations)
 
 	mux.Get("/admin/todo-list", Repo.AdminTodoList)
 	mux.Post("/admin/todo-list", Repo.PostAdminTodoList)
-	mux.Get("/admin/delete-todo/{id}", Repo.AdminDeleteTodo)
+	mux.Post("/admin/delete-todo/{id}", Repo.AdminDeleteTodo)
+
+	mux.Get("/admin/audit", Repo.AdminAuditLog)
+
+	mux.Get("/admin/reports", Repo.AdminReports)
+	mux.Get("/admin/reports/{report}/{format}", Repo.AdminDownloadReport)
+
+	mux.Get("/admin/api-keys", Repo.AdminAPIKeys)
+	mux.Post("/admin/api-keys", Repo.PostAdminAPIKey)
+	mux.Post("/admin/api-keys/{id}/revoke", Repo.AdminRevokeAPIKey)
+
+	mux.Get("/admin/webhooks", Repo.AdminWebhooks)
+	mux.Post("/admin/webhooks", Repo.PostAdminWebhook)
+	mux.Get("/admin/webhooks/{id}", Repo.AdminWebhook)
+	mux.Post("/admin/webhooks/{id}/active", Repo.AdminToggleWebhook)
+	mux.Post("/admin/webhooks/{id}/delete", Repo.AdminDeleteWebhook)
+	mux.Post("/admin/webhooks/{id}/deliveries/{delivery}/retry", Repo.AdminRetryWebhookDelivery)
+
+	mux.Get("/admin/import", Repo.AdminImport)
+	mux.Post("/admin/import/upload", Repo.PostAdminImportUpload)
+	mux.Post("/admin/import/mapping", Repo.PostAdminImportMapping)
+	mux.Post("/admin/import/commit", Repo.PostAdminImportCommit)
+	mux.Post("/admin/import/cancel", Repo.PostAdminImportCancel)
+
+	mux.Get("/admin/today", Repo.AdminFrontDesk)
+	mux.Get("/admin/today/no-shows", Repo.AdminNoShowReport)
+	mux.Post("/admin/today/{id}/check-in", Repo.AdminCheckIn)
+	mux.Post("/admin/today/{id}/check-out", Repo.AdminCheckOut)
+	mux.Post("/admin/today/{id}/no-show", Repo.AdminMarkNoShow)
+
+	mux.Get("/admin/trash/reservations", Repo.AdminTrashReservations)
+	mux.Post("/admin/trash/reservations/{id}/restore", Repo.AdminRestoreReservation)
+	mux.Get("/admin/trash/rooms", Repo.AdminTrashRooms)
+	mux.Post("/admin/trash/rooms/{id}/restore", Repo.AdminRestoreRoom)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/api"
+	"github.com/atuprosper/booking-project/internal/audit"
+	"github.com/atuprosper/booking-project/internal/booking"
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/webhooks"
+)
+
+// subscribe hooks the side effects of a change up to the events that announce it. Audit entries and webhook
+// deliveries are written in the change's transaction, so neither is lost if the other is. The webhook sender
+// is woken and the metrics counted once the change is committed, and mail is sent in the background
+func (m *Repository) subscribe(bus *events.Bus) {
+	bus.Subscribe("audit", events.InTx, m.auditEvent)
+	bus.Subscribe("webhooks", events.InTx, m.webhookEvent)
+	bus.Subscribe("webhook-sender", events.Inline, m.webhookSent)
+	bus.Subscribe("metrics", events.Inline, m.metricsEvent)
+	bus.Subscribe("mail", events.Async, m.mailEvent)
+}
+
+// actor returns the context of r, saying which admin is making the changes for the events announcing them
+func (m *Repository) actor(r *http.Request) context.Context {
+	return booking.WithUser(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+}
+
+// blockChange is what the audit log records when an owner block is added or removed
+type blockChange struct {
+	Date string
+}
+
+// messageChange is what the audit log records when a guest is written to
+type messageChange struct {
+	Subject string
+}
+
+// trashChange is what the audit log records when a reservation or room is taken out of the trash
+type trashChange struct {
+	Deleted string
+}
+
+// restored returns the audit changes for taking something deleted at deletedAt out of the trash
+func restored(deletedAt time.Time) []models.AuditChange {
+	return audit.Diff(trashChange{Deleted: deletedAt.Format("2006-01-02 15:04:05")}, trashChange{})
+}
+
+// auditEvent records who changed what in the audit log
+func (m *Repository) auditEvent(ctx context.Context, event events.Event) error {
+	entry := models.AuditLog{UserID: event.Metadata().UserID}
+
+	switch e := event.(type) {
+	case events.ReservationCreated:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionCreate, audit.EntityReservation, e.Reservation.ID
+		entry.Changes = audit.Diff(nil, e.Reservation)
+	case events.ReservationUpdated:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionUpdate, audit.EntityReservation, e.After.ID
+		entry.Changes = audit.Diff(e.Before, e.After)
+	case events.ReservationStatusChanged:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionStatusChange, audit.EntityReservation, e.After.ID
+		entry.Changes = audit.Diff(e.Before, e.After)
+	case events.ReservationDeleted:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionDelete, audit.EntityReservation, e.Reservation.ID
+		entry.Changes = audit.Diff(e.Reservation, nil)
+	case events.ReservationRestored:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionRestore, audit.EntityReservation, e.ReservationID
+		entry.Changes = restored(e.DeletedAt)
+	case events.RoomCreated:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionCreate, audit.EntityRoom, e.Room.ID
+		entry.Changes = audit.Diff(nil, e.Room)
+	case events.RoomUpdated:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionUpdate, audit.EntityRoom, e.After.ID
+		entry.Changes = audit.Diff(e.Before, e.After)
+	case events.RoomDeleted:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionDelete, audit.EntityRoom, e.Room.ID
+		entry.Changes = audit.Diff(e.Room, nil)
+	case events.RoomRestored:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionRestore, audit.EntityRoom, e.RoomID
+		entry.Changes = restored(e.DeletedAt)
+	case events.RoomBlocked:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionBlockAdded, audit.EntityRoom, e.RoomID
+		entry.Changes = audit.Diff(nil, blockChange{Date: e.Date.Format("2006-01-02")})
+	case events.RoomUnblocked:
+		entry.Action, entry.Entity, entry.EntityID = audit.ActionBlockRemoved, audit.EntityRoom, e.RoomID
+		entry.Changes = audit.Diff(blockChange{Date: e.Date.Format("2006-01-02")}, nil)
+	case events.GuestsMessaged:
+		// Recorded against each reservation, so the message shows in every one's history
+		for _, reservation := range e.Reservations {
+			entry.Action, entry.Entity, entry.EntityID = audit.ActionMessage, audit.EntityReservation, reservation.ID
+			entry.Changes = audit.Diff(nil, messageChange{Subject: e.Subject})
+			if err := m.DB.InsertAuditLog(ctx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	return m.DB.InsertAuditLog(ctx, entry)
+}
+
+// webhookPayload returns the webhook event integrations know event as and what they are sent for it, and false
+// for the events they can't subscribe to
+func webhookPayload(event events.Event) (string, interface{}, bool) {
+	switch e := event.(type) {
+	case events.ReservationCreated:
+		if e.Imported {
+			return "", nil, false
+		}
+		return webhooks.EventReservationCreated, api.FromReservation(e.Reservation), true
+	case events.ReservationUpdated:
+		return webhooks.EventReservationUpdated, api.FromReservation(e.After), true
+	case events.ReservationStatusChanged:
+		if e.After.Status == models.StatusCancelled {
+			return webhooks.EventReservationCancelled, api.FromReservation(e.After), true
+		}
+		return webhooks.EventReservationUpdated, api.FromReservation(e.After), true
+	case events.RoomBlocked:
+		return webhooks.EventRoomBlocked, webhooks.RoomBlocked{RoomID: e.RoomID, Date: e.Date.Format("2006-01-02")}, true
+	}
+	return "", nil, false
+}
+
+// webhookEvent queues the events integrations can subscribe to for the webhooks that want them
+func (m *Repository) webhookEvent(ctx context.Context, event events.Event) error {
+	name, data, ok := webhookPayload(event)
+	if !ok {
+		return nil
+	}
+
+	_, err := webhooks.Enqueue(ctx, m.DB, name, data)
+	return err
+}
+
+// webhookSent wakes the webhook sender for the deliveries webhookEvent queued, now they are committed and it can see them
+func (m *Repository) webhookSent(ctx context.Context, event events.Event) error {
+	if _, _, ok := webhookPayload(event); ok {
+		m.wakeWebhooks()
+	}
+	return nil
+}
+
+// metricsEvent counts the bookings made and the searches for free rooms
+func (m *Repository) metricsEvent(ctx context.Context, event events.Event) error {
+	switch e := event.(type) {
+	case events.ReservationCreated:
+		if !e.Imported {
+			metrics.ReservationsCreated.Inc()
+		}
+	case events.AvailabilitySearched:
+		if e.Rooms == 0 {
+			metrics.AvailabilitySearches.WithLabelValues("none").Inc()
+		} else {
+			metrics.AvailabilitySearches.WithLabelValues("available").Inc()
+		}
+	}
+	return nil
+}
+
+// mailEvent confirms new bookings to the guest and the admin, and sends what staff write to guests
+func (m *Repository) mailEvent(ctx context.Context, event events.Event) error {
+	switch e := event.(type) {
+	case events.ReservationCreated:
+		if e.Imported {
+			return nil
+		}
+
+		for _, message := range m.Mail.ConfirmationMails(e.Reservation) {
+			m.App.MailChannel <- message
+		}
+	case events.GuestsMessaged:
+		for _, reservation := range e.Reservations {
+			m.App.MailChannel <- m.Mail.GuestMessage(reservation, e.Subject, e.Message)
+		}
+	}
+	return nil
+}
+
+// wakeWebhooks tells the sender there are deliveries to send now. It never waits, as the sender is
+// already awake if there is a signal waiting
+func (m *Repository) wakeWebhooks() {
+	if m.App.WebhookChannel == nil {
+		return
+	}
+
+	select {
+	case m.App.WebhookChannel <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/audit"
+	"github.com/atuprosper/booking-project/internal/events"
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// eventRecorder keeps the events published while it is subscribed
+type eventRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (e *eventRecorder) record(ctx context.Context, event events.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.names = append(e.names, event.Name())
+	return nil
+}
+
+var handlerEventTests = []struct {
+	name    string
+	method  string
+	url     string
+	params  map[string]string
+	data    string
+	handler func(*Repository, http.ResponseWriter, *http.Request)
+	// The events the handler should publish, in order
+	expected []string
+}{
+	{
+		"edit-reservation", "POST", "/admin/reservations/all/1", nil,
+		"first_name=John&last_name=Smith&email=john@smith.com&phone=555&year=2040&month=01",
+		(*Repository).PostAdminSingleReservation, []string{"reservation.updated"},
+	},
+	{
+		"edit-reservation-invalid", "POST", "/admin/reservations/all/1", nil,
+		"first_name=J&last_name=Smith&email=john@smith.com&phone=555",
+		(*Repository).PostAdminSingleReservation, nil,
+	},
+	{
+		"change-status", "POST", "/admin/reservations/all/1/status", map[string]string{"src": "all", "id": "1"},
+		"status=cancelled", (*Repository).AdminUpdateReservationStatus, []string{"reservation.status_changed"},
+	},
+	{
+		"change-status-refused", "POST", "/admin/reservations/all/1/status", map[string]string{"src": "all", "id": "1"},
+		"status=checked-out", (*Repository).AdminUpdateReservationStatus, nil,
+	},
+	{
+		// The front desk confirms a pending reservation on the way
+		"check-in", "POST", "/admin/today/1/check-in", map[string]string{"id": "1"},
+		"", (*Repository).AdminCheckIn, []string{"reservation.status_changed", "reservation.status_changed"},
+	},
+	{
+		"no-show", "POST", "/admin/today/1/no-show", map[string]string{"id": "1"},
+		"", (*Repository).AdminMarkNoShow, []string{"reservation.status_changed", "reservation.status_changed"},
+	},
+	{
+		"check-out-refused", "POST", "/admin/today/1/check-out", map[string]string{"id": "1"},
+		"", (*Repository).AdminCheckOut, nil,
+	},
+	{
+		"message-guest", "POST", "/admin/reservations/all/1/message", map[string]string{"src": "all", "id": "1"},
+		"subject=Parking&message=Your+space+is+B12", (*Repository).PostAdminReservationMessage, []string{"guests.messaged"},
+	},
+	{
+		"message-missing-guest", "POST", "/admin/reservations/all/100/message", map[string]string{"src": "all", "id": "100"},
+		"subject=Parking&message=Your+space+is+B12", (*Repository).PostAdminReservationMessage, nil,
+	},
+	{
+		"delete-reservation", "POST", "/admin/delete-reservation/all/1", map[string]string{"src": "all", "id": "1"},
+		"", (*Repository).AdminDeleteReservation, []string{"reservation.deleted"},
+	},
+	{
+		"bulk-status", "POST", "/admin/reservations/bulk", nil,
+		"action=status&status=confirmed&id=1&id=2", (*Repository).AdminBulkReservations,
+		[]string{"reservation.status_changed", "reservation.status_changed"},
+	},
+	{
+		"bulk-delete", "POST", "/admin/reservations/bulk", nil,
+		"action=delete&id=1&id=2", (*Repository).AdminBulkReservations,
+		[]string{"reservation.deleted", "reservation.deleted"},
+	},
+	{
+		"new-room", "POST", "/admin/rooms/new-room", nil,
+		"room_name=Sea+View&price=120&image_src=sea.png&description=By+the+sea",
+		(*Repository).PostAdminNewRoom, []string{"room.created"},
+	},
+	{
+		"edit-room", "POST", "/admin/rooms/1", nil,
+		"room_name=Sea+View&price=120&image_src=sea.png&description=By+the+sea",
+		(*Repository).PostAdminSingleRoom, []string{"room.updated"},
+	},
+	{
+		"delete-room", "POST", "/admin/delete-room/1", map[string]string{"id": "1"},
+		"", (*Repository).AdminDeleteRoom, []string{"room.deleted"},
+	},
+	{
+		"restore-room", "POST", "/admin/trash/rooms/1/restore", map[string]string{"id": "1"},
+		"", (*Repository).AdminRestoreRoom, []string{"room.restored"},
+	},
+	{
+		"block-room", "POST", "/admin/reservations-calendar", nil,
+		"year=2040&month=1&add_block_1_2040-01-02=1", (*Repository).AdminPostReservationsCalendar,
+		[]string{"room.blocked"},
+	},
+	{
+		"api-create-reservation", "POST", "/api/v1/reservations", nil,
+		`{"first_name": "John", "last_name": "Smith", "email": "john@smith.com", "phone": "555", "room_id": 1, "start_date": "2040-01-01", "end_date": "2040-01-03"}`,
+		(*Repository).APICreateReservation, []string{"reservation.created"},
+	},
+	{
+		"api-cancel-reservation", "POST", "/api/v1/reservations/1/cancel", map[string]string{"id": "1"},
+		"", (*Repository).APICancelReservation, []string{"reservation.status_changed"},
+	},
+}
+
+func TestHandlerEvents(t *testing.T) {
+	for _, e := range handlerEventTests {
+		// Every case starts from the fixtures
+		useFixtureRepo(t)
+
+		recorder := &eventRecorder{}
+		unsubscribe := Repo.Events.Subscribe("recorder", events.Inline, recorder.record)
+
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.data))
+		req.RequestURI = e.url
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rctx := chi.NewRouteContext()
+		for key, value := range e.params {
+			rctx.URLParams.Add(key, value)
+		}
+		ctx := getContext(req)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		// The calendar page leaves each room's blocks in the session for its POST
+		session.Put(ctx, "block_map_1", map[string]int{})
+		session.Put(ctx, "block_map_2", map[string]int{})
+
+		rr := httptest.NewRecorder()
+		e.handler(Repo, rr, req)
+		unsubscribe()
+
+		if !reflect.DeepEqual(recorder.names, e.expected) {
+			t.Errorf("failed %s: expected events %v, but got %v", e.name, e.expected, recorder.names)
+		}
+	}
+}
+
+func TestRestoreReservationUnavailableEvents(t *testing.T) {
+	useFixtureRepo(t)
+	ctx := context.Background()
+
+	// John Smith's room is rebooked for his dates while his reservation is in the trash
+	if _, err := Repo.Booking.DeleteReservation(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	rebooked := fixtureReservations[0]
+	rebooked.FirstName = "Jane"
+	if _, err := Repo.Booking.CreateReservation(ctx, rebooked); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &eventRecorder{}
+	defer Repo.Events.Subscribe("recorder", events.Inline, recorder.record)()
+
+	req, _ := http.NewRequest("POST", "/admin/trash/reservations/1/restore", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	Repo.AdminRestoreReservation(rr, req)
+
+	if len(recorder.names) != 0 {
+		t.Errorf("expected a refused restore to publish nothing, but got %v", recorder.names)
+	}
+	if reservation, _ := Repo.DB.GetReservationByID(ctx, 1); reservation.DeletedAt.IsZero() {
+		t.Error("expected the reservation to stay in the trash")
+	}
+}
+
+func TestFailedAuditRollsBack(t *testing.T) {
+	useFixtureRepo(t)
+	ctx := context.Background()
+
+	failure := errors.New("audit log is full")
+	unsubscribe := Repo.Events.Subscribe("failing", events.InTx, func(ctx context.Context, event events.Event) error {
+		return failure
+	})
+	defer unsubscribe()
+
+	recorder := &eventRecorder{}
+	defer Repo.Events.Subscribe("recorder", events.Inline, recorder.record)()
+
+	_, err := Repo.Booking.ChangeStatus(ctx, 1, models.StatusCancelled)
+	if !errors.Is(err, failure) {
+		t.Errorf("expected the subscriber's error, but got %v", err)
+	}
+
+	// The change, and the audit entry written before the failing subscriber ran, are rolled back together
+	if reservation, _ := Repo.DB.GetReservationByID(ctx, 1); reservation.Status == models.StatusCancelled {
+		t.Error("expected the reservation not to be cancelled")
+	}
+	if logs, _ := Repo.DB.GetAuditLogsForEntity(ctx, audit.EntityReservation, 1); len(logs) != 0 {
+		t.Errorf("expected no audit entry, but got %+v", logs)
+	}
+	if len(recorder.names) != 0 {
+		t.Errorf("expected nothing to be published after a rolled back change, but got %v", recorder.names)
+	}
+}
+
+func TestMessageGuestAudit(t *testing.T) {
+	useFixtureRepo(t)
+	ctx := context.Background()
+
+	post := func(id string) (*httptest.ResponseRecorder, context.Context) {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/"+id+"/message", strings.NewReader("subject=Parking&message=Your+space+is+B12"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", id)
+		sessionCtx := getContext(req)
+		req = req.WithContext(context.WithValue(sessionCtx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		Repo.PostAdminReservationMessage(rr, req)
+		return rr, sessionCtx
+	}
+
+	reservation, _ := Repo.DB.GetReservationByID(ctx, 1)
+	reservation.Email = "<b>john@smith.com</b>"
+	if err := Repo.DB.UpdateReservation(ctx, reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	_, sessionCtx := post("1")
+	if flash := session.GetString(sessionCtx, "flash"); !strings.Contains(flash, "&lt;b&gt;john@smith.com") {
+		t.Errorf("expected the guest's email to be escaped in the flash, but got %q", flash)
+	}
+
+	logs, err := Repo.DB.GetAuditLogsForEntity(ctx, audit.EntityReservation, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.AuditChange{{Field: "Subject", To: "Parking"}}
+	if len(logs) != 1 || logs[0].Action != audit.ActionMessage || !reflect.DeepEqual(logs[0].Changes, expected) {
+		t.Errorf("expected the message to be audited, but got %+v", logs)
+	}
+
+	// A reservation in the trash isn't messaged
+	if _, err := Repo.Booking.DeleteReservation(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if rr, _ := post("2"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected a trashed reservation to be refused with %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if logs, _ := Repo.DB.GetAuditLogsForEntity(ctx, audit.EntityReservation, 2); len(logs) != 1 || logs[0].Action != audit.ActionDelete {
+		t.Errorf("expected only the delete to be audited for the trashed reservation, but got %+v", logs)
+	}
+}
+
+func TestMetricsEvents(t *testing.T) {
+	useFixtureRepo(t)
+	ctx := context.Background()
+
+	created := testutil.ToFloat64(metrics.ReservationsCreated)
+	available, none := testutil.ToFloat64(metrics.AvailabilitySearches.WithLabelValues("available")), testutil.ToFloat64(metrics.AvailabilitySearches.WithLabelValues("none"))
+
+	// John Smith's fixture has room 1 from the 10th to the 12th, and Jane Doe's room 2
+	if _, err := Repo.Booking.SearchAvailability(ctx, fixtureReservations[0].StartDate, fixtureReservations[0].EndDate, 0); err != nil {
+		t.Fatal(err)
+	}
+	stay := fixtureReservations[0]
+	stay.StartDate, stay.EndDate = stay.StartDate.AddDate(0, 0, 3), stay.EndDate.AddDate(0, 0, 3)
+	if _, err := Repo.Booking.SearchAvailability(ctx, stay.StartDate, stay.EndDate, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Repo.Booking.CreateReservation(ctx, stay); err != nil {
+		t.Fatal(err)
+	}
+	// Imported reservations were booked long ago, so they aren't counted
+	stay.StartDate, stay.EndDate = stay.StartDate.AddDate(0, 1, 0), stay.EndDate.AddDate(0, 1, 0)
+	if _, err := Repo.Booking.ImportReservations(ctx, []models.Reservation{stay}); err != nil {
+		t.Fatal(err)
+	}
+
+	if testutil.ToFloat64(metrics.ReservationsCreated) != created+1 {
+		t.Errorf("expected one booking to be counted, but got %v", testutil.ToFloat64(metrics.ReservationsCreated)-created)
+	}
+	if testutil.ToFloat64(metrics.AvailabilitySearches.WithLabelValues("available")) != available+1 || testutil.ToFloat64(metrics.AvailabilitySearches.WithLabelValues("none")) != none+1 {
+		t.Error("expected one search with rooms free and one without to be counted")
+	}
+}
+
+func TestMakeReservationEvents(t *testing.T) {
+	recorder := &eventRecorder{}
+	unsubscribe := Repo.Events.Subscribe("recorder", events.Inline, recorder.record)
+	defer unsubscribe()
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader("first_name=John&last_name=Smith&email=john@smith.com&phone=555"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := getContext(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "reservation", models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+	})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostMakeReservation).ServeHTTP(rr, req)
+
+	if !reflect.DeepEqual(recorder.names, []string{"reservation.created"}) {
+		t.Errorf("expected a booking to publish reservation.created, but got %v", recorder.names)
+	}
+}
+
+func TestRestoreAudit(t *testing.T) {
+	useMemoryRepo(t)
+	ctx := context.Background()
+
+	if _, err := Repo.Booking.DeleteRoom(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	room, _ := Repo.DB.GetRoomByID(ctx, 1)
+
+	req, _ := http.NewRequest("POST", "/admin/trash/rooms/1/restore", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(getContext(req), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	Repo.AdminRestoreRoom(rr, req)
+
+	logs, err := Repo.DB.GetAuditLogsForEntity(ctx, audit.EntityRoom, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range logs {
+		if entry.Action != audit.ActionRestore {
+			continue
+		}
+
+		expected := []models.AuditChange{{Field: "Deleted", From: room.DeletedAt.Format("2006-01-02 15:04:05")}}
+		if !reflect.DeepEqual(entry.Changes, expected) {
+			t.Errorf("expected the restore to record when the room was deleted, but got %+v", entry.Changes)
+		}
+		return
+	}
+	t.Errorf("expected the restore to be audited, but got %+v", logs)
+}
@@ -0,0 +1,252 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/forms"
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Row is one line of an upload after it has been checked
+type Row struct {
+	// The line in the file, counting the header as line 1
+	Line   int
+	Values map[string]string
+	Errors []string
+	// Filled in for a reservations file
+	Reservation models.Reservation
+	// Filled in for a rooms file
+	Room models.Room
+}
+
+// Valid reports whether the row can be imported
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Preview is the dry run of an upload, every row with the errors that would stop it being imported
+type Preview struct {
+	Kind   string
+	Fields []Field
+	Rows   []Row
+}
+
+// ValidRows returns the number of rows that can be imported
+func (p Preview) ValidRows() int {
+	count := 0
+	for _, row := range p.Rows {
+		if row.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+// InvalidRows returns the number of rows with errors
+func (p Preview) InvalidRows() int {
+	return len(p.Rows) - p.ValidRows()
+}
+
+// OK reports whether the whole file can be imported. Imports are all or nothing
+func (p Preview) OK() bool {
+	return len(p.Rows) > 0 && p.InvalidRows() == 0
+}
+
+// Reservations returns the reservations of a checked reservations file
+func (p Preview) Reservations() []models.Reservation {
+	var reservations []models.Reservation
+	for _, row := range p.Rows {
+		reservations = append(reservations, row.Reservation)
+	}
+	return reservations
+}
+
+// Rooms returns the rooms of a checked rooms file
+func (p Preview) Rooms() []models.Room {
+	var rooms []models.Room
+	for _, row := range p.Rows {
+		rooms = append(rooms, row.Room)
+	}
+	return rooms
+}
+
+// Availability reports whether roomID is free from start to end, like repository.DatabaseRepo.SearchAvailabilityByDatesByRoomID
+type Availability func(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+
+// CheckReservations validates every row of a reservations file with the rules used when a guest books,
+// and rejects stays that clash with a booking already made or with an earlier row of the file
+func CheckReservations(ctx context.Context, upload Upload, rooms []models.Room, available Availability) (Preview, error) {
+	preview := Preview{Kind: KindReservations, Fields: ReservationFields}
+
+	// Rows accepted so far, to catch two rows of the file booking the same room
+	var accepted []Row
+
+	for i, record := range upload.Rows {
+		values := upload.Values(record)
+		row := Row{Line: i + 2, Values: flatten(values)}
+
+		form := forms.New(values)
+		form.ReservationRules()
+		form.Required("room", "start_date", "end_date")
+		row.Errors = formErrors(form, ReservationFields)
+
+		reservation := models.Reservation{
+			FirstName: values.Get("first_name"),
+			LastName:  values.Get("last_name"),
+			Email:     values.Get("email"),
+			Phone:     values.Get("phone"),
+			Status:    models.StatusConfirmed,
+		}
+
+		if value := values.Get("room"); value != "" {
+			room, ok := findRoom(rooms, value)
+			if ok {
+				reservation.RoomID = room.ID
+				reservation.Room = room
+			} else {
+				row.Errors = append(row.Errors, fmt.Sprintf("There is no room called %q", value))
+			}
+		}
+
+		reservation.StartDate = parseDate(&row, values.Get("start_date"), "Arrival")
+		reservation.EndDate = parseDate(&row, values.Get("end_date"), "Departure")
+		if !reservation.StartDate.IsZero() && !reservation.EndDate.IsZero() && !reservation.EndDate.After(reservation.StartDate) {
+			row.Errors = append(row.Errors, "Departure must be after arrival")
+		}
+
+		if value := values.Get("status"); value != "" {
+			status, ok := models.ParseReservationStatus(strings.ToLower(value))
+			if ok {
+				reservation.Status = status
+			} else {
+				row.Errors = append(row.Errors, fmt.Sprintf("Status %q is not one of the reservation statuses", value))
+			}
+		}
+
+		if value := values.Get("created_at"); value != "" {
+			reservation.CreatedAt = parseDate(&row, value, "Booked On")
+		}
+
+		if row.Valid() && reservation.Status.HoldsRoom() {
+			free, err := available(ctx, reservation.StartDate, reservation.EndDate, reservation.RoomID)
+			if err != nil {
+				return Preview{}, err
+			}
+
+			if !free {
+				row.Errors = append(row.Errors, fmt.Sprintf("%s is already booked for some of these dates", reservation.Room.RoomName))
+			} else if line, clash := overlapping(accepted, reservation); clash {
+				row.Errors = append(row.Errors, fmt.Sprintf("%s is also booked for some of these dates on line %d", reservation.Room.RoomName, line))
+			}
+		}
+
+		row.Reservation = reservation
+		if row.Valid() && reservation.Status.HoldsRoom() {
+			accepted = append(accepted, row)
+		}
+
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	return preview, nil
+}
+
+// CheckRooms validates every row of a rooms file with the rules used when a room is added by hand,
+// and rejects names already taken by a room or by an earlier row of the file
+func CheckRooms(upload Upload, rooms []models.Room) Preview {
+	preview := Preview{Kind: KindRooms, Fields: RoomFields}
+
+	taken := make(map[string]bool)
+	for _, room := range rooms {
+		taken[strings.ToLower(room.RoomName)] = true
+	}
+
+	for i, record := range upload.Rows {
+		values := upload.Values(record)
+		row := Row{Line: i + 2, Values: flatten(values)}
+
+		form := forms.New(values)
+		form.RoomRules()
+		row.Errors = formErrors(form, RoomFields)
+
+		row.Room = models.Room{
+			RoomName:    values.Get("room_name"),
+			Price:       values.Get("price"),
+			ImageSource: values.Get("image_src"),
+			Description: values.Get("description"),
+		}
+
+		name := strings.ToLower(row.Room.RoomName)
+		if name != "" && taken[name] {
+			row.Errors = append(row.Errors, fmt.Sprintf("A room called %q already exists", row.Room.RoomName))
+		}
+		taken[name] = true
+
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	return preview
+}
+
+// findRoom looks a room up by ID or, ignoring case, by name
+func findRoom(rooms []models.Room, value string) (models.Room, bool) {
+	id, err := strconv.Atoi(value)
+	for _, room := range rooms {
+		if (err == nil && room.ID == id) || strings.EqualFold(room.RoomName, value) {
+			return room, true
+		}
+	}
+	return models.Room{}, false
+}
+
+// overlapping returns the line of an accepted row whose stay in the same room clashes with reservation.
+// Like the availability search, a stay that starts the day another ends counts as a clash
+func overlapping(accepted []Row, reservation models.Reservation) (int, bool) {
+	for _, row := range accepted {
+		other := row.Reservation
+		if other.RoomID == reservation.RoomID &&
+			!reservation.StartDate.After(other.EndDate) && !reservation.EndDate.Before(other.StartDate) {
+			return row.Line, true
+		}
+	}
+	return 0, false
+}
+
+// parseDate parses value, adding an error to row if it isn't a date. Empty values are left to the required rule
+func parseDate(row *Row, value, label string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s %q is not a date like %s", label, value, DateLayout))
+		return time.Time{}
+	}
+	return date
+}
+
+// formErrors returns the first error of each field that failed validation, in field order
+func formErrors(form *forms.Form, fields []Field) []string {
+	var messages []string
+	for _, field := range fields {
+		if message := form.Errors.Get(field.Name); message != "" {
+			messages = append(messages, field.Label+": "+message)
+		}
+	}
+	return messages
+}
+
+func flatten(values map[string][]string) map[string]string {
+	flat := make(map[string]string)
+	for key, value := range values {
+		if len(value) > 0 {
+			flat[key] = value[0]
+		}
+	}
+	return flat
+}
@@ -0,0 +1,219 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// The kinds of record that can be imported
+const (
+	KindReservations = "reservations"
+	KindRooms        = "rooms"
+)
+
+// Kinds lists every kind of record that can be imported
+var Kinds = []string{KindReservations, KindRooms}
+
+// MaxRows is the most rows one file may hold, so a preview stays small enough to read and keep in the session
+const MaxRows = 2000
+
+// DateLayout is the format every date in an import file must use
+const DateLayout = "2006-01-02"
+
+var (
+	ErrUnknownKind = errors.New("unknown import kind")
+	ErrEmptyFile   = errors.New("the file has no rows below its header")
+	ErrTooManyRows = fmt.Errorf("the file has more than %d rows", MaxRows)
+)
+
+// Field is a value the import reads from each row
+type Field struct {
+	// The name the value goes by in forms validation, e.g. first_name
+	Name     string
+	Label    string
+	Required bool
+	// Other headers the column is commonly given, used to guess the mapping
+	Aliases []string
+}
+
+// ReservationFields are the fields a reservations file is mapped onto
+var ReservationFields = []Field{
+	{Name: "first_name", Label: "First Name", Required: true, Aliases: []string{"given name", "forename"}},
+	{Name: "last_name", Label: "Last Name", Required: true, Aliases: []string{"surname", "family name"}},
+	{Name: "email", Label: "Email", Required: true, Aliases: []string{"email address", "e-mail"}},
+	{Name: "phone", Label: "Phone", Required: true, Aliases: []string{"phone number", "telephone", "mobile"}},
+	{Name: "room", Label: "Room (name or ID)", Required: true, Aliases: []string{"room name", "room id", "room_id"}},
+	{Name: "start_date", Label: "Arrival", Required: true, Aliases: []string{"arrival", "check in", "start"}},
+	{Name: "end_date", Label: "Departure", Required: true, Aliases: []string{"departure", "check out", "end"}},
+	{Name: "status", Label: "Status", Aliases: []string{"state"}},
+	{Name: "created_at", Label: "Booked On", Aliases: []string{"booked on", "booking date", "created"}},
+}
+
+// RoomFields are the fields a rooms file is mapped onto
+var RoomFields = []Field{
+	{Name: "room_name", Label: "Room Name", Required: true, Aliases: []string{"name", "room"}},
+	{Name: "price", Label: "Price", Required: true, Aliases: []string{"rate", "nightly rate"}},
+	{Name: "image_src", Label: "Image", Required: true, Aliases: []string{"image", "image url", "photo"}},
+	{Name: "description", Label: "Description", Required: true, Aliases: []string{"details"}},
+}
+
+// Fields returns the fields a file of kind is mapped onto, or false if there is no such kind
+func Fields(kind string) ([]Field, bool) {
+	switch kind {
+	case KindReservations:
+		return ReservationFields, true
+	case KindRooms:
+		return RoomFields, true
+	}
+	return nil, false
+}
+
+// Upload is a parsed CSV file waiting to be mapped and imported
+type Upload struct {
+	Kind     string
+	Filename string
+	Header   []string
+	Rows     [][]string
+	// The column each field is read from, -1 when the file has no such column
+	Mapping map[string]int
+}
+
+// Parse reads a CSV file of kind, taking the first line as its header, and guesses which column holds each field
+func Parse(kind, filename string, r io.Reader) (Upload, error) {
+	fields, ok := Fields(kind)
+	if !ok {
+		return Upload{}, ErrUnknownKind
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return Upload{}, ErrEmptyFile
+	} else if err != nil {
+		return Upload{}, err
+	}
+
+	upload := Upload{
+		Kind:     kind,
+		Filename: filename,
+		Header:   header,
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return Upload{}, err
+		}
+
+		if blank(record) {
+			continue
+		}
+
+		if len(upload.Rows) == MaxRows {
+			return Upload{}, ErrTooManyRows
+		}
+		upload.Rows = append(upload.Rows, record)
+	}
+
+	if len(upload.Rows) == 0 {
+		return Upload{}, ErrEmptyFile
+	}
+
+	upload.Mapping = guessMapping(fields, header)
+
+	return upload, nil
+}
+
+// Column returns the column field is read from, or -1 if it isn't mapped
+func (u Upload) Column(field string) int {
+	column, ok := u.Mapping[field]
+	if !ok || column >= len(u.Header) {
+		return -1
+	}
+	return column
+}
+
+// Map points each field at the column picked for it, ignoring fields and columns that don't exist
+func (u *Upload) Map(columns map[string]int) {
+	fields, _ := Fields(u.Kind)
+
+	u.Mapping = make(map[string]int)
+	for _, field := range fields {
+		column, ok := columns[field.Name]
+		if !ok || column < 0 || column >= len(u.Header) {
+			column = -1
+		}
+		u.Mapping[field.Name] = column
+	}
+}
+
+// Values returns the mapped fields of row as form values, so they can be checked with the forms package
+func (u Upload) Values(row []string) url.Values {
+	fields, _ := Fields(u.Kind)
+
+	values := url.Values{}
+	for _, field := range fields {
+		column := u.Column(field.Name)
+		if column >= 0 && column < len(row) {
+			values.Set(field.Name, strings.TrimSpace(row[column]))
+		}
+	}
+	return values
+}
+
+// guessMapping maps each field to the first column whose header matches its name, label or an alias
+func guessMapping(fields []Field, header []string) map[string]int {
+	mapping := make(map[string]int)
+	for _, field := range fields {
+		mapping[field.Name] = -1
+
+		names := append([]string{field.Name, field.Label}, field.Aliases...)
+		for column, title := range header {
+			if matches(title, names) {
+				mapping[field.Name] = column
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+func matches(title string, names []string) bool {
+	title = normalize(title)
+	for _, name := range names {
+		if title == normalize(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lower cases s and drops everything but letters and digits, so "First Name" matches first_name
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+var testRooms = []models.Room{
+	{ID: 1, RoomName: "General's Quarters"},
+	{ID: 2, RoomName: "Major's Suite"},
+}
+
+func alwaysFree(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	return true, nil
+}
+
+func TestParse(t *testing.T) {
+	file := "Given Name,Surname,E-mail,Telephone,Room,Check In,Check Out,Notes\n" +
+		"John,Smith,john@here.com,555,1,2026-01-01,2026-01-03,late\n" +
+		",,,,,,,\n" +
+		"Jane,Doe,jane@here.com,556,Major's Suite,2026-01-02,2026-01-04,\n"
+
+	upload, err := Parse(KindReservations, "old.csv", strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(upload.Rows) != 2 {
+		t.Errorf("expected blank lines to be skipped leaving 2 rows, but got %d", len(upload.Rows))
+	}
+
+	expected := map[string]int{
+		"first_name": 0,
+		"last_name":  1,
+		"email":      2,
+		"phone":      3,
+		"room":       4,
+		"start_date": 5,
+		"end_date":   6,
+		"status":     -1,
+		"created_at": -1,
+	}
+	for field, column := range expected {
+		if upload.Column(field) != column {
+			t.Errorf("expected %s to be guessed as column %d, but got %d", field, column, upload.Column(field))
+		}
+	}
+
+	values := upload.Values(upload.Rows[1])
+	if values.Get("room") != "Major's Suite" || values.Get("status") != "" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+var parseErrorTests = []struct {
+	name     string
+	kind     string
+	file     string
+	expected error
+}{
+	{"unknown-kind", "guests", "a\n1\n", ErrUnknownKind},
+	{"empty", KindRooms, "", ErrEmptyFile},
+	{"header-only", KindRooms, "room_name,price\n", ErrEmptyFile},
+	{"too-many-rows", KindRooms, "room_name\n" + strings.Repeat("x\n", MaxRows+1), ErrTooManyRows},
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, e := range parseErrorTests {
+		_, err := Parse(e.kind, "file.csv", strings.NewReader(e.file))
+		if err != e.expected {
+			t.Errorf("%s: expected %v, but got %v", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestUploadMap(t *testing.T) {
+	upload := Upload{Kind: KindRooms, Header: []string{"a", "b"}}
+	upload.Map(map[string]int{"room_name": 1, "price": 5, "colour": 0})
+
+	if upload.Column("room_name") != 1 {
+		t.Errorf("expected room_name to be column 1, but got %d", upload.Column("room_name"))
+	}
+	if upload.Column("price") != -1 {
+		t.Errorf("expected a column past the header to be unmapped, but got %d", upload.Column("price"))
+	}
+	if _, ok := upload.Mapping["colour"]; ok {
+		t.Error("expected an unknown field to be dropped")
+	}
+}
+
+var checkReservationTests = []struct {
+	name     string
+	row      string
+	expected string
+}{
+	{"valid", "John,Smith,john@here.com,555,1,2026-01-01,2026-01-03,,", ""},
+	{"room-by-name", "John,Smith,john@here.com,555,major's suite,2026-01-01,2026-01-03,checked-out,2025-12-01", ""},
+	{"missing-name", ",Smith,john@here.com,555,1,2026-01-01,2026-01-03,,", "First Name: This field is required"},
+	{"short-name", "Jo,Smith,john@here.com,555,1,2026-01-01,2026-01-03,,", "First Name: This field must be at least 3 characters long"},
+	{"bad-email", "John,Smith,john,555,1,2026-01-01,2026-01-03,,", "Email: Invalid email address"},
+	{"unknown-room", "John,Smith,john@here.com,555,Attic,2026-01-01,2026-01-03,,", `There is no room called "Attic"`},
+	{"bad-date", "John,Smith,john@here.com,555,1,01/01/2026,2026-01-03,,", `Arrival "01/01/2026" is not a date like 2006-01-02`},
+	{"backwards", "John,Smith,john@here.com,555,1,2026-01-03,2026-01-01,,", "Departure must be after arrival"},
+	{"bad-status", "John,Smith,john@here.com,555,1,2026-01-01,2026-01-03,lost,", `Status "lost" is not one of the reservation statuses`},
+}
+
+func TestCheckReservations(t *testing.T) {
+	header := "first_name,last_name,email,phone,room,start_date,end_date,status,created_at\n"
+
+	for _, e := range checkReservationTests {
+		upload, err := Parse(KindReservations, "old.csv", strings.NewReader(header+e.row+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		preview, err := CheckReservations(context.Background(), upload, testRooms, alwaysFree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row := preview.Rows[0]
+		if e.expected == "" {
+			if !row.Valid() {
+				t.Errorf("%s: expected the row to be valid, but got %v", e.name, row.Errors)
+			}
+			continue
+		}
+
+		if row.Valid() || row.Errors[0] != e.expected {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expected, row.Errors)
+		}
+	}
+}
+
+func TestCheckReservationsConflicts(t *testing.T) {
+	file := "first_name,last_name,email,phone,room,start_date,end_date,status\n" +
+		"John,Smith,john@here.com,555,1,2026-01-01,2026-01-03,\n" +
+		"Jane,Doe,jane@here.com,556,1,2026-01-02,2026-01-04,\n" +
+		"Jack,Black,jack@here.com,557,1,2026-01-02,2026-01-04,cancelled\n" +
+		"Jill,White,jill@here.com,558,2,2026-02-01,2026-02-03,\n"
+
+	upload, err := Parse(KindReservations, "old.csv", strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Room 2 is already booked in February
+	available := func(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+		return roomID != 2, nil
+	}
+
+	preview, err := CheckReservations(context.Background(), upload, testRooms, available)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !preview.Rows[0].Valid() {
+		t.Errorf("expected line 2 to be valid, but got %v", preview.Rows[0].Errors)
+	}
+
+	if errs := preview.Rows[1].Errors; len(errs) != 1 || !strings.Contains(errs[0], "on line 2") {
+		t.Errorf("expected line 3 to clash with line 2, but got %v", errs)
+	}
+
+	if !preview.Rows[2].Valid() {
+		t.Errorf("expected a cancelled stay not to clash, but got %v", preview.Rows[2].Errors)
+	}
+
+	if errs := preview.Rows[3].Errors; len(errs) != 1 || !strings.Contains(errs[0], "already booked") {
+		t.Errorf("expected line 5 to clash with an existing booking, but got %v", errs)
+	}
+
+	if preview.OK() || preview.ValidRows() != 2 || preview.InvalidRows() != 2 {
+		t.Errorf("expected 2 valid and 2 invalid rows, but got %d and %d", preview.ValidRows(), preview.InvalidRows())
+	}
+}
+
+func TestCheckRooms(t *testing.T) {
+	file := "room_name,price,image_src,description\n" +
+		"Sea View Room,120,sea.png,A room by the sea\n" +
+		"sea view room,130,sea2.png,The same name again\n" +
+		"Major's Suite,150,major.png,Already in the hotel\n" +
+		"Den,,den.png,Up the stairs\n"
+
+	upload, err := Parse(KindRooms, "rooms.csv", strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview := CheckRooms(upload, testRooms)
+
+	expected := []string{
+		"",
+		`A room called "sea view room" already exists`,
+		`A room called "Major's Suite" already exists`,
+		"Room Name: This field must be at least 5 characters long",
+	}
+
+	for i, message := range expected {
+		row := preview.Rows[i]
+		if message == "" && !row.Valid() {
+			t.Errorf("line %d: expected no errors, but got %v", row.Line, row.Errors)
+		}
+		if message != "" && (row.Valid() || row.Errors[0] != message) {
+			t.Errorf("line %d: expected error %q, but got %v", row.Line, message, row.Errors)
+		}
+	}
+
+	if preview.Rows[0].Room.Price != "120" {
+		t.Errorf("expected the room to be read from the row, but got %+v", preview.Rows[0].Room)
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// The app's metrics, on Default. Durations use the client's default buckets, which suit requests and queries
+var (
+	HTTPRequests = with.NewCounterVec(prometheus.CounterOpts{
+		Name: "bookings_http_requests_total",
+		Help: "HTTP requests served, by method, chi route pattern and status code",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = with.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bookings_http_request_duration_seconds",
+		Help: "How long HTTP requests took, by method and chi route pattern",
+	}, []string{"method", "route"})
+
+	DBQueryDuration = with.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bookings_db_query_duration_seconds",
+		Help: "How long database operations took, by repository method",
+	}, []string{"operation"})
+
+	MailSent = with.NewCounter(prometheus.CounterOpts{
+		Name: "bookings_mail_sent_total",
+		Help: "Mail handed to Sendinblue",
+	})
+	MailFailures = with.NewCounter(prometheus.CounterOpts{
+		Name: "bookings_mail_send_failures_total",
+		Help: "Mail that couldn't be sent",
+	})
+
+	ReservationsCreated = with.NewCounter(prometheus.CounterOpts{
+		Name: "bookings_reservations_created_total",
+		Help: "Reservations booked on the site, in the admin or through the API",
+	})
+	AvailabilitySearches = with.NewCounterVec(prometheus.CounterOpts{
+		Name: "bookings_availability_searches_total",
+		Help: `Searches for free rooms, by whether any were found, "available" or "none"`,
+	}, []string{"result"})
+)
+
+// RegisterDB exposes the stats of the database pool db, as the go_sql_ metrics with db_name="bookings"
+func RegisterDB(db *sql.DB) {
+	register(collectors.NewDBStatsCollector(db, "bookings"))
+}
+
+// RegisterMailQueue exposes how many mails are waiting to be sent, read from depth
+func RegisterMailQueue(depth func() int) {
+	register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "bookings_mail_queue_depth",
+		Help: "Mail waiting to be sent",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
@@ -0,0 +1,52 @@
+// Package metrics counts and times what the app does with the Prometheus client, and serves it at /metrics
+package metrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Default is the registry the app's metrics are on, and that Handler serves. It has the Go runtime and process metrics too
+var Default = prometheus.NewRegistry()
+
+// with creates the app's own metrics on Default
+var with = promauto.With(Default)
+
+func init() {
+	Default.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Handler serves the app's metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// register adds c to Default, replacing a collector already there for the same metrics rather than failing.
+// The app registers its database and mail queue when it starts, and tests start it more than once
+func register(c prometheus.Collector) {
+	err := Default.Register(c)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		Default.Unregister(registered.ExistingCollector)
+		err = Default.Register(c)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SampleCount returns how many observations h has had for the label values, as the client only exposes them when scraped
+func SampleCount(h *prometheus.HistogramVec, labelValues ...string) uint64 {
+	var m dto.Metric
+	if err := h.WithLabelValues(labelValues...).(prometheus.Metric).Write(&m); err != nil {
+		return 0
+	}
+	return m.GetHistogram().GetSampleCount()
+}
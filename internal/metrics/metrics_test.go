@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	_ "modernc.org/sqlite"
+)
+
+func TestHandler(t *testing.T) {
+	AvailabilitySearches.WithLabelValues("available").Inc()
+	DBQueryDuration.WithLabelValues("GetRoomByID").Observe(0.5)
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("expected the Prometheus text format, but got %q", rr.Header().Get("Content-Type"))
+	}
+
+	for _, expected := range []string{
+		"# TYPE bookings_availability_searches_total counter\n",
+		`bookings_db_query_duration_seconds_bucket{operation="GetRoomByID",le="0.5"} `,
+		"# TYPE go_goroutines gauge\n",
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, rr.Body.String())
+		}
+	}
+
+	if SampleCount(DBQueryDuration, "GetRoomByID") == 0 {
+		t.Error("expected the observation to be counted")
+	}
+}
+
+func TestRegisterDB(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+
+	// Registering again replaces the pool, as the app does when it is started twice in tests
+	RegisterDB(db)
+	RegisterDB(db)
+
+	expected := `# HELP go_sql_max_open_connections Maximum number of open connections to the database.
+# TYPE go_sql_max_open_connections gauge
+go_sql_max_open_connections{db_name="bookings"} 4
+`
+	if err := testutil.GatherAndCompare(Default, strings.NewReader(expected), "go_sql_max_open_connections"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterMailQueue(t *testing.T) {
+	RegisterMailQueue(func() int { return 2 })
+	RegisterMailQueue(func() int { return 3 })
+
+	expected := `# HELP bookings_mail_queue_depth Mail waiting to be sent
+# TYPE bookings_mail_queue_depth gauge
+bookings_mail_queue_depth 3
+`
+	if err := testutil.GatherAndCompare(Default, strings.NewReader(expected), "bookings_mail_queue_depth"); err != nil {
+		t.Error(err)
+	}
+}
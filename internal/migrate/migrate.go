@@ -0,0 +1,401 @@
+// Package migrate applies the migrations embedded in the migrations package, so the app needs no separate tool
+// to set up or change its database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/migrations"
+)
+
+// Migration is one version of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Adopt, if set, reports whether another tool already built what Up creates. The migration is then adopted:
+	// recorded as applied without running Up, and never rolled back, as Down would drop that database's data
+	Adopt func(ctx context.Context, tx *sql.Tx) (bool, error)
+}
+
+// ErrAdopted is returned for rolling back an adopted migration
+var ErrAdopted = errors.New("it was adopted on a database another tool built, so rolling it back would drop that data")
+
+// Status is a migration and when it was applied, which is zero while it is pending
+type Status struct {
+	Migration
+	AppliedAt time.Time
+	Adopted   bool
+}
+
+// Pending reports whether the migration has not been applied yet
+func (s Status) Pending() bool {
+	return s.AppliedAt.IsZero()
+}
+
+// Runner applies migrations to a database, recording which are applied in the schema_versions table
+type Runner struct {
+	DB         *sql.DB
+	Driver     string
+	Migrations []Migration
+	// Replaced in tests to control the clock
+	now func() time.Time
+}
+
+// Any number will do, as long as nothing else takes the same advisory lock
+const postgresLockID = 4_151_020_264
+
+const createVersionsTable = `create table if not exists schema_versions (
+	version bigint primary key,
+	name varchar(255) not null,
+	applied_at timestamp not null,
+	adopted boolean not null default false
+)`
+
+// New returns a runner for the migrations embedded for the database db is connected to
+func New(db *driver.DB) (*Runner, error) {
+	files, dir := migrations.Postgres, "postgres"
+	if db.Driver == driver.SQLite {
+		files, dir = migrations.SQLite, "sqlite"
+	}
+
+	loaded, err := Load(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{
+		DB:         db.SQL,
+		Driver:     db.Driver,
+		Migrations: loaded,
+		now:        time.Now,
+	}
+
+	for i := range r.Migrations {
+		if r.Migrations[i].Version == sodaBaseline {
+			r.Migrations[i].Adopt = r.sodaMigrated
+		}
+	}
+
+	return r, nil
+}
+
+// Migration files are named version_name.dialect.up.sql or .down.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.\w+\.(up|down)\.sql$`)
+
+// Load reads the migrations in dir, oldest first. Every version needs both an up and a down file
+func Load(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s is not named version_name.dialect.up.sql or .down.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("version %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var loaded []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("version %d %s needs both an up and a down file", m.Version, m.Name)
+		}
+		loaded = append(loaded, *m)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Version < loaded[j].Version
+	})
+
+	return loaded, nil
+}
+
+// Latest returns the newest version, or 0 if there are no migrations
+func (r *Runner) Latest() int64 {
+	if len(r.Migrations) == 0 {
+		return 0
+	}
+	return r.Migrations[len(r.Migrations)-1].Version
+}
+
+// Status returns every migration, oldest first, with when it was applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := r.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.Migrations {
+			s := applied[m.Version]
+			s.Migration = m
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Up applies every pending migration, returning the ones it applied
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	return r.To(ctx, r.Latest())
+}
+
+// Down rolls back the newest applied migration, returning it. It returns nil if none are applied
+func (r *Runner) Down(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := r.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(r.Migrations) - 1; i >= 0; i-- {
+			m := r.Migrations[i]
+			if applied[m.Version].Pending() {
+				continue
+			}
+
+			rolledBack, err := r.down(ctx, conn, m)
+			if rolledBack {
+				done = append(done, m)
+			}
+			return err
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// To applies the pending migrations up to and including version, oldest first, then rolls back the applied
+// ones after it, newest first. It returns the migrations it applied or rolled back. Version 0 rolls back everything.
+// Nothing is done if an adopted migration would have to be rolled back
+func (r *Runner) To(ctx context.Context, version int64) ([]Migration, error) {
+	if version != 0 && !r.known(version) {
+		return nil, fmt.Errorf("there is no migration %d", version)
+	}
+
+	var done []Migration
+
+	err := r.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.Migrations {
+			if m.Version > version && applied[m.Version].Adopted {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, ErrAdopted)
+			}
+		}
+
+		for _, m := range r.Migrations {
+			if m.Version > version || !applied[m.Version].Pending() {
+				continue
+			}
+
+			ran, err := r.up(ctx, conn, m)
+			if err != nil {
+				return err
+			}
+			if ran {
+				done = append(done, m)
+			}
+		}
+
+		for i := len(r.Migrations) - 1; i >= 0; i-- {
+			m := r.Migrations[i]
+			if m.Version <= version || applied[m.Version].Pending() {
+				continue
+			}
+
+			rolledBack, err := r.down(ctx, conn, m)
+			if err != nil {
+				return err
+			}
+			if rolledBack {
+				done = append(done, m)
+			}
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// known reports whether there is a migration with version
+func (r *Runner) known(version int64) bool {
+	for _, m := range r.Migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// locked calls fn with a connection no other runner is migrating through, creating schema_versions first.
+// Postgres is held with an advisory lock for the whole run. SQLite has none, but the driver begins every
+// transaction by taking the database's write lock, so up and down check again inside theirs
+func (r *Runner) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if r.Driver != driver.SQLite {
+		_, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", postgresLockID)
+		if err != nil {
+			return err
+		}
+		// Unlocked even when ctx is done, as the connection goes back to the pool still holding it otherwise
+		defer conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", postgresLockID)
+	}
+
+	_, err = conn.ExecContext(ctx, createVersionsTable)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// up applies m in one transaction, returning false if another runner applied it first. An m another tool
+// already built is adopted instead
+func (r *Runner) up(ctx context.Context, conn *sql.Conn, m Migration) (bool, error) {
+	return inTx(ctx, conn, m, false, func(tx *sql.Tx) error {
+		adopted := false
+		if m.Adopt != nil {
+			var err error
+			adopted, err = m.Adopt(ctx, tx)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		if !adopted {
+			_, err := tx.ExecContext(ctx, m.Up)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, "insert into schema_versions (version, name, applied_at, adopted) values ($1, $2, $3, $4)",
+			m.Version, m.Name, r.now(), adopted)
+		return err
+	})
+}
+
+// down rolls back m in one transaction, returning false if another runner rolled it back first. It refuses
+// to roll back an adopted m with ErrAdopted
+func (r *Runner) down(ctx context.Context, conn *sql.Conn, m Migration) (bool, error) {
+	return inTx(ctx, conn, m, true, func(tx *sql.Tx) error {
+		var adopted bool
+		err := tx.QueryRowContext(ctx, "select adopted from schema_versions where version = $1", m.Version).Scan(&adopted)
+		if err != nil {
+			return err
+		}
+		if adopted {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, ErrAdopted)
+		}
+
+		_, err = tx.ExecContext(ctx, m.Down)
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, "delete from schema_versions where version = $1", m.Version)
+		return err
+	})
+}
+
+// inTx calls fn in one transaction, if m is applied when wasApplied says it should be
+func inTx(ctx context.Context, conn *sql.Conn, m Migration, wasApplied bool, fn func(*sql.Tx) error) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "select count(*) from schema_versions where version = $1", m.Version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if (count > 0) != wasApplied {
+		return false, nil
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// appliedVersions returns when each applied migration was applied and whether it was adopted, by version
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]Status, error) {
+	applied := map[int64]Status{}
+
+	rows, err := conn.QueryContext(ctx, "select version, applied_at, adopted from schema_versions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var s Status
+		if err := rows.Scan(&version, &s.AppliedAt, &s.Adopted); err != nil {
+			return nil, err
+		}
+		applied[version] = s
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,325 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+)
+
+// newRunner returns a runner for the embedded SQLite migrations on a new database file at path
+func newRunner(t *testing.T, path string) *Runner {
+	t.Helper()
+
+	db, err := driver.NewDatabase("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := New(&driver.DB{SQL: db, Driver: driver.SQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+// versions returns the versions of migrations
+func versions(migrations []Migration) []int64 {
+	var v []int64
+	for _, m := range migrations {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+func TestRunner(t *testing.T) {
+	runner := newRunner(t, filepath.Join(t.TempDir(), "bookings.db"))
+	ctx := context.Background()
+
+	if len(runner.Migrations) < 2 {
+		t.Fatalf("expected the embedded migrations, but got %v", versions(runner.Migrations))
+	}
+	first, latest := runner.Migrations[0].Version, runner.Latest()
+
+	countRooms := func() (int, error) {
+		var rooms int
+		err := runner.DB.QueryRow("select count(*) from rooms").Scan(&rooms)
+		return rooms, err
+	}
+
+	done, err := runner.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(runner.Migrations) {
+		t.Errorf("expected every migration to be applied, but got %v", versions(done))
+	}
+	if rooms, err := countRooms(); err != nil || rooms != 2 {
+		t.Errorf("expected the 2 seeded rooms, but got %d: %v", rooms, err)
+	}
+
+	done, err = runner.Up(ctx)
+	if err != nil || len(done) != 0 {
+		t.Errorf("expected nothing left to apply, but got %v: %v", versions(done), err)
+	}
+
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.Pending() {
+			t.Errorf("expected %d %s to be applied", s.Version, s.Name)
+		}
+	}
+
+	done, err = runner.Down(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != latest {
+		t.Errorf("expected %d to be rolled back, but got %v", latest, versions(done))
+	}
+
+	statuses, _ = runner.Status(ctx)
+	if !statuses[len(statuses)-1].Pending() {
+		t.Error("expected the rolled back migration to be pending")
+	}
+
+	done, err = runner.To(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(runner.Migrations)-1 {
+		t.Errorf("expected the rest to be rolled back, but got %v", versions(done))
+	}
+	if _, err := countRooms(); err == nil {
+		t.Error("expected the rooms table to be dropped")
+	}
+
+	done, err = runner.Down(ctx)
+	if err != nil || len(done) != 0 {
+		t.Errorf("expected nothing left to roll back, but got %v: %v", versions(done), err)
+	}
+
+	done, err = runner.To(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != first {
+		t.Errorf("expected only %d to be applied, but got %v", first, versions(done))
+	}
+
+	if _, err := runner.To(ctx, 1); err == nil {
+		t.Error("expected an error migrating to a version that doesn't exist")
+	}
+}
+
+// migrateWithSoda builds the baseline's schema and seed on runner's database the way soda would, recording
+// the fizz migrations in its schema_migration table up to version
+func migrateWithSoda(t *testing.T, runner *Runner, version string) {
+	t.Helper()
+
+	_, err := runner.DB.Exec("create table schema_migration (version varchar(14) not null)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runner.DB.Exec("insert into schema_migration (version) values ('20230211182718'), ($1)", version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runner.DB.Exec(runner.Migrations[0].Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunner_Soda(t *testing.T) {
+	runner := newRunner(t, filepath.Join(t.TempDir(), "bookings.db"))
+	ctx := context.Background()
+	migrateWithSoda(t, runner, sodaVersion)
+
+	_, err := runner.DB.Exec(`insert into reservations (email, start_date, end_date, room_id, processed, created_at, updated_at)
+		values ('john@smith.com', '2040-01-01', '2040-01-02', 1, 1, '2023-05-01 00:00:00+00:00', '2023-05-01 00:00:00+00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The baseline would fail creating tables that exist, so it is only recorded, and the rest is run
+	done, err := runner.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(runner.Migrations) {
+		t.Errorf("expected every migration to be applied, but got %v", versions(done))
+	}
+
+	statuses, _ := runner.Status(ctx)
+	if !statuses[0].Adopted || statuses[1].Adopted {
+		t.Errorf("expected only the baseline to be adopted, but got %+v", statuses)
+	}
+
+	var status string
+	err = runner.DB.QueryRow("select status from reservations").Scan(&status)
+	if err != nil || status != "confirmed" {
+		t.Errorf("expected the processed reservation to be confirmed, but got %q: %v", status, err)
+	}
+
+	if _, err := runner.To(ctx, 0); !errors.Is(err, ErrAdopted) {
+		t.Errorf("expected ErrAdopted rolling back everything, but got %v", err)
+	}
+	statuses, _ = runner.Status(ctx)
+	if statuses[len(statuses)-1].Pending() {
+		t.Error("expected nothing to be rolled back when the baseline can't be")
+	}
+
+	done, err = runner.Down(ctx)
+	if err != nil || len(done) != 1 || done[0].Version == sodaBaseline {
+		t.Errorf("expected the migration after the baseline to be rolled back, but got %v: %v", versions(done), err)
+	}
+
+	done, err = runner.Down(ctx)
+	if !errors.Is(err, ErrAdopted) || len(done) != 0 {
+		t.Errorf("expected ErrAdopted rolling back the baseline, but got %v: %v", versions(done), err)
+	}
+
+	var rooms int
+	err = runner.DB.QueryRow("select count(*) from rooms").Scan(&rooms)
+	if err != nil || rooms != 2 {
+		t.Errorf("expected soda's rooms to be left alone, but got %d: %v", rooms, err)
+	}
+}
+
+func TestRunner_PartlySoda(t *testing.T) {
+	runner := newRunner(t, filepath.Join(t.TempDir(), "bookings.db"))
+	ctx := context.Background()
+	migrateWithSoda(t, runner, "20230211194741")
+
+	done, err := runner.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "soda migrate") || len(done) != 0 {
+		t.Errorf("expected a database soda is still migrating to be refused, but got %v: %v", versions(done), err)
+	}
+}
+
+func TestRunner_FailedMigration(t *testing.T) {
+	runner := newRunner(t, filepath.Join(t.TempDir(), "bookings.db"))
+	ctx := context.Background()
+
+	runner.Migrations = []Migration{
+		{Version: 1, Name: "create_rooms", Up: "create table rooms (id integer primary key)", Down: "drop table rooms"},
+		{Version: 2, Name: "broken", Up: "create table guests (id integer primary key); create tabel oops", Down: "drop table guests"},
+	}
+
+	done, err := runner.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "2 broken") {
+		t.Errorf("expected the broken migration to fail, but got %v", err)
+	}
+	if len(done) != 1 {
+		t.Errorf("expected the first migration to be applied, but got %v", versions(done))
+	}
+
+	// Nothing of the failed migration is left behind
+	if _, err := runner.DB.Exec("insert into guests (id) values (1)"); err == nil {
+		t.Error("expected the failed migration to be rolled back")
+	}
+
+	statuses, _ := runner.Status(ctx)
+	if statuses[0].Pending() || !statuses[1].Pending() {
+		t.Errorf("expected only the first migration to be applied, but got %+v", statuses)
+	}
+}
+
+func TestRunner_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookings.db")
+	ctx := context.Background()
+
+	// Like app instances starting together on the same database
+	runners := []*Runner{newRunner(t, path), newRunner(t, path), newRunner(t, path)}
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, len(runners))
+	errs := make([]error, len(runners))
+	for i, runner := range runners {
+		wg.Add(1)
+		go func(i int, runner *Runner) {
+			defer wg.Done()
+			applied[i], errs[i] = runner.Up(ctx)
+		}(i, runner)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range runners {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		total += len(applied[i])
+	}
+
+	if total != len(runners[0].Migrations) {
+		t.Errorf("expected each migration to be applied once, but %d were applied", total)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	files := fstest.MapFS{
+		"sqlite/2_seed.sqlite3.up.sql":            {Data: []byte("insert")},
+		"sqlite/2_seed.sqlite3.down.sql":          {Data: []byte("delete")},
+		"sqlite/10_add_column.sqlite3.up.sql":     {Data: []byte("alter")},
+		"sqlite/10_add_column.sqlite3.down.sql":   {Data: []byte("alter back")},
+		"sqlite/1_create_tables.sqlite3.up.sql":   {Data: []byte("create")},
+		"sqlite/1_create_tables.sqlite3.down.sql": {Data: []byte("drop")},
+	}
+
+	loaded, err := Load(files, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := versions(loaded); len(v) != 3 || v[0] != 1 || v[1] != 2 || v[2] != 10 {
+		t.Errorf("expected versions 1, 2 and 10 in order, but got %v", v)
+	}
+	if loaded[0].Name != "create_tables" || loaded[0].Up != "create" || loaded[0].Down != "drop" {
+		t.Errorf("unexpected migration %+v", loaded[0])
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing-down": {"sqlite/1_create.sqlite3.up.sql": {Data: []byte("create")}},
+		"bad-name":     {"sqlite/create.sqlite3.up.sql": {Data: []byte("create")}},
+		"two-names": {
+			"sqlite/1_create.sqlite3.up.sql":   {Data: []byte("create")},
+			"sqlite/1_seed.sqlite3.down.sql":   {Data: []byte("delete")},
+			"sqlite/1_create.sqlite3.down.sql": {Data: []byte("drop")},
+		},
+	}
+
+	for name, files := range invalid {
+		if _, err := Load(files, "sqlite"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	for _, db := range []*driver.DB{{Driver: driver.Postgres}, {Driver: driver.SQLite}} {
+		runner, err := New(db)
+		if err != nil {
+			t.Fatalf("%s: %s", db.Driver, err)
+		}
+		if len(runner.Migrations) == 0 {
+			t.Errorf("%s: expected migrations", db.Driver)
+		}
+	}
+
+	postgres, _ := New(&driver.DB{Driver: driver.Postgres})
+	sqlite, _ := New(&driver.DB{Driver: driver.SQLite})
+	if v, w := versions(postgres.Migrations), versions(sqlite.Migrations); len(v) != len(w) || v[len(v)-1] != w[len(w)-1] {
+		t.Errorf("expected the same versions for both databases, but got %v and %v", v, w)
+	}
+}
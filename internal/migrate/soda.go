@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/atuprosper/booking-project/internal/driver"
+)
+
+// sodaBaseline is the first embedded migration, which builds the schema and seed the fizz migrations built up
+// to sodaVersion, the last of them before the app ran its own
+const (
+	sodaBaseline = 20261019170000
+	sodaVersion  = "20230427135252"
+)
+
+// sodaMigrated reports whether soda migrated the database up to sodaVersion, so the baseline is there already.
+// A database soda migrated only part of the way fits neither, so it is refused until soda finishes
+func (r *Runner) sodaMigrated(ctx context.Context, tx *sql.Tx) (bool, error) {
+	exists := `select count(*) from information_schema.tables
+		where table_schema = current_schema() and table_name = 'schema_migration'`
+	if r.Driver == driver.SQLite {
+		exists = "select count(*) from sqlite_master where type = 'table' and name = 'schema_migration'"
+	}
+
+	var tables int
+	err := tx.QueryRowContext(ctx, exists).Scan(&tables)
+	if err != nil || tables == 0 {
+		return false, err
+	}
+
+	var migrated int
+	err = tx.QueryRowContext(ctx, "select count(*) from schema_migration where version = $1", sodaVersion).Scan(&migrated)
+	if err != nil {
+		return false, err
+	}
+	if migrated == 0 {
+		return false, fmt.Errorf("soda hasn't run fizz migration %s on this database yet, so run soda migrate first", sodaVersion)
+	}
+
+	return true, nil
+}
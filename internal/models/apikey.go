@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// APIScope is what an API key may do. Each scope includes everything the ones before it allow
+type APIScope string
+
+const (
+	ScopeReadOnly APIScope = "read-only"
+	ScopeBooking  APIScope = "booking"
+	ScopeAdmin    APIScope = "admin"
+)
+
+// APIScopes lists every scope from the least to the most allowed
+var APIScopes = []APIScope{
+	ScopeReadOnly,
+	ScopeBooking,
+	ScopeAdmin,
+}
+
+// DefaultAPIRateLimit is how many requests a minute a key may make unless it is given its own limit
+const DefaultAPIRateLimit = 60
+
+// ParseAPIScope returns the scope named by s, or false if there is no such scope
+func ParseAPIScope(s string) (APIScope, bool) {
+	for _, scope := range APIScopes {
+		if string(scope) == s {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// Allows reports whether a key with scope s may use an endpoint that needs required
+func (s APIScope) Allows(required APIScope) bool {
+	return s.level() >= required.level() && s.level() > 0
+}
+
+func (s APIScope) level() int {
+	for i, scope := range APIScopes {
+		if scope == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// APIKey is a credential an integration uses to call the API
+type APIKey struct {
+	ID   int
+	Name string
+	// The start of the key, kept in the clear so a key can be looked up and recognised in the admin
+	Prefix string
+	// The SHA-256 of the whole key. The key itself is only shown once, when it is created
+	Hash  string
+	Scope APIScope
+	// Requests allowed a minute
+	RateLimit int
+	// The admin who created the key
+	UserID     int
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Revoked reports whether the key has been revoked and can no longer be used
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
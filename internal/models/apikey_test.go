@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+var scopeTests = []struct {
+	scope    APIScope
+	required APIScope
+	allowed  bool
+}{
+	{ScopeReadOnly, ScopeReadOnly, true},
+	{ScopeReadOnly, ScopeBooking, false},
+	{ScopeBooking, ScopeReadOnly, true},
+	{ScopeBooking, ScopeAdmin, false},
+	{ScopeAdmin, ScopeBooking, true},
+	{APIScope("owner"), ScopeReadOnly, false},
+	{APIScope(""), APIScope(""), false},
+}
+
+func TestAPIScope_Allows(t *testing.T) {
+	for _, e := range scopeTests {
+		if e.scope.Allows(e.required) != e.allowed {
+			t.Errorf("expected %q allowing %q to be %v", e.scope, e.required, e.allowed)
+		}
+	}
+}
+
+func TestParseAPIScope(t *testing.T) {
+	if scope, ok := ParseAPIScope("booking"); !ok || scope != ScopeBooking {
+		t.Errorf("expected the booking scope, but got %q", scope)
+	}
+
+	if _, ok := ParseAPIScope("owner"); ok {
+		t.Error("expected an unknown scope to be refused")
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+// BulkResult records what a bulk action did to each of the reservations it was given
+type BulkResult struct {
+	Succeeded []int
+	Skipped   []BulkSkip
+}
+
+// BulkSkip is a reservation a bulk action left alone, and why
+type BulkSkip struct {
+	ID     int
+	Reason string
+}
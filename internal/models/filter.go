@@ -0,0 +1,101 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// How many reservations a list shows per page unless asked otherwise
+const DefaultPerPage = 25
+
+// ReservationSorts lists the orders a reservation list can be sorted in
+var ReservationSorts = []string{"arrival", "departure", "created", "name", "room"}
+
+// ReservationFilter selects, orders and pages a list of reservations. Zero fields don't filter
+type ReservationFilter struct {
+	// Matches the start of the first name, last name, email or phone
+	Search string
+	// Reservations with nights on or between Start and End
+	Start  time.Time
+	End    time.Time
+	RoomID int
+	Status ReservationStatus
+	// One of ReservationSorts, arrival by default
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// Offset returns how many reservations come before the filter's page
+func (f ReservationFilter) Offset() int {
+	if f.Page < 1 {
+		return 0
+	}
+	return (f.Page - 1) * f.PerPage
+}
+
+// Values returns the filter as query string values, without the page, so it survives moving between pages
+func (f ReservationFilter) Values() url.Values {
+	v := url.Values{}
+	if f.Search != "" {
+		v.Set("q", f.Search)
+	}
+	if !f.Start.IsZero() {
+		v.Set("start", f.Start.Format("2006-01-02"))
+	}
+	if !f.End.IsZero() {
+		v.Set("end", f.End.Format("2006-01-02"))
+	}
+	if f.RoomID != 0 {
+		v.Set("room", strconv.Itoa(f.RoomID))
+	}
+	if f.Status != "" {
+		v.Set("status", string(f.Status))
+	}
+	if f.Sort != "" {
+		v.Set("sort", f.Sort)
+	}
+	if f.Desc {
+		v.Set("dir", "desc")
+	}
+	return v
+}
+
+// ReservationPage is one page of a filtered reservation list
+type ReservationPage struct {
+	Reservations []Reservation
+	// Reservations matching the filter across every page
+	Total  int
+	Filter ReservationFilter
+}
+
+// TotalPages returns the number of pages the matching reservations fill
+func (p ReservationPage) TotalPages() int {
+	if p.Filter.PerPage < 1 {
+		return 1
+	}
+	pages := (p.Total + p.Filter.PerPage - 1) / p.Filter.PerPage
+	if pages < 1 {
+		return 1
+	}
+	return pages
+}
+
+// HasPrev reports whether there is a page before this one
+func (p ReservationPage) HasPrev() bool {
+	return p.Filter.Page > 1
+}
+
+// HasNext reports whether there is a page after this one
+func (p ReservationPage) HasNext() bool {
+	return p.Filter.Page < p.TotalPages()
+}
+
+// PageURL returns the query string for page n of the same list, e.g. "?page=2&q=smith"
+func (p ReservationPage) PageURL(n int) string {
+	v := p.Filter.Values()
+	v.Set("page", strconv.Itoa(n))
+	return "?" + v.Encode()
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReservationFilter_Values(t *testing.T) {
+	filter := ReservationFilter{
+		Search: "smith",
+		Start:  time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		RoomID: 2,
+		Status: StatusConfirmed,
+		Sort:   "name",
+		Desc:   true,
+		Page:   3,
+	}
+
+	expected := "dir=desc&q=smith&room=2&sort=name&start=2026-10-01&status=confirmed"
+	if encoded := filter.Values().Encode(); encoded != expected {
+		t.Errorf("expected %s but got %s", expected, encoded)
+	}
+}
+
+var reservationPageTests = []struct {
+	total      int
+	page       int
+	totalPages int
+	hasPrev    bool
+	hasNext    bool
+	offset     int
+}{
+	{0, 1, 1, false, false, 0},
+	{25, 1, 1, false, false, 0},
+	{26, 1, 2, false, true, 0},
+	{60, 2, 3, true, true, 25},
+	{60, 3, 3, true, false, 50},
+}
+
+func TestReservationPage(t *testing.T) {
+	for _, e := range reservationPageTests {
+		page := ReservationPage{
+			Total:  e.total,
+			Filter: ReservationFilter{Page: e.page, PerPage: DefaultPerPage},
+		}
+
+		if page.TotalPages() != e.totalPages {
+			t.Errorf("%d results: expected %d pages but got %d", e.total, e.totalPages, page.TotalPages())
+		}
+		if page.HasPrev() != e.hasPrev || page.HasNext() != e.hasNext {
+			t.Errorf("%d results on page %d: got prev %v and next %v", e.total, e.page, page.HasPrev(), page.HasNext())
+		}
+		if page.Filter.Offset() != e.offset {
+			t.Errorf("page %d: expected offset %d but got %d", e.page, e.offset, page.Filter.Offset())
+		}
+	}
+
+	page := ReservationPage{Filter: ReservationFilter{Search: "ann", Page: 1, PerPage: DefaultPerPage}}
+	if url := page.PageURL(2); url != "?page=2&q=ann" {
+		t.Errorf("expected ?page=2&q=ann but got %s", url)
+	}
+}
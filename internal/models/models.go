@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
@@ -25,6 +26,7 @@ type Room struct {
 	Description string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	DeletedAt   time.Time
 }
 
 // Restriction is the restriction model
@@ -48,7 +50,17 @@ type Reservation struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
-	Processed int
+	Status    ReservationStatus
+	DeletedAt time.Time
+	// Captured by the front desk at check-in
+	IDDocument     string
+	FrontDeskNotes string
+	// When the reservation entered each status, zero if it never has
+	ConfirmedAt  time.Time
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	CancelledAt  time.Time
+	NoShowAt     time.Time
 }
 
 // RoomRestriction is the room restriction model
@@ -66,6 +78,9 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
+// ErrRoomUnavailable is returned when a stay clashes with a booking already holding the room
+var ErrRoomUnavailable = errors.New("room is not available for these dates")
+
 // Informations for sending mail
 type MailData struct {
 	To       string
@@ -73,6 +88,39 @@ type MailData struct {
 	Subject  string
 	Content  string
 	Template string
+	// The reservation the mail is about, zero if it isn't about one
+	ReservationID int
+}
+
+// Mail log statuses
+const (
+	MailSent   = "sent"
+	MailFailed = "failed"
+)
+
+// MailLog records one email handed to the mail server, and whether it went out
+type MailLog struct {
+	ID            int
+	ReservationID int
+	To            string
+	From          string
+	Subject       string
+	Content       string
+	Status        string
+	Error         string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ReservationNote is an internal note left on a reservation by staff
+type ReservationNote struct {
+	ID            int
+	ReservationID int
+	UserID        int
+	Note          string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          User
 }
 
 // Informations for sending mail
@@ -83,3 +131,23 @@ type TodoList struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// AuditLog is the audit log model, one entry per admin write
+type AuditLog struct {
+	ID        int
+	UserID    int
+	Action    string
+	Entity    string
+	EntityID  int
+	Changes   []AuditChange
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	User      User
+}
+
+// AuditChange holds the before and after value of a single changed field
+type AuditChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
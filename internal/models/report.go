@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ReportKind names one of the reservation reports
+type ReportKind string
+
+const (
+	ReportByStayDate    ReportKind = "by-stay-date"
+	ReportByBookingDate ReportKind = "by-booking-date"
+	ReportByRoom        ReportKind = "by-room"
+	ReportCancellations ReportKind = "cancellations"
+	ReportNoShows       ReportKind = "no-shows"
+)
+
+// ReportQuery selects the reservations that go into a report. End is exclusive
+type ReportQuery struct {
+	Kind  ReportKind
+	Start time.Time
+	End   time.Time
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PriceValue returns the room price as a number. Prices are free text, e.g. "$89", so anything
+// that isn't a digit or a decimal point is dropped and a price that still won't parse is zero
+func (r Room) PriceValue() float64 {
+	digits := strings.Map(func(c rune) rune {
+		if (c >= '0' && c <= '9') || c == '.' {
+			return c
+		}
+		return -1
+	}, r.Price)
+
+	price, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return 0
+	}
+	return price
+}
+
+// OccupancyStats holds the totals the dashboard KPIs are worked out from, for one date range
+type OccupancyStats struct {
+	Start time.Time
+	End   time.Time
+	// Rooms that could be sold in the range
+	Rooms int
+	// Room nights held by reservations that were not cancelled or no-shows
+	RoomNightsSold int
+	// Room price times nights sold
+	Revenue float64
+}
+
+// Nights returns the number of nights in the range, counting the start date but not the end date
+func (s OccupancyStats) Nights() int {
+	if !s.End.After(s.Start) {
+		return 0
+	}
+	return int(s.End.Sub(s.Start).Hours() / 24)
+}
+
+// AvailableRoomNights returns the room nights there were to sell in the range
+func (s OccupancyStats) AvailableRoomNights() int {
+	return s.Rooms * s.Nights()
+}
+
+// OccupancyRate returns the percentage of available room nights that were sold
+func (s OccupancyStats) OccupancyRate() float64 {
+	available := s.AvailableRoomNights()
+	if available == 0 {
+		return 0
+	}
+	return float64(s.RoomNightsSold) / float64(available) * 100
+}
+
+// ADR returns the average daily rate, the revenue per room night sold
+func (s OccupancyStats) ADR() float64 {
+	if s.RoomNightsSold == 0 {
+		return 0
+	}
+	return s.Revenue / float64(s.RoomNightsSold)
+}
+
+// RevPAR returns the revenue per available room night
+func (s OccupancyStats) RevPAR() float64 {
+	available := s.AvailableRoomNights()
+	if available == 0 {
+		return 0
+	}
+	return s.Revenue / float64(available)
+}
+
+// Pickup is the business for stays in the next Days days that was booked in the dashboard's date range
+type Pickup struct {
+	Days  int
+	Stats OccupancyStats
+}
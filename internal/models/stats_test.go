@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Two rooms over ten nights, with seven room nights sold at 100 and three at 150
+var seededStats = OccupancyStats{
+	Start:          time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	End:            time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC),
+	Rooms:          2,
+	RoomNightsSold: 10,
+	Revenue:        7*100 + 3*150,
+}
+
+func TestOccupancyStats_KPIs(t *testing.T) {
+	if nights := seededStats.Nights(); nights != 10 {
+		t.Errorf("expected 10 nights but got %d", nights)
+	}
+
+	if available := seededStats.AvailableRoomNights(); available != 20 {
+		t.Errorf("expected 20 available room nights but got %d", available)
+	}
+
+	if rate := seededStats.OccupancyRate(); rate != 50 {
+		t.Errorf("expected 50%% occupancy but got %v", rate)
+	}
+
+	if adr := seededStats.ADR(); adr != 115 {
+		t.Errorf("expected an ADR of 115 but got %v", adr)
+	}
+
+	if revpar := seededStats.RevPAR(); revpar != 57.5 {
+		t.Errorf("expected a RevPAR of 57.5 but got %v", revpar)
+	}
+}
+
+func TestOccupancyStats_Empty(t *testing.T) {
+	var stats OccupancyStats
+
+	if stats.OccupancyRate() != 0 || stats.ADR() != 0 || stats.RevPAR() != 0 {
+		t.Error("expected empty stats to give zero KPIs instead of dividing by zero")
+	}
+
+	backwards := OccupancyStats{Start: seededStats.End, End: seededStats.Start, Rooms: 2}
+	if nights := backwards.Nights(); nights != 0 {
+		t.Errorf("expected a backwards range to have no nights but got %d", nights)
+	}
+}
+
+func TestRoom_PriceValue(t *testing.T) {
+	prices := map[string]float64{
+		"89":      89,
+		"$120.50": 120.5,
+		"1,200":   1200,
+		"free":    0,
+		"":        0,
+	}
+
+	for price, expected := range prices {
+		if value := (Room{Price: price}).PriceValue(); value != expected {
+			t.Errorf("expected %q to be %v but got %v", price, expected, value)
+		}
+	}
+}
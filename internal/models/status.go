@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ReservationStatus is where a reservation is in its lifecycle
+type ReservationStatus string
+
+const (
+	StatusPending    ReservationStatus = "pending"
+	StatusConfirmed  ReservationStatus = "confirmed"
+	StatusCheckedIn  ReservationStatus = "checked-in"
+	StatusCheckedOut ReservationStatus = "checked-out"
+	StatusCancelled  ReservationStatus = "cancelled"
+	StatusNoShow     ReservationStatus = "no-show"
+)
+
+// ErrInvalidTransition is returned when a reservation cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid reservation status transition")
+
+// ReservationStatuses lists every status in lifecycle order
+var ReservationStatuses = []ReservationStatus{
+	StatusPending,
+	StatusConfirmed,
+	StatusCheckedIn,
+	StatusCheckedOut,
+	StatusCancelled,
+	StatusNoShow,
+}
+
+// The only place the allowed transitions are defined. Statuses without an entry are final
+var statusTransitions = map[ReservationStatus][]ReservationStatus{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+// ParseReservationStatus returns the status named by s, or false if there is no such status
+func ParseReservationStatus(s string) (ReservationStatus, bool) {
+	for _, status := range ReservationStatuses {
+		if string(status) == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// AllowedTransitions returns the statuses a reservation in status s may move to
+func (s ReservationStatus) AllowedTransitions() []ReservationStatus {
+	return statusTransitions[s]
+}
+
+// Transition returns an error wrapping ErrInvalidTransition unless s may move to next
+func (s ReservationStatus) Transition(next ReservationStatus) error {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, s, next)
+}
+
+// HoldsRoom reports whether a reservation in status s still keeps its room unavailable for other bookings
+func (s ReservationStatus) HoldsRoom() bool {
+	return s != StatusCancelled && s != StatusNoShow
+}
+
+// Label returns the status formatted for display, e.g. "Checked In"
+func (s ReservationStatus) Label() string {
+	words := strings.Split(string(s), "-")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+var transitionTests = []struct {
+	from    ReservationStatus
+	to      ReservationStatus
+	allowed bool
+}{
+	{StatusPending, StatusConfirmed, true},
+	{StatusPending, StatusCancelled, true},
+	{StatusPending, StatusCheckedIn, false},
+	{StatusConfirmed, StatusCheckedIn, true},
+	{StatusConfirmed, StatusNoShow, true},
+	{StatusConfirmed, StatusPending, false},
+	{StatusCheckedIn, StatusCheckedOut, true},
+	{StatusCheckedIn, StatusCancelled, false},
+	{StatusCheckedOut, StatusCheckedIn, false},
+	{StatusCancelled, StatusConfirmed, false},
+	{StatusNoShow, StatusCheckedIn, false},
+}
+
+func TestReservationStatus_Transition(t *testing.T) {
+	for _, e := range transitionTests {
+		err := e.from.Transition(e.to)
+		if e.allowed && err != nil {
+			t.Errorf("%s to %s should be allowed but got %s", e.from, e.to, err)
+		}
+		if !e.allowed && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s to %s should be rejected but got %v", e.from, e.to, err)
+		}
+	}
+}
+
+func TestParseReservationStatus(t *testing.T) {
+	status, ok := ParseReservationStatus("checked-in")
+	if !ok || status != StatusCheckedIn {
+		t.Errorf("expected checked-in but got %q, %v", status, ok)
+	}
+
+	if _, ok := ParseReservationStatus("processed"); ok {
+		t.Error("parsed a status that does not exist")
+	}
+}
+
+func TestReservationStatus_Label(t *testing.T) {
+	if label := StatusCheckedOut.Label(); label != "Checked Out" {
+		t.Errorf("expected Checked Out but got %s", label)
+	}
+}
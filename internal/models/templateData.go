@@ -13,4 +13,6 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	// The configured hotel name, shown in titles and the footer
+	HotelName string
 }
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Webhook is an external endpoint that is sent the events it subscribes to
+type Webhook struct {
+	ID          int
+	URL         string
+	Description string
+	// Signs every payload, so the receiver can check it came from us
+	Secret string
+	Events []string
+	// Inactive webhooks are kept, with their log, but sent nothing
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Subscribes reports whether the webhook wants event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Where a webhook delivery has got to
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// Every attempt failed, and no more will be made
+	DeliveryFailed = "failed"
+)
+
+// WebhookDelivery is one event queued for, and then logged against, a webhook
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	Event     string
+	// The JSON body, kept so every attempt sends exactly the same thing
+	Payload  string
+	Status   string
+	Attempts int
+	// The HTTP status and error of the last attempt
+	ResponseStatus int
+	Error          string
+	NextAttemptAt  time.Time
+	DeliveredAt    time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Webhook        Webhook
+}
@@ -0,0 +1,292 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operation describes one endpoint of an API
+type Operation struct {
+	Method     string
+	Path       string
+	Summary    string
+	Tag        string
+	Parameters []Parameter
+	// A value of the type the endpoint reads from the request body, nil if it reads none
+	Body      interface{}
+	Responses []Response
+	// The scope an API key needs to call the endpoint, empty when it can be called without a key
+	Scope string
+}
+
+// Parameter is a value read from the path or the query string
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// The JSON schema type and format of the value, e.g. "string" and "date"
+	Type   string
+	Format string
+}
+
+// Response is one of the responses an operation can send
+type Response struct {
+	Status      int
+	Description string
+	// A value of the type written to the response body, nil if there is none
+	Body interface{}
+}
+
+// Document builds an OpenAPI 3 document describing operations. Body types are described by reflection,
+// so the document can't drift from the types the handlers read and write
+func Document(title, version, server string, operations []Operation) map[string]interface{} {
+	g := &generator{schemas: make(map[string]interface{})}
+
+	paths := make(map[string]interface{})
+	secured := false
+	for _, op := range operations {
+		secured = secured || op.Scope != ""
+
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	components := map[string]interface{}{
+		"schemas": g.schemas,
+	}
+	if secured {
+		components["securitySchemes"] = map[string]interface{}{
+			securityScheme: map[string]interface{}{
+				"type":        "http",
+				"scheme":      "bearer",
+				"description": "An API key, sent as Authorization: Bearer <key>",
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": server},
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+// securityScheme names the scheme of operations that need an API key
+const securityScheme = "apiKey"
+
+// generator collects the schema of every named type it meets, so each is described once and referenced
+type generator struct {
+	schemas map[string]interface{}
+}
+
+func (g *generator) operation(op Operation) map[string]interface{} {
+	operation := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+
+	if op.Tag != "" {
+		operation["tags"] = []string{op.Tag}
+	}
+
+	// Bearer schemes can't list scopes, so the scope needed is given in the description
+	if op.Scope != "" {
+		operation["security"] = []interface{}{
+			map[string]interface{}{securityScheme: []string{}},
+		}
+		operation["description"] = "Needs an API key with the " + op.Scope + " scope or above."
+	}
+
+	if len(op.Parameters) > 0 {
+		var parameters []interface{}
+		for _, p := range op.Parameters {
+			schema := map[string]interface{}{"type": p.Type}
+			if p.Format != "" {
+				schema["format"] = p.Format
+			}
+
+			parameters = append(parameters, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				// Path parameters are always required
+				"required": p.Required || p.In == "path",
+				"schema":   schema,
+			})
+		}
+		operation["parameters"] = parameters
+	}
+
+	if op.Body != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  g.content(op.Body),
+		}
+	}
+
+	responses := make(map[string]interface{})
+	for _, r := range op.Responses {
+		description := r.Description
+		if description == "" {
+			description = http.StatusText(r.Status)
+		}
+
+		response := map[string]interface{}{"description": description}
+		if r.Body != nil {
+			response["content"] = g.content(r.Body)
+		}
+		responses[strconv.Itoa(r.Status)] = response
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+func (g *generator) content(body interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": g.schema(reflect.TypeOf(body)),
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of t, following json struct tags. A format tag, e.g. `format:"date"`, sets the format of a field
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.object(t)
+	}
+
+	// Interfaces and anything else could hold any value
+	return map[string]interface{}{}
+}
+
+// object describes a named struct in the components, returning a reference to it. Unnamed structs are described in place
+func (g *generator) object(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if name == "" {
+		return g.properties(t)
+	}
+
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, ok := g.schemas[name]; ok {
+		return ref
+	}
+
+	// Claim the name before describing the fields, in case a field refers back to the type
+	g.schemas[name] = nil
+	g.schemas[name] = g.properties(t)
+
+	return ref
+}
+
+// properties describes the exported fields of a struct as they are encoded by encoding/json
+func (g *generator) properties(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, omitempty := jsonName(field)
+		if name == "-" {
+			continue
+		}
+
+		schema := g.schema(field.Type)
+		if format := field.Tag.Get("format"); format != "" {
+			schema["format"] = format
+		}
+		properties[name] = schema
+
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	object := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// jsonName returns the name encoding/json gives field, and whether it is left out when empty
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// operationID names an operation from its method and path, e.g. GET /rooms/{id} becomes getRoomsId
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.Trim(part, "{}")
+		if part == "" {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '_' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
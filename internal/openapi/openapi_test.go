@@ -0,0 +1,133 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Guest struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Born     string    `json:"born" format:"date"`
+	Nickname string    `json:"nickname,omitempty"`
+	Tags     []string  `json:"tags"`
+	Visits   []Visit   `json:"visits"`
+	Seen     time.Time `json:"seen"`
+	Secret   string    `json:"-"`
+	internal string
+}
+
+type Visit struct {
+	Nights int  `json:"nights"`
+	Paid   bool `json:"paid"`
+	Guest  *Guest
+}
+
+func TestDocument(t *testing.T) {
+	operations := []Operation{
+		{
+			Method:     http.MethodGet,
+			Path:       "/guests/{id}",
+			Summary:    "Get a guest",
+			Tag:        "guests",
+			Parameters: []Parameter{{Name: "id", In: "path", Type: "integer"}},
+			Responses:  []Response{{Status: http.StatusOK, Body: Guest{}}, {Status: http.StatusNotFound}},
+			Scope:      "read",
+		},
+		{
+			Method:    http.MethodPost,
+			Path:      "/guests",
+			Summary:   "Add a guest",
+			Body:      Guest{},
+			Responses: []Response{{Status: http.StatusCreated, Description: "Added", Body: Guest{}}},
+		},
+	}
+
+	document := Document("Guests", "1.0.0", "/api", operations)
+
+	// The document must survive a round trip through JSON, as that's how it is served
+	out, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := decoded["paths"].(map[string]interface{})
+	get := paths["/guests/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+
+	if get["operationId"] != "getGuestsId" {
+		t.Errorf("expected operation id getGuestsId, but got %v", get["operationId"])
+	}
+
+	parameter := get["parameters"].([]interface{})[0].(map[string]interface{})
+	if parameter["required"] != true {
+		t.Error("expected a path parameter to be required")
+	}
+
+	notFound := get["responses"].(map[string]interface{})["404"].(map[string]interface{})
+	if notFound["description"] != "Not Found" {
+		t.Errorf("expected the status text as the default description, but got %v", notFound["description"])
+	}
+
+	if _, ok := get["security"]; !ok {
+		t.Error("expected an operation with a scope to need a key")
+	}
+
+	post := paths["/guests"].(map[string]interface{})["post"].(map[string]interface{})
+	if _, ok := post["requestBody"]; !ok {
+		t.Error("expected a request body for the post")
+	}
+
+	if _, ok := post["security"]; ok {
+		t.Error("expected an operation without a scope to be public")
+	}
+
+	components := decoded["components"].(map[string]interface{})
+	if _, ok := components["securitySchemes"].(map[string]interface{})["apiKey"]; !ok {
+		t.Error("expected the apiKey security scheme")
+	}
+
+	schemas := components["schemas"].(map[string]interface{})
+	guest := schemas["Guest"].(map[string]interface{})
+	properties := guest["properties"].(map[string]interface{})
+
+	expected := map[string]map[string]interface{}{
+		"id":     {"type": "integer"},
+		"born":   {"type": "string", "format": "date"},
+		"seen":   {"type": "string", "format": "date-time"},
+		"tags":   {"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"visits": {"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/Visit"}},
+	}
+	for name, schema := range expected {
+		if !reflect.DeepEqual(properties[name], map[string]interface{}(schema)) {
+			t.Errorf("expected %s to be %v, but got %v", name, schema, properties[name])
+		}
+	}
+
+	for _, name := range []string{"Secret", "internal", "-"} {
+		if _, ok := properties[name]; ok {
+			t.Errorf("expected %s to be left out", name)
+		}
+	}
+
+	required := guest["required"].([]interface{})
+	for _, name := range required {
+		if name == "nickname" {
+			t.Error("expected an omitempty field not to be required")
+		}
+	}
+
+	// A type that refers back to itself is described once
+	visit := schemas["Visit"].(map[string]interface{})["properties"].(map[string]interface{})
+	if visit["Guest"].(map[string]interface{})["$ref"] != "#/components/schemas/Guest" {
+		t.Errorf("expected Visit.Guest to refer to Guest, but got %v", visit["Guest"])
+	}
+}
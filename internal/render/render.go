@@ -66,6 +66,8 @@ func AddDefaultData(templateData *models.TemplateData, r *http.Request) *models.
 		templateData.IsAuthenticated = 1
 	}
 
+	templateData.HotelName = app.HotelName
+
 	return templateData
 }
 
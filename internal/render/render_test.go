@@ -21,6 +21,9 @@ func TestAddDefaultData(test *testing.T) {
 	if result.Flash != "123" {
 		test.Error("flash value of 123 not found in session")
 	}
+	if result.HotelName != "Seaview" {
+		test.Errorf("expected the configured hotel name, but got %q", result.HotelName)
+	}
 
 }
 
@@ -37,6 +37,7 @@ func TestMain(mainTest *testing.M) {
 	session.Cookie.Secure = false
 
 	testApp.Session = session
+	testApp.HotelName = "Seaview"
 
 	app = &testApp
 
@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CellKind says how a spreadsheet should hold a cell
+type CellKind int
+
+// The kinds of cell. Numbers and dates are written to XLSX as numbers, so they can be summed and sorted
+const (
+	CellText CellKind = iota
+	CellNumber
+	CellDate
+)
+
+// Cell is one cell of a report row
+type Cell struct {
+	Value string
+	Kind  CellKind
+}
+
+// Text returns a cell holding s as it is
+func Text(s string) Cell {
+	return Cell{Value: s}
+}
+
+// Texts returns a text cell for each of values, as for a header row
+func Texts(values ...string) []Cell {
+	cells := make([]Cell, len(values))
+	for i, value := range values {
+		cells[i] = Text(value)
+	}
+	return cells
+}
+
+// Int returns a cell holding the whole number n
+func Int(n int) Cell {
+	return Cell{Value: strconv.Itoa(n), Kind: CellNumber}
+}
+
+// Money returns a cell holding an amount to two decimal places
+func Money(amount float64) Cell {
+	return Cell{Value: fmt.Sprintf("%.2f", amount), Kind: CellNumber}
+}
+
+// Date returns a cell holding the day of t, or an empty cell if it is zero
+func Date(t time.Time) Cell {
+	if t.IsZero() {
+		return Cell{}
+	}
+	return Cell{Value: t.Format("2006-01-02"), Kind: CellDate}
+}
+
+// formulaStarts are what a spreadsheet takes a cell starting with as a formula
+const formulaStarts = "=+-@\t\r"
+
+// neutralise keeps a spreadsheet from running text as a formula, by starting it with a quote if it could be one.
+// Guests choose their names, email and phone, so a booking as =HYPERLINK(...) would otherwise run in the export
+func neutralise(s string) string {
+	if s != "" && strings.ContainsRune(formulaStarts, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
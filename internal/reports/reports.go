@@ -0,0 +1,76 @@
+package reports
+
+import (
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// Report describes one of the downloadable reservation reports
+type Report struct {
+	Kind        models.ReportKind
+	Title       string
+	Description string
+}
+
+// Reports lists every report in the order the reports page shows them
+var Reports = []Report{
+	{models.ReportByStayDate, "Reservations by Stay Date", "Reservations with nights between the dates, ordered by arrival"},
+	{models.ReportByBookingDate, "Reservations by Booking Date", "Reservations made between the dates, ordered by when they were made"},
+	{models.ReportByRoom, "Reservations by Room", "Reservations with nights between the dates, grouped by room"},
+	{models.ReportCancellations, "Cancellations", "Reservations cancelled between the dates"},
+	{models.ReportNoShows, "No-Shows", "Guests due between the dates who never arrived"},
+}
+
+// Find returns the report named by kind, or false if there is no such report
+func Find(kind string) (Report, bool) {
+	for _, report := range Reports {
+		if string(report.Kind) == kind {
+			return report, true
+		}
+	}
+	return Report{}, false
+}
+
+// Columns is the header row of every reservation report
+var Columns = []string{
+	"ID",
+	"First Name",
+	"Last Name",
+	"Email",
+	"Phone",
+	"Room",
+	"Arrival",
+	"Departure",
+	"Nights",
+	"Status",
+	"Booked",
+	"Cancelled",
+	"No Show",
+	"Revenue",
+}
+
+// Row returns the report columns for one reservation. Revenue is the room price times the nights booked
+func Row(r models.Reservation) []Cell {
+	nights := int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+
+	return []Cell{
+		Int(r.ID),
+		Text(r.FirstName),
+		Text(r.LastName),
+		Text(r.Email),
+		Text(r.Phone),
+		Text(r.Room.RoomName),
+		Date(r.StartDate),
+		Date(r.EndDate),
+		Int(nights),
+		Text(r.Status.Label()),
+		Date(r.CreatedAt),
+		Date(r.CancelledAt),
+		Date(r.NoShowAt),
+		Money(r.Room.PriceValue() * float64(nights)),
+	}
+}
+
+// Header returns Columns as the first row of a report
+func Header() []Cell {
+	return Texts(Columns...)
+}
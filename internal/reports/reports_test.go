@@ -0,0 +1,186 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+var seededReservation = models.Reservation{
+	ID:        7,
+	FirstName: "Ada",
+	LastName:  "Lovelace",
+	Email:     "ada@example.com",
+	Phone:     "5550100",
+	StartDate: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2026, 10, 4, 0, 0, 0, 0, time.UTC),
+	CreatedAt: time.Date(2026, 9, 12, 8, 30, 0, 0, time.UTC),
+	Status:    models.StatusCheckedOut,
+	Room:      models.Room{RoomName: "General's Quarters", Price: "$89.50"},
+}
+
+func TestRow(t *testing.T) {
+	row := Row(seededReservation)
+
+	if len(row) != len(Columns) {
+		t.Fatalf("expected %d columns but got %d", len(Columns), len(row))
+	}
+
+	expected := map[string]Cell{
+		"ID":        {"7", CellNumber},
+		"Arrival":   {"2026-10-01", CellDate},
+		"Nights":    {"3", CellNumber},
+		"Status":    {"Checked Out", CellText},
+		"Booked":    {"2026-09-12", CellDate},
+		"Cancelled": {"", CellText},
+		"Revenue":   {"268.50", CellNumber},
+	}
+	for i, column := range Columns {
+		if want, ok := expected[column]; ok && row[i] != want {
+			t.Errorf("expected %s to be %+v but got %+v", column, want, row[i])
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	if report, ok := Find("no-shows"); !ok || report.Kind != models.ReportNoShows {
+		t.Errorf("expected to find the no-shows report but got %v, %v", report, ok)
+	}
+
+	if _, ok := Find("payroll"); ok {
+		t.Error("found a report that does not exist")
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(FormatCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(Texts("Room", "Guest"))
+	w.Write(Texts("General's Quarters", "Lovelace, Ada"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Room,Guest\nGeneral's Quarters,\"Lovelace, Ada\"\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q but got %q", expected, buf.String())
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(FormatXLSX, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(Texts("Room", "Notes"))
+	w.Write(Texts("Major's Suite", "<late> & tired"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := readSheet(t, buf.Bytes())
+
+	if !strings.Contains(sheet, "<t xml:space=\"preserve\">Major's Suite</t>") {
+		t.Error("expected the sheet to hold the written cells")
+	}
+	if !strings.Contains(sheet, "&lt;late&gt; &amp; tired") {
+		t.Error("expected cell text to be escaped")
+	}
+	if strings.Count(sheet, "<row>") != 2 {
+		t.Errorf("expected 2 rows but got %d", strings.Count(sheet, "<row>"))
+	}
+}
+
+func TestWriters_Formulas(t *testing.T) {
+	row := []Cell{Text("=HYPERLINK(\"http://evil\")"), Text("@SUM(A1)"), Text("+1 555"), Text("-2"), Text("\tx"), Text("\rx"),
+		Text("Ada"), Int(-2)}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(FormatCSV, &buf)
+	w.Write(row)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\"'=HYPERLINK(\"\"http://evil\"\")\",'@SUM(A1),'+1 555,'-2,'\tx,\"'\rx\",Ada,-2\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q but got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(FormatXLSX, &buf)
+	w.Write(row)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := readSheet(t, buf.Bytes())
+	if !strings.Contains(sheet, "<t xml:space=\"preserve\">'=HYPERLINK") || !strings.Contains(sheet, "<t xml:space=\"preserve\">'@SUM(A1)</t>") {
+		t.Errorf("expected formulas to start with a quote, but got %s", sheet)
+	}
+	if !strings.Contains(sheet, "<c><v>-2</v></c>") {
+		t.Errorf("expected a negative number to stay a number, but got %s", sheet)
+	}
+}
+
+func TestXLSXWriter_NumbersAndDates(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, _ := NewWriter(FormatXLSX, &buf)
+	w.Write(Row(seededReservation))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := readSheet(t, buf.Bytes())
+
+	// 2026-10-01 is day 46296 counting from 1899-12-30
+	for _, cell := range []string{"<c><v>7</v></c>", "<c><v>3</v></c>", "<c><v>268.50</v></c>", `<c s="1"><v>46296</v></c>`} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("expected the sheet to hold %s, but got %s", cell, sheet)
+		}
+	}
+	if strings.Contains(sheet, ">2026-10-01<") {
+		t.Errorf("expected dates to be written as numbers, but got %s", sheet)
+	}
+}
+
+// readSheet returns the sheet of the workbook in content
+func readSheet(t *testing.T, content []byte) string {
+	t.Helper()
+
+	z, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("expected a zip file: %s", err)
+	}
+
+	for _, f := range z.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, _ := f.Open()
+		sheet, _ := io.ReadAll(r)
+		r.Close()
+		return string(sheet)
+	}
+
+	t.Fatal("expected the workbook to have a sheet")
+	return ""
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
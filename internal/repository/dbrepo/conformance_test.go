@@ -0,0 +1,1579 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/driver"
+	"github.com/atuprosper/booking-project/internal/migrate"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The conformance tests run every DatabaseRepo method against each backend, so they can't drift apart.
+// Each test is given a fresh repository holding only what the migrations seed: the two rooms, the two
+// restrictions and the admin, all with id 1 upwards. SQLite gets a new database file for each test.
+//
+// Postgres is only tested when TEST_DBURI points at a database, which is migrated first, for example
+//
+//	TEST_DBURI="host=localhost port=5432 dbname=bookings_test user=postgres password=" go test ./internal/repository/dbrepo
+//
+// Everything in that database is deleted before each test.
+
+// newRepo returns a fresh repository holding only the seeded rows
+type newRepo func(t *testing.T) repository.DatabaseRepo
+
+// backends returns the repositories to test, by name
+func backends() map[string]newRepo {
+	repos := map[string]newRepo{
+		"memory": func(t *testing.T) repository.DatabaseRepo {
+			return NewMemoryRepo(&config.AppConfig{})
+		},
+		"sqlite": sqliteRepo,
+	}
+
+	if dbURI := os.Getenv("TEST_DBURI"); dbURI != "" {
+		repos["postgres"] = postgresRepo(dbURI)
+	}
+
+	return repos
+}
+
+// Empties a migrated Postgres database and seeds it the way the migrations do, with the ids starting from 1 again
+var resetPostgres = []string{
+	`truncate table webhook_deliveries, webhooks, api_keys, audit_logs, mail_logs, reservation_notes, todo_list,
+		room_restrictions, reservations, restrictions, rooms, users restart identity cascade`,
+	`insert into users (first_name, last_name, email, password, access_level, created_at, updated_at) values
+		('Prosper', 'Atu', 'atu@prosper.com', '$2a$12$yD7f6L4WzEkRw.Esr07W0Okl5M/K4/V9vaV.3Tgifv8NfOCH5au1y', 1, now(), now())`,
+	`insert into rooms (room_name, created_at, updated_at) values
+		('Generals Suit', now(), now()), ('Luxery One', now(), now())`,
+	`insert into restrictions (restriction_name, created_at, updated_at) values
+		('Reservation', now(), now()), ('Owners Block', now(), now())`,
+}
+
+// postgresRepo returns a newRepo resetting the Postgres database at dbURI
+func postgresRepo(dbURI string) newRepo {
+	return func(t *testing.T) repository.DatabaseRepo {
+		t.Helper()
+
+		db, err := driver.NewDatabase(dbURI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		runner, err := migrate.New(&driver.DB{SQL: db, Driver: driver.Postgres})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := runner.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, statement := range resetPostgres {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return NewPostgresRepo(db, &config.AppConfig{DBTimeouts: config.NewDBTimeouts()})
+	}
+}
+
+// sqliteRepo returns a repository on a new SQLite database file with the migrations applied
+func sqliteRepo(t *testing.T) repository.DatabaseRepo {
+	t.Helper()
+
+	db, err := driver.NewDatabase("sqlite://" + filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := migrate.New(&driver.DB{SQL: db, Driver: driver.SQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteRepo(db, &config.AppConfig{DBTimeouts: config.NewDBTimeouts()})
+}
+
+var conformanceTests = []struct {
+	name string
+	test func(*testing.T, repository.DatabaseRepo)
+}{
+	{"Rooms", checkRooms},
+	{"Availability", checkAvailability},
+	{"Restrictions", checkRestrictions},
+	{"ForeignKeys", checkForeignKeys},
+	{"Users", checkUsers},
+	{"Authenticate", checkAuthenticate},
+	{"InsertUser", checkInsertUser},
+	{"Reservations", checkReservations},
+	{"BulkChanges", checkBulkChanges},
+	{"Trash", checkTrash},
+	{"RestoreTaken", checkRestoreTaken},
+	{"Purge", checkPurge},
+	{"SearchReservations", checkSearchReservations},
+	{"FrontDesk", checkFrontDesk},
+	{"AtDesk", checkAtDesk},
+	{"ImportReservations", checkImportReservations},
+	{"InsertBooking", checkInsertBooking},
+	{"Stats", checkStats},
+	{"Reports", checkReports},
+	{"Todos", checkTodos},
+	{"NotesAndMailLogs", checkNotesAndMailLogs},
+	{"AuditLogs", checkAuditLogs},
+	{"WithTx", checkWithTx},
+	{"APIKeys", checkAPIKeys},
+	{"Webhooks", checkWebhooks},
+}
+
+func TestConformance(t *testing.T) {
+	for name, newRepo := range backends() {
+		for _, e := range conformanceTests {
+			t.Run(name+"/"+e.name, func(t *testing.T) {
+				e.test(t, newRepo(t))
+			})
+		}
+	}
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+// book reserves room for a stay from start to end without checking it is free, returning the reservation id
+func book(t *testing.T, repo repository.DatabaseRepo, room int, start, end string) int {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", LastName: "Smith", RoomID: room,
+		StartDate: date(start), EndDate: date(end)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: room, ReservationID: id, RestrictionID: 1,
+		StartDate: date(start), EndDate: date(end)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// insertReservation inserts reservation without holding its room, moving it on to status, and returns its id
+func insertReservation(t *testing.T, repo repository.DatabaseRepo, reservation models.Reservation, status models.ReservationStatus) int {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every status is reached through the ones the lifecycle requires before it
+	var path []models.ReservationStatus
+	switch status {
+	case models.StatusPending, "":
+		return id
+	case models.StatusConfirmed, models.StatusCancelled:
+		path = []models.ReservationStatus{status}
+	case models.StatusCheckedOut:
+		path = []models.ReservationStatus{models.StatusConfirmed, models.StatusCheckedIn, status}
+	default:
+		path = []models.ReservationStatus{models.StatusConfirmed, status}
+	}
+	for _, next := range path {
+		if err := repo.UpdateReservationStatus(ctx, id, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func reservationIDs(reservations []models.Reservation) []int {
+	ids := []int{}
+	for _, r := range reservations {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func roomIDs(rooms []models.Room) []int {
+	ids := []int{}
+	for _, r := range rooms {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func deliveryIDs(deliveries []models.WebhookDelivery) []int {
+	ids := []int{}
+	for _, d := range deliveries {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func skippedIDs(result models.BulkResult) []int {
+	ids := []int{}
+	for _, skip := range result.Skipped {
+		ids = append(ids, skip.ID)
+	}
+	return ids
+}
+
+// sameIDs reports whether got holds the ids in expected, in the same order
+func sameIDs(got []int, expected ...int) bool {
+	if len(expected) == 0 {
+		return len(got) == 0
+	}
+	return reflect.DeepEqual(got, expected)
+}
+
+func checkRooms(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	rooms, err := repo.AllRooms(ctx)
+	if err != nil || !sameIDs(roomIDs(rooms), 1, 2) || rooms[0].RoomName != "Generals Suit" || rooms[0].Price != "0" {
+		t.Fatalf("expected the seeded rooms, but got %+v, %v", rooms, err)
+	}
+
+	id, err := repo.InsertRoom(ctx, models.Room{RoomName: "Annex", Price: "120", ImageSource: "annex.png", Description: "Quiet"})
+	if err != nil || id != 3 {
+		t.Fatalf("expected room 3, but got %d, %v", id, err)
+	}
+
+	err = repo.UpdateRoom(ctx, models.Room{ID: id, RoomName: "Annex Suite", Price: "150", ImageSource: "suite.png", Description: "Quieter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, err := repo.GetRoomByID(ctx, id)
+	if err != nil || room.RoomName != "Annex Suite" || room.Price != "150" || room.ImageSource != "suite.png" ||
+		room.Description != "Quieter" || room.CreatedAt.IsZero() || !room.DeletedAt.IsZero() {
+		t.Errorf("expected the updated room, but got %+v, %v", room, err)
+	}
+
+	imported, err := repo.ImportRooms(ctx, []models.Room{{RoomName: "Cellar"}, {RoomName: "Attic", Price: "90"}})
+	if err != nil || !sameIDs(imported, 4, 5) {
+		t.Fatalf("expected rooms 4 and 5, but got %v, %v", imported, err)
+	}
+
+	// Ordered by name
+	rooms, _ = repo.AllRooms(ctx)
+	if !sameIDs(roomIDs(rooms), 3, 5, 4, 1, 2) {
+		t.Errorf("expected the rooms by name, but got %+v", rooms)
+	}
+
+	if _, err := repo.GetRoomByID(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for room 99, but got %v", err)
+	}
+
+	if err := repo.DeleteRoom(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	rooms, _ = repo.AllRooms(ctx)
+	if !sameIDs(roomIDs(rooms), 5, 4, 1, 2) {
+		t.Errorf("expected the trashed room to be left out, but got %+v", rooms)
+	}
+
+	rooms, _ = repo.SearchAvailabilityForAllRooms(ctx, date("2040-01-01"), date("2040-01-02"))
+	for _, r := range rooms {
+		if r.ID == id {
+			t.Error("expected a trashed room not to be offered")
+		}
+	}
+
+	deleted, _ := repo.DeletedRooms(ctx)
+	if !sameIDs(roomIDs(deleted), id) || deleted[0].DeletedAt.IsZero() {
+		t.Errorf("expected the trashed room in the trash, but got %+v", deleted)
+	}
+
+	if room, _ := repo.GetRoomByID(ctx, id); room.DeletedAt.IsZero() {
+		t.Error("expected a trashed room to still be found, with when it was deleted")
+	}
+
+	if err := repo.RestoreRoom(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, _ := repo.DeletedRooms(ctx); len(deleted) != 0 {
+		t.Errorf("expected the trash to be empty, but got %+v", deleted)
+	}
+	if room, _ := repo.GetRoomByID(ctx, id); !room.DeletedAt.IsZero() {
+		t.Error("expected a restored room not to be marked deleted")
+	}
+}
+
+// Room 1 is booked from the 10th to the 12th. Stays overlap if they share any date, arrival and departure included
+var availabilityTests = []struct {
+	name      string
+	start     string
+	end       string
+	available bool
+}{
+	{"before", "2040-01-01", "2040-01-09", true},
+	{"ends-on-arrival", "2040-01-08", "2040-01-10", false},
+	{"inside", "2040-01-11", "2040-01-11", false},
+	{"around", "2040-01-05", "2040-01-20", false},
+	{"starts-on-departure", "2040-01-12", "2040-01-14", false},
+	{"after", "2040-01-13", "2040-01-15", true},
+}
+
+func checkAvailability(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	id := book(t, repo, 1, "2040-01-10", "2040-01-12")
+
+	for _, e := range availabilityTests {
+		available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date(e.start), date(e.end), 1)
+		if err != nil || available != e.available {
+			t.Errorf("failed %s: expected available %v, but got %v, %v", e.name, e.available, available, err)
+		}
+
+		rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date(e.start), date(e.end))
+		expected := []int{2}
+		if e.available {
+			expected = []int{1, 2}
+		}
+		if err != nil || !sameIDs(roomIDs(rooms), expected...) {
+			t.Errorf("failed %s: expected rooms %v free, but got %+v, %v", e.name, expected, rooms, err)
+		}
+	}
+
+	// Whether each change to the reservation leaves room 1 held for its stay
+	steps := []struct {
+		name   string
+		change func() error
+		held   bool
+	}{
+		{"trashed", func() error { return repo.DeleteReservation(ctx, id) }, false},
+		{"restored", func() error { return repo.RestoreReservation(ctx, id) }, true},
+		{"confirmed", func() error { return repo.UpdateReservationStatus(ctx, id, models.StatusConfirmed) }, true},
+		{"cancelled", func() error { return repo.UpdateReservationStatus(ctx, id, models.StatusCancelled) }, false},
+	}
+
+	for _, e := range steps {
+		if err := e.change(); err != nil {
+			t.Fatalf("failed %s: %v", e.name, err)
+		}
+		available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-10"), date("2040-01-12"), 1)
+		if available == e.held {
+			t.Errorf("failed %s: expected the room held %v, but it was available %v", e.name, e.held, available)
+		}
+	}
+
+	noShow := book(t, repo, 2, "2040-01-10", "2040-01-12")
+	if err := repo.UpdateReservationStatus(ctx, noShow, models.StatusConfirmed); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateReservationStatus(ctx, noShow, models.StatusNoShow); err != nil {
+		t.Fatal(err)
+	}
+	if available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-10"), date("2040-01-12"), 2); !available {
+		t.Error("expected a no-show to free its room")
+	}
+
+	if err := repo.InsertBlockForRoom(ctx, 1, date("2040-01-11")); err != nil {
+		t.Fatal(err)
+	}
+	if available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-10"), date("2040-01-12"), 1); available {
+		t.Error("expected an owner block to hold the room")
+	}
+	if available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-12"), date("2040-01-13"), 1); !available {
+		t.Error("expected an owner block to hold the room for its day only")
+	}
+}
+
+func checkRestrictions(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	id := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	book(t, repo, 2, "2040-01-10", "2040-01-12")
+	cancelled := book(t, repo, 1, "2040-01-20", "2040-01-22")
+	if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.InsertBlockForRoom(ctx, 1, date("2040-01-15")); err != nil {
+		t.Fatal(err)
+	}
+
+	restrictions, err := repo.GetRestrictionsForCurrentRoom(ctx, 1, date("2040-01-01"), date("2040-01-31"))
+	if err != nil || len(restrictions) != 2 {
+		t.Fatalf("expected the stay and the block on room 1, but got %+v, %v", restrictions, err)
+	}
+
+	var stay, block models.RoomRestriction
+	for _, r := range restrictions {
+		if r.RestrictionID == 1 {
+			stay = r
+		} else {
+			block = r
+		}
+	}
+
+	if stay.ReservationID != id || stay.RoomID != 1 || !stay.StartDate.Equal(date("2040-01-10")) ||
+		!stay.EndDate.Equal(date("2040-01-12")) || stay.Reservation.Status != models.StatusPending {
+		t.Errorf("expected the stay, but got %+v", stay)
+	}
+	if block.RestrictionID != 2 || block.ReservationID != 0 || !block.StartDate.Equal(date("2040-01-15")) ||
+		!block.EndDate.Equal(date("2040-01-15")) {
+		t.Errorf("expected the block, but got %+v", block)
+	}
+
+	// The calendar leaves out a stay that ends on the first day it shows
+	if restrictions, _ := repo.GetRestrictionsForCurrentRoom(ctx, 1, date("2040-01-12"), date("2040-01-14")); len(restrictions) != 0 {
+		t.Errorf("expected nothing from the 12th to the 14th, but got %+v", restrictions)
+	}
+
+	if err := repo.DeleteBlockByID(ctx, block.ID); err != nil {
+		t.Fatal(err)
+	}
+	restrictions, _ = repo.GetRestrictionsForCurrentRoom(ctx, 1, date("2040-01-01"), date("2040-01-31"))
+	if len(restrictions) != 1 || restrictions[0].ID != stay.ID {
+		t.Errorf("expected only the stay once the block is deleted, but got %+v", restrictions)
+	}
+}
+
+func checkForeignKeys(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	id := book(t, repo, 1, "2040-01-10", "2040-01-12")
+
+	refused := []struct {
+		name   string
+		insert func() error
+	}{
+		{"reservation for room 9", func() error {
+			_, err := repo.InsertReservation(ctx, models.Reservation{RoomID: 9})
+			return err
+		}},
+		{"restriction for no reservation", func() error {
+			return repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 1, RestrictionID: 1})
+		}},
+		{"restriction for reservation 99", func() error {
+			return repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 1, ReservationID: 99, RestrictionID: 1})
+		}},
+		{"restriction for room 9", func() error {
+			return repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 9, ReservationID: id, RestrictionID: 1})
+		}},
+		{"restriction of kind 9", func() error {
+			return repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 1, ReservationID: id, RestrictionID: 9})
+		}},
+		{"block on room 9", func() error {
+			return repo.InsertBlockForRoom(ctx, 9, date("2040-01-01"))
+		}},
+		{"todo for user 9", func() error {
+			_, err := repo.InsertTodoList(ctx, models.TodoList{UserID: 9, Todo: "Paint"})
+			return err
+		}},
+		{"note on reservation 99", func() error {
+			return repo.InsertReservationNote(ctx, models.ReservationNote{ReservationID: 99, Note: "Late"})
+		}},
+		{"delivery to webhook 9", func() error {
+			_, err := repo.InsertWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: 9, NextAttemptAt: time.Now()})
+			return err
+		}},
+		{"repeated API key prefix", func() error {
+			_, err := repo.InsertAPIKey(ctx, models.APIKey{Name: "Twice", Prefix: "abcd1234"})
+			if err == nil {
+				_, err = repo.InsertAPIKey(ctx, models.APIKey{Name: "Twice", Prefix: "abcd1234"})
+			}
+			return err
+		}},
+	}
+
+	for _, e := range refused {
+		if err := e.insert(); err == nil {
+			t.Errorf("expected a %s to be refused", e.name)
+		}
+	}
+
+	if restrictions, _ := repo.GetRestrictionsForCurrentRoom(ctx, 1, date("2040-01-01"), date("2040-01-31")); len(restrictions) != 1 {
+		t.Errorf("expected nothing refused to have been written, but got %+v", restrictions)
+	}
+}
+
+func checkUsers(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	if !repo.AllUsers(ctx) {
+		t.Error("expected AllUsers to be true")
+	}
+
+	user, err := repo.GetUserByID(ctx, 1)
+	if err != nil || user.Email != "atu@prosper.com" || user.FirstName != "Prosper" || user.AccessLevel != 1 || user.Password == "" {
+		t.Fatalf("expected the seeded admin, but got %+v, %v", user, err)
+	}
+
+	if _, err := repo.GetUserByID(ctx, 9); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for user 9, but got %v", err)
+	}
+
+	err = repo.UpdateUser(ctx, models.User{ID: 1, FirstName: "Ada", LastName: "Lovelace", Email: "ada@prosper.com", AccessLevel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updating a user that doesn't exist must not touch the ones that do
+	err = repo.UpdateUser(ctx, models.User{ID: 2, FirstName: "Nobody", Email: "nobody@prosper.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ = repo.GetUserByID(ctx, 1)
+	if user.FirstName != "Ada" || user.LastName != "Lovelace" || user.Email != "ada@prosper.com" || user.AccessLevel != 3 {
+		t.Errorf("expected only the admin's own update, but got %+v", user)
+	}
+}
+
+func checkAuthenticate(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	if id, hash, err := repo.Authenticate(ctx, "atu@prosper.com", "password"); err != nil || id != 1 || hash == "" {
+		t.Errorf("expected the seeded admin to log in, but got %d, %v", id, err)
+	}
+	if _, _, err := repo.Authenticate(ctx, "atu@prosper.com", "secret"); err == nil {
+		t.Error("expected a wrong password to be refused")
+	}
+	if _, _, err := repo.Authenticate(ctx, "nobody@prosper.com", "password"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown email, but got %v", err)
+	}
+}
+
+func checkInsertUser(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	id, err := repo.InsertUser(ctx, models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@prosper.com",
+		Password: string(hash), AccessLevel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 {
+		t.Errorf("expected the new user to be 2, but got %d", id)
+	}
+
+	user, err := repo.GetUserByEmail(ctx, "ada@prosper.com")
+	if err != nil || user.ID != id || user.FirstName != "Ada" || user.AccessLevel != 3 || user.CreatedAt.IsZero() {
+		t.Errorf("expected the new user, but got %+v, %v", user, err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "nobody@prosper.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown email, but got %v", err)
+	}
+
+	if _, err := repo.InsertUser(ctx, models.User{Email: "atu@prosper.com", Password: string(hash)}); err == nil {
+		t.Error("expected a second user with the admin's email to be refused")
+	}
+
+	if id, _, err := repo.Authenticate(ctx, "ada@prosper.com", "secret"); err != nil || id != 2 {
+		t.Errorf("expected the new user to log in, but got %d, %v", id, err)
+	}
+
+	hash, _ = bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	if err := repo.UpdateUserPassword(ctx, 1, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.Authenticate(ctx, "atu@prosper.com", "password"); err == nil {
+		t.Error("expected the old password to be refused")
+	}
+	if id, _, err := repo.Authenticate(ctx, "atu@prosper.com", "changed"); err != nil || id != 1 {
+		t.Errorf("expected the new password to log in, but got %d, %v", id, err)
+	}
+	if _, _, err := repo.Authenticate(ctx, "ada@prosper.com", "secret"); err != nil {
+		t.Errorf("expected only the admin's password to change, but got %v", err)
+	}
+}
+
+func checkReservations(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@smith.com",
+		Phone: "555", RoomID: 1, StartDate: date("2040-01-10"), EndDate: date("2040-01-12")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reservation, err := repo.GetReservationByID(ctx, id)
+	if err != nil || reservation.FirstName != "John" || reservation.Email != "john@smith.com" || reservation.Phone != "555" ||
+		!reservation.StartDate.Equal(date("2040-01-10")) || !reservation.EndDate.Equal(date("2040-01-12")) ||
+		reservation.Status != models.StatusPending || reservation.Room.ID != 1 || reservation.Room.RoomName != "Generals Suit" ||
+		reservation.Room.Price != "0" || reservation.CreatedAt.IsZero() {
+		t.Fatalf("expected the new reservation, but got %+v, %v", reservation, err)
+	}
+
+	if _, err := repo.GetReservationByID(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for reservation 99, but got %v", err)
+	}
+
+	// Only the guest details are changed
+	err = repo.UpdateReservation(ctx, models.Reservation{ID: id, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com",
+		Phone: "777", RoomID: 2, StartDate: date("2040-02-01"), Status: models.StatusCheckedOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reservation, _ = repo.GetReservationByID(ctx, id)
+	if reservation.FirstName != "Jane" || reservation.LastName != "Doe" || reservation.Email != "jane@doe.com" ||
+		reservation.Phone != "777" || reservation.RoomID != 1 || !reservation.StartDate.Equal(date("2040-01-10")) ||
+		reservation.Status != models.StatusPending {
+		t.Errorf("expected only the guest details to change, but got %+v", reservation)
+	}
+
+	if err := repo.UpdateReservationStatus(ctx, id, models.StatusConfirmed); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateReservationStatus(ctx, id, models.StatusCheckedOut); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("expected confirmed to checked-out to be refused, but got %v", err)
+	}
+	if err := repo.UpdateReservationStatus(ctx, 99, models.StatusConfirmed); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for reservation 99, but got %v", err)
+	}
+
+	arrived := time.Date(2040, 1, 10, 15, 30, 0, 0, time.UTC)
+	if err := repo.CheckInReservation(ctx, id, arrived, "Passport 123", "Late arrival"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CheckInReservation(ctx, id, arrived, "", ""); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("expected a second check in to be refused, but got %v", err)
+	}
+
+	reservation, _ = repo.GetReservationByID(ctx, id)
+	if reservation.Status != models.StatusCheckedIn || reservation.ConfirmedAt.IsZero() || !reservation.CheckedInAt.Equal(arrived) ||
+		reservation.IDDocument != "Passport 123" || reservation.FrontDeskNotes != "Late arrival" {
+		t.Errorf("expected the reservation to be checked in, but got %+v", reservation)
+	}
+
+	if err := repo.UpdateReservationStatus(ctx, id, models.StatusCheckedOut); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, id); reservation.CheckedOutAt.IsZero() {
+		t.Errorf("expected the check out to be stamped, but got %+v", reservation)
+	}
+}
+
+func checkBulkChanges(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	stay := models.Reservation{FirstName: "John", RoomID: 1, StartDate: date("2040-01-10"), EndDate: date("2040-01-12")}
+	pending := insertReservation(t, repo, stay, models.StatusPending)
+	cancelled := insertReservation(t, repo, stay, models.StatusCancelled)
+
+	result, err := repo.BulkUpdateReservationStatus(ctx, []int{pending, cancelled, 99}, models.StatusConfirmed)
+	if err != nil || !sameIDs(result.Succeeded, pending) || !sameIDs(skippedIDs(result), cancelled, 99) {
+		t.Errorf("expected only the pending reservation confirmed, but got %+v, %v", result, err)
+	}
+
+	if reservation, _ := repo.GetReservationByID(ctx, pending); reservation.Status != models.StatusConfirmed || reservation.ConfirmedAt.IsZero() {
+		t.Errorf("expected the reservation to be confirmed, but got %+v", reservation)
+	}
+
+	result, err = repo.BulkDeleteReservations(ctx, []int{pending, 99})
+	if err != nil || !sameIDs(result.Succeeded, pending) || !sameIDs(skippedIDs(result), 99) {
+		t.Errorf("expected only the confirmed reservation deleted, but got %+v, %v", result, err)
+	}
+
+	result, _ = repo.BulkDeleteReservations(ctx, []int{pending, cancelled})
+	if !sameIDs(result.Succeeded, cancelled) || !sameIDs(skippedIDs(result), pending) {
+		t.Errorf("expected a reservation already in the trash to be skipped, but got %+v", result)
+	}
+}
+
+func checkTrash(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	first := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	second := book(t, repo, 2, "2040-01-10", "2040-01-12")
+
+	for _, id := range []int{first, second} {
+		if err := repo.DeleteReservation(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := repo.DeletedReservations(ctx)
+	if err != nil || !sameIDs(reservationIDs(deleted), second, first) || deleted[0].DeletedAt.IsZero() ||
+		deleted[0].Room.RoomName != "Luxery One" {
+		t.Fatalf("expected both reservations in the trash, most recent first, but got %+v, %v", deleted, err)
+	}
+
+	if reservation, err := repo.GetReservationByID(ctx, first); err != nil || reservation.DeletedAt.IsZero() {
+		t.Errorf("expected a trashed reservation to still be found, with when it was deleted, but got %+v, %v", reservation, err)
+	}
+
+	page, _ := repo.SearchReservations(ctx, models.ReservationFilter{PerPage: 10})
+	if len(page.Reservations) != 0 {
+		t.Errorf("expected trashed reservations not to be listed, but got %+v", page.Reservations)
+	}
+	if count, _ := repo.CountReservationsByStatus(ctx, models.StatusPending); count != 0 {
+		t.Errorf("expected trashed reservations not to be counted, but got %d", count)
+	}
+
+	if err := repo.RestoreReservation(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, first); !reservation.DeletedAt.IsZero() {
+		t.Errorf("expected a restored reservation not to be marked deleted, but got %+v", reservation)
+	}
+	if deleted, _ := repo.DeletedReservations(ctx); !sameIDs(reservationIDs(deleted), second) {
+		t.Errorf("expected only the other reservation left in the trash, but got %+v", deleted)
+	}
+}
+
+// checkRestoreTaken checks a reservation can't be restored once another holds its room for its dates
+func checkRestoreTaken(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	trashed := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	_ = repo.DeleteReservation(ctx, trashed)
+	taken := book(t, repo, 1, "2040-01-11", "2040-01-13")
+
+	if err := repo.RestoreReservation(ctx, trashed); !errors.Is(err, models.ErrRoomUnavailable) {
+		t.Errorf("expected ErrRoomUnavailable restoring over another booking, but got %v", err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, trashed); reservation.DeletedAt.IsZero() {
+		t.Errorf("expected the refused reservation to stay in the trash, but got %+v", reservation)
+	}
+
+	// A cancelled reservation doesn't hold its room, so it comes back whoever has the room now
+	cancelled := book(t, repo, 1, "2040-01-12", "2040-01-14")
+	_ = repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled)
+	_ = repo.DeleteReservation(ctx, cancelled)
+
+	if err := repo.RestoreReservation(ctx, cancelled); err != nil {
+		t.Errorf("expected a cancelled reservation to be restored, but got %v", err)
+	}
+
+	_ = repo.UpdateReservationStatus(ctx, taken, models.StatusCancelled)
+	if err := repo.RestoreReservation(ctx, trashed); err != nil {
+		t.Errorf("expected the reservation to be restored once the room is free again, but got %v", err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, trashed); !reservation.DeletedAt.IsZero() {
+		t.Errorf("expected the reservation out of the trash, but got %+v", reservation)
+	}
+}
+
+func checkPurge(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	kept := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	trashed := book(t, repo, 1, "2040-02-10", "2040-02-12")
+	onRoom2 := book(t, repo, 2, "2040-01-10", "2040-01-12")
+
+	if err := repo.InsertReservationNote(ctx, models.ReservationNote{ReservationID: trashed, Note: "Late"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = repo.DeleteReservation(ctx, trashed)
+
+	if purged, err := repo.PurgeDeletedReservations(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("expected nothing trashed an hour ago to purge, but got %d, %v", purged, err)
+	}
+
+	purged, err := repo.PurgeDeletedReservations(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Errorf("expected 1 reservation purged, but got %d, %v", purged, err)
+	}
+	if _, err := repo.GetReservationByID(ctx, trashed); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the purged reservation to be gone, but got %v", err)
+	}
+	if notes, _ := repo.GetNotesForReservation(ctx, trashed); len(notes) != 0 {
+		t.Errorf("expected the purged reservation's notes to go with it, but got %+v", notes)
+	}
+	if restrictions, _ := repo.GetRestrictionsForCurrentRoom(ctx, 1, date("2040-02-01"), date("2040-02-28")); len(restrictions) != 0 {
+		t.Errorf("expected the purged reservation's restriction to go with it, but got %+v", restrictions)
+	}
+
+	// A trashed room is kept while it has reservations, as purging it would take them with it
+	_ = repo.DeleteRoom(ctx, 2)
+	purged, err = repo.PurgeDeletedRooms(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 0 {
+		t.Errorf("expected room 2 to be kept for its reservation, but got %d purged, %v", purged, err)
+	}
+	if _, err := repo.GetRoomByID(ctx, 2); err != nil {
+		t.Errorf("expected room 2 to still be in the trash, but got %v", err)
+	}
+	if reservation, err := repo.GetReservationByID(ctx, onRoom2); err != nil || !reservation.DeletedAt.IsZero() {
+		t.Errorf("expected the live reservation on room 2 to survive the purge, but got %+v, %v", reservation, err)
+	}
+
+	// Once its reservations have been purged too, the room goes
+	_ = repo.DeleteReservation(ctx, onRoom2)
+	_, _ = repo.PurgeDeletedReservations(ctx, time.Now().Add(time.Minute))
+	purged, err = repo.PurgeDeletedRooms(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Errorf("expected room 2 to be purged once it had no reservations, but got %d, %v", purged, err)
+	}
+	if _, err := repo.GetRoomByID(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected room 2 to be gone, but got %v", err)
+	}
+	if _, err := repo.GetReservationByID(ctx, kept); err != nil {
+		t.Errorf("expected the reservation on room 1 to be kept, but got %v", err)
+	}
+}
+
+func checkSearchReservations(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	smith := insertReservation(t, repo, models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@smith.com",
+		Phone: "555-1000", RoomID: 1, StartDate: date("2040-01-10"), EndDate: date("2040-01-12")}, models.StatusPending)
+	doe := insertReservation(t, repo, models.Reservation{FirstName: "Jane", LastName: "Doe", Email: "jane_doe@mail.com",
+		Phone: "555-2000", RoomID: 2, StartDate: date("2040-01-05"), EndDate: date("2040-01-14")}, models.StatusPending)
+	brown := insertReservation(t, repo, models.Reservation{FirstName: "Ann", LastName: "Brown", Email: "ann%b@mail.com",
+		Phone: "555-3000", RoomID: 1, StartDate: date("2040-02-01"), EndDate: date("2040-02-03")}, models.StatusConfirmed)
+	trashed := insertReservation(t, repo, models.Reservation{FirstName: "Walter", LastName: "White", RoomID: 1,
+		StartDate: date("2040-01-20"), EndDate: date("2040-01-22")}, models.StatusPending)
+	_ = repo.DeleteReservation(ctx, trashed)
+
+	tests := []struct {
+		name     string
+		filter   models.ReservationFilter
+		expected []int
+	}{
+		{"all", models.ReservationFilter{}, []int{doe, smith, brown}},
+		{"first-name", models.ReservationFilter{Search: "jo"}, []int{smith}},
+		{"last-name-any-case", models.ReservationFilter{Search: " SMITH "}, []int{smith}},
+		{"email", models.ReservationFilter{Search: "jane_doe@"}, []int{doe}},
+		{"phone", models.ReservationFilter{Search: "555-2"}, []int{doe}},
+		{"start-of-field-only", models.ReservationFilter{Search: "mith"}, []int{}},
+		{"percent-is-literal", models.ReservationFilter{Search: "ann%"}, []int{brown}},
+		{"underscore-is-literal", models.ReservationFilter{Search: "j_"}, []int{}},
+		{"leaving-after", models.ReservationFilter{Start: date("2040-01-13")}, []int{doe, brown}},
+		{"arriving-before", models.ReservationFilter{End: date("2040-01-10")}, []int{doe, smith}},
+		{"room", models.ReservationFilter{RoomID: 1}, []int{smith, brown}},
+		{"status", models.ReservationFilter{Status: models.StatusConfirmed}, []int{brown}},
+		{"by-departure", models.ReservationFilter{Sort: "departure"}, []int{smith, doe, brown}},
+		{"by-created", models.ReservationFilter{Sort: "created"}, []int{smith, doe, brown}},
+		{"by-name", models.ReservationFilter{Sort: "name"}, []int{brown, doe, smith}},
+		{"by-name-desc", models.ReservationFilter{Sort: "name", Desc: true}, []int{smith, doe, brown}},
+		{"by-room-then-id", models.ReservationFilter{Sort: "room"}, []int{smith, brown, doe}},
+		{"unknown-sort", models.ReservationFilter{Sort: "price"}, []int{doe, smith, brown}},
+		{"first-page", models.ReservationFilter{PerPage: 2, Page: 1}, []int{doe, smith}},
+		{"second-page", models.ReservationFilter{PerPage: 2, Page: 2}, []int{brown}},
+	}
+
+	for _, e := range tests {
+		if e.filter.PerPage == 0 {
+			e.filter.PerPage = 10
+		}
+
+		page, err := repo.SearchReservations(ctx, e.filter)
+		if err != nil || !sameIDs(reservationIDs(page.Reservations), e.expected...) {
+			t.Errorf("failed %s: expected %v, but got %v, %v", e.name, e.expected, reservationIDs(page.Reservations), err)
+			continue
+		}
+
+		total := len(e.expected)
+		if e.filter.Page > 0 {
+			total = 3
+		}
+		if len(page.Reservations) > 0 && page.Total != total {
+			t.Errorf("failed %s: expected a total of %d, but got %d", e.name, total, page.Total)
+		}
+	}
+
+	page, _ := repo.SearchReservations(ctx, models.ReservationFilter{RoomID: 2, PerPage: 10})
+	if len(page.Reservations) != 1 || page.Reservations[0].Room.RoomName != "Luxery One" || page.Reservations[0].Email != "jane_doe@mail.com" {
+		t.Errorf("expected the reservation with its room, but got %+v", page.Reservations)
+	}
+}
+
+func checkAtDesk(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	arrived := time.Date(2040, 1, 10, 15, 30, 0, 0, time.UTC)
+
+	// The desk deals with whoever is booked, so a pending reservation is confirmed on the way
+	checkedIn := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	if err := repo.CheckInReservation(ctx, checkedIn, arrived, "Passport 123", ""); err != nil {
+		t.Fatal(err)
+	}
+	reservation, _ := repo.GetReservationByID(ctx, checkedIn)
+	if reservation.Status != models.StatusCheckedIn || !reservation.ConfirmedAt.Equal(arrived) || !reservation.CheckedInAt.Equal(arrived) {
+		t.Errorf("expected the pending reservation to be confirmed and checked in, but got %+v", reservation)
+	}
+
+	noShow := book(t, repo, 2, "2040-01-10", "2040-01-12")
+	if err := repo.MarkNoShow(ctx, noShow); err != nil {
+		t.Fatal(err)
+	}
+	reservation, _ = repo.GetReservationByID(ctx, noShow)
+	if reservation.Status != models.StatusNoShow || reservation.ConfirmedAt.IsZero() || reservation.NoShowAt.IsZero() {
+		t.Errorf("expected the pending reservation to be confirmed and marked as a no-show, but got %+v", reservation)
+	}
+
+	if err := repo.MarkNoShow(ctx, checkedIn); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("expected a checked in guest not to be a no-show, but got %v", err)
+	}
+
+	cancelled := book(t, repo, 1, "2040-02-10", "2040-02-12")
+	if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CheckInReservation(ctx, cancelled, arrived, "", ""); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("expected a cancelled reservation not to be checked in, but got %v", err)
+	}
+	if err := repo.MarkNoShow(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for reservation 99, but got %v", err)
+	}
+
+	reservation, _ = repo.GetReservationByID(ctx, cancelled)
+	if reservation.Status != models.StatusCancelled || !reservation.ConfirmedAt.IsZero() {
+		t.Errorf("expected the cancelled reservation to be left alone, but got %+v", reservation)
+	}
+}
+
+func checkFrontDesk(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	stay := func(last string, room int, start, end string) models.Reservation {
+		return models.Reservation{FirstName: "Guest", LastName: last, RoomID: room, StartDate: date(start), EndDate: date(end)}
+	}
+
+	smith := insertReservation(t, repo, stay("Smith", 1, "2040-03-10", "2040-03-12"), models.StatusPending)
+	adams := insertReservation(t, repo, stay("Adams", 2, "2040-03-10", "2040-03-13"), models.StatusConfirmed)
+	late := insertReservation(t, repo, stay("Late", 2, "2040-03-08", "2040-03-09"), models.StatusPending)
+	leaving := insertReservation(t, repo, stay("Leaving", 1, "2040-03-07", "2040-03-10"), models.StatusCheckedIn)
+	staying := insertReservation(t, repo, stay("Staying", 2, "2040-03-01", "2040-03-15"), models.StatusCheckedIn)
+	insertReservation(t, repo, stay("Cancelled", 1, "2040-03-10", "2040-03-12"), models.StatusCancelled)
+	trashed := insertReservation(t, repo, stay("Trashed", 1, "2040-03-10", "2040-03-12"), models.StatusPending)
+	_ = repo.DeleteReservation(ctx, trashed)
+
+	tests := []struct {
+		name     string
+		list     func() ([]models.Reservation, error)
+		expected []int
+	}{
+		{"arriving", func() ([]models.Reservation, error) { return repo.ReservationsArrivingOn(ctx, date("2040-03-10")) }, []int{adams, smith}},
+		{"in-house", func() ([]models.Reservation, error) { return repo.ReservationsInHouse(ctx) }, []int{leaving, staying}},
+		{"departing", func() ([]models.Reservation, error) { return repo.ReservationsDepartingOn(ctx, date("2040-03-10")) }, []int{leaving}},
+		{"not-arrived", func() ([]models.Reservation, error) { return repo.ReservationsNotArrivedBy(ctx, date("2040-03-10")) }, []int{late, adams, smith}},
+		{"nobody-departing", func() ([]models.Reservation, error) { return repo.ReservationsDepartingOn(ctx, date("2040-03-12")) }, []int{}},
+	}
+
+	for _, e := range tests {
+		reservations, err := e.list()
+		if err != nil || !sameIDs(reservationIDs(reservations), e.expected...) {
+			t.Errorf("failed %s: expected %v, but got %v, %v", e.name, e.expected, reservationIDs(reservations), err)
+		}
+	}
+
+	inHouse, _ := repo.ReservationsInHouse(ctx)
+	if len(inHouse) == 0 || inHouse[0].CheckedInAt.IsZero() || inHouse[0].Room.RoomName != "Generals Suit" ||
+		inHouse[0].Status != models.StatusCheckedIn {
+		t.Errorf("expected the guests in house with their rooms, but got %+v", inHouse)
+	}
+}
+
+func checkImportReservations(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	book(t, repo, 2, "2040-01-10", "2040-01-12")
+
+	stay := func(room int, start, end string, status models.ReservationStatus) models.Reservation {
+		return models.Reservation{FirstName: "Jane", LastName: "Doe", RoomID: room, StartDate: date(start), EndDate: date(end),
+			Status: status}
+	}
+
+	clashes := [][]models.Reservation{
+		{stay(1, "2040-01-01", "2040-01-03", models.StatusCheckedOut), stay(1, "2040-01-02", "2040-01-04", models.StatusConfirmed)},
+		{stay(1, "2040-01-01", "2040-01-03", models.StatusCheckedOut), stay(2, "2040-01-11", "2040-01-11", models.StatusPending)},
+	}
+
+	for _, reservations := range clashes {
+		_, err := repo.ImportReservations(ctx, reservations)
+		if !errors.Is(err, models.ErrRoomUnavailable) {
+			t.Errorf("expected the second stay to clash, but got %v", err)
+		}
+		if count, _ := repo.CountReservationsByStatus(ctx, models.StatusCheckedOut); count != 0 {
+			t.Errorf("expected nothing to be imported, but %d reservations were", count)
+		}
+	}
+
+	checkedOut := stay(1, "2040-01-01", "2040-01-03", models.StatusCheckedOut)
+	checkedOut.CreatedAt = time.Date(2039, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ids, err := repo.ImportReservations(ctx, []models.Reservation{
+		checkedOut,
+		stay(1, "2040-01-02", "2040-01-04", models.StatusCancelled),
+		stay(2, "2040-01-13", "2040-01-14", models.StatusPending),
+	})
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("expected a cancelled stay not to clash, but got %v, %v", ids, err)
+	}
+
+	reservation, _ := repo.GetReservationByID(ctx, ids[0])
+	if reservation.Status != models.StatusCheckedOut || !reservation.CreatedAt.Equal(checkedOut.CreatedAt) ||
+		!reservation.CheckedOutAt.Equal(checkedOut.CreatedAt) {
+		t.Errorf("expected the stay as it was booked, but got %+v", reservation)
+	}
+
+	reservation, _ = repo.GetReservationByID(ctx, ids[1])
+	if reservation.Status != models.StatusCancelled || reservation.CancelledAt.IsZero() {
+		t.Errorf("expected the cancellation to be stamped, but got %+v", reservation)
+	}
+
+	// Imported stays hold their rooms
+	if available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-13"), date("2040-01-13"), 2); available {
+		t.Error("expected the imported stay to hold room 2")
+	}
+}
+
+func checkInsertBooking(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	book(t, repo, 1, "2040-01-10", "2040-01-12")
+	cancelled := book(t, repo, 2, "2040-01-10", "2040-01-12")
+	if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+
+	stay := func(room int, start, end string) models.Reservation {
+		return models.Reservation{FirstName: "Jane", LastName: "Doe", RoomID: room, StartDate: date(start), EndDate: date(end),
+			Status: models.StatusCheckedOut}
+	}
+
+	if _, err := repo.InsertBooking(ctx, stay(1, "2040-01-12", "2040-01-14")); !errors.Is(err, models.ErrRoomUnavailable) {
+		t.Errorf("expected the stay to clash, but got %v", err)
+	}
+	if count, _ := repo.CountReservationsByStatus(ctx, models.StatusPending); count != 1 {
+		t.Errorf("expected nothing to be booked, but there are %d pending reservations", count)
+	}
+
+	id, err := repo.InsertBooking(ctx, stay(2, "2040-01-11", "2040-01-13"))
+	if err != nil {
+		t.Fatalf("expected a cancelled stay not to clash, but got %v", err)
+	}
+
+	reservation, _ := repo.GetReservationByID(ctx, id)
+	if reservation.Status != models.StatusPending || reservation.CreatedAt.IsZero() {
+		t.Errorf("expected a pending booking, but got %+v", reservation)
+	}
+	if available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2040-01-13"), date("2040-01-13"), 2); available {
+		t.Error("expected the booking to hold its room")
+	}
+
+	// Only one of the guests racing for the same nights gets them
+	var wg sync.WaitGroup
+	booked := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if id, err := repo.InsertBooking(ctx, stay(1, "2040-03-01", "2040-03-03")); err == nil {
+				booked <- id
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(booked) != 1 {
+		t.Errorf("expected one of the racing bookings to succeed, but %d did", len(booked))
+	}
+}
+
+// seedStats books the reservations the stats and reports are worked out from, returning their ids in the order booked:
+// one on room 1 and one on room 2 in January, a cancellation, a no-show and one in the trash
+func seedStats(t *testing.T, repo repository.DatabaseRepo) []int {
+	t.Helper()
+	ctx := context.Background()
+
+	rooms := map[int]string{1: "$100.50", 2: "80"}
+	for id, price := range rooms {
+		room, _ := repo.GetRoomByID(ctx, id)
+		room.Price = price
+		if err := repo.UpdateRoom(ctx, room); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stay := func(room int, start, end string) models.Reservation {
+		return models.Reservation{FirstName: "Guest", LastName: "Stats", RoomID: room, StartDate: date(start), EndDate: date(end)}
+	}
+
+	ids := []int{
+		insertReservation(t, repo, stay(1, "2040-01-10", "2040-01-13"), models.StatusPending),
+		insertReservation(t, repo, stay(2, "2040-01-09", "2040-01-12"), models.StatusConfirmed),
+		insertReservation(t, repo, stay(1, "2040-01-12", "2040-01-14"), models.StatusCancelled),
+		insertReservation(t, repo, stay(2, "2040-01-25", "2040-01-26"), models.StatusNoShow),
+		insertReservation(t, repo, stay(2, "2040-01-01", "2040-01-20"), models.StatusPending),
+	}
+	_ = repo.DeleteReservation(ctx, ids[4])
+
+	return ids
+}
+
+func checkStats(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	seedStats(t, repo)
+
+	// From the 11th to the 14th, room 1 sells the 11th and 12th and room 2 the 11th
+	stats, err := repo.OccupancyForRange(ctx, date("2040-01-11"), date("2040-01-14"))
+	if err != nil || stats.Rooms != 2 || stats.RoomNightsSold != 3 || stats.Revenue != 281 ||
+		!stats.Start.Equal(date("2040-01-11")) || !stats.End.Equal(date("2040-01-14")) {
+		t.Errorf("expected 3 room nights for 281, but got %+v, %v", stats, err)
+	}
+
+	if stats, _ := repo.OccupancyForRange(ctx, date("2040-01-13"), date("2040-01-20")); stats.RoomNightsSold != 0 || stats.Revenue != 0 {
+		t.Errorf("expected nothing sold after the stays, but got %+v", stats)
+	}
+
+	// Everything was booked just now
+	pickup, err := repo.PickupForRange(ctx, date("2040-01-11"), date("2040-01-14"), time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || pickup.RoomNightsSold != 3 || pickup.Revenue != 281 {
+		t.Errorf("expected 3 room nights for 281 picked up in the last hour, but got %+v, %v", pickup, err)
+	}
+	pickup, _ = repo.PickupForRange(ctx, date("2040-01-11"), date("2040-01-14"), time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	if pickup.RoomNightsSold != 0 || pickup.Revenue != 0 {
+		t.Errorf("expected nothing picked up before that, but got %+v", pickup)
+	}
+
+	if count, err := repo.CountReservationsCreatedBetween(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)); err != nil || count != 4 {
+		t.Errorf("expected 4 reservations booked in the last hour, but got %d, %v", count, err)
+	}
+	if count, _ := repo.CountReservationsCreatedBetween(ctx, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)); count != 0 {
+		t.Errorf("expected nothing booked before that, but got %d", count)
+	}
+
+	counts := map[models.ReservationStatus]int{
+		models.StatusPending:   1,
+		models.StatusConfirmed: 1,
+		models.StatusCancelled: 1,
+		models.StatusNoShow:    1,
+		models.StatusCheckedIn: 0,
+	}
+	for status, expected := range counts {
+		if count, err := repo.CountReservationsByStatus(ctx, status); err != nil || count != expected {
+			t.Errorf("expected %d %s, but got %d, %v", expected, status, count, err)
+		}
+	}
+}
+
+func checkReports(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	ids := seedStats(t, repo)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		query    models.ReportQuery
+		expected []int
+	}{
+		// The stay on room 2 arrives first
+		{"by-stay-date", models.ReportQuery{Kind: models.ReportByStayDate, Start: date("2040-01-01"), End: date("2040-02-01")}, []int{ids[1], ids[0]}},
+		{"by-booking-date", models.ReportQuery{Kind: models.ReportByBookingDate, Start: now.Add(-time.Hour), End: now.Add(time.Hour)}, ids[:4]},
+		{"by-room", models.ReportQuery{Kind: models.ReportByRoom, Start: date("2040-01-01"), End: date("2040-02-01")}, []int{ids[0], ids[1]}},
+		{"cancellations", models.ReportQuery{Kind: models.ReportCancellations, Start: now.Add(-time.Hour), End: now.Add(time.Hour)}, ids[2:3]},
+		{"no-shows", models.ReportQuery{Kind: models.ReportNoShows, Start: date("2040-01-01"), End: date("2040-02-01")}, ids[3:4]},
+		{"no-shows-elsewhere", models.ReportQuery{Kind: models.ReportNoShows, Start: date("2040-02-01"), End: date("2040-03-01")}, []int{}},
+	}
+
+	for _, e := range tests {
+		var got []models.Reservation
+		err := repo.EachReportReservation(ctx, e.query, func(r models.Reservation) error {
+			got = append(got, r)
+			return nil
+		})
+		if err != nil || !sameIDs(reservationIDs(got), e.expected...) {
+			t.Errorf("failed %s: expected %v, but got %v, %v", e.name, e.expected, reservationIDs(got), err)
+		}
+	}
+
+	var first models.Reservation
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.EachReportReservation(ctx, models.ReportQuery{Kind: models.ReportByRoom, Start: date("2040-01-01"), End: date("2040-02-01")},
+		func(r models.Reservation) error {
+			first = r
+			calls++
+			return stop
+		})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected the report to stop at the first error, but got %v after %d calls", err, calls)
+	}
+	if first.Room.RoomName != "Generals Suit" || first.Room.Price != "$100.50" || first.Status != models.StatusPending {
+		t.Errorf("expected the reservation with its room and price, but got %+v", first)
+	}
+
+	var cancelled models.Reservation
+	_ = repo.EachReportReservation(ctx, models.ReportQuery{Kind: models.ReportCancellations, Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+		func(r models.Reservation) error {
+			cancelled = r
+			return nil
+		})
+	if cancelled.CancelledAt.IsZero() {
+		t.Errorf("expected the cancellation with when it happened, but got %+v", cancelled)
+	}
+
+	if err := repo.EachReportReservation(ctx, models.ReportQuery{Kind: "by-mood"}, func(models.Reservation) error { return nil }); err == nil {
+		t.Error("expected an unknown report to be refused")
+	}
+}
+
+func checkTodos(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	var ids []int
+	for _, todo := range []string{"Paint", "Clean"} {
+		id, err := repo.InsertTodoList(ctx, models.TodoList{UserID: 1, Todo: todo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	todos, err := repo.GetTodoListByUserID(ctx, 1)
+	if err != nil || len(todos) != 2 || todos[0].Todo != "Paint" || todos[1].Todo != "Clean" || todos[0].UserID != 1 {
+		t.Fatalf("expected both todos, oldest first, but got %+v, %v", todos, err)
+	}
+	if todos[0].ID != ids[0] || todos[1].ID != ids[1] {
+		t.Errorf("expected the ids %v to be returned, but got %+v", ids, todos)
+	}
+
+	if err := repo.DeleteTodo(ctx, todos[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if todos, _ := repo.GetTodoListByUserID(ctx, 1); len(todos) != 1 || todos[0].Todo != "Clean" {
+		t.Errorf("expected only the second todo left, but got %+v", todos)
+	}
+	if todos, _ := repo.GetTodoListByUserID(ctx, 9); len(todos) != 0 {
+		t.Errorf("expected no todos for user 9, but got %+v", todos)
+	}
+}
+
+func checkNotesAndMailLogs(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	id := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	other := book(t, repo, 2, "2040-01-10", "2040-01-12")
+
+	for _, note := range []string{"Early check in", "Allergic to feathers"} {
+		if err := repo.InsertReservationNote(ctx, models.ReservationNote{ReservationID: id, UserID: 1, Note: note}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notes, err := repo.GetNotesForReservation(ctx, id)
+	if err != nil || len(notes) != 2 || notes[0].Note != "Allergic to feathers" || notes[1].Note != "Early check in" ||
+		notes[0].User.ID != 1 || notes[0].User.Email != "atu@prosper.com" {
+		t.Errorf("expected both notes, newest first, with who wrote them, but got %+v, %v", notes, err)
+	}
+
+	for _, subject := range []string{"Confirmed", "Reminder"} {
+		err := repo.InsertMailLog(ctx, models.MailLog{ReservationID: id, To: "john@smith.com", From: "atu@prosper.com",
+			Subject: subject, Content: "<p>Hi</p>", Status: "sent"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = repo.InsertMailLog(ctx, models.MailLog{ReservationID: id, Subject: "Failed", Status: "failed", Error: "refused"})
+
+	logs, err := repo.GetMailLogsForReservation(ctx, id)
+	if err != nil || len(logs) != 3 || logs[0].Error != "refused" || logs[1].Subject != "Reminder" || logs[2].To != "john@smith.com" ||
+		logs[2].Content != "<p>Hi</p>" {
+		t.Errorf("expected the emails, newest first, but got %+v, %v", logs, err)
+	}
+
+	if notes, _ := repo.GetNotesForReservation(ctx, other); len(notes) != 0 {
+		t.Errorf("expected no notes on the other reservation, but got %+v", notes)
+	}
+	if logs, _ := repo.GetMailLogsForReservation(ctx, other); len(logs) != 0 {
+		t.Errorf("expected no emails about the other reservation, but got %+v", logs)
+	}
+}
+
+func checkWithTx(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	failed := errors.New("subscriber failed")
+
+	audited := func(id int) int {
+		logs, err := repo.GetAuditLogsForEntity(ctx, "reservation", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(logs)
+	}
+
+	// Everything fn did is rolled back with its error, including what methods that begin their own transaction did
+	cancelled := book(t, repo, 1, "2040-01-10", "2040-01-12")
+	err := repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled); err != nil {
+			return err
+		}
+		if err := repo.InsertAuditLog(ctx, models.AuditLog{Action: "status_change", Entity: "reservation", EntityID: cancelled}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the error of fn, but got %v", err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, cancelled); reservation.Status != models.StatusPending || audited(cancelled) != 0 {
+		t.Errorf("expected the change and its audit entry to be rolled back, but got %s and %d entries", reservation.Status, audited(cancelled))
+	}
+
+	// A method that fails only undoes its own statements, so fn can carry on
+	err = repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCheckedOut); !errors.Is(err, models.ErrInvalidTransition) {
+			t.Errorf("expected models.ErrInvalidTransition, but got %v", err)
+		}
+		if err := repo.UpdateReservationStatus(ctx, cancelled, models.StatusCancelled); err != nil {
+			return err
+		}
+		return repo.InsertAuditLog(ctx, models.AuditLog{Action: "status_change", Entity: "reservation", EntityID: cancelled})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := repo.GetReservationByID(ctx, cancelled); reservation.Status != models.StatusCancelled || audited(cancelled) != 1 {
+		t.Errorf("expected the change and its audit entry to be committed, but got %s and %d entries", reservation.Status, audited(cancelled))
+	}
+}
+
+func checkAuditLogs(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	changes := []models.AuditChange{{Field: "price", From: "0", To: "120"}}
+	entries := []models.AuditLog{
+		{UserID: 1, Action: "update", Entity: "room", EntityID: 1, Changes: changes},
+		{UserID: 0, Action: "delete", Entity: "reservation", EntityID: 7},
+	}
+	for _, entry := range entries {
+		if err := repo.InsertAuditLog(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		search   string
+		entity   string
+		expected []string
+	}{
+		{"everything", "", "", []string{"delete", "update"}},
+		{"entity", "", "room", []string{"update"}},
+		{"action", "DEL", "", []string{"delete"}},
+		{"changes", "Price", "", []string{"update"}},
+		{"user", "atu@", "", []string{"update"}},
+		{"entity-id", "7", "", []string{"delete"}},
+		{"entity-and-search", "delete", "room", []string{}},
+	}
+
+	for _, e := range tests {
+		logs, err := repo.SearchAuditLogs(ctx, e.search, e.entity)
+		var actions []string
+		for _, entry := range logs {
+			actions = append(actions, entry.Action)
+		}
+		if err != nil || len(actions) != len(e.expected) || (len(actions) > 0 && !reflect.DeepEqual(actions, e.expected)) {
+			t.Errorf("failed %s: expected %v, but got %v, %v", e.name, e.expected, actions, err)
+		}
+	}
+
+	logs, err := repo.GetAuditLogsForEntity(ctx, "room", 1)
+	if err != nil || len(logs) != 1 || !reflect.DeepEqual(logs[0].Changes, changes) || logs[0].User.Email != "atu@prosper.com" ||
+		logs[0].CreatedAt.IsZero() {
+		t.Errorf("expected the room's history, but got %+v, %v", logs, err)
+	}
+	if logs, _ := repo.GetAuditLogsForEntity(ctx, "room", 2); len(logs) != 0 {
+		t.Errorf("expected no history for room 2, but got %+v", logs)
+	}
+}
+
+func checkAPIKeys(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	first, err := repo.InsertAPIKey(ctx, models.APIKey{Name: "Channel manager", Prefix: "aaaa1111", Hash: "hash-a",
+		Scope: models.ScopeBooking, RateLimit: 60, UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.InsertAPIKey(ctx, models.APIKey{Name: "Reporting", Prefix: "bbbb2222", Hash: "hash-b",
+		Scope: models.ScopeReadOnly, RateLimit: 10, UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := repo.AllAPIKeys(ctx)
+	if err != nil || len(keys) != 2 || keys[0].ID != second || keys[1].ID != first {
+		t.Errorf("expected both keys, newest first, but got %+v, %v", keys, err)
+	}
+
+	key, err := repo.GetAPIKeyByPrefix(ctx, "aaaa1111")
+	if err != nil || key.ID != first || key.Name != "Channel manager" || key.Hash != "hash-a" || key.Scope != models.ScopeBooking ||
+		key.RateLimit != 60 || key.UserID != 1 || key.Revoked() || !key.LastUsedAt.IsZero() {
+		t.Errorf("expected the first key, but got %+v, %v", key, err)
+	}
+
+	if _, err := repo.GetAPIKeyByPrefix(ctx, "cccc3333"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown prefix, but got %v", err)
+	}
+
+	used := time.Date(2040, 1, 1, 9, 0, 0, 0, time.UTC)
+	if err := repo.TouchAPIKey(ctx, first, used); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RevokeAPIKey(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ = repo.GetAPIKeyByPrefix(ctx, "aaaa1111")
+	if !key.LastUsedAt.Equal(used) || !key.Revoked() {
+		t.Errorf("expected the key used and revoked, but got %+v", key)
+	}
+
+	if err := repo.RevokeAPIKey(ctx, first); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows revoking a key twice, but got %v", err)
+	}
+	if err := repo.RevokeAPIKey(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows revoking key 99, but got %v", err)
+	}
+}
+
+func checkWebhooks(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	insert := func(hook models.Webhook) int {
+		t.Helper()
+		id, err := repo.InsertWebhook(ctx, hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	created := insert(models.Webhook{URL: "https://example.com/created", Description: "Channel manager", Secret: "s1",
+		Events: []string{"reservation.created", "room.updated"}, Active: true})
+	cancelled := insert(models.Webhook{URL: "https://example.com/cancelled", Secret: "s2",
+		Events: []string{"reservation.cancelled"}, Active: true})
+	paused := insert(models.Webhook{URL: "https://example.com/paused", Secret: "s3",
+		Events: []string{"reservation.created"}, Active: false})
+
+	hooks, err := repo.AllWebhooks(ctx)
+	if err != nil || len(hooks) != 3 || hooks[0].ID != created || hooks[2].ID != paused {
+		t.Fatalf("expected the webhooks, oldest first, but got %+v, %v", hooks, err)
+	}
+
+	hook, err := repo.GetWebhookByID(ctx, created)
+	if err != nil || hook.URL != "https://example.com/created" || hook.Description != "Channel manager" || hook.Secret != "s1" ||
+		!reflect.DeepEqual(hook.Events, []string{"reservation.created", "room.updated"}) || !hook.Active {
+		t.Errorf("expected the first webhook, but got %+v, %v", hook, err)
+	}
+	if _, err := repo.GetWebhookByID(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for webhook 99, but got %v", err)
+	}
+
+	// Only whole event names match, and only active webhooks
+	subscribed := func(event string) []int {
+		hooks, err := repo.WebhooksForEvent(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := map[int]bool{}
+		for _, hook := range hooks {
+			ids[hook.ID] = true
+		}
+		var sorted []int
+		for _, id := range []int{created, cancelled, paused} {
+			if ids[id] {
+				sorted = append(sorted, id)
+			}
+		}
+		return sorted
+	}
+
+	if got := subscribed("reservation.created"); !sameIDs(got, created) {
+		t.Errorf("expected only the active webhook for reservation.created, but got %v", got)
+	}
+	if got := subscribed("reservation"); !sameIDs(got) {
+		t.Errorf("expected no webhook for part of an event name, but got %v", got)
+	}
+
+	_ = repo.SetWebhookActive(ctx, paused, true)
+	_ = repo.SetWebhookActive(ctx, cancelled, false)
+	if got := subscribed("reservation.created"); !sameIDs(got, created, paused) {
+		t.Errorf("expected both webhooks for reservation.created once turned on, but got %v", got)
+	}
+
+	now := time.Now()
+	deliver := func(webhook int, next time.Time) int {
+		t.Helper()
+		id, err := repo.InsertWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: webhook, Event: "reservation.created",
+			Payload: `{"id":1}`, Status: models.DeliveryPending, NextAttemptAt: next})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	first := deliver(created, now.Add(-2*time.Minute))
+	second := deliver(created, now.Add(-time.Minute))
+	later := deliver(created, now.Add(time.Hour))
+	deliver(cancelled, now.Add(-3*time.Minute))
+
+	due, err := repo.DueWebhookDeliveries(ctx, now, 10)
+	if err != nil || !sameIDs(deliveryIDs(due), first, second) {
+		t.Fatalf("expected the deliveries due to active webhooks, oldest first, but got %v, %v", deliveryIDs(due), err)
+	}
+	if due[0].Webhook.ID != created || due[0].Webhook.URL != "https://example.com/created" || due[0].Webhook.Secret != "s1" ||
+		due[0].Payload != `{"id":1}` || due[0].Event != "reservation.created" {
+		t.Errorf("expected the delivery with its webhook, but got %+v", due[0])
+	}
+
+	if due, _ := repo.DueWebhookDeliveries(ctx, now, 1); !sameIDs(deliveryIDs(due), first) {
+		t.Errorf("expected only as many deliveries as asked for, but got %v", deliveryIDs(due))
+	}
+
+	delivered := due[0]
+	delivered.Status = models.DeliveryDelivered
+	delivered.Attempts = 1
+	delivered.ResponseStatus = 200
+	delivered.DeliveredAt = now
+	if err := repo.UpdateWebhookDelivery(ctx, delivered); err != nil {
+		t.Fatal(err)
+	}
+
+	if due, _ := repo.DueWebhookDeliveries(ctx, now, 10); !sameIDs(deliveryIDs(due), second) {
+		t.Errorf("expected a delivered delivery not to be due, but got %v", deliveryIDs(due))
+	}
+
+	deliveries, err := repo.GetWebhookDeliveries(ctx, created, 10)
+	if err != nil || !sameIDs(deliveryIDs(deliveries), later, second, first) {
+		t.Fatalf("expected the deliveries, newest first, but got %v, %v", deliveryIDs(deliveries), err)
+	}
+	if d := deliveries[2]; d.Status != models.DeliveryDelivered || d.Attempts != 1 || d.ResponseStatus != 200 || d.DeliveredAt.IsZero() {
+		t.Errorf("expected the outcome of the attempt, but got %+v", d)
+	}
+	if deliveries, _ := repo.GetWebhookDeliveries(ctx, created, 2); !sameIDs(deliveryIDs(deliveries), later, second) {
+		t.Errorf("expected only the latest 2 deliveries, but got %v", deliveryIDs(deliveries))
+	}
+
+	if err := repo.RetryWebhookDelivery(ctx, created, first); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := repo.DueWebhookDeliveries(ctx, time.Now().Add(time.Second), 10); !sameIDs(deliveryIDs(due), second, first) {
+		t.Errorf("expected the retried delivery to be due again, but got %v", deliveryIDs(due))
+	}
+	if err := repo.RetryWebhookDelivery(ctx, cancelled, first); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows retrying another webhook's delivery, but got %v", err)
+	}
+
+	if err := repo.DeleteWebhook(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetWebhookByID(ctx, created); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the deleted webhook to be gone, but got %v", err)
+	}
+	if deliveries, _ := repo.GetWebhookDeliveries(ctx, created, 10); len(deliveries) != 0 {
+		t.Errorf("expected the deleted webhook's deliveries to go with it, but got %v", deliveryIDs(deliveries))
+	}
+}
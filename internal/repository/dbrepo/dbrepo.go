@@ -2,14 +2,18 @@ package dbrepo
 
 import (
 	"database/sql"
+	"sync"
 
 	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/models"
 	"github.com/atuprosper/booking-project/internal/repository"
 )
 
-type postgresDBRepo struct {
-	App *config.AppConfig
-	DB  *sql.DB
+// sqlDBRepo runs the same queries on Postgres and on a SQLite database file, written for both where the dialect allows
+type sqlDBRepo struct {
+	App     *config.AppConfig
+	DB      *sql.DB
+	dialect dialect
 }
 
 type testDBRepo struct {
@@ -17,10 +21,42 @@ type testDBRepo struct {
 	DB  *sql.DB
 }
 
+// memoryDBRepo keeps everything in memory, enforcing what the Postgres schema does: foreign keys, unique columns,
+// cascading deletes and dates without a time of day. It runs the demo without a database
+type memoryDBRepo struct {
+	App *config.AppConfig
+
+	mu sync.RWMutex
+	// The last id given out in each table
+	serial           map[string]int
+	users            map[int]models.User
+	rooms            map[int]models.Room
+	restrictions     map[int]models.Restriction
+	reservations     map[int]models.Reservation
+	roomRestrictions map[int]models.RoomRestriction
+	todos            map[int]models.TodoList
+	notes            map[int]models.ReservationNote
+	mailLogs         map[int]models.MailLog
+	auditLogs        map[int]models.AuditLog
+	apiKeys          map[int]models.APIKey
+	webhooks         map[int]models.Webhook
+	deliveries       map[int]models.WebhookDelivery
+}
+
 func NewPostgresRepo(dbConnection *sql.DB, appConfig *config.AppConfig) repository.DatabaseRepo {
-	return &postgresDBRepo{
-		App: appConfig,
-		DB:  dbConnection,
+	return &sqlDBRepo{
+		App:     appConfig,
+		DB:      dbConnection,
+		dialect: postgres,
+	}
+}
+
+// NewSQLiteRepo returns a repo on a SQLite database opened by driver.ConnectSQL, which sets it up the way the queries need
+func NewSQLiteRepo(dbConnection *sql.DB, appConfig *config.AppConfig) repository.DatabaseRepo {
+	return &sqlDBRepo{
+		App:     appConfig,
+		DB:      dbConnection,
+		dialect: sqlite,
 	}
 }
 
@@ -29,3 +65,25 @@ func NewTestRepo(appConfig *config.AppConfig) repository.DatabaseRepo {
 		App: appConfig,
 	}
 }
+
+// NewMemoryRepo returns a repo holding what a newly migrated database would: the seeded rooms, restrictions and admin
+func NewMemoryRepo(appConfig *config.AppConfig) repository.DatabaseRepo {
+	repo := &memoryDBRepo{
+		App:              appConfig,
+		serial:           make(map[string]int),
+		users:            make(map[int]models.User),
+		rooms:            make(map[int]models.Room),
+		restrictions:     make(map[int]models.Restriction),
+		reservations:     make(map[int]models.Reservation),
+		roomRestrictions: make(map[int]models.RoomRestriction),
+		todos:            make(map[int]models.TodoList),
+		notes:            make(map[int]models.ReservationNote),
+		mailLogs:         make(map[int]models.MailLog),
+		auditLogs:        make(map[int]models.AuditLog),
+		apiKeys:          make(map[int]models.APIKey),
+		webhooks:         make(map[int]models.Webhook),
+		deliveries:       make(map[int]models.WebhookDelivery),
+	}
+	repo.seed()
+	return repo
+}
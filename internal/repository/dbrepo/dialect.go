@@ -0,0 +1,26 @@
+package dbrepo
+
+// dialect is what the SQL repository needs to know about the database it runs on. The queries are otherwise the same
+// on Postgres and SQLite: both take $1 placeholders, and dates are sent as the day they fall on, without a time
+type dialect struct {
+	// Gives a parameter the type it is compared as, where the database can't tell from the query, like $2::date
+	cast func(param, sqlType string) string
+	// Locks the rows a select reads until the transaction ends, appended to the select
+	forUpdate string
+	// Matches text like like does, ignoring case
+	ilike string
+}
+
+var postgres = dialect{
+	cast:      func(param, sqlType string) string { return param + "::" + sqlType },
+	forUpdate: " for update",
+	ilike:     "ilike",
+}
+
+// SQLite has no row locks, but its transactions take the write lock up front (see driver.DataSource), so a transaction
+// has the database to itself from its first read. Its like already ignores case, for ASCII
+var sqlite = dialect{
+	cast:      func(param, sqlType string) string { return param },
+	forUpdate: "",
+	ilike:     "like",
+}
@@ -0,0 +1,1702 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The restrictions seeded by the migrations, and so the only ones a room restriction can refer to
+const (
+	restrictionReservation = 1
+	restrictionOwnerBlock  = 2
+)
+
+// seed fills the repo with what the migrations seed a new database with: the restrictions, two rooms and the admin
+func (m *memoryDBRepo) seed() {
+	m.restrictions[restrictionReservation] = models.Restriction{ID: restrictionReservation, RestrictionName: "Reservation"}
+	m.restrictions[restrictionOwnerBlock] = models.Restriction{ID: restrictionOwnerBlock, RestrictionName: "Owners Block"}
+
+	for _, name := range []string{"Generals Suit", "Luxery One"} {
+		id := m.nextID("rooms")
+		m.rooms[id] = models.Room{ID: id, RoomName: name, Price: "0", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	}
+
+	// The password is "password", as the README says
+	id := m.nextID("users")
+	m.users[id] = models.User{
+		ID:          id,
+		FirstName:   "Prosper",
+		LastName:    "Atu",
+		Email:       "atu@prosper.com",
+		Password:    "$2a$12$yD7f6L4WzEkRw.Esr07W0Okl5M/K4/V9vaV.3Tgifv8NfOCH5au1y",
+		AccessLevel: 1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+}
+
+// nextID returns the next id of table, the way its serial column would
+func (m *memoryDBRepo) nextID(table string) int {
+	m.serial[table]++
+	return m.serial[table]
+}
+
+// foreignKey is returned where Postgres would refuse a row that refers to one that doesn't exist
+func foreignKey(table string, id int) error {
+	return fmt.Errorf("violates foreign key constraint: %s %d does not exist", table, id)
+}
+
+// unique is returned where Postgres would refuse a row that repeats a unique column
+func unique(column, value string) error {
+	return fmt.Errorf("violates unique constraint: %s %q already exists", column, value)
+}
+
+// day drops the time of day from t, as storing it in a date column does
+func day(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nightsBetween returns how many nights there are from start to end
+func nightsBetween(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// stampStatus sets reservation to status, recording at in the column for that status
+func stampStatus(reservation *models.Reservation, status models.ReservationStatus, at time.Time) {
+	reservation.Status = status
+	switch status {
+	case models.StatusConfirmed:
+		reservation.ConfirmedAt = at
+	case models.StatusCheckedIn:
+		reservation.CheckedInAt = at
+	case models.StatusCheckedOut:
+		reservation.CheckedOutAt = at
+	case models.StatusCancelled:
+		reservation.CancelledAt = at
+	case models.StatusNoShow:
+		reservation.NoShowAt = at
+	}
+}
+
+// joinRoom returns reservation with the id and name of its room, as the queries joining rooms do
+func (m *memoryDBRepo) joinRoom(reservation models.Reservation) models.Reservation {
+	room := m.rooms[reservation.RoomID]
+	reservation.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	return reservation
+}
+
+// findReservations returns the reservations match keeps, with their rooms, in id order
+func (m *memoryDBRepo) findReservations(match func(models.Reservation) bool) []models.Reservation {
+	var found []models.Reservation
+	for _, reservation := range m.reservations {
+		if match(reservation) {
+			found = append(found, m.joinRoom(reservation))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found
+}
+
+// holdsRoom reports whether restriction keeps its room from being booked. Owner blocks always do; a reservation's
+// restriction stops holding it once the reservation is in the trash, cancelled or a no-show
+func (m *memoryDBRepo) holdsRoom(restriction models.RoomRestriction) bool {
+	if restriction.ReservationID == 0 {
+		return true
+	}
+	reservation := m.reservations[restriction.ReservationID]
+	return reservation.DeletedAt.IsZero() && reservation.Status.HoldsRoom()
+}
+
+// available reports whether no restriction holding roomID overlaps start to end. Like the Postgres query,
+// a stay that starts on the day another ends counts as overlapping
+func (m *memoryDBRepo) available(roomID int, start, end time.Time) bool {
+	start, end = day(start), day(end)
+	for _, restriction := range m.roomRestrictions {
+		if restriction.RoomID == roomID && !start.After(restriction.EndDate) && !end.Before(restriction.StartDate) &&
+			m.holdsRoom(restriction) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteReservation removes a reservation for good, with its room restrictions and notes
+func (m *memoryDBRepo) deleteReservation(id int) {
+	delete(m.reservations, id)
+	for restrictionID, restriction := range m.roomRestrictions {
+		if restriction.ReservationID == id {
+			delete(m.roomRestrictions, restrictionID)
+		}
+	}
+	for noteID, note := range m.notes {
+		if note.ReservationID == id {
+			delete(m.notes, noteID)
+		}
+	}
+}
+
+// deleteRoom removes a room for good, with its reservations and room restrictions
+func (m *memoryDBRepo) deleteRoom(id int) {
+	delete(m.rooms, id)
+	for reservationID, reservation := range m.reservations {
+		if reservation.RoomID == id {
+			m.deleteReservation(reservationID)
+		}
+	}
+	for restrictionID, restriction := range m.roomRestrictions {
+		if restriction.RoomID == id {
+			delete(m.roomRestrictions, restrictionID)
+		}
+	}
+}
+
+func (m *memoryDBRepo) AllUsers(ctx context.Context) bool {
+	return true
+}
+
+// memoryTables is a copy of everything the repo holds
+type memoryTables struct {
+	serial           map[string]int
+	users            map[int]models.User
+	rooms            map[int]models.Room
+	restrictions     map[int]models.Restriction
+	reservations     map[int]models.Reservation
+	roomRestrictions map[int]models.RoomRestriction
+	todos            map[int]models.TodoList
+	notes            map[int]models.ReservationNote
+	mailLogs         map[int]models.MailLog
+	auditLogs        map[int]models.AuditLog
+	apiKeys          map[int]models.APIKey
+	webhooks         map[int]models.Webhook
+	deliveries       map[int]models.WebhookDelivery
+}
+
+// WithTx runs fn, putting everything back as it was if fn fails. There is no isolation, so others see what fn
+// changes as it goes, and lose what they change meanwhile if it fails, which is as much as the demo and tests need
+func (m *memoryDBRepo) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.RLock()
+	before := memoryTables{
+		serial:           maps.Clone(m.serial),
+		users:            maps.Clone(m.users),
+		rooms:            maps.Clone(m.rooms),
+		restrictions:     maps.Clone(m.restrictions),
+		reservations:     maps.Clone(m.reservations),
+		roomRestrictions: maps.Clone(m.roomRestrictions),
+		todos:            maps.Clone(m.todos),
+		notes:            maps.Clone(m.notes),
+		mailLogs:         maps.Clone(m.mailLogs),
+		auditLogs:        maps.Clone(m.auditLogs),
+		apiKeys:          maps.Clone(m.apiKeys),
+		webhooks:         maps.Clone(m.webhooks),
+		deliveries:       maps.Clone(m.deliveries),
+	}
+	m.mu.RUnlock()
+
+	err := fn(ctx)
+	if err != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.serial, m.users, m.rooms, m.restrictions = before.serial, before.users, before.rooms, before.restrictions
+		m.reservations, m.roomRestrictions, m.todos, m.notes = before.reservations, before.roomRestrictions, before.todos, before.notes
+		m.mailLogs, m.auditLogs, m.apiKeys = before.mailLogs, before.auditLogs, before.apiKeys
+		m.webhooks, m.deliveries = before.webhooks, before.deliveries
+	}
+	return err
+}
+
+// Inserts a reservation into the database
+func (m *memoryDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, foreignKey("room", res.RoomID)
+	}
+
+	id := m.nextID("reservations")
+	m.reservations[id] = models.Reservation{
+		ID:        id,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		StartDate: day(res.StartDate),
+		EndDate:   day(res.EndDate),
+		RoomID:    res.RoomID,
+		Status:    models.StatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return id, nil
+}
+
+// insertRoomRestriction stores restriction once the room, reservation and restriction it refers to are known to exist
+func (m *memoryDBRepo) insertRoomRestriction(restriction models.RoomRestriction) error {
+	if _, ok := m.rooms[restriction.RoomID]; !ok {
+		return foreignKey("room", restriction.RoomID)
+	}
+	if _, ok := m.restrictions[restriction.RestrictionID]; !ok {
+		return foreignKey("restriction", restriction.RestrictionID)
+	}
+	if _, ok := m.reservations[restriction.ReservationID]; !ok && restriction.ReservationID != 0 {
+		return foreignKey("reservation", restriction.ReservationID)
+	}
+
+	id := m.nextID("room_restrictions")
+	m.roomRestrictions[id] = models.RoomRestriction{
+		ID:            id,
+		StartDate:     day(restriction.StartDate),
+		EndDate:       day(restriction.EndDate),
+		RoomID:        restriction.RoomID,
+		ReservationID: restriction.ReservationID,
+		RestrictionID: restriction.RestrictionID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	return nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (m *memoryDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Postgres is sent the reservation id as it is, so a restriction for no reservation is refused there too
+	if _, ok := m.reservations[res.ReservationID]; !ok {
+		return foreignKey("reservation", res.ReservationID)
+	}
+
+	return m.insertRoomRestriction(res)
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
+func (m *memoryDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.available(roomID, start, end), nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
+func (m *memoryDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		if room.DeletedAt.IsZero() && m.available(room.ID, start, end) {
+			rooms = append(rooms, models.Room{ID: room.ID, RoomName: room.RoomName})
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	return rooms, nil
+}
+
+// Get all rooms
+func (m *memoryDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		if room.DeletedAt.IsZero() {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].RoomName != rooms[j].RoomName {
+			return rooms[i].RoomName < rooms[j].RoomName
+		}
+		return rooms[i].ID < rooms[j].ID
+	})
+
+	return rooms, nil
+}
+
+// GetRoomByID gets a room by id
+func (m *memoryDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return models.Room{}, sql.ErrNoRows
+	}
+
+	return room, nil
+}
+
+// UpdateRoom updates a room in the database
+func (m *memoryDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.rooms[room.ID]
+	if !ok {
+		return nil
+	}
+
+	current.RoomName = room.RoomName
+	current.Price = room.Price
+	current.ImageSource = room.ImageSource
+	current.Description = room.Description
+	current.UpdatedAt = time.Now()
+	m.rooms[room.ID] = current
+
+	return nil
+}
+
+// insertRoom stores room and returns its id
+func (m *memoryDBRepo) insertRoom(room models.Room) int {
+	id := m.nextID("rooms")
+	m.rooms[id] = models.Room{
+		ID:          id,
+		RoomName:    room.RoomName,
+		Price:       room.Price,
+		ImageSource: room.ImageSource,
+		Description: room.Description,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	return id
+}
+
+// Inserts a room into the database and returns its id
+func (m *memoryDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertRoom(room), nil
+}
+
+// ImportRooms inserts rooms, returning their ids
+func (m *memoryDBRepo) ImportRooms(ctx context.Context, rooms []models.Room) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for _, room := range rooms {
+		ids = append(ids, m.insertRoom(room))
+	}
+
+	return ids, nil
+}
+
+// DeleteRoom moves a room to the trash
+func (m *memoryDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[id]
+	if ok && room.DeletedAt.IsZero() {
+		room.DeletedAt = time.Now()
+		m.rooms[id] = room
+	}
+
+	return nil
+}
+
+// DeletedRooms returns the rooms in the trash, most recently deleted first
+func (m *memoryDBRepo) DeletedRooms(ctx context.Context) ([]models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		if !room.DeletedAt.IsZero() {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].DeletedAt.After(rooms[j].DeletedAt) })
+
+	return rooms, nil
+}
+
+// RestoreRoom takes a room out of the trash
+func (m *memoryDBRepo) RestoreRoom(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[id]
+	if ok {
+		room.DeletedAt = time.Time{}
+		room.UpdatedAt = time.Now()
+		m.rooms[id] = room
+	}
+
+	return nil
+}
+
+// PurgeDeletedRooms permanently deletes rooms trashed before the given time and returns how many were removed.
+// Rooms that still have reservations, trashed or not, are kept, as deleting them would take the reservations with them
+func (m *memoryDBRepo) PurgeDeletedRooms(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	booked := map[int]bool{}
+	for _, reservation := range m.reservations {
+		booked[reservation.RoomID] = true
+	}
+
+	purged := 0
+	for id, room := range m.rooms {
+		if !room.DeletedAt.IsZero() && room.DeletedAt.Before(before) && !booked[id] {
+			m.deleteRoom(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// GetUserByID returns a user by id
+func (m *memoryDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail returns the user who logs in with email
+func (m *memoryDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+// InsertUser inserts a user, whose Password must already be a bcrypt hash, returning its id
+func (m *memoryDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.users {
+		if other.Email == user.Email {
+			return 0, unique("email", user.Email)
+		}
+	}
+
+	user.ID = m.nextID("users")
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// UpdateUser updates a user in the database
+func (m *memoryDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.users[user.ID]
+	if !ok {
+		return nil
+	}
+
+	for _, other := range m.users {
+		if other.ID != user.ID && other.Email == user.Email {
+			return unique("email", user.Email)
+		}
+	}
+
+	current.FirstName = user.FirstName
+	current.LastName = user.LastName
+	current.Email = user.Email
+	current.AccessLevel = user.AccessLevel
+	current.UpdatedAt = time.Now()
+	m.users[user.ID] = current
+
+	return nil
+}
+
+// UpdateUserPassword replaces a user's password with passwordHash, a bcrypt hash
+func (m *memoryDBRepo) UpdateUserPassword(ctx context.Context, id int, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now()
+	m.users[id] = user
+
+	return nil
+}
+
+// Authenticate authenticates a user
+func (m *memoryDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	m.mu.RLock()
+	var found *models.User
+	for _, user := range m.users {
+		if user.Email == email {
+			user := user
+			found = &user
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if found == nil {
+		return 0, "", sql.ErrNoRows
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return found.ID, found.Password, nil
+}
+
+// reservationSorts orders two reservations by each of models.ReservationSorts, returning less than zero if a comes first
+var reservationSorts = map[string]func(a, b models.Reservation) int{
+	"arrival":   func(a, b models.Reservation) int { return compareTimes(a.StartDate, b.StartDate) },
+	"departure": func(a, b models.Reservation) int { return compareTimes(a.EndDate, b.EndDate) },
+	"created":   func(a, b models.Reservation) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	"name":      func(a, b models.Reservation) int { return strings.Compare(a.LastName, b.LastName) },
+	"room":      func(a, b models.Reservation) int { return strings.Compare(a.Room.RoomName, b.Room.RoomName) },
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// SearchReservations returns one page of the reservations matching filter, and how many match in total
+func (m *memoryDBRepo) SearchReservations(ctx context.Context, filter models.ReservationFilter) (models.ReservationPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page := models.ReservationPage{Filter: filter}
+
+	compare, ok := reservationSorts[filter.Sort]
+	if !ok {
+		compare = reservationSorts["arrival"]
+	}
+
+	search := strings.ToLower(strings.TrimSpace(filter.Search))
+	start, end := day(filter.Start), day(filter.End)
+
+	matches := m.findReservations(func(r models.Reservation) bool {
+		return r.DeletedAt.IsZero() &&
+			(search == "" || strings.HasPrefix(strings.ToLower(r.FirstName), search) ||
+				strings.HasPrefix(strings.ToLower(r.LastName), search) ||
+				strings.HasPrefix(strings.ToLower(r.Email), search) || strings.HasPrefix(r.Phone, search)) &&
+			(start.IsZero() || !r.EndDate.Before(start)) &&
+			(end.IsZero() || !r.StartDate.After(end)) &&
+			(filter.RoomID == 0 || r.RoomID == filter.RoomID) &&
+			(filter.Status == "" || r.Status == filter.Status)
+	})
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		order := compare(matches[i], matches[j])
+		if order == 0 {
+			order = matches[i].ID - matches[j].ID
+		}
+		if filter.Desc {
+			return order > 0
+		}
+		return order < 0
+	})
+
+	offset := filter.Offset()
+	if offset >= len(matches) || filter.PerPage <= 0 {
+		// The total comes from the rows of the page in Postgres, so an empty page has none
+		return page, nil
+	}
+
+	last := offset + filter.PerPage
+	if last > len(matches) {
+		last = len(matches)
+	}
+
+	page.Reservations = matches[offset:last]
+	page.Total = len(matches)
+
+	return page, nil
+}
+
+// GetReservationByID returns one reservation by ID
+func (m *memoryDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reservation, ok := m.reservations[id]
+	if !ok {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	reservation = m.joinRoom(reservation)
+	reservation.Room.Price = m.rooms[reservation.RoomID].Price
+	return reservation, nil
+}
+
+// UpdateReservation updates a reservation in the database
+func (m *memoryDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reservation, ok := m.reservations[u.ID]
+	if !ok {
+		return nil
+	}
+
+	reservation.FirstName = u.FirstName
+	reservation.LastName = u.LastName
+	reservation.Email = u.Email
+	reservation.Phone = u.Phone
+	reservation.UpdatedAt = time.Now()
+	m.reservations[u.ID] = reservation
+
+	return nil
+}
+
+// trashReservation moves a reservation to the trash, reporting false if there is no such reservation or it is already there
+func (m *memoryDBRepo) trashReservation(id int, at time.Time) bool {
+	reservation, ok := m.reservations[id]
+	if !ok || !reservation.DeletedAt.IsZero() {
+		return false
+	}
+
+	reservation.DeletedAt = at
+	m.reservations[id] = reservation
+	return true
+}
+
+// DeleteReservation moves one reservation to the trash by id
+func (m *memoryDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trashReservation(id, time.Now())
+	return nil
+}
+
+// transitionReservation moves a reservation to status, stamping the time it got there with at
+func (m *memoryDBRepo) transitionReservation(id int, status models.ReservationStatus, at time.Time) error {
+	reservation, ok := m.reservations[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := reservation.Status.Transition(status)
+	if err != nil {
+		return err
+	}
+
+	stampStatus(&reservation, status, at)
+	reservation.UpdatedAt = time.Now()
+	m.reservations[id] = reservation
+
+	return nil
+}
+
+// UpdateReservationStatus moves a reservation to a new status and records when it happened.
+// The move is rejected with models.ErrInvalidTransition unless the lifecycle allows it
+func (m *memoryDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transitionReservation(id, status, time.Now())
+}
+
+// BulkUpdateReservationStatus moves every reservation in ids to status, skipping those the lifecycle won't allow to move
+func (m *memoryDBRepo) BulkUpdateReservationStatus(ctx context.Context, ids []int, status models.ReservationStatus) (models.BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result models.BulkResult
+
+	now := time.Now()
+	for _, id := range ids {
+		err := m.transitionReservation(id, status, now)
+		switch {
+		case errors.Is(err, models.ErrInvalidTransition):
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: "not found"})
+		default:
+			result.Succeeded = append(result.Succeeded, id)
+		}
+	}
+
+	return result, nil
+}
+
+// BulkDeleteReservations moves every reservation in ids to the trash
+func (m *memoryDBRepo) BulkDeleteReservations(ctx context.Context, ids []int) (models.BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result models.BulkResult
+
+	now := time.Now()
+	for _, id := range ids {
+		if m.trashReservation(id, now) {
+			result.Succeeded = append(result.Succeeded, id)
+		} else {
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: "not found or already deleted"})
+		}
+	}
+
+	return result, nil
+}
+
+// ImportReservations inserts reservations and a room restriction for each stay, returning their ids. Nothing is
+// imported if one of them fails, including a stay that clashes with a booking already holding its room
+func (m *memoryDBRepo) ImportReservations(ctx context.Context, reservations []models.Reservation) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var ids []int
+
+	for _, res := range reservations {
+		// Checked against the reservations imported so far too, as they hold rooms as well
+		id, err := m.insertStay(res, now)
+		if err != nil {
+			for _, id := range ids {
+				m.deleteReservation(id)
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// InsertBooking inserts a pending reservation and the room restriction holding its room, once the room is known to be
+// free, returning the reservation id. models.ErrRoomUnavailable is returned if it isn't.
+// It is created at res.CreatedAt, or now if that is zero
+func (m *memoryDBRepo) InsertBooking(ctx context.Context, res models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res.Status = models.StatusPending
+
+	return m.insertStay(res, time.Now())
+}
+
+// insertStay stores res with its status and a room restriction, refusing it if it would hold a room that is already held.
+// It is created at now unless it says otherwise
+func (m *memoryDBRepo) insertStay(res models.Reservation, now time.Time) (int, error) {
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, foreignKey("room", res.RoomID)
+	}
+
+	if res.Status.HoldsRoom() && !m.available(res.RoomID, res.StartDate, res.EndDate) {
+		return 0, fmt.Errorf("%w: room %d from %s to %s", models.ErrRoomUnavailable, res.RoomID,
+			res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+	}
+
+	createdAt := res.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	id := m.nextID("reservations")
+	reservation := models.Reservation{
+		ID:        id,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		StartDate: day(res.StartDate),
+		EndDate:   day(res.EndDate),
+		RoomID:    res.RoomID,
+		CreatedAt: createdAt,
+		UpdatedAt: now,
+	}
+	stampStatus(&reservation, res.Status, createdAt)
+	m.reservations[id] = reservation
+
+	err := m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: id,
+		RestrictionID: restrictionReservation,
+	})
+	if err != nil {
+		m.deleteReservation(id)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CheckInReservation moves a reservation to checked-in, recording when the guest actually arrived
+// and the ID and notes taken at the desk. A pending reservation is confirmed first, and left pending if that fails
+func (m *memoryDBRepo) CheckInReservation(ctx context.Context, id int, arrivedAt time.Time, idDocument, notes string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.transitionAtDesk(id, models.StatusCheckedIn, arrivedAt)
+	if err != nil {
+		return err
+	}
+
+	reservation := m.reservations[id]
+	reservation.IDDocument = idDocument
+	reservation.FrontDeskNotes = notes
+	m.reservations[id] = reservation
+
+	return nil
+}
+
+// MarkNoShow moves a reservation whose guest never arrived to no-show. A pending reservation is confirmed first,
+// and left pending if that fails
+func (m *memoryDBRepo) MarkNoShow(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transitionAtDesk(id, models.StatusNoShow, time.Now())
+}
+
+// transitionAtDesk moves a reservation to status, confirming it on the way if it is still pending. The lifecycle only
+// lets confirmed guests check in or be marked as no-shows, but the front desk deals with whoever is booked for the day
+func (m *memoryDBRepo) transitionAtDesk(id int, status models.ReservationStatus, at time.Time) error {
+	before, ok := m.reservations[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if before.Status == models.StatusPending {
+		err := m.transitionReservation(id, models.StatusConfirmed, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := m.transitionReservation(id, status, at)
+	if err != nil {
+		m.reservations[id] = before
+		return err
+	}
+	return nil
+}
+
+// listReservations returns the reservations not in the trash that match keeps, ordered by each of less in turn
+func (m *memoryDBRepo) listReservations(match func(models.Reservation) bool, less ...func(a, b models.Reservation) int) []models.Reservation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reservations := m.findReservations(func(r models.Reservation) bool {
+		return r.DeletedAt.IsZero() && match(r)
+	})
+
+	sort.SliceStable(reservations, func(i, j int) bool {
+		for _, compare := range less {
+			if order := compare(reservations[i], reservations[j]); order != 0 {
+				return order < 0
+			}
+		}
+		return false
+	})
+
+	return reservations
+}
+
+// waiting reports whether a reservation's guest is still to arrive
+func waiting(r models.Reservation) bool {
+	return r.Status == models.StatusPending || r.Status == models.StatusConfirmed
+}
+
+// ReservationsArrivingOn returns the reservations due to arrive on date that have not checked in yet
+func (m *memoryDBRepo) ReservationsArrivingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	return m.listReservations(func(r models.Reservation) bool {
+		return r.StartDate.Equal(day(date)) && waiting(r)
+	}, reservationSorts["name"]), nil
+}
+
+// ReservationsInHouse returns the reservations whose guests are checked in right now
+func (m *memoryDBRepo) ReservationsInHouse(ctx context.Context) ([]models.Reservation, error) {
+	return m.listReservations(func(r models.Reservation) bool {
+		return r.Status == models.StatusCheckedIn
+	}, reservationSorts["departure"], reservationSorts["name"]), nil
+}
+
+// ReservationsDepartingOn returns the checked in reservations due to leave on date
+func (m *memoryDBRepo) ReservationsDepartingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	return m.listReservations(func(r models.Reservation) bool {
+		return r.EndDate.Equal(day(date)) && r.Status == models.StatusCheckedIn
+	}, reservationSorts["name"]), nil
+}
+
+// ReservationsNotArrivedBy returns the reservations due on or before date whose guests never checked in
+func (m *memoryDBRepo) ReservationsNotArrivedBy(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	return m.listReservations(func(r models.Reservation) bool {
+		return !r.StartDate.After(day(date)) && waiting(r)
+	}, reservationSorts["arrival"], reservationSorts["name"]), nil
+}
+
+// DeletedReservations returns the reservations in the trash, most recently deleted first
+func (m *memoryDBRepo) DeletedReservations(ctx context.Context) ([]models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reservations := m.findReservations(func(r models.Reservation) bool {
+		return !r.DeletedAt.IsZero()
+	})
+	sort.SliceStable(reservations, func(i, j int) bool { return reservations[i].DeletedAt.After(reservations[j].DeletedAt) })
+
+	return reservations, nil
+}
+
+// RestoreReservation takes a reservation out of the trash, unless another reservation has taken its room for its
+// dates meanwhile. models.ErrRoomUnavailable is returned if one has
+func (m *memoryDBRepo) RestoreReservation(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reservation, ok := m.reservations[id]
+	if !ok || reservation.DeletedAt.IsZero() {
+		return nil
+	}
+
+	if reservation.Status.HoldsRoom() && !m.available(reservation.RoomID, reservation.StartDate, reservation.EndDate) {
+		return fmt.Errorf("%w: room %d from %s to %s", models.ErrRoomUnavailable, reservation.RoomID,
+			reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	}
+
+	reservation.DeletedAt = time.Time{}
+	reservation.UpdatedAt = time.Now()
+	m.reservations[id] = reservation
+
+	return nil
+}
+
+// PurgeDeletedReservations permanently deletes reservations trashed before the given time
+// and returns how many were removed. Their room restrictions and notes go with them
+func (m *memoryDBRepo) PurgeDeletedReservations(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, reservation := range m.reservations {
+		if !reservation.DeletedAt.IsZero() && reservation.DeletedAt.Before(before) {
+			m.deleteReservation(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// GetRestrictionsForCurrentRoom returns the restrictions holding a room on the nights from start to end
+func (m *memoryDBRepo) GetRestrictionsForCurrentRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start, end = day(start), day(end)
+
+	var restrictions []models.RoomRestriction
+	for _, restriction := range m.roomRestrictions {
+		if restriction.RoomID == roomID && start.Before(restriction.EndDate) && !end.Before(restriction.StartDate) &&
+			m.holdsRoom(restriction) {
+			restriction.Reservation.Status = m.reservations[restriction.ReservationID].Status
+			restrictions = append(restrictions, restriction)
+		}
+	}
+	sort.Slice(restrictions, func(i, j int) bool { return restrictions[i].ID < restrictions[j].ID })
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom blocks the room with id for the night of startDate
+func (m *memoryDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate,
+		RoomID:        id,
+		RestrictionID: restrictionOwnerBlock,
+	})
+}
+
+// DeleteBlockByID deletes a room restriction
+func (m *memoryDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.roomRestrictions, id)
+	return nil
+}
+
+// InsertTodoList inserts a new todo list into the database and returns its id
+func (m *memoryDBRepo) InsertTodoList(ctx context.Context, todo models.TodoList) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[todo.UserID]; !ok {
+		return 0, foreignKey("user", todo.UserID)
+	}
+
+	id := m.nextID("todo_list")
+	m.todos[id] = models.TodoList{
+		ID:        id,
+		Todo:      todo.Todo,
+		UserID:    todo.UserID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return id, nil
+}
+
+// GetTodoListByUserID gets all todo for a user by user_id
+func (m *memoryDBRepo) GetTodoListByUserID(ctx context.Context, id int) ([]models.TodoList, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var todoList []models.TodoList
+	for _, todo := range m.todos {
+		if todo.UserID == id {
+			todoList = append(todoList, todo)
+		}
+	}
+	sort.Slice(todoList, func(i, j int) bool { return todoList[i].ID < todoList[j].ID })
+
+	return todoList, nil
+}
+
+// DeleteTodo deletes a todo
+func (m *memoryDBRepo) DeleteTodo(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.todos, id)
+	return nil
+}
+
+// OccupancyForRange totals the room nights sold and their revenue for stays between start and end.
+// Reservations that overlap the range only count the nights inside it
+func (m *memoryDBRepo) OccupancyForRange(ctx context.Context, start, end time.Time) (models.OccupancyStats, error) {
+	return m.occupancy(start, end, func(models.Reservation) bool { return true }), nil
+}
+
+// PickupForRange totals the room nights and revenue for stays between start and end, like OccupancyForRange,
+// counting only the reservations booked between bookedStart and bookedEnd
+func (m *memoryDBRepo) PickupForRange(ctx context.Context, start, end, bookedStart, bookedEnd time.Time) (models.OccupancyStats, error) {
+	return m.occupancy(start, end, func(r models.Reservation) bool {
+		return !r.CreatedAt.Before(bookedStart) && r.CreatedAt.Before(bookedEnd)
+	}), nil
+}
+
+// occupancy totals the room nights and revenue for stays between start and end, of the reservations booked
+// returns true for
+func (m *memoryDBRepo) occupancy(start, end time.Time, booked func(models.Reservation) bool) models.OccupancyStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := models.OccupancyStats{
+		Start: start,
+		End:   end,
+	}
+
+	for _, room := range m.rooms {
+		if room.DeletedAt.IsZero() {
+			stats.Rooms++
+		}
+	}
+
+	from, to := day(start), day(end)
+	for _, r := range m.reservations {
+		if !r.DeletedAt.IsZero() || !r.Status.HoldsRoom() || !r.StartDate.Before(to) || !r.EndDate.After(from) || !booked(r) {
+			continue
+		}
+
+		first, last := r.StartDate, r.EndDate
+		if first.Before(from) {
+			first = from
+		}
+		if last.After(to) {
+			last = to
+		}
+
+		nights := nightsBetween(first, last)
+		stats.RoomNightsSold += nights
+		stats.Revenue += float64(nights) * m.rooms[r.RoomID].PriceValue()
+	}
+
+	return stats
+}
+
+// CountReservationsCreatedBetween returns how many reservations were booked between start and end
+func (m *memoryDBRepo) CountReservationsCreatedBetween(ctx context.Context, start, end time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, r := range m.reservations {
+		if r.DeletedAt.IsZero() && !r.CreatedAt.Before(start) && r.CreatedAt.Before(end) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountReservationsByStatus returns how many reservations are in status
+func (m *memoryDBRepo) CountReservationsByStatus(ctx context.Context, status models.ReservationStatus) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, r := range m.reservations {
+		if r.DeletedAt.IsZero() && r.Status == status {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// stayOverlaps reports whether r is a stay, not cancelled or a no-show, with nights between start and end
+func stayOverlaps(r models.Reservation, start, end time.Time) bool {
+	return r.StartDate.Before(end) && r.EndDate.After(start) && r.Status.HoldsRoom()
+}
+
+// The filter and order of each report
+var reportRules = map[models.ReportKind]struct {
+	match func(r models.Reservation, start, end time.Time) bool
+	order []func(a, b models.Reservation) int
+}{
+	models.ReportByStayDate: {stayOverlaps, []func(a, b models.Reservation) int{reservationSorts["arrival"]}},
+	models.ReportByBookingDate: {
+		func(r models.Reservation, start, end time.Time) bool {
+			return !r.CreatedAt.Before(start) && r.CreatedAt.Before(end)
+		},
+		[]func(a, b models.Reservation) int{reservationSorts["created"]},
+	},
+	models.ReportByRoom: {stayOverlaps, []func(a, b models.Reservation) int{reservationSorts["room"], reservationSorts["arrival"]}},
+	models.ReportCancellations: {
+		func(r models.Reservation, start, end time.Time) bool {
+			return r.Status == models.StatusCancelled && !r.CancelledAt.Before(start) && r.CancelledAt.Before(end)
+		},
+		[]func(a, b models.Reservation) int{func(a, b models.Reservation) int { return compareTimes(a.CancelledAt, b.CancelledAt) }},
+	},
+	models.ReportNoShows: {
+		func(r models.Reservation, start, end time.Time) bool {
+			return r.Status == models.StatusNoShow && !r.StartDate.Before(start) && r.StartDate.Before(end)
+		},
+		[]func(a, b models.Reservation) int{reservationSorts["arrival"]},
+	},
+}
+
+// EachReportReservation calls fn with every reservation in a report, in order. It stops at the first error fn returns
+func (m *memoryDBRepo) EachReportReservation(ctx context.Context, query models.ReportQuery, fn func(models.Reservation) error) error {
+	rules, ok := reportRules[query.Kind]
+	if !ok {
+		return fmt.Errorf("unknown report %q", query.Kind)
+	}
+
+	// Collected first so fn can use the repo without waiting on the lock
+	reservations := m.listReservations(func(r models.Reservation) bool {
+		return rules.match(r, query.Start, query.End)
+	}, rules.order...)
+
+	m.mu.RLock()
+	for i := range reservations {
+		reservations[i].Room.Price = m.rooms[reservations[i].RoomID].Price
+	}
+	m.mu.RUnlock()
+
+	for _, reservation := range reservations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(reservation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// joinUser returns the name and email of the user with id, as the queries joining users do
+func (m *memoryDBRepo) joinUser(id int) models.User {
+	user := m.users[id]
+	return models.User{ID: id, FirstName: user.FirstName, LastName: user.LastName, Email: user.Email}
+}
+
+// InsertReservationNote adds an internal note to a reservation
+func (m *memoryDBRepo) InsertReservationNote(ctx context.Context, note models.ReservationNote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[note.ReservationID]; !ok {
+		return foreignKey("reservation", note.ReservationID)
+	}
+
+	id := m.nextID("reservation_notes")
+	m.notes[id] = models.ReservationNote{
+		ID:            id,
+		ReservationID: note.ReservationID,
+		UserID:        note.UserID,
+		Note:          note.Note,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	return nil
+}
+
+// GetNotesForReservation returns the internal notes on a reservation, newest first
+func (m *memoryDBRepo) GetNotesForReservation(ctx context.Context, reservationID int) ([]models.ReservationNote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var notes []models.ReservationNote
+	for _, note := range m.notes {
+		if note.ReservationID == reservationID {
+			note.User = m.joinUser(note.UserID)
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID > notes[j].ID })
+
+	return notes, nil
+}
+
+// InsertMailLog records an email handed to the mail server
+func (m *memoryDBRepo) InsertMailLog(ctx context.Context, entry models.MailLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = m.nextID("mail_logs")
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+	m.mailLogs[entry.ID] = entry
+
+	return nil
+}
+
+// GetMailLogsForReservation returns the emails sent about a reservation, newest first
+func (m *memoryDBRepo) GetMailLogsForReservation(ctx context.Context, reservationID int) ([]models.MailLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var logs []models.MailLog
+	for _, entry := range m.mailLogs {
+		if entry.ReservationID == reservationID {
+			logs = append(logs, entry)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID > logs[j].ID })
+
+	return logs, nil
+}
+
+// InsertAuditLog records an admin change in the audit log
+func (m *memoryDBRepo) InsertAuditLog(ctx context.Context, entry models.AuditLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = m.nextID("audit_logs")
+	entry.Changes = append([]models.AuditChange(nil), entry.Changes...)
+	entry.User = models.User{}
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+	m.auditLogs[entry.ID] = entry
+
+	return nil
+}
+
+// findAuditLogs returns the audit log entries match keeps, newest first, with the users who made them
+func (m *memoryDBRepo) findAuditLogs(match func(models.AuditLog) bool) []models.AuditLog {
+	var logs []models.AuditLog
+	for _, entry := range m.auditLogs {
+		entry.User = m.joinUser(entry.UserID)
+		if match(entry) {
+			entry.Changes = append([]models.AuditChange(nil), entry.Changes...)
+			logs = append(logs, entry)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID > logs[j].ID })
+	return logs
+}
+
+// SearchAuditLogs returns audit log entries, newest first, matching the search text and entity.
+// Empty arguments match everything
+func (m *memoryDBRepo) SearchAuditLogs(ctx context.Context, search, entity string) ([]models.AuditLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(search))
+	}
+
+	logs := m.findAuditLogs(func(entry models.AuditLog) bool {
+		if entity != "" && entry.Entity != entity {
+			return false
+		}
+		if search == "" {
+			return true
+		}
+		changes, _ := json.Marshal(entry.Changes)
+		return contains(entry.Action) || contains(string(changes)) || contains(entry.User.Email) ||
+			strconv.Itoa(entry.EntityID) == search
+	})
+
+	if len(logs) > 500 {
+		logs = logs[:500]
+	}
+
+	return logs, nil
+}
+
+// GetAuditLogsForEntity returns the history of a single record, newest first
+func (m *memoryDBRepo) GetAuditLogsForEntity(ctx context.Context, entity string, entityID int) ([]models.AuditLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findAuditLogs(func(entry models.AuditLog) bool {
+		return entry.Entity == entity && entry.EntityID == entityID
+	}), nil
+}
+
+// InsertAPIKey stores a new API key and returns its id
+func (m *memoryDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.apiKeys {
+		if other.Prefix == key.Prefix {
+			return 0, unique("prefix", key.Prefix)
+		}
+	}
+
+	id := m.nextID("api_keys")
+	m.apiKeys[id] = models.APIKey{
+		ID:        id,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		Scope:     key.Scope,
+		RateLimit: key.RateLimit,
+		UserID:    key.UserID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return id, nil
+}
+
+// AllAPIKeys returns every API key, revoked ones included, newest first
+func (m *memoryDBRepo) AllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+
+	return keys, nil
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix, revoked or not
+func (m *memoryDBRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+
+	return models.APIKey{}, sql.ErrNoRows
+}
+
+// RevokeAPIKey stops an API key from being used. It returns sql.ErrNoRows if there is no such key, or it is already revoked
+func (m *memoryDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok || key.Revoked() {
+		return sql.ErrNoRows
+	}
+
+	key.RevokedAt = time.Now()
+	key.UpdatedAt = key.RevokedAt
+	m.apiKeys[id] = key
+
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (m *memoryDBRepo) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if ok {
+		key.LastUsedAt = at
+		m.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// webhook returns the webhook with id, with a copy of its events so the caller can't change the stored ones
+func (m *memoryDBRepo) webhook(id int) (models.Webhook, bool) {
+	hook, ok := m.webhooks[id]
+	hook.Events = append([]string(nil), hook.Events...)
+	return hook, ok
+}
+
+// findWebhooks returns the webhooks match keeps, oldest first
+func (m *memoryDBRepo) findWebhooks(match func(models.Webhook) bool) []models.Webhook {
+	var hooks []models.Webhook
+	for id := range m.webhooks {
+		hook, _ := m.webhook(id)
+		if match(hook) {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks
+}
+
+// InsertWebhook stores a new webhook and returns its id
+func (m *memoryDBRepo) InsertWebhook(ctx context.Context, hook models.Webhook) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID("webhooks")
+	m.webhooks[id] = models.Webhook{
+		ID:          id,
+		URL:         hook.URL,
+		Description: hook.Description,
+		Secret:      hook.Secret,
+		Events:      append([]string(nil), hook.Events...),
+		Active:      hook.Active,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	return id, nil
+}
+
+// AllWebhooks returns every webhook, oldest first
+func (m *memoryDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findWebhooks(func(models.Webhook) bool { return true }), nil
+}
+
+// GetWebhookByID returns a webhook by id
+func (m *memoryDBRepo) GetWebhookByID(ctx context.Context, id int) (models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hook, ok := m.webhook(id)
+	if !ok {
+		return models.Webhook{}, sql.ErrNoRows
+	}
+
+	return hook, nil
+}
+
+// SetWebhookActive turns sending to a webhook on or off
+func (m *memoryDBRepo) SetWebhookActive(ctx context.Context, id int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hook, ok := m.webhooks[id]
+	if ok {
+		hook.Active = active
+		hook.UpdatedAt = time.Now()
+		m.webhooks[id] = hook
+	}
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook, and its delivery log with it
+func (m *memoryDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.webhooks, id)
+	for deliveryID, delivery := range m.deliveries {
+		if delivery.WebhookID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+// WebhooksForEvent returns the active webhooks subscribed to event
+func (m *memoryDBRepo) WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findWebhooks(func(hook models.Webhook) bool {
+		return hook.Active && hook.Subscribes(event)
+	}), nil
+}
+
+// InsertWebhookDelivery queues a delivery and returns its id
+func (m *memoryDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[delivery.WebhookID]; !ok {
+		return 0, foreignKey("webhook", delivery.WebhookID)
+	}
+
+	id := m.nextID("webhook_deliveries")
+	m.deliveries[id] = models.WebhookDelivery{
+		ID:            id,
+		WebhookID:     delivery.WebhookID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	return id, nil
+}
+
+// findDeliveries returns the deliveries match keeps, ordered by less, up to limit
+func (m *memoryDBRepo) findDeliveries(match func(models.WebhookDelivery) bool, less func(a, b models.WebhookDelivery) bool, limit int) []models.WebhookDelivery {
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if match(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return less(deliveries[i], deliveries[j]) })
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries due by now, with their webhooks, oldest first.
+// Deliveries to inactive webhooks wait until they are turned back on
+func (m *memoryDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := m.findDeliveries(func(d models.WebhookDelivery) bool {
+		return d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now) && m.webhooks[d.WebhookID].Active
+	}, func(a, b models.WebhookDelivery) bool {
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		return a.ID < b.ID
+	}, limit)
+
+	for i, d := range deliveries {
+		hook := m.webhooks[d.WebhookID]
+		deliveries[i].Webhook = models.Webhook{ID: hook.ID, URL: hook.URL, Secret: hook.Secret}
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt at a delivery
+func (m *memoryDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.deliveries[delivery.ID]
+	if !ok {
+		return nil
+	}
+
+	current.Status = delivery.Status
+	current.Attempts = delivery.Attempts
+	current.ResponseStatus = delivery.ResponseStatus
+	current.Error = delivery.Error
+	current.NextAttemptAt = delivery.NextAttemptAt
+	current.DeliveredAt = delivery.DeliveredAt
+	current.UpdatedAt = time.Now()
+	m.deliveries[delivery.ID] = current
+
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries to a webhook, newest first
+func (m *memoryDBRepo) GetWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findDeliveries(func(d models.WebhookDelivery) bool {
+		return d.WebhookID == webhookID
+	}, func(a, b models.WebhookDelivery) bool {
+		return a.ID > b.ID
+	}, limit), nil
+}
+
+// RetryWebhookDelivery queues a delivery to a webhook to be sent again straight away, whatever happened to it before.
+// It returns sql.ErrNoRows if the webhook has no such delivery
+func (m *memoryDBRepo) RetryWebhookDelivery(ctx context.Context, webhookID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok || delivery.WebhookID != webhookID {
+		return sql.ErrNoRows
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = time.Now()
+	delivery.UpdatedAt = delivery.NextAttemptAt
+	m.deliveries[id] = delivery
+
+	return nil
+}
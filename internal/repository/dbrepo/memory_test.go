@@ -0,0 +1,37 @@
+package dbrepo
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+func TestMemoryConcurrentBookings(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := date("2040-01-01").AddDate(0, 0, i*3)
+			id, err := repo.InsertReservation(context.Background(), models.Reservation{RoomID: 1, StartDate: start, EndDate: start})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = repo.InsertRoomRestriction(context.Background(), models.RoomRestriction{RoomID: 1, ReservationID: id,
+				RestrictionID: 1, StartDate: start, EndDate: start})
+			_, _ = repo.SearchAvailabilityForAllRooms(context.Background(), start, start)
+		}(i)
+	}
+	wg.Wait()
+
+	page, _ := repo.SearchReservations(context.Background(), models.ReservationFilter{PerPage: 50})
+	if page.Total != 20 {
+		t.Errorf("expected 20 reservations, but got %d", page.Total)
+	}
+}
@@ -0,0 +1,182 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/config"
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/atuprosper/booking-project/internal/models"
+	"github.com/atuprosper/booking-project/internal/repository"
+)
+
+// stalled is a database that never answers. Every query and statement waits until its context is done,
+// telling started when it begins so the test knows the query reached the database
+type stalled struct {
+	started chan struct{}
+}
+
+func (s *stalled) Connect(ctx context.Context) (driver.Conn, error) { return &stalledConn{s}, nil }
+func (s *stalled) Driver() driver.Driver                            { return s }
+func (s *stalled) Open(name string) (driver.Conn, error)            { return &stalledConn{s}, nil }
+
+type stalledConn struct {
+	db *stalled
+}
+
+func (c *stalledConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *stalledConn) Close() error              { return nil }
+func (c *stalledConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *stalledConn) Commit() error             { return nil }
+func (c *stalledConn) Rollback() error           { return nil }
+
+func (c *stalledConn) wait(ctx context.Context) error {
+	c.db.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *stalledConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.wait(ctx)
+}
+
+func (c *stalledConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return nil, c.wait(ctx)
+}
+
+// newStalledRepo returns a postgres repo on a database that never answers, and the channel its queries start on
+func newStalledRepo(timeouts config.DBTimeouts) (repository.DatabaseRepo, chan struct{}) {
+	db := &stalled{started: make(chan struct{}, 1)}
+	return NewPostgresRepo(sql.OpenDB(db), &config.AppConfig{DBTimeouts: timeouts}), db.started
+}
+
+var stalledTests = []struct {
+	name string
+	op   func(context.Context, repository.DatabaseRepo) error
+}{
+	{"GetRoomByID", func(ctx context.Context, repo repository.DatabaseRepo) error {
+		_, err := repo.GetRoomByID(ctx, 1)
+		return err
+	}},
+	{"InsertReservation", func(ctx context.Context, repo repository.DatabaseRepo) error {
+		_, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", RoomID: 1})
+		return err
+	}},
+	{"SearchAvailabilityForAllRooms", func(ctx context.Context, repo repository.DatabaseRepo) error {
+		_, err := repo.SearchAvailabilityForAllRooms(ctx, time.Now(), time.Now().AddDate(0, 0, 2))
+		return err
+	}},
+	{"UpdateReservationStatus", func(ctx context.Context, repo repository.DatabaseRepo) error {
+		return repo.UpdateReservationStatus(ctx, 1, models.StatusConfirmed)
+	}},
+	{"DeleteBlockByID", func(ctx context.Context, repo repository.DatabaseRepo) error {
+		return repo.DeleteBlockByID(ctx, 1)
+	}},
+}
+
+func TestQueriesStopWhenRequestIsCancelled(t *testing.T) {
+	for _, e := range stalledTests {
+		repo, started := newStalledRepo(config.NewDBTimeouts())
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- e.op(ctx, repo)
+		}()
+
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("failed %s: the query never reached the database", e.name)
+		}
+		cancel()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("failed %s: expected context.Canceled, but got %v", e.name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("failed %s: the query kept running after the request was cancelled", e.name)
+		}
+	}
+}
+
+func TestQueriesStopAtTheirTimeout(t *testing.T) {
+	for _, e := range stalledTests {
+		timeouts := config.NewDBTimeouts()
+		timeouts.Default = time.Minute
+		if err := timeouts.Set(e.name + "=20ms"); err != nil {
+			t.Fatal(err)
+		}
+
+		repo, _ := newStalledRepo(timeouts)
+		timed := metrics.SampleCount(metrics.DBQueryDuration, e.name)
+		begun := time.Now()
+
+		err := e.op(context.Background(), repo)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("failed %s: expected context.DeadlineExceeded, but got %v", e.name, err)
+		}
+		if took := time.Since(begun); took > 5*time.Second {
+			t.Errorf("failed %s: expected the operation's own 20ms timeout, but it took %s", e.name, took)
+		}
+		if metrics.SampleCount(metrics.DBQueryDuration, e.name) != timed+1 {
+			t.Errorf("failed %s: expected how long it took to be recorded", e.name)
+		}
+	}
+}
+
+func TestDBTimeouts(t *testing.T) {
+	timeouts := config.NewDBTimeouts()
+	if err := timeouts.Set("SearchReservations=5s, EachReportReservation=10m"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Duration{
+		"SearchReservations":    5 * time.Second,
+		"EachReportReservation": 10 * time.Minute,
+		"ImportRooms":           time.Minute,
+		"GetRoomByID":           config.DefaultDBTimeout,
+	}
+	for op, timeout := range expected {
+		if got := timeouts.For(op); got != timeout {
+			t.Errorf("expected %s to have %s, but got %s", op, timeout, got)
+		}
+	}
+
+	// A typo names no operation, so would silently leave the default in place
+	for _, list := range []string{"SearchReservations", "=5s", "SearchReservations=soon", "SearchReservations=-1s", "SearchReservation=5s"} {
+		if err := timeouts.Set(list); err == nil {
+			t.Errorf("expected %q to be rejected", list)
+		}
+	}
+	if got := timeouts.For("SearchReservation"); got != config.DefaultDBTimeout {
+		t.Errorf("expected a rejected operation to keep the default, but got %s", got)
+	}
+
+	// Every operation the repository times must be one a timeout can be set for
+	files, _ := filepath.Glob("*.go")
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range regexp.MustCompile(`timeout\(ctx, "(\w+)"\)`).FindAllStringSubmatch(string(source), -1) {
+			if !slices.Contains(config.DBOperations, match[1]) {
+				t.Errorf("expected %s, timed in %s, to be in config.DBOperations", match[1], file)
+			}
+		}
+	}
+}
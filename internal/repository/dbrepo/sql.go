@@ -0,0 +1,2360 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/metrics"
+	"github.com/atuprosper/booking-project/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// timeout bounds ctx by how long the operation op, named after its method, may take. Cancelling it records how
+// long the operation took
+func (m *sqlDBRepo) timeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, m.App.DBTimeouts.For(op))
+	return ctx, func() {
+		cancel()
+		metrics.DBQueryDuration.WithLabelValues(op).Observe(time.Since(started).Seconds())
+	}
+}
+
+func (repo *sqlDBRepo) AllUsers(ctx context.Context) bool {
+	return true
+}
+
+// Inserts a reservation into the database
+func (repo *sqlDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	// Close this transaction if unable to run this statement within the timeout
+	ctx, cancel := repo.timeout(ctx, "InsertReservation")
+	defer cancel()
+
+	var newID int
+
+	insertStatement := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err := repo.conn(ctx).QueryRowContext(ctx, insertStatement, res.FirstName, res.LastName, res.Email, res.Phone, day(res.StartDate), day(res.EndDate), res.RoomID, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (repo *sqlDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	ctx, cancel := repo.timeout(ctx, "InsertRoomRestriction")
+	defer cancel()
+
+	insertStatement := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id) values($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := repo.conn(ctx).ExecContext(ctx, insertStatement, day(res.StartDate), day(res.EndDate), res.RoomID, res.ReservationID, time.Now(), time.Now(), res.RestrictionID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
+func (repo *sqlDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := repo.timeout(ctx, "SearchAvailabilityByDatesByRoomID")
+	defer cancel()
+
+	var numRows int
+
+	// Restrictions belonging to a trashed, cancelled or no-show reservation no longer hold the room
+	query := `
+		select
+			count(rr.id)
+		from
+			room_restrictions rr
+			left join reservations r on (rr.reservation_id = r.id)
+		where
+			rr.room_id = $1
+			and $2 <= rr.end_date and $3 >= rr.start_date
+			and r.deleted_at is null
+			and coalesce(r.status, '') not in ('cancelled', 'no-show');`
+
+	row := repo.conn(ctx).QueryRowContext(ctx, query, roomID, day(start), day(end))
+	err := row.Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	if numRows == 0 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
+func (repo *sqlDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := repo.timeout(ctx, "SearchAvailabilityForAllRooms")
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `
+		select
+			r.id, r.room_name
+		from
+			rooms r
+		where r.deleted_at is null and r.id not in 
+		(select rr.room_id from room_restrictions rr
+			left join reservations res on (rr.reservation_id = res.id)
+			where $1 <= rr.end_date and $2 >= rr.start_date and res.deleted_at is null
+			and coalesce(res.status, '') not in ('cancelled', 'no-show'));
+	`
+
+	rows, err := repo.conn(ctx).QueryContext(ctx, query, day(start), day(end))
+	if err != nil {
+		return rooms, err
+	}
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// Get all rooms
+func (m *sqlDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.timeout(ctx, "AllRooms")
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, price, image_src, description, created_at, updated_at from rooms
+		where deleted_at is null order by room_name`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.Price,
+			&room.ImageSource,
+			&room.Description,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetRoomByID gets a room by id
+func (repo *sqlDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := repo.timeout(ctx, "GetRoomByID")
+	defer cancel()
+
+	var room models.Room
+
+	query := `
+		select id, room_name, price, image_src, description, created_at, updated_at, deleted_at from rooms where id = $1
+	`
+
+	var deletedAt sql.NullTime
+
+	row := repo.conn(ctx).QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.Price,
+		&room.ImageSource,
+		&room.Description,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+		&deletedAt,
+	)
+
+	if err != nil {
+		return room, err
+	}
+
+	room.DeletedAt = deletedAt.Time
+
+	return room, nil
+}
+
+// UpdateRoom updates a room in the database
+func (m *sqlDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := m.timeout(ctx, "UpdateRoom")
+	defer cancel()
+
+	query := `
+		update rooms set room_name = $1, price = $2, image_src = $3, description = $4, updated_at = $5
+		where id = $6
+	`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query,
+		room.RoomName,
+		room.Price,
+		room.ImageSource,
+		room.Description,
+		time.Now(),
+		room.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Inserts a room into the database and returns its id
+func (repo *sqlDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	ctx, cancel := repo.timeout(ctx, "InsertRoom")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into rooms (room_name, price, image_src, description, created_at, updated_at) values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := repo.conn(ctx).QueryRowContext(ctx, query, room.RoomName, room.Price, room.ImageSource, room.Description, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteRoom moves a room to the trash
+func (m *sqlDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "DeleteRoom")
+	defer cancel()
+
+	query := `update rooms set deleted_at = $1 where id = $2 and deleted_at is null`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetUserByID returns a user by id
+func (repo *sqlDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := repo.timeout(ctx, "GetUserByID")
+	defer cancel()
+
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
+			from users where id = $1`
+
+	row := repo.conn(ctx).QueryRowContext(ctx, query, id)
+
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.AccessLevel,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail returns the user who logs in with email
+func (repo *sqlDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := repo.timeout(ctx, "GetUserByEmail")
+	defer cancel()
+
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
+			from users where email = $1`
+
+	row := repo.conn(ctx).QueryRowContext(ctx, query, email)
+
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.AccessLevel,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// InsertUser inserts a user, whose Password must already be a bcrypt hash, returning its id
+func (repo *sqlDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	ctx, cancel := repo.timeout(ctx, "InsertUser")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := repo.conn(ctx).QueryRowContext(ctx, query, user.FirstName, user.LastName, user.Email, user.Password,
+		user.AccessLevel, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateUser updates a user in the database
+func (repo *sqlDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	ctx, cancel := repo.timeout(ctx, "UpdateUser")
+	defer cancel()
+
+	query := `
+		update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
+		where id = $6
+	`
+
+	_, err := repo.conn(ctx).ExecContext(ctx, query,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.AccessLevel,
+		time.Now(),
+		user.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateUserPassword replaces a user's password with passwordHash, a bcrypt hash
+func (repo *sqlDBRepo) UpdateUserPassword(ctx context.Context, id int, passwordHash string) error {
+	ctx, cancel := repo.timeout(ctx, "UpdateUserPassword")
+	defer cancel()
+
+	query := `update users set password = $1, updated_at = $2 where id = $3`
+
+	_, err := repo.conn(ctx).ExecContext(ctx, query, passwordHash, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Authenticate authenticates a user
+func (repo *sqlDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := repo.timeout(ctx, "Authenticate")
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	row := repo.conn(ctx).QueryRowContext(ctx, "select id, password from users where email = $1", email)
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return id, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return id, hashedPassword, nil
+}
+
+// The columns a reservation list can be sorted by, keyed by models.ReservationSorts
+var reservationSortColumns = map[string]string{
+	"arrival":   "r.start_date",
+	"departure": "r.end_date",
+	"created":   "r.created_at",
+	"name":      "r.last_name",
+	"room":      "rm.room_name",
+}
+
+// Escapes the LIKE wildcards in a search so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchReservations returns one page of the reservations matching filter, and how many match in total
+func (m *sqlDBRepo) SearchReservations(ctx context.Context, filter models.ReservationFilter) (models.ReservationPage, error) {
+	ctx, cancel := m.timeout(ctx, "SearchReservations")
+	defer cancel()
+
+	page := models.ReservationPage{Filter: filter}
+
+	sortColumn, ok := reservationSortColumns[filter.Sort]
+	if !ok {
+		sortColumn = reservationSortColumns["arrival"]
+	}
+	direction := "asc"
+	if filter.Desc {
+		direction = "desc"
+	}
+
+	var start, end sql.NullTime
+	if !filter.Start.IsZero() {
+		start = sql.NullTime{Time: day(filter.Start), Valid: true}
+	}
+	if !filter.End.IsZero() {
+		end = sql.NullTime{Time: day(filter.End), Valid: true}
+	}
+
+	// Searches match the start of a field so they can use the lower(...) indexes, text_pattern_ops on Postgres
+	search := ""
+	if filter.Search != "" {
+		search = likeEscaper.Replace(strings.ToLower(strings.TrimSpace(filter.Search))) + "%"
+	}
+
+	query := fmt.Sprintf(`
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status,
+		rm.id, rm.room_name, count(*) over ()
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.deleted_at is null
+		and ($1 = '' or lower(r.first_name) like $1 escape '\' or lower(r.last_name) like $1 escape '\'
+			or lower(r.email) like $1 escape '\' or r.phone like $1 escape '\')
+		and (%s is null or r.end_date >= $2)
+		and (%s is null or r.start_date <= $3)
+		and ($4 = 0 or r.room_id = $4)
+		and ($5 = '' or r.status = $5)
+		order by %s %s, r.id %s
+		limit $6 offset $7
+	`, m.dialect.cast("$2", "date"), m.dialect.cast("$3", "date"), sortColumn, direction, direction)
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query,
+		search,
+		start,
+		end,
+		filter.RoomID,
+		filter.Status,
+		filter.PerPage,
+		filter.Offset(),
+	)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&page.Total,
+		)
+
+		if err != nil {
+			return page, err
+		}
+		page.Reservations = append(page.Reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+// GetReservationByID returns one reservation by ID
+func (m *sqlDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "GetReservationByID")
+	defer cancel()
+
+	var reservation models.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status,
+		r.confirmed_at, r.checked_in_at, r.checked_out_at, r.cancelled_at, r.no_show_at,
+		r.id_document, r.front_desk_notes, r.deleted_at, rm.id, rm.room_name, rm.price
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.id = $1
+	`
+
+	row := m.conn(ctx).QueryRowContext(ctx, query, id)
+
+	var confirmedAt, checkedInAt, checkedOutAt, cancelledAt, noShowAt, deletedAt sql.NullTime
+
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.FirstName,
+		&reservation.LastName,
+		&reservation.Email,
+		&reservation.Phone,
+		&reservation.StartDate,
+		&reservation.EndDate,
+		&reservation.RoomID,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+		&reservation.Status,
+		&confirmedAt,
+		&checkedInAt,
+		&checkedOutAt,
+		&cancelledAt,
+		&noShowAt,
+		&reservation.IDDocument,
+		&reservation.FrontDeskNotes,
+		&deletedAt,
+		&reservation.Room.ID,
+		&reservation.Room.RoomName,
+		&reservation.Room.Price,
+	)
+
+	if err != nil {
+		return reservation, err
+	}
+
+	reservation.DeletedAt = deletedAt.Time
+	reservation.ConfirmedAt = confirmedAt.Time
+	reservation.CheckedInAt = checkedInAt.Time
+	reservation.CheckedOutAt = checkedOutAt.Time
+	reservation.CancelledAt = cancelledAt.Time
+	reservation.NoShowAt = noShowAt.Time
+
+	return reservation, nil
+}
+
+// UpdateReservation updates a reservation in the database
+func (m *sqlDBRepo) UpdateReservation(ctx context.Context, user models.Reservation) error {
+	ctx, cancel := m.timeout(ctx, "UpdateReservation")
+	defer cancel()
+
+	query := `
+		update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
+		where id = $6
+	`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.Phone,
+		time.Now(),
+		user.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteReservation moves one reservation to the trash by id
+func (m *sqlDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "DeleteReservation")
+	defer cancel()
+
+	query := "update reservations set deleted_at = $1 where id = $2 and deleted_at is null"
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// The column recording when a reservation entered each status
+var statusTimestampColumns = map[models.ReservationStatus]string{
+	models.StatusConfirmed:  "confirmed_at",
+	models.StatusCheckedIn:  "checked_in_at",
+	models.StatusCheckedOut: "checked_out_at",
+	models.StatusCancelled:  "cancelled_at",
+	models.StatusNoShow:     "no_show_at",
+}
+
+// UpdateReservationStatus moves a reservation to a new status and records when it happened.
+// The move is rejected with models.ErrInvalidTransition unless the lifecycle allows it
+func (m *sqlDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	ctx, cancel := m.timeout(ctx, "UpdateReservationStatus")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.transitionReservation(ctx, tx, id, status, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BulkUpdateReservationStatus moves every reservation in ids to status in one transaction.
+// Reservations the lifecycle won't allow to move are skipped; any other error undoes the whole batch
+func (m *sqlDBRepo) BulkUpdateReservationStatus(ctx context.Context, ids []int, status models.ReservationStatus) (models.BulkResult, error) {
+	ctx, cancel := m.timeout(ctx, "BulkUpdateReservationStatus")
+	defer cancel()
+
+	var result models.BulkResult
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, id := range ids {
+		err = m.transitionReservation(ctx, tx, id, status, now)
+		switch {
+		case errors.Is(err, models.ErrInvalidTransition):
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: "not found"})
+		case err != nil:
+			return models.BulkResult{}, err
+		default:
+			result.Succeeded = append(result.Succeeded, id)
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// BulkDeleteReservations moves every reservation in ids to the trash in one transaction
+func (m *sqlDBRepo) BulkDeleteReservations(ctx context.Context, ids []int) (models.BulkResult, error) {
+	ctx, cancel := m.timeout(ctx, "BulkDeleteReservations")
+	defer cancel()
+
+	var result models.BulkResult
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	query := "update reservations set deleted_at = $1 where id = $2 and deleted_at is null"
+
+	now := time.Now()
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, query, now, id)
+		if err != nil {
+			return models.BulkResult{}, err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return models.BulkResult{}, err
+		}
+
+		if affected == 0 {
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: "not found or already deleted"})
+		} else {
+			result.Succeeded = append(result.Succeeded, id)
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// ImportReservations inserts reservations and a room restriction for each stay in one transaction, returning their ids.
+// A stay that clashes with a booking already holding its room fails the whole import with models.ErrRoomUnavailable
+func (m *sqlDBRepo) ImportReservations(ctx context.Context, reservations []models.Reservation) ([]int, error) {
+	ctx, cancel := m.timeout(ctx, "ImportReservations")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var ids []int
+
+	for _, res := range reservations {
+		// Checked in the transaction as the rows written so far, and any booking made since the preview, now hold rooms too
+		id, err := m.insertStay(ctx, tx, res, now)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, tx.Commit()
+}
+
+// InsertBooking inserts a pending reservation and the room restriction holding its room, in one transaction with the
+// check that the room is free, returning the reservation id. models.ErrRoomUnavailable is returned if it isn't.
+// It is created at res.CreatedAt, or now if that is zero
+func (m *sqlDBRepo) InsertBooking(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := m.timeout(ctx, "InsertBooking")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res.Status = models.StatusPending
+
+	id, err := m.insertStay(ctx, tx, res, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// insertStay writes res with its status and a room restriction in tx, refusing it if it would hold a room that is already
+// held. It is created at now unless it says otherwise
+func (m *sqlDBRepo) insertStay(ctx context.Context, tx *txn, res models.Reservation, now time.Time) (int, error) {
+	insert := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, status, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	restriction := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+
+	err := m.lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	if res.Status.HoldsRoom() {
+		err = m.roomFree(ctx, tx, res.RoomID, res.StartDate, res.EndDate)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	createdAt := res.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, insert, res.FirstName, res.LastName, res.Email, res.Phone, day(res.StartDate), day(res.EndDate),
+		res.RoomID, res.Status, createdAt, now).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if column, ok := statusTimestampColumns[res.Status]; ok {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("update reservations set %s = $1 where id = $2", column), createdAt, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, restriction, day(res.StartDate), day(res.EndDate), res.RoomID, id, 1, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// lockRoom locks room roomID until tx ends. Bookings and restores of the same room wait for each other here,
+// so two can't both find it free
+func (m *sqlDBRepo) lockRoom(ctx context.Context, tx *txn, roomID int) error {
+	_, err := tx.ExecContext(ctx, "select id from rooms where id = $1"+m.dialect.forUpdate, roomID)
+	return err
+}
+
+// roomFree returns models.ErrRoomUnavailable if a reservation in the database holds room roomID for any of start to end
+func (m *sqlDBRepo) roomFree(ctx context.Context, tx *txn, roomID int, start, end time.Time) error {
+	query := `
+		select
+			count(rr.id)
+		from
+			room_restrictions rr
+			left join reservations r on (rr.reservation_id = r.id)
+		where
+			rr.room_id = $1
+			and $2 <= rr.end_date and $3 >= rr.start_date
+			and r.deleted_at is null
+			and coalesce(r.status, '') not in ('cancelled', 'no-show')`
+
+	var clashes int
+	err := tx.QueryRowContext(ctx, query, roomID, day(start), day(end)).Scan(&clashes)
+	if err != nil {
+		return err
+	}
+
+	if clashes > 0 {
+		return fmt.Errorf("%w: room %d from %s to %s", models.ErrRoomUnavailable, roomID,
+			start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+
+	return nil
+}
+
+// ImportRooms inserts rooms in one transaction, returning their ids
+func (m *sqlDBRepo) ImportRooms(ctx context.Context, rooms []models.Room) ([]int, error) {
+	ctx, cancel := m.timeout(ctx, "ImportRooms")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into rooms (room_name, price, image_src, description, created_at, updated_at) values ($1, $2, $3, $4, $5, $6) returning id`
+
+	now := time.Now()
+	var ids []int
+
+	for _, room := range rooms {
+		var id int
+		err = tx.QueryRowContext(ctx, query, room.RoomName, room.Price, room.ImageSource, room.Description, now, now).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, tx.Commit()
+}
+
+// CheckInReservation moves a reservation to checked-in, recording when the guest actually arrived
+// and the ID and notes taken at the desk. A pending reservation is confirmed first, in the same transaction
+func (m *sqlDBRepo) CheckInReservation(ctx context.Context, id int, arrivedAt time.Time, idDocument, notes string) error {
+	ctx, cancel := m.timeout(ctx, "CheckInReservation")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.confirmAtDesk(ctx, tx, id, arrivedAt)
+	if err != nil {
+		return err
+	}
+
+	err = m.transitionReservation(ctx, tx, id, models.StatusCheckedIn, arrivedAt)
+	if err != nil {
+		return err
+	}
+
+	query := "update reservations set id_document = $1, front_desk_notes = $2 where id = $3"
+
+	_, err = tx.ExecContext(ctx, query, idDocument, notes, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkNoShow moves a reservation whose guest never arrived to no-show. A pending reservation is confirmed first,
+// in the same transaction
+func (m *sqlDBRepo) MarkNoShow(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "MarkNoShow")
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	err = m.confirmAtDesk(ctx, tx, id, now)
+	if err != nil {
+		return err
+	}
+
+	err = m.transitionReservation(ctx, tx, id, models.StatusNoShow, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// confirmAtDesk confirms the reservation with id inside tx if it is still pending. The lifecycle only lets confirmed
+// guests check in or be marked as no-shows, but the front desk deals with whoever is booked for the day
+func (m *sqlDBRepo) confirmAtDesk(ctx context.Context, tx *txn, id int, at time.Time) error {
+	var current models.ReservationStatus
+	err := tx.QueryRowContext(ctx, "select status from reservations where id = $1"+m.dialect.forUpdate, id).Scan(&current)
+	if err != nil || current != models.StatusPending {
+		return err
+	}
+
+	return m.transitionReservation(ctx, tx, id, models.StatusConfirmed, at)
+}
+
+// transitionReservation moves a reservation to status inside tx, stamping the status column with at
+func (m *sqlDBRepo) transitionReservation(ctx context.Context, tx *txn, id int, status models.ReservationStatus, at time.Time) error {
+	// Lock the row so two staff members can't move the same reservation at once
+	var current models.ReservationStatus
+	err := tx.QueryRowContext(ctx, "select status from reservations where id = $1"+m.dialect.forUpdate, id).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	err = current.Transition(status)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("update reservations set status = $1, %s = $2, updated_at = $3 where id = $4", statusTimestampColumns[status])
+
+	_, err = tx.ExecContext(ctx, query, status, at, time.Now(), id)
+	return err
+}
+
+// ReservationsArrivingOn returns the reservations due to arrive on date that have not checked in yet
+func (m *sqlDBRepo) ReservationsArrivingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "ReservationsArrivingOn")
+	defer cancel()
+
+	query := frontDeskSelect + `
+		where r.deleted_at is null and r.start_date = $1
+		and r.status in ('pending', 'confirmed')
+		order by r.last_name asc
+	`
+
+	return m.queryFrontDesk(ctx, query, day(date))
+}
+
+// ReservationsInHouse returns the reservations whose guests are checked in right now
+func (m *sqlDBRepo) ReservationsInHouse(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "ReservationsInHouse")
+	defer cancel()
+
+	query := frontDeskSelect + `
+		where r.deleted_at is null and r.status = 'checked-in'
+		order by r.end_date asc, r.last_name asc
+	`
+
+	return m.queryFrontDesk(ctx, query)
+}
+
+// ReservationsDepartingOn returns the checked in reservations due to leave on date
+func (m *sqlDBRepo) ReservationsDepartingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "ReservationsDepartingOn")
+	defer cancel()
+
+	query := frontDeskSelect + `
+		where r.deleted_at is null and r.end_date = $1
+		and r.status = 'checked-in'
+		order by r.last_name asc
+	`
+
+	return m.queryFrontDesk(ctx, query, day(date))
+}
+
+// ReservationsNotArrivedBy returns the reservations due on or before date whose guests never checked in
+func (m *sqlDBRepo) ReservationsNotArrivedBy(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "ReservationsNotArrivedBy")
+	defer cancel()
+
+	query := frontDeskSelect + `
+		where r.deleted_at is null and r.start_date <= $1
+		and r.status in ('pending', 'confirmed')
+		order by r.start_date asc, r.last_name asc
+	`
+
+	return m.queryFrontDesk(ctx, query, day(date))
+}
+
+// The columns the front desk pages show, shared by the queries that feed them
+const frontDeskSelect = `
+	select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.status, r.checked_in_at, r.id_document, r.front_desk_notes,
+	rm.id, rm.room_name
+	from reservations r
+	left join rooms rm on (r.room_id = rm.id)
+`
+
+// queryFrontDesk runs a query selecting frontDeskSelect and scans the rows into reservations
+func (m *sqlDBRepo) queryFrontDesk(ctx context.Context, query string, args ...interface{}) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var checkedInAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Status,
+			&checkedInAt,
+			&i.IDDocument,
+			&i.FrontDeskNotes,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+		i.CheckedInAt = checkedInAt.Time
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetRestrictionsForCurrentRoom returns restrictions for a room by date range
+func (m *sqlDBRepo) GetRestrictionsForCurrentRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.timeout(ctx, "GetRestrictionsForCurrentRoom")
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+		coalesce(r.status, '')
+		from room_restrictions rr
+		left join reservations r on (rr.reservation_id = r.id)
+		where $1 < rr.end_date and $2 >= rr.start_date
+		and rr.room_id = $3 and r.deleted_at is null
+		and coalesce(r.status, '') not in ('cancelled', 'no-show')
+`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, day(start), day(end), roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.Reservation.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a room restriction
+func (m *sqlDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := m.timeout(ctx, "InsertBlockForRoom")
+	defer cancel()
+
+	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+		created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, day(startDate), day(startDate), id, 2, time.Now(), time.Now())
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteBlockByID deletes a room restriction
+func (m *sqlDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "DeleteBlockByID")
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// InsertTodoList inserts a new todo list into the database and returns its id
+func (repo *sqlDBRepo) InsertTodoList(ctx context.Context, todo models.TodoList) (int, error) {
+	ctx, cancel := repo.timeout(ctx, "InsertTodoList")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into todo_list (todo, user_id, created_at, updated_at) values($1, $2, $3, $4) returning id`
+
+	err := repo.conn(ctx).QueryRowContext(ctx, query, todo.Todo, todo.UserID, time.Now(), time.Now()).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetTodoListByUserID gets all todo for a user by user_id
+func (m *sqlDBRepo) GetTodoListByUserID(ctx context.Context, id int) ([]models.TodoList, error) {
+	ctx, cancel := m.timeout(ctx, "GetTodoListByUserID")
+	defer cancel()
+
+	var todoList []models.TodoList
+
+	query := `
+		select id, todo, user_id, created_at, updated_at from todo_list where user_id = $1 
+		order by created_at asc
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, id)
+	if err != nil {
+		return todoList, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.TodoList
+		err := rows.Scan(
+			&i.ID,
+			&i.Todo,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		)
+
+		if err != nil {
+			return todoList, err
+		}
+		todoList = append(todoList, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return todoList, err
+	}
+
+	return todoList, nil
+}
+
+// DeleteTodo deletes a todo
+func (m *sqlDBRepo) DeleteTodo(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "DeleteTodo")
+	defer cancel()
+
+	query := `delete from todo_list where id = $1`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// InsertAuditLog records an admin change in the audit log
+func (m *sqlDBRepo) InsertAuditLog(ctx context.Context, entry models.AuditLog) error {
+	ctx, cancel := m.timeout(ctx, "InsertAuditLog")
+	defer cancel()
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into audit_logs (user_id, action, entity, entity_id, changes, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = m.conn(ctx).ExecContext(ctx, query,
+		entry.UserID,
+		entry.Action,
+		entry.Entity,
+		entry.EntityID,
+		string(changes),
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// OccupancyForRange totals the room nights sold and their revenue for stays between start and end.
+// Reservations that overlap the range only count the nights inside it
+func (m *sqlDBRepo) OccupancyForRange(ctx context.Context, start, end time.Time) (models.OccupancyStats, error) {
+	ctx, cancel := m.timeout(ctx, "OccupancyForRange")
+	defer cancel()
+
+	return m.occupancy(ctx, start, end, "")
+}
+
+// PickupForRange totals the room nights and revenue for stays between start and end, like OccupancyForRange,
+// counting only the reservations booked between bookedStart and bookedEnd
+func (m *sqlDBRepo) PickupForRange(ctx context.Context, start, end, bookedStart, bookedEnd time.Time) (models.OccupancyStats, error) {
+	ctx, cancel := m.timeout(ctx, "PickupForRange")
+	defer cancel()
+
+	return m.occupancy(ctx, start, end, "and r.created_at >= $3 and r.created_at < $4", bookedStart, bookedEnd)
+}
+
+// occupancy totals the room nights and revenue for stays between start and end, of the reservations that also
+// match the condition booked, whose parameters follow start and end in args
+func (m *sqlDBRepo) occupancy(ctx context.Context, start, end time.Time, booked string, args ...interface{}) (models.OccupancyStats, error) {
+	stats := models.OccupancyStats{
+		Start: start,
+		End:   end,
+	}
+
+	err := m.conn(ctx).QueryRowContext(ctx, "select count(*) from rooms where deleted_at is null").Scan(&stats.Rooms)
+	if err != nil {
+		return stats, err
+	}
+
+	// Date arithmetic and cleaning up the free text prices differ between the databases, so the nights and revenue are added up here
+	query := `
+		select r.start_date, r.end_date, coalesce(rm.price, '')
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.deleted_at is null
+		and r.status not in ('cancelled', 'no-show')
+		and r.start_date < $2 and r.end_date > $1
+	` + booked
+
+	start, end = day(start), day(end)
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, append([]interface{}{start, end}, args...)...)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stayStart, stayEnd time.Time
+		var room models.Room
+		err := rows.Scan(&stayStart, &stayEnd, &room.Price)
+		if err != nil {
+			return stats, err
+		}
+
+		// Only the nights inside the range count
+		if stayStart.Before(start) {
+			stayStart = start
+		}
+		if stayEnd.After(end) {
+			stayEnd = end
+		}
+
+		nights := nightsBetween(stayStart, stayEnd)
+		stats.RoomNightsSold += nights
+		stats.Revenue += float64(nights) * room.PriceValue()
+	}
+
+	if err = rows.Err(); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// CountReservationsCreatedBetween returns how many reservations were booked between start and end
+func (m *sqlDBRepo) CountReservationsCreatedBetween(ctx context.Context, start, end time.Time) (int, error) {
+	ctx, cancel := m.timeout(ctx, "CountReservationsCreatedBetween")
+	defer cancel()
+
+	var count int
+
+	query := `
+		select count(*) from reservations
+		where deleted_at is null and created_at >= $1 and created_at < $2
+	`
+
+	err := m.conn(ctx).QueryRowContext(ctx, query, start, end).Scan(&count)
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// CountReservationsByStatus returns how many reservations are in status
+func (m *sqlDBRepo) CountReservationsByStatus(ctx context.Context, status models.ReservationStatus) (int, error) {
+	ctx, cancel := m.timeout(ctx, "CountReservationsByStatus")
+	defer cancel()
+
+	var count int
+
+	query := "select count(*) from reservations where deleted_at is null and status = $1"
+
+	err := m.conn(ctx).QueryRowContext(ctx, query, status).Scan(&count)
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// The filter and order of each report, over reservations r joined to rooms rm
+var reportClauses = map[models.ReportKind]string{
+	models.ReportByStayDate: `r.start_date < $2 and r.end_date > $1
+		and r.status not in ('cancelled', 'no-show')
+		order by r.start_date asc, r.id asc`,
+	models.ReportByBookingDate: `r.created_at >= $1 and r.created_at < $2
+		order by r.created_at asc`,
+	models.ReportByRoom: `r.start_date < $2 and r.end_date > $1
+		and r.status not in ('cancelled', 'no-show')
+		order by rm.room_name asc, r.start_date asc`,
+	models.ReportCancellations: `r.status = 'cancelled' and r.cancelled_at >= $1 and r.cancelled_at < $2
+		order by r.cancelled_at asc`,
+	models.ReportNoShows: `r.status = 'no-show' and r.start_date >= $1 and r.start_date < $2
+		order by r.start_date asc`,
+}
+
+// EachReportReservation calls fn with every reservation in a report, one row at a time,
+// so an export can be written out without loading the whole report. It stops at the first error fn returns
+func (m *sqlDBRepo) EachReportReservation(ctx context.Context, query models.ReportQuery, fn func(models.Reservation) error) error {
+	ctx, cancel := m.timeout(ctx, "EachReportReservation")
+	defer cancel()
+
+	clause, ok := reportClauses[query.Kind]
+	if !ok {
+		return fmt.Errorf("unknown report %q", query.Kind)
+	}
+
+	sqlQuery := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status,
+		r.cancelled_at, r.no_show_at,
+		coalesce(rm.id, 0), coalesce(rm.room_name, ''), coalesce(rm.price, '')
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.deleted_at is null and ` + clause
+
+	// The stay date reports compare with date columns, so they are sent the days
+	start, end := query.Start, query.End
+	if query.Kind != models.ReportByBookingDate && query.Kind != models.ReportCancellations {
+		start, end = day(start), day(end)
+	}
+
+	rows, err := m.conn(ctx).QueryContext(ctx, sqlQuery, start, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var cancelledAt, noShowAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&cancelledAt,
+			&noShowAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&i.Room.Price,
+		)
+		if err != nil {
+			return err
+		}
+		i.CancelledAt = cancelledAt.Time
+		i.NoShowAt = noShowAt.Time
+
+		if err = fn(i); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// InsertReservationNote adds an internal note to a reservation
+func (m *sqlDBRepo) InsertReservationNote(ctx context.Context, note models.ReservationNote) error {
+	ctx, cancel := m.timeout(ctx, "InsertReservationNote")
+	defer cancel()
+
+	query := `insert into reservation_notes (reservation_id, user_id, note, created_at, updated_at)
+		values ($1, $2, $3, $4, $5)`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query,
+		note.ReservationID,
+		note.UserID,
+		note.Note,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetNotesForReservation returns the internal notes on a reservation, newest first
+func (m *sqlDBRepo) GetNotesForReservation(ctx context.Context, reservationID int) ([]models.ReservationNote, error) {
+	ctx, cancel := m.timeout(ctx, "GetNotesForReservation")
+	defer cancel()
+
+	var notes []models.ReservationNote
+
+	query := `
+		select n.id, n.reservation_id, n.user_id, n.note, n.created_at, n.updated_at,
+		coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, '')
+		from reservation_notes n
+		left join users u on (n.user_id = u.id)
+		where n.reservation_id = $1
+		order by n.created_at desc
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return notes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.ReservationNote
+		err := rows.Scan(
+			&i.ID,
+			&i.ReservationID,
+			&i.UserID,
+			&i.Note,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.User.FirstName,
+			&i.User.LastName,
+			&i.User.Email,
+		)
+		if err != nil {
+			return notes, err
+		}
+		i.User.ID = i.UserID
+
+		notes = append(notes, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return notes, err
+	}
+
+	return notes, nil
+}
+
+// InsertMailLog records an email handed to the mail server
+func (m *sqlDBRepo) InsertMailLog(ctx context.Context, entry models.MailLog) error {
+	ctx, cancel := m.timeout(ctx, "InsertMailLog")
+	defer cancel()
+
+	query := `insert into mail_logs (reservation_id, mail_to, mail_from, subject, content, status, error, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query,
+		entry.ReservationID,
+		entry.To,
+		entry.From,
+		entry.Subject,
+		entry.Content,
+		entry.Status,
+		entry.Error,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMailLogsForReservation returns the emails sent about a reservation, newest first
+func (m *sqlDBRepo) GetMailLogsForReservation(ctx context.Context, reservationID int) ([]models.MailLog, error) {
+	ctx, cancel := m.timeout(ctx, "GetMailLogsForReservation")
+	defer cancel()
+
+	var logs []models.MailLog
+
+	query := `
+		select id, reservation_id, mail_to, mail_from, subject, content, status, error, created_at, updated_at
+		from mail_logs
+		where reservation_id = $1
+		order by created_at desc
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return logs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.MailLog
+		err := rows.Scan(
+			&i.ID,
+			&i.ReservationID,
+			&i.To,
+			&i.From,
+			&i.Subject,
+			&i.Content,
+			&i.Status,
+			&i.Error,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		)
+		if err != nil {
+			return logs, err
+		}
+
+		logs = append(logs, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+
+	return logs, nil
+}
+
+// SearchAuditLogs returns audit log entries, newest first, matching the search text and entity.
+// Empty arguments match everything
+func (m *sqlDBRepo) SearchAuditLogs(ctx context.Context, search, entity string) ([]models.AuditLog, error) {
+	ctx, cancel := m.timeout(ctx, "SearchAuditLogs")
+	defer cancel()
+
+	query := `
+		select a.id, a.user_id, a.action, a.entity, a.entity_id, a.changes, a.created_at, a.updated_at,
+		coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, '')
+		from audit_logs a
+		left join users u on (a.user_id = u.id)
+		where ($1 = '' or a.entity = $1)
+		and ($2 = '' or a.action %[1]s '%%' || $2 || '%%' or a.changes %[1]s '%%' || $2 || '%%'
+			or u.email %[1]s '%%' || $2 || '%%' or cast(a.entity_id as text) = $2)
+		order by a.created_at desc
+		limit 500
+	`
+	query = fmt.Sprintf(query, m.dialect.ilike)
+
+	return m.queryAuditLogs(ctx, query, entity, search)
+}
+
+// GetAuditLogsForEntity returns the history of a single record, newest first
+func (m *sqlDBRepo) GetAuditLogsForEntity(ctx context.Context, entity string, entityID int) ([]models.AuditLog, error) {
+	ctx, cancel := m.timeout(ctx, "GetAuditLogsForEntity")
+	defer cancel()
+
+	query := `
+		select a.id, a.user_id, a.action, a.entity, a.entity_id, a.changes, a.created_at, a.updated_at,
+		coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, '')
+		from audit_logs a
+		left join users u on (a.user_id = u.id)
+		where a.entity = $1 and a.entity_id = $2
+		order by a.created_at desc
+	`
+
+	return m.queryAuditLogs(ctx, query, entity, entityID)
+}
+
+// queryAuditLogs runs an audit log select and scans the rows
+func (m *sqlDBRepo) queryAuditLogs(ctx context.Context, query string, args ...interface{}) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return logs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.AuditLog
+		var changes string
+		err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Action,
+			&i.Entity,
+			&i.EntityID,
+			&changes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.User.FirstName,
+			&i.User.LastName,
+			&i.User.Email,
+		)
+		if err != nil {
+			return logs, err
+		}
+
+		if err = json.Unmarshal([]byte(changes), &i.Changes); err != nil {
+			return logs, err
+		}
+		i.User.ID = i.UserID
+
+		logs = append(logs, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+
+	return logs, nil
+}
+
+// DeletedReservations returns the reservations in the trash, most recently deleted first
+func (m *sqlDBRepo) DeletedReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.timeout(ctx, "DeletedReservations")
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status, r.deleted_at,
+		rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.deleted_at is not null
+		order by r.deleted_at desc
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.DeletedAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// RestoreReservation takes a reservation out of the trash, in one transaction with checking that no other
+// reservation has taken its room for its dates meanwhile. It returns models.ErrRoomUnavailable if one has
+func (m *sqlDBRepo) RestoreReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "RestoreReservation")
+	defer cancel()
+
+	stay := "select room_id, start_date, end_date, status from reservations where id = $1 and deleted_at is not null"
+	query := "update reservations set deleted_at = null, updated_at = $1 where id = $2"
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var res models.Reservation
+	err = tx.QueryRowContext(ctx, stay, id).Scan(&res.RoomID, &res.StartDate, &res.EndDate, &res.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	if res.Status.HoldsRoom() {
+		err = m.roomFree(ctx, tx, res.RoomID, res.StartDate, res.EndDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedReservations permanently deletes reservations trashed before the given time
+// and returns how many were removed. Their room restrictions go with them through the foreign key
+func (m *sqlDBRepo) PurgeDeletedReservations(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := m.timeout(ctx, "PurgeDeletedReservations")
+	defer cancel()
+
+	query := "delete from reservations where deleted_at is not null and deleted_at < $1"
+
+	result, err := m.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
+
+// DeletedRooms returns the rooms in the trash, most recently deleted first
+func (m *sqlDBRepo) DeletedRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.timeout(ctx, "DeletedRooms")
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, price, image_src, description, created_at, updated_at, deleted_at from rooms
+		where deleted_at is not null order by deleted_at desc`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.Price,
+			&room.ImageSource,
+			&room.Description,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.DeletedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// RestoreRoom takes a room out of the trash
+func (m *sqlDBRepo) RestoreRoom(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "RestoreRoom")
+	defer cancel()
+
+	query := "update rooms set deleted_at = null, updated_at = $1 where id = $2"
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeDeletedRooms permanently deletes rooms trashed before the given time and returns how many were removed.
+// Rooms that still have reservations, trashed or not, are kept, as deleting them would take the reservations with them
+func (m *sqlDBRepo) PurgeDeletedRooms(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := m.timeout(ctx, "PurgeDeletedRooms")
+	defer cancel()
+
+	query := `delete from rooms where deleted_at is not null and deleted_at < $1
+		and not exists (select 1 from reservations where room_id = rooms.id)`
+
+	result, err := m.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
+
+// InsertAPIKey stores a new API key and returns its id
+func (m *sqlDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := m.timeout(ctx, "InsertAPIKey")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into api_keys (name, prefix, key_hash, scope, rate_limit, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.conn(ctx).QueryRowContext(ctx, query,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		key.Scope,
+		key.RateLimit,
+		key.UserID,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// AllAPIKeys returns every API key, revoked ones included, newest first
+func (m *sqlDBRepo) AllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := m.timeout(ctx, "AllAPIKeys")
+	defer cancel()
+
+	var keys []models.APIKey
+
+	query := `select id, name, prefix, key_hash, scope, rate_limit, user_id, last_used_at, revoked_at, created_at, updated_at
+		from api_keys order by created_at desc`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix, revoked or not
+func (m *sqlDBRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	ctx, cancel := m.timeout(ctx, "GetAPIKeyByPrefix")
+	defer cancel()
+
+	query := `select id, name, prefix, key_hash, scope, rate_limit, user_id, last_used_at, revoked_at, created_at, updated_at
+		from api_keys where prefix = $1`
+
+	return scanAPIKey(m.conn(ctx).QueryRowContext(ctx, query, prefix))
+}
+
+// RevokeAPIKey stops an API key from being used. It returns sql.ErrNoRows if there is no such key, or it is already revoked
+func (m *sqlDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "RevokeAPIKey")
+	defer cancel()
+
+	query := `update api_keys set revoked_at = $1, updated_at = $1 where id = $2 and revoked_at is null`
+
+	result, err := m.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if revoked == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (m *sqlDBRepo) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := m.timeout(ctx, "TouchAPIKey")
+	defer cancel()
+
+	query := `update api_keys set last_used_at = $1 where id = $2`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, at, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// scanAPIKey reads an API key from a row selected with the columns of AllAPIKeys
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&key.Scope,
+		&key.RateLimit,
+		&key.UserID,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		return key, err
+	}
+
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return key, nil
+}
+
+// InsertWebhook stores a new webhook and returns its id
+func (m *sqlDBRepo) InsertWebhook(ctx context.Context, hook models.Webhook) (int, error) {
+	ctx, cancel := m.timeout(ctx, "InsertWebhook")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into webhooks (url, description, secret, events, active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.conn(ctx).QueryRowContext(ctx, query,
+		hook.URL,
+		hook.Description,
+		hook.Secret,
+		strings.Join(hook.Events, ","),
+		hook.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// AllWebhooks returns every webhook, oldest first
+func (m *sqlDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := m.timeout(ctx, "AllWebhooks")
+	defer cancel()
+
+	query := `select id, url, description, secret, events, active, created_at, updated_at
+		from webhooks order by id`
+
+	return m.queryWebhooks(ctx, query)
+}
+
+// GetWebhookByID returns a webhook by id
+func (m *sqlDBRepo) GetWebhookByID(ctx context.Context, id int) (models.Webhook, error) {
+	ctx, cancel := m.timeout(ctx, "GetWebhookByID")
+	defer cancel()
+
+	query := `select id, url, description, secret, events, active, created_at, updated_at
+		from webhooks where id = $1`
+
+	return scanWebhook(m.conn(ctx).QueryRowContext(ctx, query, id))
+}
+
+// SetWebhookActive turns sending to a webhook on or off
+func (m *sqlDBRepo) SetWebhookActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := m.timeout(ctx, "SetWebhookActive")
+	defer cancel()
+
+	query := `update webhooks set active = $1, updated_at = $2 where id = $3`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook, and its delivery log with it
+func (m *sqlDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	ctx, cancel := m.timeout(ctx, "DeleteWebhook")
+	defer cancel()
+
+	_, err := m.conn(ctx).ExecContext(ctx, "delete from webhooks where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WebhooksForEvent returns the active webhooks subscribed to event
+func (m *sqlDBRepo) WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error) {
+	ctx, cancel := m.timeout(ctx, "WebhooksForEvent")
+	defer cancel()
+
+	// Events are stored comma separated, so wrap them in commas to match whole names only
+	query := `select id, url, description, secret, events, active, created_at, updated_at
+		from webhooks where active and ',' || events || ',' like '%,' || $1 || ',%'`
+
+	return m.queryWebhooks(ctx, query, event)
+}
+
+// InsertWebhookDelivery queues a delivery and returns its id
+func (m *sqlDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := m.timeout(ctx, "InsertWebhookDelivery")
+	defer cancel()
+
+	var newID int
+
+	query := `insert into webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.conn(ctx).QueryRowContext(ctx, query,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.Status,
+		delivery.NextAttemptAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries due by now, with their webhooks, oldest first.
+// Deliveries to inactive webhooks wait until they are turned back on
+func (m *sqlDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := m.timeout(ctx, "DueWebhookDeliveries")
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	query := `
+		select d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_status, d.error,
+		d.next_attempt_at, d.delivered_at, d.created_at, d.updated_at, w.url, w.secret
+		from webhook_deliveries d
+		left join webhooks w on (w.id = d.webhook_id)
+		where d.status = $1 and d.next_attempt_at <= $2 and w.active
+		order by d.next_attempt_at, d.id
+		limit $3
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, models.DeliveryPending, now, limit)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+
+		err = rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseStatus,
+			&d.Error,
+			&d.NextAttemptAt,
+			&deliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Webhook.URL,
+			&d.Webhook.Secret,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+
+		d.DeliveredAt = deliveredAt.Time
+		d.Webhook.ID = d.WebhookID
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt at a delivery
+func (m *sqlDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	ctx, cancel := m.timeout(ctx, "UpdateWebhookDelivery")
+	defer cancel()
+
+	var deliveredAt sql.NullTime
+	if !delivery.DeliveredAt.IsZero() {
+		deliveredAt = sql.NullTime{Time: delivery.DeliveredAt, Valid: true}
+	}
+
+	query := `update webhook_deliveries set status = $1, attempts = $2, response_status = $3, error = $4,
+		next_attempt_at = $5, delivered_at = $6, updated_at = $7
+		where id = $8`
+
+	_, err := m.conn(ctx).ExecContext(ctx, query,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		deliveredAt,
+		time.Now(),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries to a webhook, newest first
+func (m *sqlDBRepo) GetWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := m.timeout(ctx, "GetWebhookDeliveries")
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	query := `
+		select id, webhook_id, event, payload, status, attempts, response_status, error,
+		next_attempt_at, delivered_at, created_at, updated_at
+		from webhook_deliveries
+		where webhook_id = $1
+		order by created_at desc, id desc
+		limit $2
+	`
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+
+		err = rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseStatus,
+			&d.Error,
+			&d.NextAttemptAt,
+			&deliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+
+		d.DeliveredAt = deliveredAt.Time
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery queues a delivery to a webhook to be sent again straight away, whatever happened to it before.
+// It returns sql.ErrNoRows if the webhook has no such delivery
+func (m *sqlDBRepo) RetryWebhookDelivery(ctx context.Context, webhookID, id int) error {
+	ctx, cancel := m.timeout(ctx, "RetryWebhookDelivery")
+	defer cancel()
+
+	query := `update webhook_deliveries set status = $1, next_attempt_at = $2, updated_at = $2
+		where id = $3 and webhook_id = $4`
+
+	result, err := m.conn(ctx).ExecContext(ctx, query, models.DeliveryPending, time.Now(), id, webhookID)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// queryWebhooks returns the webhooks selected by query, which must select the columns of AllWebhooks
+func (m *sqlDBRepo) queryWebhooks(ctx context.Context, query string, args ...interface{}) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+
+	rows, err := m.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return hooks, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// scanWebhook reads a webhook from a row selected with the columns of AllWebhooks
+func scanWebhook(row interface{ Scan(...interface{}) error }) (models.Webhook, error) {
+	var hook models.Webhook
+	var events string
+
+	err := row.Scan(
+		&hook.ID,
+		&hook.URL,
+		&hook.Description,
+		&hook.Secret,
+		&events,
+		&hook.Active,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err != nil {
+		return hook, err
+	}
+
+	if events != "" {
+		hook.Events = strings.Split(events, ",")
+	}
+
+	return hook, nil
+}
@@ -1,18 +1,26 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/atuprosper/booking-project/internal/api"
 	"github.com/atuprosper/booking-project/internal/models"
 )
 
-func (repo *testDBRepo) AllUsers() bool {
+func (repo *testDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
+// WithTx runs fn, as the test repo keeps nothing to roll back
+func (repo *testDBRepo) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
 // Inserts a reservation into the database
-func (repo *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (repo *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 	// Fail test if the room_id == 2
 	if res.RoomID == 2 {
 		return 0, errors.New("failed to insert reservation")
@@ -21,133 +29,496 @@ func (repo *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
 }
 
 // InsertRoomRestriction inserts a room restriction into the database
-func (repo *testDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
+func (repo *testDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
 	return nil
 }
 
+// InsertBooking inserts a pending reservation and its room restriction if the room is free
+func (repo *testDBRepo) InsertBooking(ctx context.Context, res models.Reservation) (int, error) {
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, res.StartDate, res.EndDate, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		return 0, models.ErrRoomUnavailable
+	}
+	return repo.InsertReservation(ctx, res)
+}
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (repo *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (repo *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	// Rooms are free in 2040, the query fails in 2060 and every other date is booked
+	switch start.Year() {
+	case 2040:
+		return true, nil
+	case 2060:
+		return false, errors.New("failed to query availability")
+	}
 	return false, nil
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (repo *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (repo *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 	var rooms []models.Room
 
 	return rooms, nil
 }
 
 // GetRoomByID gets a room by id
-func (repo *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (repo *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
 
+	// Only rooms 1 and 2 exist
+	if id > 2 {
+		return room, sql.ErrNoRows
+	}
+	room.ID = id
+
 	return room, nil
 }
 
 // GetUserByID returns a user by id
-func (repo *testDBRepo) GetUserByID(id int) (models.User, error) {
+func (repo *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
 	var user models.User
 
 	return user, nil
 }
 
-// UpdateUser updates a user in the database
-func (repo *testDBRepo) UpdateUser(user models.User) error {
-	return nil
+// GetUserByEmail returns the user who logs in with email
+func (repo *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+
+	return user, nil
 }
 
-// Authenticate authenticates a user
-func (repo *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	return 1, "", nil
+// InsertUser inserts a user, returning its id
+func (repo *testDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	return 1, nil
 }
 
-// AllReservations returns a slice of all reservations
-func (repo *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
+// UpdateUser updates a user in the database
+func (repo *testDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	return nil
+}
 
-	return reservations, nil
+// UpdateUserPassword replaces a user's password
+func (repo *testDBRepo) UpdateUserPassword(ctx context.Context, id int, passwordHash string) error {
+	return nil
 }
 
-// AllNewReservations returns a slice of all reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
+// Authenticate authenticates a user
+func (repo *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	return 1, "", nil
+}
 
-	return reservations, nil
+// SearchReservations returns one page of the reservations matching filter
+func (m *testDBRepo) SearchReservations(ctx context.Context, filter models.ReservationFilter) (models.ReservationPage, error) {
+	page := models.ReservationPage{
+		Filter: filter,
+		Total:  1,
+		Reservations: []models.Reservation{
+			{ID: 1, FirstName: "John", LastName: "Smith", Status: models.StatusPending},
+		},
+	}
+	return page, nil
 }
 
 // GetReservationByID returns one reservation by ID
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	var reservation models.Reservation
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	// Reservation 100 doesn't exist
+	if id == 100 {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	reservation := models.Reservation{
+		ID:     id,
+		Status: models.StatusPending,
+	}
 
 	return reservation, nil
 }
 
 // UpdateReservation updates a reservation in the database
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
 	return nil
 }
 
-// DeleteReservation deletes one reservation by id
-func (m *testDBRepo) DeleteReservation(id int) error {
+// DeleteReservation moves one reservation to the trash by id
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
 	return nil
 }
 
-// UpdateProcessedForReservation updates processed for a reservation by id
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// UpdateReservationStatus moves a reservation to a new status
+func (m *testDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	return models.StatusPending.Transition(status)
+}
+
+// BulkUpdateReservationStatus moves every reservation in ids to status, treating them all as pending
+func (m *testDBRepo) BulkUpdateReservationStatus(ctx context.Context, ids []int, status models.ReservationStatus) (models.BulkResult, error) {
+	var result models.BulkResult
+	for _, id := range ids {
+		if err := models.StatusPending.Transition(status); err != nil {
+			result.Skipped = append(result.Skipped, models.BulkSkip{ID: id, Reason: err.Error()})
+		} else {
+			result.Succeeded = append(result.Succeeded, id)
+		}
+	}
+	return result, nil
+}
+
+// BulkDeleteReservations moves every reservation in ids to the trash
+func (m *testDBRepo) BulkDeleteReservations(ctx context.Context, ids []int) (models.BulkResult, error) {
+	return models.BulkResult{Succeeded: ids}, nil
+}
+
+// ImportReservations inserts reservations and their room restrictions
+func (m *testDBRepo) ImportReservations(ctx context.Context, reservations []models.Reservation) ([]int, error) {
+	var ids []int
+	for i := range reservations {
+		ids = append(ids, i+1)
+	}
+	return ids, nil
+}
+
+// ImportRooms inserts rooms
+func (m *testDBRepo) ImportRooms(ctx context.Context, rooms []models.Room) ([]int, error) {
+	var ids []int
+	for i := range rooms {
+		ids = append(ids, i+1)
+	}
+	return ids, nil
+}
+
+// CheckInReservation checks a guest in, confirming the pending reservation on the way
+func (m *testDBRepo) CheckInReservation(ctx context.Context, id int, arrivedAt time.Time, idDocument, notes string) error {
+	return nil
+}
+
+// MarkNoShow marks a guest as a no-show, confirming the pending reservation on the way
+func (m *testDBRepo) MarkNoShow(ctx context.Context, id int) error {
 	return nil
 }
 
+// ReservationsArrivingOn returns the reservations due to arrive on date
+func (m *testDBRepo) ReservationsArrivingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// ReservationsInHouse returns the reservations checked in right now
+func (m *testDBRepo) ReservationsInHouse(ctx context.Context) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// ReservationsDepartingOn returns the reservations due to leave on date
+func (m *testDBRepo) ReservationsDepartingOn(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// ReservationsNotArrivedBy returns the reservations due on or before date that never checked in
+func (m *testDBRepo) ReservationsNotArrivedBy(ctx context.Context, date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
 // Get all rooms
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
 	var rooms []models.Room
 
 	return rooms, nil
 }
 
 // Get the restrictions for a room
-func (m *testDBRepo) GetRestrictionsForCurrentRoom(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+func (m *testDBRepo) GetRestrictionsForCurrentRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
 
 	return restrictions, nil
 }
 
 // InsertBlockForRoom inserts a room restriction
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
 	return nil
 }
 
 // DeleteBlockByID deletes a room restriction
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
 	return nil
 }
 
 // UpdateRoom updates a room in the database
-func (m *testDBRepo) UpdateRoom(room models.Room) error {
+func (m *testDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
 	return nil
 }
 
-// Inserts a room into the database
-func (repo *testDBRepo) InsertRoom(room models.Room) error {
-	return nil
+// Inserts a room into the database and returns its id
+func (repo *testDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	return 1, nil
 }
 
-// DeleteRoom deletes a room
-func (m *testDBRepo) DeleteRoom(id int) error {
+// DeleteRoom moves a room to the trash
+func (m *testDBRepo) DeleteRoom(ctx context.Context, id int) error {
 	return nil
 }
 
-// InsertTodoList inserts a new todo list into the database
-func (repo *testDBRepo) InsertTodoList(todo models.TodoList) error {
-	return nil
+// InsertTodoList inserts a new todo list into the database and returns its id
+func (repo *testDBRepo) InsertTodoList(ctx context.Context, todo models.TodoList) (int, error) {
+	return 1, nil
 }
 
 // GetTodoListByUserID gets all todo for a user by user_id
-func (repo *testDBRepo) GetTodoListByUserID(id int) ([]models.TodoList, error) {
+func (repo *testDBRepo) GetTodoListByUserID(ctx context.Context, id int) ([]models.TodoList, error) {
 	var todoList []models.TodoList
 	return todoList, nil
 }
 
 // DeleteTodo deletes a todo
-func (m *testDBRepo) DeleteTodo(id int) error {
+func (m *testDBRepo) DeleteTodo(ctx context.Context, id int) error {
+	return nil
+}
+
+// OccupancyForRange returns seeded stats of two rooms half sold at an average of 115 a night
+func (m *testDBRepo) OccupancyForRange(ctx context.Context, start, end time.Time) (models.OccupancyStats, error) {
+	stats := models.OccupancyStats{
+		Start: start,
+		End:   end,
+		Rooms: 2,
+	}
+	stats.RoomNightsSold = stats.Nights()
+	stats.Revenue = float64(stats.RoomNightsSold) * 115
+	return stats, nil
+}
+
+// PickupForRange returns the same seeded stats as OccupancyForRange, as if everything was booked in the window
+func (m *testDBRepo) PickupForRange(ctx context.Context, start, end, bookedStart, bookedEnd time.Time) (models.OccupancyStats, error) {
+	return m.OccupancyForRange(ctx, start, end)
+}
+
+// CountReservationsCreatedBetween returns how many reservations were booked between start and end
+func (m *testDBRepo) CountReservationsCreatedBetween(ctx context.Context, start, end time.Time) (int, error) {
+	return 12, nil
+}
+
+// CountReservationsByStatus returns how many reservations are in status
+func (m *testDBRepo) CountReservationsByStatus(ctx context.Context, status models.ReservationStatus) (int, error) {
+	return 3, nil
+}
+
+// EachReportReservation calls fn with a single seeded reservation
+func (m *testDBRepo) EachReportReservation(ctx context.Context, query models.ReportQuery, fn func(models.Reservation) error) error {
+	return fn(models.Reservation{
+		ID:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: query.Start,
+		EndDate:   query.Start.AddDate(0, 0, 2),
+		Status:    models.StatusConfirmed,
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters", Price: "100"},
+	})
+}
+
+// InsertReservationNote adds an internal note to a reservation
+func (m *testDBRepo) InsertReservationNote(ctx context.Context, note models.ReservationNote) error {
+	return nil
+}
+
+// GetNotesForReservation returns the internal notes on a reservation
+func (m *testDBRepo) GetNotesForReservation(ctx context.Context, reservationID int) ([]models.ReservationNote, error) {
+	var notes []models.ReservationNote
+	return notes, nil
+}
+
+// InsertMailLog records an email handed to the mail server
+func (m *testDBRepo) InsertMailLog(ctx context.Context, entry models.MailLog) error {
+	return nil
+}
+
+// GetMailLogsForReservation returns the emails sent about a reservation
+func (m *testDBRepo) GetMailLogsForReservation(ctx context.Context, reservationID int) ([]models.MailLog, error) {
+	var logs []models.MailLog
+	return logs, nil
+}
+
+// InsertAuditLog records an admin change in the audit log
+func (m *testDBRepo) InsertAuditLog(ctx context.Context, entry models.AuditLog) error {
+	return nil
+}
+
+// SearchAuditLogs returns audit log entries matching the search text and entity
+func (m *testDBRepo) SearchAuditLogs(ctx context.Context, search, entity string) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	return logs, nil
+}
+
+// GetAuditLogsForEntity returns the history of a single record
+func (m *testDBRepo) GetAuditLogsForEntity(ctx context.Context, entity string, entityID int) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	return logs, nil
+}
+
+// DeletedReservations returns the reservations in the trash
+func (m *testDBRepo) DeletedReservations(ctx context.Context) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// RestoreReservation takes a reservation out of the trash if its room is free
+func (m *testDBRepo) RestoreReservation(ctx context.Context, id int) error {
+	reservation, err := m.GetReservationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	available, err := m.SearchAvailabilityByDatesByRoomID(ctx, reservation.StartDate, reservation.EndDate, reservation.RoomID)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return models.ErrRoomUnavailable
+	}
+	return nil
+}
+
+// PurgeDeletedReservations permanently deletes reservations trashed before the given time
+func (m *testDBRepo) PurgeDeletedReservations(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+// DeletedRooms returns the rooms in the trash
+func (m *testDBRepo) DeletedRooms(ctx context.Context) ([]models.Room, error) {
+	var rooms []models.Room
+	return rooms, nil
+}
+
+// RestoreRoom takes a room out of the trash
+func (m *testDBRepo) RestoreRoom(ctx context.Context, id int) error {
+	return nil
+}
+
+// PurgeDeletedRooms permanently deletes rooms trashed before the given time
+func (m *testDBRepo) PurgeDeletedRooms(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+// testAPIKeys are the keys the test repo knows, by prefix. Each is sent as bk_<prefix>_secret
+var testAPIKeys = map[string]models.APIKey{
+	"readkey1": {ID: 1, Prefix: "readkey1", Scope: models.ScopeReadOnly, RateLimit: models.DefaultAPIRateLimit},
+	"bookkey1": {ID: 2, Prefix: "bookkey1", Scope: models.ScopeBooking, RateLimit: models.DefaultAPIRateLimit},
+	"adminkey": {ID: 3, Prefix: "adminkey", Scope: models.ScopeAdmin, RateLimit: models.DefaultAPIRateLimit},
+	"revoked1": {ID: 4, Prefix: "revoked1", Scope: models.ScopeAdmin, RateLimit: models.DefaultAPIRateLimit, RevokedAt: time.Now()},
+	"limited1": {ID: 5, Prefix: "limited1", Scope: models.ScopeReadOnly, RateLimit: 2},
+}
+
+// InsertAPIKey stores a new API key
+func (m *testDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	return 1, nil
+}
+
+// AllAPIKeys returns every API key
+func (m *testDBRepo) AllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	return keys, nil
+}
+
+// GetAPIKeyByPrefix returns one of the testAPIKeys, and fails for the prefix failkey1
+func (m *testDBRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	if prefix == "failkey1" {
+		return models.APIKey{}, errors.New("failed to get api key")
+	}
+
+	key, ok := testAPIKeys[prefix]
+	if !ok {
+		return models.APIKey{}, sql.ErrNoRows
+	}
+
+	key.Hash = api.HashKey("bk_" + prefix + "_secret")
+	return key, nil
+}
+
+// RevokeAPIKey stops an API key from being used. Only key 1 exists
+func (m *testDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	if id != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (m *testDBRepo) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	return nil
+}
+
+// InsertWebhook stores a new webhook
+func (m *testDBRepo) InsertWebhook(ctx context.Context, hook models.Webhook) (int, error) {
+	return 1, nil
+}
+
+// AllWebhooks returns every webhook
+func (m *testDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	return hooks, nil
+}
+
+// GetWebhookByID returns a webhook by id. Only webhook 1 exists
+func (m *testDBRepo) GetWebhookByID(ctx context.Context, id int) (models.Webhook, error) {
+	if id != 1 {
+		return models.Webhook{}, sql.ErrNoRows
+	}
+	return testWebhook, nil
+}
+
+// SetWebhookActive turns sending to a webhook on or off
+func (m *testDBRepo) SetWebhookActive(ctx context.Context, id int, active bool) error {
+	return nil
+}
+
+// DeleteWebhook deletes a webhook
+func (m *testDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	return nil
+}
+
+// testWebhook is subscribed to every event, so handlers always have a delivery to queue
+var testWebhook = models.Webhook{
+	ID:     1,
+	URL:    "https://crm.example.com/hooks",
+	Secret: "whsec_test",
+	Events: []string{"reservation.created", "reservation.updated", "reservation.cancelled", "room.blocked"},
+	Active: true,
+}
+
+// WebhooksForEvent returns the webhooks subscribed to event
+func (m *testDBRepo) WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error) {
+	return []models.Webhook{testWebhook}, nil
+}
+
+// InsertWebhookDelivery queues a delivery
+func (m *testDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	return 1, nil
+}
+
+// DueWebhookDeliveries returns the deliveries due to be sent
+func (m *testDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt at a delivery
+func (m *testDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest deliveries to a webhook
+func (m *testDBRepo) GetWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	return []models.WebhookDelivery{
+		{ID: 1, WebhookID: webhookID, Event: "reservation.created", Status: models.DeliveryFailed, Attempts: 6, ResponseStatus: 500, Error: "receiver answered 500"},
+	}, nil
+}
+
+// RetryWebhookDelivery queues a delivery to be sent again. Only delivery 1 exists
+func (m *testDBRepo) RetryWebhookDelivery(ctx context.Context, webhookID, id int) error {
+	if id != 1 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
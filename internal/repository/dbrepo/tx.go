@@ -0,0 +1,99 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txKey is the key of the transaction WithTx passes on in the context
+type txKey struct{}
+
+// querier runs statements, on the pool or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txn is a transaction a method begins for its own statements. Inside WithTx it is a savepoint in WithTx's
+// transaction instead, so rolling it back only undoes the method's statements, and committing it leaves the rest to WithTx
+type txn struct {
+	*sql.Tx
+	ctx    context.Context
+	nested bool
+	done   bool
+}
+
+// WithTx runs fn in one transaction, committed if fn returns nil and rolled back if not. The repository methods
+// fn calls with the context it is given run in that transaction
+func (m *sqlDBRepo) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(context.WithValue(ctx, txKey{}, tx.Tx))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// conn returns the transaction of WithTx in ctx, or the pool outside one
+func (m *sqlDBRepo) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return m.DB
+}
+
+// begin starts a transaction, or a savepoint in the transaction of WithTx in ctx
+func (m *sqlDBRepo) begin(ctx context.Context) (*txn, error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		_, err := tx.ExecContext(ctx, "savepoint nested")
+		if err != nil {
+			return nil, err
+		}
+		return &txn{Tx: tx, ctx: ctx, nested: true}, nil
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, ctx: ctx}, nil
+}
+
+// Commit commits the transaction, or releases the savepoint
+func (t *txn) Commit() error {
+	if !t.nested {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	_, err := t.ExecContext(t.ctx, "release savepoint nested")
+	return err
+}
+
+// Rollback rolls the transaction back, or undoes what was done since the savepoint
+func (t *txn) Rollback() error {
+	if !t.nested {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	_, err := t.ExecContext(t.ctx, "rollback to savepoint nested")
+	if err != nil {
+		return err
+	}
+	_, err = t.ExecContext(t.ctx, "release savepoint nested")
+	return err
+}
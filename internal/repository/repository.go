@@ -1,42 +1,99 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/atuprosper/booking-project/internal/models"
 )
 
 type DatabaseRepo interface {
-	AllUsers() bool
-
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(res models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlockByID(id int) error
-
-	AllRooms() ([]models.Room, error)
-	UpdateRoom(room models.Room) error
-	InsertRoom(room models.Room) error
-	DeleteRoom(id int) error
-
-	InsertTodoList(todo models.TodoList) error
-	GetTodoListByUserID(id int) ([]models.TodoList, error)
-	DeleteTodo(id int) error
-
-	GetRestrictionsForCurrentRoom(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	AllUsers(ctx context.Context) bool
+
+	// WithTx runs fn in one transaction, committed if fn returns nil and rolled back if not. The repository
+	// methods fn calls with the context it is given run in that transaction
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error
+	InsertBooking(ctx context.Context, res models.Reservation) (int, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertUser(ctx context.Context, user models.User) (int, error)
+	UpdateUser(ctx context.Context, user models.User) error
+	UpdateUserPassword(ctx context.Context, id int, passwordHash string) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+
+	SearchReservations(ctx context.Context, filter models.ReservationFilter) (models.ReservationPage, error)
+
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error
+	BulkUpdateReservationStatus(ctx context.Context, ids []int, status models.ReservationStatus) (models.BulkResult, error)
+	BulkDeleteReservations(ctx context.Context, ids []int) (models.BulkResult, error)
+	ImportReservations(ctx context.Context, reservations []models.Reservation) ([]int, error)
+	CheckInReservation(ctx context.Context, id int, arrivedAt time.Time, idDocument, notes string) error
+	MarkNoShow(ctx context.Context, id int) error
+	ReservationsArrivingOn(ctx context.Context, date time.Time) ([]models.Reservation, error)
+	ReservationsInHouse(ctx context.Context) ([]models.Reservation, error)
+	ReservationsDepartingOn(ctx context.Context, date time.Time) ([]models.Reservation, error)
+	ReservationsNotArrivedBy(ctx context.Context, date time.Time) ([]models.Reservation, error)
+	DeletedReservations(ctx context.Context) ([]models.Reservation, error)
+	RestoreReservation(ctx context.Context, id int) error
+	PurgeDeletedReservations(ctx context.Context, before time.Time) (int, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	ImportRooms(ctx context.Context, rooms []models.Room) ([]int, error)
+	DeleteRoom(ctx context.Context, id int) error
+	DeletedRooms(ctx context.Context) ([]models.Room, error)
+	RestoreRoom(ctx context.Context, id int) error
+	PurgeDeletedRooms(ctx context.Context, before time.Time) (int, error)
+
+	InsertTodoList(ctx context.Context, todo models.TodoList) (int, error)
+	GetTodoListByUserID(ctx context.Context, id int) ([]models.TodoList, error)
+	DeleteTodo(ctx context.Context, id int) error
+
+	GetRestrictionsForCurrentRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+
+	OccupancyForRange(ctx context.Context, start, end time.Time) (models.OccupancyStats, error)
+	PickupForRange(ctx context.Context, start, end, bookedStart, bookedEnd time.Time) (models.OccupancyStats, error)
+	CountReservationsCreatedBetween(ctx context.Context, start, end time.Time) (int, error)
+	CountReservationsByStatus(ctx context.Context, status models.ReservationStatus) (int, error)
+	EachReportReservation(ctx context.Context, query models.ReportQuery, fn func(models.Reservation) error) error
+
+	InsertReservationNote(ctx context.Context, note models.ReservationNote) error
+	GetNotesForReservation(ctx context.Context, reservationID int) ([]models.ReservationNote, error)
+	InsertMailLog(ctx context.Context, entry models.MailLog) error
+	GetMailLogsForReservation(ctx context.Context, reservationID int) ([]models.MailLog, error)
+
+	InsertAuditLog(ctx context.Context, entry models.AuditLog) error
+	SearchAuditLogs(ctx context.Context, search, entity string) ([]models.AuditLog, error)
+	GetAuditLogsForEntity(ctx context.Context, entity string, entityID int) ([]models.AuditLog, error)
+
+	InsertAPIKey(ctx context.Context, key models.APIKey) (int, error)
+	AllAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	TouchAPIKey(ctx context.Context, id int, at time.Time) error
+
+	InsertWebhook(ctx context.Context, hook models.Webhook) (int, error)
+	AllWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhookByID(ctx context.Context, id int) (models.Webhook, error)
+	SetWebhookActive(ctx context.Context, id int, active bool) error
+	DeleteWebhook(ctx context.Context, id int) error
+	WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error)
+	InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, webhookID, id int) error
 }
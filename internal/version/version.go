@@ -0,0 +1,47 @@
+// Package version holds what the running binary was built from. The values are set when linking, e.g.
+//
+//	go build -ldflags "-X github.com/atuprosper/booking-project/internal/version.Version=v1.4.0
+//	  -X github.com/atuprosper/booking-project/internal/version.Commit=$(git rev-parse HEAD)
+//	  -X github.com/atuprosper/booking-project/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/web
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set when linking. They are variables rather than constants so -X can set them
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is what the binary was built from
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns what the binary was built from. Without a commit set when linking, it falls back to the one the Go
+// toolchain records when building in a git checkout
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
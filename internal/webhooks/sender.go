@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// RetryDelays is how long to wait after each failed attempt. A delivery is given up on once they run out
+var RetryDelays = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// How many due deliveries are sent in one go
+const batchSize = 50
+
+// How much of a failed response's body is kept in the log
+const maxLoggedBody = 512
+
+// Sender sends queued deliveries to their webhooks
+type Sender struct {
+	Store  Store
+	Client *http.Client
+	// Replaced in tests to control the clock
+	now func() time.Time
+}
+
+// NewSender returns a sender that gives each receiver 10 seconds to answer
+func NewSender(store Store) *Sender {
+	return &Sender{
+		Store:  store,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// SendDue attempts every delivery that is due, returning how many were delivered.
+// Cancelling ctx abandons the attempt in flight, which is retried like any other failure
+func (s *Sender) SendDue(ctx context.Context) (int, error) {
+	deliveries, err := s.Store.DueWebhookDeliveries(ctx, s.now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		delivery = s.Send(ctx, delivery)
+
+		err = s.Store.UpdateWebhookDelivery(ctx, delivery)
+		if err != nil {
+			return delivered, err
+		}
+
+		if delivery.Status == models.DeliveryDelivered {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// Send makes one attempt at delivery and returns it updated with the outcome. A failed attempt is
+// retried after the next of the RetryDelays, or marked failed when there are none left
+func (s *Sender) Send(ctx context.Context, delivery models.WebhookDelivery) models.WebhookDelivery {
+	now := s.now()
+	delivery.Attempts++
+
+	status, err := s.post(ctx, delivery, now)
+	delivery.ResponseStatus = status
+
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = now
+		delivery.Error = ""
+		return delivery
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts > len(RetryDelays) {
+		delivery.Status = models.DeliveryFailed
+		return delivery
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = now.Add(RetryDelays[delivery.Attempts-1])
+	return delivery
+}
+
+// post sends the payload, signed, and returns the response status. Anything but a 2xx is an error
+func (s *Sender) post(ctx context.Context, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "booking-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedBody))
+		return resp.StatusCode, fmt.Errorf("receiver answered %s: %s", resp.Status, strings.TrimSpace(string(answer)))
+	}
+
+	// Read the rest of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// The events webhooks can subscribe to
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationUpdated   = "reservation.updated"
+	EventReservationCancelled = "reservation.cancelled"
+	EventRoomBlocked          = "room.blocked"
+)
+
+// Events lists every event, in the order they are offered in the admin
+var Events = []string{
+	EventReservationCreated,
+	EventReservationUpdated,
+	EventReservationCancelled,
+	EventRoomBlocked,
+}
+
+// The headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Store is where deliveries are queued and logged. The database repository is one
+type Store interface {
+	WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error)
+	InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// Payload is the body of every delivery
+type Payload struct {
+	// The same for every webhook and attempt the event is sent to, so receivers can skip repeats
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// RoomBlocked is the data of a room.blocked event
+type RoomBlocked struct {
+	RoomID int    `json:"room_id"`
+	Date   string `json:"date"`
+}
+
+// IsEvent reports whether event is one webhooks can subscribe to
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Enqueue queues event, with data as its payload, for every active webhook subscribed to it.
+// It returns how many deliveries were queued
+func Enqueue(ctx context.Context, store Store, event string, data interface{}) (int, error) {
+	hooks, err := store.WebhooksForEvent(ctx, event)
+	if err != nil || len(hooks) == 0 {
+		return 0, err
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(Payload{
+		ID:        id,
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, hook := range hooks {
+		_, err = store.InsertWebhookDelivery(ctx, models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			Event:         event,
+			Payload:       string(body),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+
+	return queued, nil
+}
+
+// Sign returns the signature of a body sent at timestamp. It is the hex HMAC-SHA256, keyed by the webhook's
+// secret, of the timestamp, a dot, and the body. Signing the timestamp stops an old delivery being replayed
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the one Sign gives, as a receiver would check it
+func Verify(secret, signature string, timestamp int64, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// NewSecret generates a secret to sign a webhook's payloads with
+func NewSecret() (string, error) {
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + secret, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
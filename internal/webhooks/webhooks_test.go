@@ -0,0 +1,246 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atuprosper/booking-project/internal/models"
+)
+
+// memoryStore keeps webhooks and deliveries in memory, the way the database would
+type memoryStore struct {
+	hooks      []models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *memoryStore) WebhooksForEvent(ctx context.Context, event string) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	for _, hook := range s.hooks {
+		if hook.Active && hook.Subscribes(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (s *memoryStore) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	delivery.ID = len(s.deliveries) + 1
+	s.deliveries = append(s.deliveries, delivery)
+	return delivery.ID, nil
+}
+
+func (s *memoryStore) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now) && len(due) < limit {
+			for _, hook := range s.hooks {
+				if hook.ID == d.WebhookID {
+					d.Webhook = hook
+				}
+			}
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	s.deliveries[delivery.ID-1] = delivery
+	return nil
+}
+
+// receiver is an endpoint that records what it is sent and answers with status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+
+	w.WriteHeader(rc.status)
+	_, _ = w.Write([]byte("receiver says no"))
+}
+
+func TestDelivery(t *testing.T) {
+	crm := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(crm)
+	defer server.Close()
+
+	store := &memoryStore{hooks: []models.Webhook{
+		{ID: 1, URL: server.URL, Secret: "whsec_crm", Events: []string{EventReservationCreated}, Active: true},
+		{ID: 2, URL: server.URL, Secret: "whsec_slack", Events: []string{EventRoomBlocked}, Active: true},
+		{ID: 3, URL: server.URL, Secret: "whsec_off", Events: []string{EventReservationCreated}, Active: false},
+	}}
+
+	queued, err := Enqueue(context.Background(), store, EventReservationCreated, map[string]int{"id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the active webhook subscribed to the event is sent it
+	if queued != 1 {
+		t.Fatalf("expected 1 delivery queued, but got %d", queued)
+	}
+
+	sender := NewSender(store)
+	delivered, err := sender.SendDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != 1 || len(crm.requests) != 1 {
+		t.Fatalf("expected 1 delivery, but %d were delivered and %d received", delivered, len(crm.requests))
+	}
+
+	req, body := crm.requests[0], crm.bodies[0]
+	if req.Header.Get(HeaderEvent) != EventReservationCreated || req.Header.Get(HeaderDelivery) != "1" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if !Verify("whsec_crm", req.Header.Get(HeaderSignature), timestamp, body) {
+		t.Error("expected the signature to verify with the webhook's secret")
+	}
+	if Verify("whsec_slack", req.Header.Get(HeaderSignature), timestamp, body) {
+		t.Error("expected the signature not to verify with another secret")
+	}
+
+	var payload struct {
+		ID    string         `json:"id"`
+		Event string         `json:"event"`
+		Data  map[string]int `json:"data"`
+	}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID == "" || payload.Event != EventReservationCreated || payload.Data["id"] != 7 {
+		t.Errorf("unexpected payload %s", body)
+	}
+
+	logged := store.deliveries[0]
+	if logged.Status != models.DeliveryDelivered || logged.Attempts != 1 || logged.ResponseStatus != http.StatusOK || logged.DeliveredAt.IsZero() {
+		t.Errorf("expected the delivery to be logged as delivered, but got %+v", logged)
+	}
+
+	// Nothing is left to send
+	delivered, _ = sender.SendDue(context.Background())
+	if delivered != 0 || len(crm.requests) != 1 {
+		t.Error("expected a delivered event not to be sent again")
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	slack := &receiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(slack)
+	defer server.Close()
+
+	store := &memoryStore{hooks: []models.Webhook{
+		{ID: 1, URL: server.URL, Secret: "whsec_slack", Events: []string{EventRoomBlocked}, Active: true},
+	}}
+
+	_, err := Enqueue(context.Background(), store, EventRoomBlocked, RoomBlocked{RoomID: 1, Date: "2040-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	sender := NewSender(store)
+	sender.now = func() time.Time { return now }
+
+	for attempt, delay := range RetryDelays {
+		_, err = sender.SendDue(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := store.deliveries[0]
+		if d.Status != models.DeliveryPending || d.Attempts != attempt+1 || !d.NextAttemptAt.Equal(now.Add(delay)) {
+			t.Fatalf("attempt %d: expected a retry in %s, but got %+v", attempt+1, delay, d)
+		}
+		if d.ResponseStatus != http.StatusServiceUnavailable || d.Error == "" {
+			t.Errorf("attempt %d: expected the failure to be logged, but got %+v", attempt+1, d)
+		}
+
+		// Not due again until the delay has passed
+		_, _ = sender.SendDue(context.Background())
+		if len(slack.requests) != attempt+1 {
+			t.Fatalf("attempt %d: expected no attempt before the retry is due", attempt+1)
+		}
+
+		now = now.Add(delay)
+	}
+
+	// The last attempt gives up
+	_, _ = sender.SendDue(context.Background())
+	if d := store.deliveries[0]; d.Status != models.DeliveryFailed || d.Attempts != len(RetryDelays)+1 {
+		t.Errorf("expected the delivery to fail after %d attempts, but got %+v", len(RetryDelays)+1, d)
+	}
+
+	// Every attempt sends the same body
+	for i, body := range slack.bodies {
+		if string(body) != string(slack.bodies[0]) {
+			t.Errorf("attempt %d sent a different body", i+1)
+		}
+	}
+
+	// A receiver that recovers is sent the next attempt
+	slack.status = http.StatusNoContent
+	store.deliveries[0].Status = models.DeliveryPending
+	delivered, _ := sender.SendDue(context.Background())
+	if delivered != 1 || store.deliveries[0].Error != "" {
+		t.Errorf("expected a retried delivery to go through, but got %+v", store.deliveries[0])
+	}
+}
+
+func TestDeliveryUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	store := &memoryStore{hooks: []models.Webhook{
+		{ID: 1, URL: url, Secret: "whsec_gone", Events: []string{EventReservationCancelled}, Active: true},
+	}}
+
+	_, _ = Enqueue(context.Background(), store, EventReservationCancelled, nil)
+	_, err := NewSender(store).SendDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := store.deliveries[0]; d.Status != models.DeliveryPending || d.ResponseStatus != 0 || d.Error == "" {
+		t.Errorf("expected a connection error to be retried, but got %+v", d)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"room.blocked"}`)
+
+	signature := Sign("whsec_test", 1700000000, body)
+	if signature != Sign("whsec_test", 1700000000, body) {
+		t.Error("expected signing to be repeatable")
+	}
+
+	if Verify("whsec_test", signature, 1700000001, body) {
+		t.Error("expected a signature not to verify with another timestamp")
+	}
+
+	if Verify("whsec_test", signature, 1700000000, []byte(`{"event":"room.blocked "}`)) {
+		t.Error("expected a signature not to verify with another body")
+	}
+}
@@ -0,0 +1,17 @@
+// Package migrations holds the database migrations. The ones in postgres/ and sqlite/ are embedded so the app
+// can run them itself, each a version_name.dialect.up.sql and .down.sql pair. The fizz migrations in this
+// directory are the history soda ran before that. The first embedded migration builds what they had built by
+// 20230427135252, and is adopted on a database soda migrated that far. The second adds what the later ones add
+package migrations
+
+import "embed"
+
+// Postgres holds the Postgres migrations
+//
+//go:embed postgres/*.sql
+var Postgres embed.FS
+
+// SQLite holds the SQLite migrations
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
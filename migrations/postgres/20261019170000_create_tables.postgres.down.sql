@@ -0,0 +1,6 @@
+drop table todo_list;
+drop table room_restrictions;
+drop table reservations;
+drop table restrictions;
+drop table rooms;
+drop table users;
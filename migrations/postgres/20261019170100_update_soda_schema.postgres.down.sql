@@ -0,0 +1,38 @@
+-- Back to the schema the fizz migrations up to 20230427135252 built, with each status other than pending
+-- kept as processed
+
+drop table webhook_deliveries;
+drop table webhooks;
+drop table api_keys;
+drop table mail_logs;
+drop table reservation_notes;
+drop table audit_logs;
+
+drop index reservations_start_date_idx;
+drop index reservations_end_date_idx;
+drop index reservations_created_at_idx;
+drop index reservations_status_start_date_idx;
+drop index reservations_room_id_start_date_idx;
+drop index reservations_lower_first_name_idx;
+drop index reservations_lower_last_name_idx;
+drop index reservations_lower_email_idx;
+drop index reservations_phone_idx;
+
+alter table reservations drop column id_document;
+alter table reservations drop column front_desk_notes;
+
+alter table reservations add column processed integer not null default 0;
+update reservations set processed = 1 where status <> 'pending';
+
+drop index reservations_status_idx;
+alter table reservations drop column status;
+alter table reservations drop column confirmed_at;
+alter table reservations drop column checked_in_at;
+alter table reservations drop column checked_out_at;
+alter table reservations drop column cancelled_at;
+alter table reservations drop column no_show_at;
+
+drop index reservations_deleted_at_idx;
+drop index rooms_deleted_at_idx;
+alter table reservations drop column deleted_at;
+alter table rooms drop column deleted_at;
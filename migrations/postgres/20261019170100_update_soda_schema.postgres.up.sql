@@ -0,0 +1,125 @@
+-- What the fizz migrations from 20261019090000 on add. A database soda migrated may have any of them already,
+-- so every column, table and index is only added if it is missing
+
+alter table reservations add column if not exists deleted_at timestamp;
+alter table rooms add column if not exists deleted_at timestamp;
+
+create index if not exists reservations_deleted_at_idx on reservations (deleted_at);
+create index if not exists rooms_deleted_at_idx on rooms (deleted_at);
+
+alter table reservations add column if not exists status varchar(255) not null default 'pending';
+alter table reservations add column if not exists confirmed_at timestamp;
+alter table reservations add column if not exists checked_in_at timestamp;
+alter table reservations add column if not exists checked_out_at timestamp;
+alter table reservations add column if not exists cancelled_at timestamp;
+alter table reservations add column if not exists no_show_at timestamp;
+
+do $$
+begin
+	if exists (select 1 from information_schema.columns
+		where table_schema = current_schema() and table_name = 'reservations' and column_name = 'processed') then
+		update reservations set status = 'confirmed', confirmed_at = updated_at where processed = 1;
+		alter table reservations drop column processed;
+	end if;
+end
+$$;
+
+create index if not exists reservations_status_idx on reservations (status);
+
+alter table reservations add column if not exists id_document varchar(255) not null default '';
+alter table reservations add column if not exists front_desk_notes text not null default '';
+
+create index if not exists reservations_start_date_idx on reservations (start_date);
+create index if not exists reservations_end_date_idx on reservations (end_date);
+create index if not exists reservations_created_at_idx on reservations (created_at);
+create index if not exists reservations_status_start_date_idx on reservations (status, start_date);
+create index if not exists reservations_room_id_start_date_idx on reservations (room_id, start_date);
+create index if not exists reservations_lower_first_name_idx on reservations (lower(first_name) text_pattern_ops);
+create index if not exists reservations_lower_last_name_idx on reservations (lower(last_name) text_pattern_ops);
+create index if not exists reservations_lower_email_idx on reservations (lower(email) text_pattern_ops);
+create index if not exists reservations_phone_idx on reservations (phone text_pattern_ops);
+
+create table if not exists audit_logs (
+	id serial primary key,
+	user_id integer not null default 0,
+	action varchar(255) not null,
+	entity varchar(255) not null,
+	entity_id integer not null default 0,
+	changes text not null default '[]',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index if not exists audit_logs_entity_entity_id_idx on audit_logs (entity, entity_id);
+create index if not exists audit_logs_created_at_idx on audit_logs (created_at);
+
+create table if not exists reservation_notes (
+	id serial primary key,
+	reservation_id integer not null references reservations (id) on delete cascade on update cascade,
+	user_id integer not null default 0,
+	note text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index if not exists reservation_notes_reservation_id_idx on reservation_notes (reservation_id);
+
+create table if not exists mail_logs (
+	id serial primary key,
+	reservation_id integer not null default 0,
+	mail_to varchar(255) not null,
+	mail_from varchar(255) not null,
+	subject varchar(255) not null default '',
+	content text not null default '',
+	status varchar(255) not null,
+	error text not null default '',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index if not exists mail_logs_reservation_id_idx on mail_logs (reservation_id);
+
+create table if not exists api_keys (
+	id serial primary key,
+	name varchar(255) not null,
+	prefix varchar(8) not null,
+	key_hash varchar(64) not null,
+	scope varchar(255) not null default 'read-only',
+	rate_limit integer not null default 60,
+	user_id integer not null default 0,
+	last_used_at timestamp,
+	revoked_at timestamp,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create unique index if not exists api_keys_prefix_idx on api_keys (prefix);
+
+create table if not exists webhooks (
+	id serial primary key,
+	url varchar(255) not null,
+	description varchar(255) not null default '',
+	secret varchar(255) not null,
+	events text not null default '',
+	active boolean not null default true,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create table if not exists webhook_deliveries (
+	id serial primary key,
+	webhook_id integer not null references webhooks (id) on delete cascade on update cascade,
+	event varchar(255) not null,
+	payload text not null,
+	status varchar(255) not null default 'pending',
+	attempts integer not null default 0,
+	response_status integer not null default 0,
+	error text not null default '',
+	next_attempt_at timestamp not null,
+	delivered_at timestamp,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index if not exists webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
+create index if not exists webhook_deliveries_webhook_id_created_at_idx on webhook_deliveries (webhook_id, created_at);
@@ -0,0 +1,83 @@
+-- The schema and seed the Postgres migrations start from, for SQLite. Dates are stored as text in UTC
+-- and times as text in UTC with their offset, so both compare and sort correctly as text.
+-- The admin's password is "password"
+
+create table users (
+	id integer primary key autoincrement,
+	first_name varchar(255) not null default '',
+	last_name varchar(255) not null default '',
+	email varchar(255) not null,
+	password varchar(60) not null,
+	access_level integer not null default 1,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create unique index users_email_idx on users (email);
+
+create table rooms (
+	id integer primary key autoincrement,
+	room_name varchar(255) not null default '',
+	price varchar(255) not null default '0',
+	image_src varchar(255) not null default '',
+	description varchar(255) not null default '',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create table restrictions (
+	id integer primary key autoincrement,
+	restriction_name varchar(255) not null default '',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create table reservations (
+	id integer primary key autoincrement,
+	first_name varchar(255) not null default '',
+	last_name varchar(255) not null default '',
+	email varchar(255) not null,
+	phone varchar(255) not null default '',
+	start_date date not null,
+	end_date date not null,
+	room_id integer not null references rooms (id) on delete cascade on update cascade,
+	processed integer not null default 0,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index reservations_email_idx on reservations (email);
+create index reservations_last_name_idx on reservations (last_name);
+
+create table room_restrictions (
+	id integer primary key autoincrement,
+	start_date date not null,
+	end_date date not null,
+	room_id integer not null references rooms (id) on delete cascade on update cascade,
+	reservation_id integer references reservations (id) on delete cascade on update cascade,
+	restriction_id integer not null references restrictions (id) on delete cascade on update cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index room_restrictions_room_id_idx on room_restrictions (room_id);
+create index room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
+
+create table todo_list (
+	id integer primary key autoincrement,
+	todo varchar(255) not null default '',
+	user_id integer not null references users (id) on delete cascade on update cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+insert into users (first_name, last_name, email, password, access_level, created_at, updated_at) values
+	('Prosper', 'Atu', 'atu@prosper.com', '$2a$12$yD7f6L4WzEkRw.Esr07W0Okl5M/K4/V9vaV.3Tgifv8NfOCH5au1y', 1, '2023-04-12 00:00:00+00:00', '2023-04-12 00:00:00+00:00');
+
+insert into rooms (room_name, created_at, updated_at) values
+	('Generals Suit', '2023-02-26 00:00:00+00:00', '2023-02-25 00:00:00+00:00'),
+	('Luxery One', '2023-03-10 00:00:00+00:00', '2023-03-10 00:00:00+00:00');
+
+insert into restrictions (restriction_name, created_at, updated_at) values
+	('Reservation', '2023-02-25 00:00:00+00:00', '2023-02-25 00:00:00+00:00'),
+	('Owners Block', '2023-02-05 00:00:00+00:00', '2023-02-05 00:00:00+00:00');
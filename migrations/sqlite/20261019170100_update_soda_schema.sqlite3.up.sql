@@ -0,0 +1,117 @@
+-- What the Postgres migration adds to the schema it starts from, for SQLite
+
+alter table reservations add column deleted_at timestamp;
+alter table rooms add column deleted_at timestamp;
+
+create index reservations_deleted_at_idx on reservations (deleted_at);
+create index rooms_deleted_at_idx on rooms (deleted_at);
+
+alter table reservations add column status varchar(255) not null default 'pending';
+alter table reservations add column confirmed_at timestamp;
+alter table reservations add column checked_in_at timestamp;
+alter table reservations add column checked_out_at timestamp;
+alter table reservations add column cancelled_at timestamp;
+alter table reservations add column no_show_at timestamp;
+
+update reservations set status = 'confirmed', confirmed_at = updated_at where processed = 1;
+alter table reservations drop column processed;
+
+create index reservations_status_idx on reservations (status);
+
+alter table reservations add column id_document varchar(255) not null default '';
+alter table reservations add column front_desk_notes text not null default '';
+
+create index reservations_start_date_idx on reservations (start_date);
+create index reservations_end_date_idx on reservations (end_date);
+create index reservations_created_at_idx on reservations (created_at);
+create index reservations_status_start_date_idx on reservations (status, start_date);
+create index reservations_room_id_start_date_idx on reservations (room_id, start_date);
+create index reservations_lower_first_name_idx on reservations (lower(first_name));
+create index reservations_lower_last_name_idx on reservations (lower(last_name));
+create index reservations_lower_email_idx on reservations (lower(email));
+create index reservations_phone_idx on reservations (phone);
+
+create table audit_logs (
+	id integer primary key autoincrement,
+	user_id integer not null default 0,
+	action varchar(255) not null,
+	entity varchar(255) not null,
+	entity_id integer not null default 0,
+	changes text not null default '[]',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index audit_logs_entity_entity_id_idx on audit_logs (entity, entity_id);
+create index audit_logs_created_at_idx on audit_logs (created_at);
+
+create table reservation_notes (
+	id integer primary key autoincrement,
+	reservation_id integer not null references reservations (id) on delete cascade on update cascade,
+	user_id integer not null default 0,
+	note text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index reservation_notes_reservation_id_idx on reservation_notes (reservation_id);
+
+create table mail_logs (
+	id integer primary key autoincrement,
+	reservation_id integer not null default 0,
+	mail_to varchar(255) not null,
+	mail_from varchar(255) not null,
+	subject varchar(255) not null default '',
+	content text not null default '',
+	status varchar(255) not null,
+	error text not null default '',
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index mail_logs_reservation_id_idx on mail_logs (reservation_id);
+
+create table api_keys (
+	id integer primary key autoincrement,
+	name varchar(255) not null,
+	prefix varchar(8) not null,
+	key_hash varchar(64) not null,
+	scope varchar(255) not null default 'read-only',
+	rate_limit integer not null default 60,
+	user_id integer not null default 0,
+	last_used_at timestamp,
+	revoked_at timestamp,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create unique index api_keys_prefix_idx on api_keys (prefix);
+
+create table webhooks (
+	id integer primary key autoincrement,
+	url varchar(255) not null,
+	description varchar(255) not null default '',
+	secret varchar(255) not null,
+	events text not null default '',
+	active boolean not null default true,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create table webhook_deliveries (
+	id integer primary key autoincrement,
+	webhook_id integer not null references webhooks (id) on delete cascade on update cascade,
+	event varchar(255) not null,
+	payload text not null,
+	status varchar(255) not null default 'pending',
+	attempts integer not null default 0,
+	response_status integer not null default 0,
+	error text not null default '',
+	next_attempt_at timestamp not null,
+	delivered_at timestamp,
+	created_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
+create index webhook_deliveries_webhook_id_created_at_idx on webhook_deliveries (webhook_id, created_at);